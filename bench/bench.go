@@ -0,0 +1,241 @@
+package bench
+
+/*
+	Load generator driving signed and encrypted message traffic against an in-process node
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/client"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/users"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+	Defaults
+*/
+const (
+	defaultUsers       int           = 4
+	defaultChannels    int           = 2
+	defaultConcurrency int           = 8
+	defaultMessageSize int           = 64
+	setupTimeout       time.Duration = time.Minute
+	sendTimeout        time.Duration = 30 * time.Second
+	benchUserPrefix    string        = "bench_user"
+	benchChannelPrefix string        = "bench_channel"
+)
+
+/*
+	Benchmark options (defaults are used if zero)
+*/
+type Options struct {
+	// Users created and channels opened with all users as members
+	Users    int `json:"users"`
+	Channels int `json:"channels"`
+
+	// Clients sending messages at once (each acts as one of the users)
+	Concurrency int `json:"concurrency"`
+
+	// Size of message payloads in bytes
+	MessageSize int `json:"messageSize"`
+}
+
+func (options *Options) setDefaults() {
+	if options.Users <= 0 {
+		options.Users = defaultUsers
+	}
+	if options.Channels <= 0 {
+		options.Channels = defaultChannels
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultConcurrency
+	}
+	if options.MessageSize <= 0 {
+		options.MessageSize = defaultMessageSize
+	}
+}
+
+/*
+	Benchmark definition (node, users, channels and connected clients)
+*/
+type Bench struct {
+	options    Options
+	node       *benchNode
+	channelIds []string
+	clients    []*client.Client
+}
+
+/*
+	Starts node, creates users and channels, and connects clients
+*/
+func Start(options Options, loggingHandler *core.LoggingHandler) (*Bench, error) {
+	options.setDefaults()
+	node, err := startNode(loggingHandler)
+	if err != nil {
+		return nil, err
+	}
+	bench := &Bench{
+		options: options,
+		node:    node,
+	}
+	if err := bench.setup(); err != nil {
+		bench.Stop()
+		return nil, err
+	}
+	return bench, nil
+}
+
+func (bench *Bench) setup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+
+	rootClient, err := client.Connect(bench.node.rootOptions)
+	if err != nil {
+		return err
+	}
+	defer rootClient.Close()
+
+	// Create users
+	userOptions := []client.Options{}
+	members := map[string]channels.ChannelPermissionObject{
+		bench.node.rootOptions.UserId: {Read: true, Write: true, Close: true},
+	}
+	for userIndex := 0; userIndex < bench.options.Users; userIndex++ {
+		userId := fmt.Sprintf("%v_%v", benchUserPrefix, userIndex)
+		signingKey := core.GeneratePrivateKey()
+		userObject := &users.UserObject{
+			Id:      userId,
+			EncKey:  core.PublicAsymKeyToString(core.GeneratePublicKey()),
+			SignKey: core.PublicAsymKeyToString(&signingKey.PublicKey),
+			Permissions: users.PermissionsObject{
+				Channel: users.ChannelPermissionsObject{
+					Read: true,
+				},
+			},
+			Active: true,
+		}
+		if _, err := rootClient.CreateUser(ctx, userObject); err != nil {
+			return err
+		}
+
+		options := bench.node.rootOptions
+		options.UserId = userId
+		options.SigningKey = signingKey
+		userOptions = append(userOptions, options)
+		members[userId] = channels.ChannelPermissionObject{Read: true, Write: true}
+	}
+
+	// Open channels with all users as members
+	for channelIndex := 0; channelIndex < bench.options.Channels; channelIndex++ {
+		channelId := fmt.Sprintf("%v_%v", benchChannelPrefix, channelIndex)
+		if _, err := rootClient.OpenChannel(ctx, &channels.ChannelObject{
+			Id: channelId,
+			Permissions: channels.ChannelPermissionsObject{
+				Users: members,
+			},
+		}); err != nil {
+			return err
+		}
+		bench.channelIds = append(bench.channelIds, channelId)
+	}
+
+	// Connect clients (users are spread across clients)
+	for clientIndex := 0; clientIndex < bench.options.Concurrency; clientIndex++ {
+		cl, err := client.Connect(userOptions[clientIndex%len(userOptions)])
+		if err != nil {
+			return err
+		}
+		bench.clients = append(bench.clients, cl)
+	}
+
+	return nil
+}
+
+/*
+	Sends messages spread across channels and clients and reports latencies by stage
+*/
+func (bench *Bench) Run(messages int) *Report {
+	col := newCollector()
+	payload := make([]byte, bench.options.MessageSize)
+	rand.Read(payload)
+
+	// Message indexes are handed out to clients
+	jobs := make(chan int, bench.options.Concurrency)
+	go func() {
+		for messageIndex := 0; messageIndex < messages; messageIndex++ {
+			jobs <- messageIndex
+		}
+		close(jobs)
+	}()
+
+	var failedLock sync.Mutex
+	failed := 0
+	waitGroup := &sync.WaitGroup{}
+	waitGroup.Add(len(bench.clients))
+	col.start(bench.node.node.Metrics)
+	start := time.Now()
+	for _, cl := range bench.clients {
+		go func(cl *client.Client) {
+			defer waitGroup.Done()
+			for messageIndex := range jobs {
+				channelId := bench.channelIds[messageIndex%len(bench.channelIds)]
+				ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+				sendStart := time.Now()
+				err := cl.SendMessage(ctx, channelId, payload)
+				cancel()
+				if err != nil {
+					failedLock.Lock()
+					failed++
+					failedLock.Unlock()
+					continue
+				}
+				col.add(SendStage, time.Since(sendStart))
+			}
+		}(cl)
+	}
+	waitGroup.Wait()
+	elapsed := time.Since(start)
+	col.stop(bench.node.node.Metrics)
+
+	return col.makeReport(bench.options, elapsed, messages-failed, failed)
+}
+
+/*
+	Disconnects clients, shuts node down and removes its configuration
+*/
+func (bench *Bench) Stop() {
+	for _, cl := range bench.clients {
+		cl.Close()
+	}
+	bench.node.stop()
+}
+
+/*
+	Runs a whole benchmark and writes its report (as JSON if asked)
+*/
+func RunAndWrite(options Options, messages int, asJson bool, writer io.Writer) error {
+	loggingHandler := core.InitializeLogging()
+	loggingHandler.SetLogLevel(core.WARN)
+
+	bench, err := Start(options, loggingHandler)
+	if err != nil {
+		return err
+	}
+	report := bench.Run(messages)
+	bench.Stop()
+
+	if asJson {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	report.Write(writer)
+	return nil
+}
@@ -0,0 +1,44 @@
+package bench
+
+import (
+	"github.com/mngharbi/DMPC/core"
+	"testing"
+)
+
+func benchmarkMessageTraffic(b *testing.B, options Options) {
+	loggingHandler := core.InitializeLogging()
+	loggingHandler.SetLogLevel(core.ERROR)
+	bench, err := Start(options, loggingHandler)
+	if err != nil {
+		b.Fatalf("Failed to start benchmark. err=%v", err)
+	}
+	defer bench.Stop()
+
+	b.ResetTimer()
+	report := bench.Run(b.N)
+	b.StopTimer()
+
+	if report.Failed > 0 {
+		b.Errorf("Messages should not fail. failed=%v", report.Failed)
+	}
+	b.ReportMetric(report.Messages, "msgs/s")
+	for _, stage := range report.Stages {
+		b.ReportMetric(float64(stage.P99.Microseconds()), stage.Stage+"-p99-us")
+	}
+}
+
+func BenchmarkMessageTraffic(b *testing.B) {
+	benchmarkMessageTraffic(b, Options{
+		Users:       2,
+		Channels:    1,
+		Concurrency: 1,
+	})
+}
+
+func BenchmarkConcurrentMessageTraffic(b *testing.B) {
+	benchmarkMessageTraffic(b, Options{
+		Users:       4,
+		Channels:    4,
+		Concurrency: 16,
+	})
+}
@@ -0,0 +1,88 @@
+package bench
+
+/*
+	In-process node with a throwaway configuration directory
+*/
+
+import (
+	"github.com/mngharbi/DMPC/cli"
+	"github.com/mngharbi/DMPC/client"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/daemon"
+	"io/ioutil"
+	"net"
+	"os"
+)
+
+type benchNode struct {
+	dir         string
+	node        *daemon.Node
+	rootOptions client.Options
+}
+
+// Port is picked by the system and released right away
+func getFreePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+/*
+	Installs node in a temporary directory and starts it
+	(changes the cli configuration directory for the rest of the process)
+*/
+func startNode(loggingHandler *core.LoggingHandler) (*benchNode, error) {
+	dir, err := ioutil.TempDir("", "dmpc_bench")
+	if err != nil {
+		return nil, err
+	}
+	port, err := getFreePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	// Install with generated root user keys
+	cli.SetInstallRoot(dir)
+	cli.Install(cli.InstallOptions{
+		Yes:          true,
+		PipelinePort: port,
+		NoMetrics:    true,
+		Quiet:        true,
+	})
+	conf := cli.GetConfig()
+	conf.Pipeline.Hostname = "localhost"
+
+	// Root identity is used to create users and channels
+	rootIdentity, err := cli.ReadIdentity(cli.RootIdentityName)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	rootOptions, err := rootIdentity.GetClientOptions(conf)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	// Fatal errors in subsystems end the process
+	node := daemon.NewNode(loggingHandler)
+	node.Start(conf, func() {
+		os.RemoveAll(dir)
+		os.Exit(1)
+	})
+
+	return &benchNode{
+		dir:         dir,
+		node:        node,
+		rootOptions: rootOptions,
+	}, nil
+}
+
+func (bn *benchNode) stop() {
+	bn.node.Shutdown()
+	os.RemoveAll(bn.dir)
+}
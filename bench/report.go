@@ -0,0 +1,184 @@
+package bench
+
+/*
+	Latency collection and reporting
+*/
+
+import (
+	"fmt"
+	"github.com/mngharbi/DMPC/core"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Stages reported (subsystem requests observed while traffic runs)
+*/
+const (
+	SendStage    string = "send"
+	DecryptStage string = "decrypt"
+	ExecuteStage string = "execute"
+	PublishStage string = "publish"
+)
+
+var reportedStages []string = []string{
+	SendStage,
+	DecryptStage,
+	ExecuteStage,
+	PublishStage,
+}
+
+// Subsystem requests timed for each stage (empty type matches all)
+var stageRequests map[string][2]string = map[string][2]string{
+	DecryptStage: {"decryptor", ""},
+	ExecuteStage: {"executor", ""},
+	PublishStage: {"messages", "add_message"},
+}
+
+/*
+	Durations by stage
+*/
+type collector struct {
+	lock      sync.Mutex
+	durations map[string][]time.Duration
+}
+
+func newCollector() *collector {
+	return &collector{
+		durations: map[string][]time.Duration{},
+	}
+}
+
+func (col *collector) add(stage string, duration time.Duration) {
+	col.lock.Lock()
+	col.durations[stage] = append(col.durations[stage], duration)
+	col.lock.Unlock()
+}
+
+func (col *collector) observeRequest(subsystem string, requestType string, duration time.Duration) {
+	for stage, request := range stageRequests {
+		if request[0] == subsystem && (request[1] == "" || request[1] == requestType) {
+			col.add(stage, duration)
+		}
+	}
+}
+
+// Starts collecting subsystem request durations of node
+func (col *collector) start(metricsRegistry *core.MetricsRegistry) {
+	metricsRegistry.SetRequestObserver(col.observeRequest)
+}
+
+func (col *collector) stop(metricsRegistry *core.MetricsRegistry) {
+	metricsRegistry.SetRequestObserver(nil)
+}
+
+/*
+	Report structure
+*/
+type StageReport struct {
+	Stage      string        `json:"stage"`
+	Count      int           `json:"count"`
+	Throughput float64       `json:"throughput"`
+	Mean       time.Duration `json:"mean"`
+	P50        time.Duration `json:"p50"`
+	P90        time.Duration `json:"p90"`
+	P99        time.Duration `json:"p99"`
+	Max        time.Duration `json:"max"`
+}
+
+type Report struct {
+	Options  Options        `json:"options"`
+	Elapsed  time.Duration  `json:"elapsed"`
+	Sent     int            `json:"sent"`
+	Failed   int            `json:"failed"`
+	Stages   []*StageReport `json:"stages"`
+	Messages float64        `json:"messagesPerSecond"`
+}
+
+// Nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func makeStageReport(stage string, durations []time.Duration, elapsed time.Duration) *StageReport {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	report := &StageReport{
+		Stage: stage,
+		Count: len(sorted),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		P99:   percentile(sorted, 99),
+	}
+	if len(sorted) == 0 {
+		return report
+	}
+	var total time.Duration
+	for _, duration := range sorted {
+		total += duration
+	}
+	report.Mean = total / time.Duration(len(sorted))
+	report.Max = sorted[len(sorted)-1]
+	if elapsed > 0 {
+		report.Throughput = float64(len(sorted)) / elapsed.Seconds()
+	}
+	return report
+}
+
+func (col *collector) makeReport(options Options, elapsed time.Duration, sent int, failed int) *Report {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	report := &Report{
+		Options: options,
+		Elapsed: elapsed,
+		Sent:    sent,
+		Failed:  failed,
+	}
+	if elapsed > 0 {
+		report.Messages = float64(sent) / elapsed.Seconds()
+	}
+	for _, stage := range reportedStages {
+		report.Stages = append(report.Stages, makeStageReport(stage, col.durations[stage], elapsed))
+	}
+	return report
+}
+
+/*
+	Human readable report
+*/
+func (report *Report) Write(writer io.Writer) {
+	fmt.Fprintf(writer, "%v users, %v channels, %v clients, %v byte messages\n",
+		report.Options.Users, report.Options.Channels, report.Options.Concurrency, report.Options.MessageSize)
+	fmt.Fprintf(writer, "%v messages sent (%v failed) in %v: %.1f messages/s\n\n",
+		report.Sent, report.Failed, report.Elapsed.Round(time.Millisecond), report.Messages)
+	fmt.Fprintf(writer, "%-8v %8v %10v %10v %10v %10v %10v %10v\n", "stage", "count", "per sec", "mean", "p50", "p90", "p99", "max")
+	for _, stage := range report.Stages {
+		fmt.Fprintf(writer, "%-8v %8v %10.1f %10v %10v %10v %10v %10v\n",
+			stage.Stage,
+			stage.Count,
+			stage.Throughput,
+			roundDuration(stage.Mean),
+			roundDuration(stage.P50),
+			roundDuration(stage.P90),
+			roundDuration(stage.P99),
+			roundDuration(stage.Max),
+		)
+	}
+}
+
+func roundDuration(duration time.Duration) time.Duration {
+	return duration.Round(time.Microsecond)
+}
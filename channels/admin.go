@@ -0,0 +1,125 @@
+/*
+	Administration of the channels subsystem (operation buffers)
+*/
+
+package channels
+
+import (
+	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Admin request/response structures
+*/
+
+type AdminAction string
+
+const (
+	BufferStatsAction     AdminAction = "buffer_stats"
+	ExpireBuffersAction   AdminAction = "expire_buffers"
+	SetBufferLimitsAction AdminAction = "set_buffer_limits"
+)
+
+type AdminRequest struct {
+	Action AdminAction `json:"action"`
+
+	// New limits for set action (expiry in seconds, defaults are used if zero)
+	MaxBufferedPerChannel int `json:"maxBufferedPerChannel"`
+	MaxBufferedTotal      int `json:"maxBufferedTotal"`
+	BufferExpiry          int `json:"bufferExpiry"`
+}
+
+func (rq *AdminRequest) Decode(stream []byte) error {
+	return json.Unmarshal(stream, rq)
+}
+
+func (rq *AdminRequest) Encode() ([]byte, error) {
+	return json.Marshal(rq)
+}
+
+// Operations buffered for a channel that is not opened yet (age in seconds)
+type BufferStats struct {
+	ChannelId  string `json:"channelId"`
+	Operations int    `json:"operations"`
+	Age        int    `json:"age"`
+}
+
+type AdminResponse struct {
+	// Limits (expiry in seconds)
+	MaxBufferedPerChannel int `json:"maxBufferedPerChannel"`
+	MaxBufferedTotal      int `json:"maxBufferedTotal"`
+	BufferExpiry          int `json:"bufferExpiry"`
+
+	// Operations buffered across all channels and by channel
+	BufferedOperations int            `json:"bufferedOperations"`
+	Buffers            []*BufferStats `json:"buffers"`
+
+	// Operations dropped by expiring buffers
+	Expired int `json:"expired"`
+}
+
+func (resp *AdminResponse) Encode() ([]byte, error) {
+	return json.Marshal(resp)
+}
+
+func (resp *AdminResponse) Decode(stream []byte) error {
+	return json.Unmarshal(stream, resp)
+}
+
+/*
+	Admin requester type
+*/
+type AdminRequester func(*AdminRequest) (*AdminResponse, error)
+
+/*
+	Errors
+*/
+
+const (
+	unknownAdminActionErrorMsg  string = "Unknown channels admin action"
+	invalidBufferLimitsErrorMsg string = "Buffer limits cannot be negative"
+)
+
+/*
+	Admin API
+*/
+
+func Admin(rq *AdminRequest) (*AdminResponse, error) {
+	return defaultSubsystem.Admin(rq)
+}
+
+func (subsystem *Subsystem) Admin(rq *AdminRequest) (*AdminResponse, error) {
+	now := time.Now()
+	expired := 0
+	switch rq.Action {
+	case BufferStatsAction:
+	case ExpireBuffersAction:
+		expired = subsystem.expireBuffers(now)
+	case SetBufferLimitsAction:
+		if rq.MaxBufferedPerChannel < 0 || rq.MaxBufferedTotal < 0 || rq.BufferExpiry < 0 {
+			return nil, core.NewError(core.InvalidRequestErrorCode, invalidBufferLimitsErrorMsg)
+		}
+		limits := makeBufferLimits(MessagesServerConfig{
+			MaxBufferedPerChannel: rq.MaxBufferedPerChannel,
+			MaxBufferedTotal:      rq.MaxBufferedTotal,
+			BufferExpiry:          time.Duration(rq.BufferExpiry) * time.Second,
+		})
+		subsystem.log.Infof(setBufferLimitsLogMsg, limits.maxPerChannel, limits.maxTotal, limits.expiry)
+		subsystem.setBufferLimits(limits, true)
+	default:
+		return nil, core.NewError(core.InvalidRequestErrorCode, unknownAdminActionErrorMsg)
+	}
+
+	limits := subsystem.getBufferLimits()
+	return &AdminResponse{
+		MaxBufferedPerChannel: limits.maxPerChannel,
+		MaxBufferedTotal:      limits.maxTotal,
+		BufferExpiry:          int(limits.expiry / time.Second),
+		BufferedOperations:    int(atomic.LoadInt64(&subsystem.bufferedOperations)),
+		Buffers:               subsystem.bufferStats(now),
+		Expired:               expired,
+	}, nil
+}
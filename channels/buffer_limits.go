@@ -0,0 +1,214 @@
+package channels
+
+/*
+	Limits on operations buffered for channels that are not opened yet
+*/
+
+import (
+	"github.com/mngharbi/memstore"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Defaults (used if not set in messages server configuration)
+*/
+const (
+	defaultMaxBufferedPerChannel int           = 1000
+	defaultMaxBufferedTotal      int           = 100000
+	defaultBufferExpiry          time.Duration = time.Hour
+	minBufferSweepInterval       time.Duration = time.Second
+)
+
+type bufferLimits struct {
+	maxPerChannel int
+	maxTotal      int
+	expiry        time.Duration
+}
+
+func makeBufferLimits(conf MessagesServerConfig) bufferLimits {
+	limits := bufferLimits{
+		maxPerChannel: conf.MaxBufferedPerChannel,
+		maxTotal:      conf.MaxBufferedTotal,
+		expiry:        conf.BufferExpiry,
+	}
+	if limits.maxPerChannel <= 0 {
+		limits.maxPerChannel = defaultMaxBufferedPerChannel
+	}
+	if limits.maxTotal <= 0 {
+		limits.maxTotal = defaultMaxBufferedTotal
+	}
+	if limits.expiry <= 0 {
+		limits.expiry = defaultBufferExpiry
+	}
+	return limits
+}
+
+func (subsystem *Subsystem) getBufferLimits() bufferLimits {
+	sv := subsystem.messagesServer
+	sv.limitsLock.RLock()
+	defer sv.limitsLock.RUnlock()
+	return sv.limits
+}
+
+// Sweeper is restarted if running so that it follows the new expiry
+func (subsystem *Subsystem) setBufferLimits(limits bufferLimits, restartSweeper bool) {
+	sv := subsystem.messagesServer
+	sv.limitsLock.Lock()
+	defer sv.limitsLock.Unlock()
+	sv.limits = limits
+	if restartSweeper && sv.sweeperQuit != nil {
+		subsystem.stopBufferSweeperLocked()
+		subsystem.startBufferSweeperLocked()
+	}
+}
+
+// Expired buffers are checked a few times per expiry period
+func (limits bufferLimits) sweepInterval() time.Duration {
+	interval := limits.expiry / 4
+	if interval < minBufferSweepInterval {
+		interval = minBufferSweepInterval
+	}
+	return interval
+}
+
+/*
+	Accounting (buffer lock must be held)
+*/
+
+// Reserves room for one operation in buffer
+func (subsystem *Subsystem) reserveBufferedOperation(bufferRecord *channelBufferRecord) (bool, string) {
+	limits := subsystem.getBufferLimits()
+	if len(bufferRecord.operations) >= limits.maxPerChannel {
+		return false, channelBufferLimitReason
+	}
+	if atomic.AddInt64(&subsystem.bufferedOperations, 1) > int64(limits.maxTotal) {
+		atomic.AddInt64(&subsystem.bufferedOperations, -1)
+		return false, totalBufferLimitReason
+	}
+	return true, ""
+}
+
+// Releases operations of buffer (replayed after opening or expired)
+func (subsystem *Subsystem) releaseBufferedOperations(bufferRecord *channelBufferRecord) {
+	atomic.AddInt64(&subsystem.bufferedOperations, -int64(len(bufferRecord.operations)))
+	bufferRecord.operations = nil
+	subsystem.metrics.bufferedOperations.Delete(bufferRecord.id)
+	subsystem.metrics.bufferedOperationsTotal.Set(float64(atomic.LoadInt64(&subsystem.bufferedOperations)))
+}
+
+func (subsystem *Subsystem) updateBufferedOperationsMetrics(bufferRecord *channelBufferRecord) {
+	subsystem.metrics.bufferedOperations.Set(float64(len(bufferRecord.operations)), bufferRecord.id)
+	subsystem.metrics.bufferedOperationsTotal.Set(float64(atomic.LoadInt64(&subsystem.bufferedOperations)))
+}
+
+/*
+	Expiry
+*/
+
+// Buffer records are collected before being locked (store is not changed while iterating)
+func (subsystem *Subsystem) bufferRecords() []*channelBufferRecord {
+	records := []*channelBufferRecord{}
+	subsystem.bufferStore.ApplyData(func(item memstore.Item) bool {
+		records = append(records, item.(*channelBufferRecord))
+		return true
+	})
+	return records
+}
+
+// Removes buffers older than expiry and returns number of operations dropped
+func (subsystem *Subsystem) expireBuffers(now time.Time) int {
+	if subsystem.bufferStore == nil {
+		return 0
+	}
+	expiry := subsystem.getBufferLimits().expiry
+
+	dropped := 0
+	for _, bufferRecord := range subsystem.bufferRecords() {
+		if now.Sub(bufferRecord.created) < expiry {
+			continue
+		}
+		bufferRecord.Lock()
+		if !bufferRecord.removed {
+			if operations := len(bufferRecord.operations); operations > 0 {
+				dropped += operations
+				subsystem.metrics.expiredBufferedOperations.Add(float64(operations))
+				subsystem.log.Infof(bufferExpiredLogMsg, bufferRecord.id, operations)
+			}
+			subsystem.releaseBufferedOperations(bufferRecord)
+			bufferRecord.removed = true
+			subsystem.bufferStore.Delete(bufferRecord, channelBufferIndexId)
+		}
+		bufferRecord.Unlock()
+	}
+	return dropped
+}
+
+func (subsystem *Subsystem) startBufferSweeper() {
+	sv := subsystem.messagesServer
+	sv.limitsLock.Lock()
+	defer sv.limitsLock.Unlock()
+	subsystem.startBufferSweeperLocked()
+}
+
+func (subsystem *Subsystem) stopBufferSweeper() {
+	sv := subsystem.messagesServer
+	sv.limitsLock.Lock()
+	defer sv.limitsLock.Unlock()
+	subsystem.stopBufferSweeperLocked()
+}
+
+// Limits lock must be held
+func (subsystem *Subsystem) startBufferSweeperLocked() {
+	sv := subsystem.messagesServer
+	sv.sweeperQuit = make(chan bool)
+	go func(quit chan bool, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				subsystem.expireBuffers(now)
+			case <-quit:
+				return
+			}
+		}
+	}(sv.sweeperQuit, sv.limits.sweepInterval())
+}
+
+func (subsystem *Subsystem) stopBufferSweeperLocked() {
+	sv := subsystem.messagesServer
+	if sv.sweeperQuit != nil {
+		close(sv.sweeperQuit)
+		sv.sweeperQuit = nil
+	}
+}
+
+/*
+	Buffer statistics (largest buffers first)
+*/
+func (subsystem *Subsystem) bufferStats(now time.Time) []*BufferStats {
+	stats := []*BufferStats{}
+	if subsystem.bufferStore == nil {
+		return stats
+	}
+	for _, bufferRecord := range subsystem.bufferRecords() {
+		bufferRecord.Lock()
+		if !bufferRecord.removed && len(bufferRecord.operations) > 0 {
+			stats = append(stats, &BufferStats{
+				ChannelId:  bufferRecord.id,
+				Operations: len(bufferRecord.operations),
+				Age:        int(now.Sub(bufferRecord.created) / time.Second),
+			})
+		}
+		bufferRecord.Unlock()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Operations != stats[j].Operations {
+			return stats[i].Operations > stats[j].Operations
+		}
+		return stats[i].ChannelId < stats[j].ChannelId
+	})
+	return stats
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/memstore"
 	"sync"
+	"time"
 )
 
 /*
@@ -13,6 +14,12 @@ type channelBufferRecord struct {
 	id         string
 	operations []*core.Operation
 	lock       *sync.Mutex
+
+	// Creation time (buffers expire if their channel is not opened in time)
+	created time.Time
+
+	// Set once removed from store (holders of the record should get it again)
+	removed bool
 }
 
 /*
@@ -24,6 +31,7 @@ func createEmptyChannelBufferRecord(id string) *channelBufferRecord {
 		id:         id,
 		operations: []*core.Operation{},
 		lock:       &sync.Mutex{},
+		created:    time.Now(),
 	}
 }
 
@@ -32,6 +40,18 @@ func createOrGetChannelBuffer(channelbufferStore *memstore.Memstore, id string)
 	return channelbufferStore.AddOrGet(newRecord).(*channelBufferRecord)
 }
 
+// Gets and locks buffer (skips buffers removed from store concurrently)
+func lockChannelBuffer(channelbufferStore *memstore.Memstore, id string) *channelBufferRecord {
+	for {
+		bufferRecord := createOrGetChannelBuffer(channelbufferStore, id)
+		bufferRecord.Lock()
+		if !bufferRecord.removed {
+			return bufferRecord
+		}
+		bufferRecord.Unlock()
+	}
+}
+
 /*
 	Comparison
 */
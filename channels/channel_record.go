@@ -1,6 +1,7 @@
 package channels
 
 import (
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/memstore"
 	"sort"
 	"sync"
@@ -19,6 +20,25 @@ type channelPermissionsRecord struct {
 	users map[string]*channelPermissionRecord
 }
 
+func (rec *channelPermissionsRecord) equal(other *channelPermissionsRecord) bool {
+	if rec == nil || other == nil {
+		return rec == other
+	}
+	if len(rec.users) != len(other.users) {
+		return false
+	}
+	for userId, userPermissions := range rec.users {
+		otherPermissions, ok := other.users[userId]
+		if !ok || (userPermissions == nil) != (otherPermissions == nil) {
+			return false
+		}
+		if userPermissions != nil && *userPermissions != *otherPermissions {
+			return false
+		}
+	}
+	return true
+}
+
 func (rec *channelPermissionsRecord) build(obj *ChannelPermissionsObject) {
 	rec.users = map[string]*channelPermissionRecord{}
 	for userId, userPermissions := range obj.Users {
@@ -37,12 +57,30 @@ type channelActionCollection []*channelActionRecord
 
 func (s channelActionCollection) Len() int           { return len(s) }
 func (s channelActionCollection) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s channelActionCollection) Less(i, j int) bool { return s[i].timestamp.Before(s[j].timestamp) }
+func (s channelActionCollection) Less(i, j int) bool { return s[i].before(s[j]) }
 
 type channelActionRecord struct {
 	issuerId    string
 	certifierId string
 	timestamp   time.Time
+	clock       core.VectorClock
+}
+
+// Ordering key of message action (messages without clock count as first message of their issuer)
+func (action *channelActionRecord) key(hash []byte) messageKey {
+	clock := action.clock
+	if len(clock) == 0 {
+		clock = clock.Increment(action.issuerId)
+	}
+	return makeMessageKey(clock, action.timestamp, hash)
+}
+
+// Action ordering for openings and closures: timestamp, then issuer id (clocks are not signed so they are not used)
+func (action *channelActionRecord) before(than *channelActionRecord) bool {
+	if !action.timestamp.Equal(than.timestamp) {
+		return action.timestamp.Before(than.timestamp)
+	}
+	return action.issuerId < than.issuerId
 }
 
 /*
@@ -87,9 +125,8 @@ type channelRecord struct {
 	closureAttempts channelActionCollection
 	keyId           string
 
-	// Message timestamps (to determine order)
-	// @TODO: Use a tree for O(log n) add message
-	messageTimestamps []time.Time
+	// Ordered index of messages (to determine positions)
+	messages messageIndex
 
 	// State management
 	state channelState
@@ -123,17 +160,52 @@ func createOrGetChannel(channelsStore *memstore.Memstore, id string) *channelRec
 	return channelsStore.AddOrGet(newRecord).(*channelRecord)
 }
 
+/*
+	Opening validation
+*/
+func isValidOpening(opening *channelActionRecord, permissions *channelPermissionsRecord, keyId string) bool {
+	return opening != nil &&
+		!opening.timestamp.IsZero() &&
+		permissions != nil &&
+		len(permissions.users) != 0 &&
+		len(keyId) != 0
+}
+
+// Opening differs from the one kept (different key id or permissions)
+func (rec *channelRecord) conflictsWith(permissions *channelPermissionsRecord, keyId string) bool {
+	return keyId != rec.keyId || !permissions.equal(rec.permissions)
+}
+
+// Resolution rule for conflicting openings: earliest timestamp, then issuer id, then key id
+func (rec *channelRecord) winsConflict(opening *channelActionRecord, keyId string) bool {
+	if opening.before(rec.opening) {
+		return true
+	}
+	return !rec.opening.before(opening) && keyId < rec.keyId
+}
+
+/*
+	Determines if opening would be kept (used to only add keys of openings kept)
+*/
+func (rec *channelRecord) keepsOpening(opening *channelActionRecord, permissions *channelPermissionsRecord, keyId string) bool {
+	if !isValidOpening(opening, permissions, keyId) {
+		return false
+	}
+	if rec.state == channelBufferedState {
+		return true
+	}
+	return rec.opening != nil &&
+		rec.conflictsWith(permissions, keyId) &&
+		rec.winsConflict(opening, keyId)
+}
+
 /*
 	Open channel action
 	Note: does not include verifying global permissions
 */
 func (rec *channelRecord) tryOpen(id string, opening *channelActionRecord, permissions *channelPermissionsRecord, keyId string) bool {
 	if rec.state != channelBufferedState ||
-		opening == nil ||
-		opening.timestamp.IsZero() ||
-		permissions == nil ||
-		len(permissions.users) == 0 ||
-		len(keyId) == 0 {
+		!isValidOpening(opening, permissions, keyId) {
 		return false
 	}
 
@@ -149,28 +221,68 @@ func (rec *channelRecord) tryOpen(id string, opening *channelActionRecord, permi
 	return true
 }
 
+/*
+	Conflicting open action (channel already opened with a different key id or permissions)
+	Channel keeps the winning opening (see resolution rule) and stays usable, so every replica
+	resolves to the same opening regardless of arrival order
+	If the winning opening replaces the kept one, closure is applied again under its permissions
+	Messages were accepted under an opening that may not be kept, so they are all retracted
+	(replicas end up with the same empty index whichever opening arrived first)
+	Returns retracted messages (in channel order) and true if opening conflicts
+	Note: does not include verifying global permissions
+*/
+func (rec *channelRecord) tryConflictingOpen(opening *channelActionRecord, permissions *channelPermissionsRecord, keyId string) ([]messageKey, bool) {
+	if rec.state == channelBufferedState ||
+		rec.opening == nil ||
+		!isValidOpening(opening, permissions, keyId) {
+		return nil, false
+	}
+
+	// Same opening is not a conflict
+	if !rec.conflictsWith(permissions, keyId) {
+		return nil, false
+	}
+
+	// Apply resolution rule
+	retracted := rec.messages.clear()
+	if rec.winsConflict(opening, keyId) {
+		rec.keyId = keyId
+		rec.opening = opening
+		rec.permissions = permissions
+		if rec.closure != nil {
+			rec.closureAttempts = append(rec.closureAttempts, rec.closure)
+		}
+		rec.closure = nil
+		rec.duration = &channelDurationRecord{
+			opened: opening.timestamp,
+		}
+		rec.state = channelOpenState
+		rec.applyCloseAttempts()
+	}
+	return retracted, true
+}
+
 /*
 	Close channel action
-	Returns number of messages left in the channel
+	Returns messages retracted because they fall after the closure (in channel order)
 	Note: does not include verifying global permissions
-	@TODO: Handle cutting out messages that fall outside duration
 */
-func (rec *channelRecord) tryClose(closure *channelActionRecord) (int, bool) {
+func (rec *channelRecord) tryClose(closure *channelActionRecord) ([]messageKey, bool) {
 	if rec.state == channelInconsistentState ||
 		closure == nil ||
 		closure.timestamp.IsZero() {
-		return 0, false
+		return nil, false
 	}
 
 	// Buffer closure if channel is still buffered
 	if rec.state == channelBufferedState {
 		rec.closureAttempts = append(rec.closureAttempts, closure)
-		return 0, true
+		return nil, true
 	}
 
 	// Closure should be after opening
 	if rec.duration == nil || rec.duration.opened.After(closure.timestamp) {
-		return 0, false
+		return nil, false
 	}
 
 	// Determine if we can close
@@ -179,19 +291,12 @@ func (rec *channelRecord) tryClose(closure *channelActionRecord) (int, bool) {
 		canClose = permissionRecord.close
 	}
 	if !canClose {
-		return 0, false
-	}
-
-	// Determine if there were earlier closure attempts (if channel is closed already)
-	if rec.state == channelClosedState && rec.duration.closed.Before(closure.timestamp) {
-		return 0, false
+		return nil, false
 	}
 
-	// If timestamp is equal, rely on issuer id as tiebreaker
-	if rec.state == channelClosedState &&
-		rec.duration.closed.Equal(closure.timestamp) &&
-		rec.closure.issuerId <= closure.issuerId {
-		return 0, false
+	// Earliest closure wins if channel is closed already (issuer id is the tiebreaker)
+	if rec.state == channelClosedState && !closure.before(rec.closure) {
+		return nil, false
 	}
 
 	// Mark as closed
@@ -200,16 +305,8 @@ func (rec *channelRecord) tryClose(closure *channelActionRecord) (int, bool) {
 	rec.duration.closed = closure.timestamp
 	rec.state = channelClosedState
 
-	// Remove late messages
-	filteredMessageTimestamps := []time.Time{}
-	for _, messageTimestamp := range rec.messageTimestamps {
-		if messageTimestamp.Before(rec.duration.closed) {
-			filteredMessageTimestamps = append(filteredMessageTimestamps, messageTimestamp)
-		}
-	}
-	rec.messageTimestamps = filteredMessageTimestamps
-
-	return len(filteredMessageTimestamps), true
+	// Retract messages from closure timestamp on (later adds use the same cutoff)
+	return rec.messages.removeFrom(closure.timestamp), true
 }
 
 /*
@@ -238,19 +335,21 @@ func (rec *channelRecord) applyCloseAttempts() bool {
 
 /*
 	Add message to channel
-	Returns position of message
-	@TODO verify duration and permissions
-	@TODO: Switch to vector clock -> timestamp -> message hash for sorting
+	Returns position of message (messages kept are ordered by vector clock depth, timestamp, then hash)
 */
-func (rec *channelRecord) addMessage(addMessageAction *channelActionRecord) (int, bool) {
+func (rec *channelRecord) addMessage(addMessageAction *channelActionRecord, messageHash []byte) (int, bool) {
 	if rec.state == channelBufferedState ||
 		rec.state == channelInconsistentState ||
 		rec.duration.opened.After(addMessageAction.timestamp) ||
-		(rec.state == channelClosedState && rec.duration.closed.Before(addMessageAction.timestamp)) ||
 		addMessageAction.timestamp.IsZero() {
 		return 0, false
 	}
 
+	// Messages from closure timestamp on are late whatever their clock (same cutoff as closing)
+	if rec.state == channelClosedState && !addMessageAction.timestamp.Before(rec.duration.closed) {
+		return 0, false
+	}
+
 	// Determine if we can write
 	var canWrite bool = false
 	if permissionRecord, ok := rec.permissions.users[addMessageAction.certifierId]; ok && permissionRecord != nil {
@@ -260,14 +359,52 @@ func (rec *channelRecord) addMessage(addMessageAction *channelActionRecord) (int
 		return 0, false
 	}
 
-	messagePosition := 0
-	for _, timestamp := range rec.messageTimestamps {
-		if addMessageAction.timestamp.After(timestamp) {
-			messagePosition++
+	return rec.messages.add(addMessageAction.key(messageHash)), true
+}
+
+// Buffered channel has a pending closure attempt certified by user
+func (rec *channelRecord) hasClosureAttemptBy(userId string) bool {
+	for _, attempt := range rec.closureAttempts {
+		if attempt.certifierId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Determines if channel should be listed for request
+	Certifier needs read permission, and channels that were never opened don't match opening time filters
+	Buffered channels have no permissions yet, so they are only visible to certifiers of their pending
+	closure attempts (members of buffered channels are those certifiers)
+*/
+func (rec *channelRecord) matchesListRequest(rq *ListChannelsRequest) bool {
+	if rec.state == channelBufferedState {
+		if !rec.hasClosureAttemptBy(rq.Signers.CertifierId) ||
+			len(rq.Member) != 0 && !rec.hasClosureAttemptBy(rq.Member) {
+			return false
+		}
+	} else {
+		if rec.permissions == nil {
+			return false
+		}
+		if permissionRecord, ok := rec.permissions.users[rq.Signers.CertifierId]; !ok || permissionRecord == nil || !permissionRecord.read {
+			return false
+		}
+		if _, ok := rec.permissions.users[rq.Member]; len(rq.Member) != 0 && !ok {
+			return false
 		}
 	}
-	rec.messageTimestamps = append(rec.messageTimestamps, addMessageAction.timestamp)
-	return messagePosition, true
+	if len(rq.State) != 0 && objectStateMapping[rec.state] != rq.State {
+		return false
+	}
+	if !rq.OpenedAfter.IsZero() && (rec.duration == nil || !rec.duration.opened.After(rq.OpenedAfter)) {
+		return false
+	}
+	if !rq.OpenedBefore.IsZero() && (rec.duration == nil || !rec.duration.opened.Before(rq.OpenedBefore)) {
+		return false
+	}
+	return true
 }
 
 /*
@@ -299,6 +436,8 @@ func (rec *channelRecord) RUnlock() {
 
 /*
 	Indexing
+	Memstore indexes are unique per record, so members are indexed in the members store
+	and states are filtered while listing
 */
 const (
 	channelIndexId string = "id"
@@ -1,6 +1,9 @@
 package channels
 
 import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mngharbi/DMPC/core"
 	"reflect"
 	"testing"
 	"time"
@@ -27,7 +30,7 @@ func TestTryOpen(t *testing.T) {
 
 	if rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Time{}},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Time{}, nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericUserId: {true, true, true},
 		}},
@@ -38,7 +41,7 @@ func TestTryOpen(t *testing.T) {
 
 	if rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now()},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now(), nil},
 		nil,
 		genericKeyId,
 	) {
@@ -47,7 +50,7 @@ func TestTryOpen(t *testing.T) {
 
 	if rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now()},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now(), nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{}},
 		genericKeyId,
 	) {
@@ -56,7 +59,7 @@ func TestTryOpen(t *testing.T) {
 
 	if rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now()},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now(), nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericUserId: {true, true, true},
 		}},
@@ -67,7 +70,7 @@ func TestTryOpen(t *testing.T) {
 
 	if !rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now()},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now(), nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericUserId: {true, true, true},
 		}},
@@ -81,7 +84,7 @@ func TestTryOpen(t *testing.T) {
 
 	if rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now()},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now(), nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericUserId: {true, true, true},
 		}},
@@ -91,13 +94,193 @@ func TestTryOpen(t *testing.T) {
 	}
 }
 
+func TestTryConflictingOpen(t *testing.T) {
+	currentTime := time.Now()
+	permissions := &channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+		genericUserId: {true, true, true},
+	}}
+	otherPermissions := &channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+		genericUserId: {true, false, true},
+	}}
+
+	// Buffered channel can not conflict
+	rec := &channelRecord{
+		state: channelBufferedState,
+	}
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil},
+		permissions,
+		genericKeyId,
+	); conflicting {
+		t.Error("Opening a buffered channel should not conflict")
+	}
+	if !rec.tryOpen(
+		genericChannelId,
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil},
+		permissions,
+		genericKeyId,
+	) {
+		t.Error("Opening a buffered channel should not fail")
+	}
+
+	// Same opening does not conflict
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute), nil},
+		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+			genericUserId: {true, true, true},
+		}},
+		genericKeyId,
+	); conflicting || rec.state != channelOpenState {
+		t.Error("Opening a channel again with the same key and permissions should not conflict")
+	}
+
+	// Later opening with different permissions conflicts but is not kept
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute), nil},
+		otherPermissions,
+		genericKeyId,
+	); !conflicting {
+		t.Error("Opening a channel with different permissions should conflict")
+	}
+	if rec.state != channelOpenState ||
+		rec.permissions != permissions ||
+		!rec.duration.opened.Equal(currentTime) {
+		t.Error("Conflicting opening should keep earliest opening and channel open")
+	}
+
+	// Opening at the same time with lower issuer id is kept
+	if !rec.keepsOpening(
+		&channelActionRecord{genericIssuerIdBefore, genericCertifierId, currentTime, nil},
+		permissions,
+		genericKeyId+"_other",
+	) {
+		t.Error("Conflicting opening at the same time with lower issuer id should be kept")
+	}
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerIdBefore, genericCertifierId, currentTime, nil},
+		permissions,
+		genericKeyId+"_other",
+	); !conflicting || rec.keyId != genericKeyId+"_other" || rec.opening.issuerId != genericIssuerIdBefore {
+		t.Error("Conflicting opening at the same time with lower issuer id should be kept")
+	}
+
+	// Opening at the same time by the same issuer with lower key id is kept
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerIdBefore, genericCertifierId, currentTime, nil},
+		permissions,
+		genericKeyId,
+	); !conflicting || rec.keyId != genericKeyId {
+		t.Error("Conflicting opening at the same time by the same issuer with lower key id should be kept")
+	}
+
+	// Earlier opening is kept
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerIdAfter, genericCertifierId, currentTime.Add(-time.Hour), nil},
+		otherPermissions,
+		genericKeyId,
+	); !conflicting || rec.keyId != genericKeyId || rec.permissions != otherPermissions ||
+		!rec.duration.opened.Equal(currentTime.Add(-time.Hour)) {
+		t.Error("Earlier conflicting opening should be kept")
+	}
+	if rec.keepsOpening(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil},
+		permissions,
+		genericKeyId+"_other",
+	) {
+		t.Error("Later conflicting opening should not be kept")
+	}
+
+	// Channel stays usable under opening kept
+	if _, ok := rec.addMessage(
+		&channelActionRecord{genericIssuerId, genericUserId, currentTime.Add(time.Minute), nil},
+		nil,
+	); ok {
+		t.Error("Adding message without write permission of opening kept should fail")
+	}
+	if _, ok := rec.tryClose(
+		&channelActionRecord{genericIssuerId, genericUserId, currentTime.Add(time.Hour), nil},
+	); !ok || rec.state != channelClosedState {
+		t.Error("Closing a channel after a conflicting opening should succeed")
+	}
+
+	// Closure is kept if earlier opening allows it
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(-2 * time.Hour), nil},
+		permissions,
+		genericKeyId,
+	); !conflicting || rec.state != channelClosedState || !rec.duration.closed.Equal(currentTime.Add(time.Hour)) {
+		t.Error("Closure allowed by earlier conflicting opening should be kept")
+	}
+
+	// Closure is dropped if earlier opening does not allow it
+	if _, conflicting := rec.tryConflictingOpen(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(-3 * time.Hour), nil},
+		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+			genericUserId: {true, true, false},
+		}},
+		genericKeyId,
+	); !conflicting || rec.state != channelOpenState || rec.closure != nil {
+		t.Error("Closure not allowed by earlier conflicting opening should be dropped")
+	}
+}
+
+func TestConflictingOpenArrivalOrder(t *testing.T) {
+	currentTime := time.Now()
+	earlierOpening := &channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil}
+	earlierPermissions := &channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+		genericUserId: {true, true, true},
+	}}
+	laterOpening := &channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute), nil}
+	laterPermissions := &channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+		genericUserId: {true, true, false},
+	}}
+
+	// Open with one opening, add messages, then conflict with the other
+	openThenConflict := func(firstOpening *channelActionRecord, firstPermissions *channelPermissionsRecord, firstKeyId string, secondOpening *channelActionRecord, secondPermissions *channelPermissionsRecord, secondKeyId string) (*channelRecord, []messageKey) {
+		rec := makeEmptyChannelRecord(genericChannelId)
+		if !rec.tryOpen(genericChannelId, firstOpening, firstPermissions, firstKeyId) {
+			t.Error("Opening a buffered channel should not fail")
+		}
+		for i := 1; i <= 3; i++ {
+			if _, ok := rec.addMessage(
+				&channelActionRecord{genericIssuerId, genericUserId, currentTime.Add(time.Duration(i) * time.Hour), nil},
+				[]byte{byte(i)},
+			); !ok {
+				t.Error("Adding message to an open channel should not fail")
+			}
+		}
+		retracted, conflicting := rec.tryConflictingOpen(secondOpening, secondPermissions, secondKeyId)
+		if !conflicting {
+			t.Error("Opening a channel with different key and permissions should conflict")
+		}
+		return rec, retracted
+	}
+	earlierFirst, earlierFirstRetracted := openThenConflict(earlierOpening, earlierPermissions, genericKeyId, laterOpening, laterPermissions, genericKeyId+"_other")
+	laterFirst, laterFirstRetracted := openThenConflict(laterOpening, laterPermissions, genericKeyId+"_other", earlierOpening, earlierPermissions, genericKeyId)
+
+	// Both replicas keep the earlier opening and retract messages accepted before the conflict
+	for _, rec := range []*channelRecord{earlierFirst, laterFirst} {
+		if rec.state != channelOpenState ||
+			rec.opening != earlierOpening ||
+			rec.permissions != earlierPermissions ||
+			rec.keyId != genericKeyId ||
+			!rec.duration.opened.Equal(earlierOpening.timestamp) ||
+			rec.messages.len() != 0 {
+			t.Errorf("Conflicting openings should converge whatever the arrival order. rec=%+v", rec)
+		}
+	}
+	if len(earlierFirstRetracted) != 3 || !reflect.DeepEqual(earlierFirstRetracted, laterFirstRetracted) {
+		t.Errorf("Messages accepted before conflict should be retracted in order. earlierFirst=%v, laterFirst=%v", earlierFirstRetracted, laterFirstRetracted)
+	}
+}
+
 func TestTryClose(t *testing.T) {
 	// Close a buffered record
 	rec := &channelRecord{
 		state: channelBufferedState,
 	}
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now()},
+		&channelActionRecord{genericIssuerId, genericCertifierId, time.Now(), nil},
 	); !ok {
 		t.Error("Closing a buffered channel should not fail")
 	}
@@ -110,7 +293,7 @@ func TestTryClose(t *testing.T) {
 
 	if !rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericIssuerId:    {false, false, false},
 			genericCertifierId: {true, true, true},
@@ -122,14 +305,16 @@ func TestTryClose(t *testing.T) {
 
 	// Add a message after a minute of opening
 	if _, ok := rec.addMessage(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute)},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute), nil},
+		nil,
 	); !ok {
 		t.Error("Adding a valid message should not fail")
 	}
 
 	// Add a message after 2 hours of opening
 	if _, ok := rec.addMessage(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(2 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(2 * time.Hour), nil},
+		nil,
 	); !ok {
 		t.Error("Adding a valid message should not fail")
 	}
@@ -139,17 +324,17 @@ func TestTryClose(t *testing.T) {
 		t.Error("Closing a channel without closure record should fail")
 	}
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericIssuerId, currentTime},
+		&channelActionRecord{genericIssuerId, genericIssuerId, currentTime, nil},
 	); ok {
 		t.Error("Closing a channel by user that doesn't have permissions should fail")
 	}
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(-1 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(-1 * time.Hour), nil},
 	); ok {
 		t.Error("Closing a channel before its opening time should fail")
 	}
-	remainingMessages, closeOk := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Hour)},
+	retracted, closeOk := rec.tryClose(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Hour), nil},
 	)
 	if !closeOk {
 		t.Error("Closing a channel should not fail")
@@ -158,38 +343,62 @@ func TestTryClose(t *testing.T) {
 		rec.closure == nil {
 		t.Error("Closing an open channel should move it to closed state ")
 	}
-	if remainingMessages != 1 {
-		t.Error("Closing an open channel with messages should remove late messages")
+	if rec.messages.len() != 1 ||
+		len(retracted) != 1 ||
+		!retracted[0].timestamp.Equal(currentTime.Add(2*time.Hour)) {
+		t.Error("Closing an open channel with messages should retract late messages")
+	}
+
+	// Late message is rejected after closure
+	if _, ok := rec.addMessage(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(2 * time.Hour), nil},
+		nil,
+	); ok {
+		t.Error("Adding a message after closure should fail")
 	}
 
 	// Try to close after first close
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(2 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(2 * time.Hour), nil},
 	); ok {
 		t.Error("Closing a channel after its closing time should fail")
 	}
 
 	// Try to close at the same time with different issuer (alphanumerically higher)
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerIdAfter, genericCertifierId, currentTime.Add(time.Hour)},
+		&channelActionRecord{genericIssuerIdAfter, genericCertifierId, currentTime.Add(time.Hour), nil},
 	); ok {
 		t.Error("Closing a channel again at its closing time with higher issuer id should fail")
 	}
 
 	// Try to close at the same time with different issuer (alphanumerically lower)
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerIdBefore, genericCertifierId, currentTime.Add(time.Hour)},
+		&channelActionRecord{genericIssuerIdBefore, genericCertifierId, currentTime.Add(time.Hour), nil},
 	); !ok {
 		t.Error("Closing a channel again at its closing time with lower issuer id should not fail")
 	}
 
-	// Try to close before first close
-	if remainingMessages, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute)},
-	); !ok || remainingMessages != 0 {
+	// Try to close before first close (message at closure time is retracted)
+	if retracted, ok := rec.tryClose(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute), nil},
+	); !ok || len(retracted) != 1 || rec.messages.len() != 0 {
 		t.Error("Closing a channel before its closing time should not fail")
 	}
 
+	// Closure with a deeper clock is still earlier if its timestamp is earlier
+	if _, ok := rec.tryClose(
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Second), core.VectorClock{genericIssuerId: 5}},
+	); !ok || !rec.duration.closed.Equal(currentTime.Add(time.Second)) {
+		t.Error("Closing a channel with an earlier closure should not fail whatever its clock")
+	}
+
+	// Closure with a shallower clock is still later if its timestamp is later
+	if _, ok := rec.tryClose(
+		&channelActionRecord{genericIssuerIdBefore, genericCertifierId, currentTime.Add(time.Minute), nil},
+	); ok {
+		t.Error("Closing a channel with a later closure should fail whatever its clock")
+	}
+
 }
 
 func TestApplyCloseAttemptsInvalid(t *testing.T) {
@@ -202,7 +411,7 @@ func TestApplyCloseAttemptsInvalid(t *testing.T) {
 
 	// Add invalid close attempt (no permissions)
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericIssuerId, currentTime.Add(1 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericIssuerId, currentTime.Add(1 * time.Hour), nil},
 	); !ok {
 		t.Error("Attempting to close a buffered channel should not fail")
 	}
@@ -214,14 +423,14 @@ func TestApplyCloseAttemptsInvalid(t *testing.T) {
 
 	// Add invalid close attempt again
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericIssuerId, currentTime.Add(1 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericIssuerId, currentTime.Add(1 * time.Hour), nil},
 	); !ok {
 		t.Error("Attempting to close a buffered channel should not fail")
 	}
 	// Open channel
 	if !rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericUserId: {true, true, true},
 		}},
@@ -248,7 +457,7 @@ func TestApplyCloseAttempts(t *testing.T) {
 	attempts := 5
 	for i := attempts; i > 0; i-- {
 		if _, ok := rec.tryClose(
-			&channelActionRecord{genericUserId, genericUserId, currentTime.Add(time.Duration(i) * time.Hour)},
+			&channelActionRecord{genericUserId, genericUserId, currentTime.Add(time.Duration(i) * time.Hour), nil},
 		); !ok {
 			t.Error("Attempting to close a buffered channel should not fail")
 		}
@@ -261,7 +470,7 @@ func TestApplyCloseAttempts(t *testing.T) {
 	// Open channel
 	if !rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericUserId: {true, true, true},
 		}},
@@ -273,7 +482,7 @@ func TestApplyCloseAttempts(t *testing.T) {
 	if !rec.applyCloseAttempts() {
 		t.Error("Applying close attempts to an open channel should not fail")
 	}
-	expectedClosureRecord := &channelActionRecord{genericUserId, genericUserId, currentTime.Add(1 * time.Hour)}
+	expectedClosureRecord := &channelActionRecord{genericUserId, genericUserId, currentTime.Add(1 * time.Hour), nil}
 	if rec.computeState() != channelClosedState ||
 		!reflect.DeepEqual(rec.closure, expectedClosureRecord) {
 		t.Error("Applying close attempts should apply them in ascending time ordering")
@@ -283,6 +492,54 @@ func TestApplyCloseAttempts(t *testing.T) {
 /*
 	Test add message
 */
+func TestCloseArrivalOrder(t *testing.T) {
+	currentTime := time.Now()
+	opening := &channelActionRecord{genericIssuerId, genericCertifierId, currentTime, nil}
+	closure := &channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(time.Hour), nil}
+	messageActions := []*channelActionRecord{
+		{genericIssuerId, genericCertifierId, currentTime.Add(time.Minute), nil},
+		{genericIssuerId, genericCertifierId, closure.timestamp, nil},
+	}
+	openChannel := func() *channelRecord {
+		rec := makeEmptyChannelRecord(genericChannelId)
+		if !rec.tryOpen(genericChannelId, opening, &channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+			genericCertifierId: {true, true, true},
+		}}, genericKeyId) {
+			t.Error("Opening a buffered channel should not fail")
+		}
+		return rec
+	}
+
+	// Messages then closure (message at closure timestamp is retracted)
+	addFirst := openChannel()
+	for messageIndex, action := range messageActions {
+		if _, ok := addFirst.addMessage(action, []byte{byte(messageIndex)}); !ok {
+			t.Error("Adding message to an open channel should not fail")
+		}
+	}
+	retracted, ok := addFirst.tryClose(closure)
+	if !ok || len(retracted) != 1 || !retracted[0].timestamp.Equal(closure.timestamp) {
+		t.Errorf("Closing should retract message at closure timestamp. retracted=%v", retracted)
+	}
+
+	// Closure then messages (message at closure timestamp is rejected)
+	closeFirst := openChannel()
+	if _, ok := closeFirst.tryClose(closure); !ok {
+		t.Error("Closing an open channel should not fail")
+	}
+	if pos, ok := closeFirst.addMessage(messageActions[0], []byte{0}); !ok || pos != 0 {
+		t.Error("Adding message before closure to a closed channel should not fail")
+	}
+	if _, ok := closeFirst.addMessage(messageActions[1], []byte{1}); ok {
+		t.Error("Adding message at closure timestamp to a closed channel should fail")
+	}
+
+	// Both replicas keep the same messages in the same positions
+	if addFirst.messages.len() != 1 || !reflect.DeepEqual(addFirst.messages.clear(), closeFirst.messages.clear()) {
+		t.Error("Messages kept should not depend on closure arrival order")
+	}
+}
+
 func TestAddMessage(t *testing.T) {
 	currentTime := time.Now()
 
@@ -299,14 +556,14 @@ func TestAddMessage(t *testing.T) {
 	}
 
 	// Adding message to buffered channel
-	if _, ok := rec.addMessage(validAddMessageActionPtr); ok {
+	if _, ok := rec.addMessage(validAddMessageActionPtr, nil); ok {
 		t.Error("Adding message to a buffered channel should fail")
 	}
 
 	// Open channel (-1 hour)
 	if !rec.tryOpen(
 		genericChannelId,
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(-1 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(-1 * time.Hour), nil},
 		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
 			genericCertifierId: {true, true, true},
 		}},
@@ -321,7 +578,7 @@ func TestAddMessage(t *testing.T) {
 	*tmpChannelAction = *validAddMessageActionPtr
 	for i := 0; i < 3; i++ {
 		tmpChannelAction.timestamp = tmpTime
-		if pos, ok := rec.addMessage(tmpChannelAction); !ok || pos != i {
+		if pos, ok := rec.addMessage(tmpChannelAction, nil); !ok || pos != i {
 			t.Error("Adding valid message to an open channel should not fail")
 		}
 		tmpTime = tmpTime.Add(time.Minute)
@@ -330,34 +587,34 @@ func TestAddMessage(t *testing.T) {
 	// Adding valid message with no permissions should fail
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.certifierId = genericIssuerId
-	if _, ok := rec.addMessage(tmpChannelAction); ok {
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
 		t.Error("Adding valid message without permissions should fail")
 	}
 
 	// Adding message with invalid timestamp should fail
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.timestamp = time.Time{}
-	if _, ok := rec.addMessage(tmpChannelAction); ok {
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
 		t.Error("Adding message with invalid timestamp should fail")
 	}
 
 	// Adding message before opening time
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.timestamp = currentTime.Add(-2 * time.Hour)
-	if _, ok := rec.addMessage(tmpChannelAction); ok {
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
 		t.Error("Adding message to open channel should fail if it's before opening time")
 	}
 
 	// Adding message at opening time
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.timestamp = currentTime.Add(-1 * time.Hour)
-	if _, ok := rec.addMessage(tmpChannelAction); !ok {
+	if _, ok := rec.addMessage(tmpChannelAction, nil); !ok {
 		t.Error("Adding message to open channel should not fail if it's at opening time")
 	}
 
 	// Close channel (+1 hour)
 	if _, ok := rec.tryClose(
-		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(1 * time.Hour)},
+		&channelActionRecord{genericIssuerId, genericCertifierId, currentTime.Add(1 * time.Hour), nil},
 	); !ok {
 		t.Error("Attempting to close an open channel should not fail")
 	}
@@ -365,21 +622,111 @@ func TestAddMessage(t *testing.T) {
 	// Adding message to closed channel before closing time (+1 second)
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.timestamp = currentTime.Add(time.Second)
-	if pos, ok := rec.addMessage(tmpChannelAction); !ok || pos != 2 {
+	if pos, ok := rec.addMessage(tmpChannelAction, nil); !ok || pos != 2 {
 		t.Error("Adding message to closed channel should not fail if it's before closure")
 	}
 
 	// Adding message to closed channel at closing time
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.timestamp = currentTime.Add(time.Hour)
-	if _, ok := rec.addMessage(tmpChannelAction); !ok {
-		t.Error("Adding message to closed channel should not fail if it's at closure")
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
+		t.Error("Adding message to closed channel should fail if it's at closure")
 	}
 
 	// Adding message to closed channel after closing time (+2 hour)
 	*tmpChannelAction = *validAddMessageActionPtr
 	tmpChannelAction.timestamp = currentTime.Add(2 * time.Hour)
-	if _, ok := rec.addMessage(tmpChannelAction); ok {
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
 		t.Error("Adding message to closed channel should fail if it's after closure")
 	}
+
+	// Adding message without clock after closing time
+	*tmpChannelAction = *validAddMessageActionPtr
+	tmpChannelAction.timestamp = currentTime.Add(2 * time.Hour)
+	tmpChannelAction.clock = nil
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
+		t.Error("Adding message without clock to closed channel should fail if it's after closure")
+	}
+
+	// Adding message with a shallow clock after closing time
+	tmpChannelAction.clock = core.VectorClock{genericCertifierId: 1}
+	if _, ok := rec.addMessage(tmpChannelAction, nil); ok {
+		t.Error("Adding message with a shallow clock to closed channel should fail if it's after closure")
+	}
+
+	// Adding message with an inflated clock before closing time is ordered last but retracts nothing
+	messagesBefore := rec.messages.len()
+	*tmpChannelAction = *validAddMessageActionPtr
+	tmpChannelAction.timestamp = currentTime.Add(time.Minute)
+	tmpChannelAction.clock = core.VectorClock{genericCertifierId: 1000}
+	if pos, ok := rec.addMessage(tmpChannelAction, nil); !ok || pos != messagesBefore || rec.messages.len() != messagesBefore+1 {
+		t.Error("Adding message with an inflated clock before closure should not fail or remove messages")
+	}
+
+	// Adding message without clock before closing time is ordered with other messages without clock
+	*tmpChannelAction = *validAddMessageActionPtr
+	tmpChannelAction.timestamp = currentTime.Add(30 * time.Minute)
+	if pos, ok := rec.addMessage(tmpChannelAction, nil); !ok || pos != messagesBefore {
+		t.Errorf("Adding message without clock before closure should be ordered by timestamp, found at position %v", pos)
+	}
+}
+
+/*
+	Benchmarks
+*/
+func makeBenchmarkChannelRecord(b *testing.B, existingMessages int) (*channelRecord, time.Time) {
+	rec := &channelRecord{
+		state: channelBufferedState,
+	}
+	openTime := time.Now()
+	if !rec.tryOpen(
+		genericChannelId,
+		&channelActionRecord{genericIssuerId, genericCertifierId, openTime, nil},
+		&channelPermissionsRecord{users: map[string]*channelPermissionRecord{
+			genericCertifierId: {true, true, true},
+		}},
+		genericKeyId,
+	) {
+		b.Fatal("Opening a buffered channel should not fail")
+	}
+
+	// Existing messages are one millisecond apart
+	for i := 1; i <= existingMessages; i++ {
+		rec.messages.add(messageKey{timestamp: openTime.Add(time.Duration(i) * time.Millisecond)})
+	}
+	return rec, openTime
+}
+
+func benchmarkChannelRecordAddMessage(b *testing.B, existingMessages int, inOrder bool) {
+	rec, openTime := makeBenchmarkChannelRecord(b, existingMessages)
+
+	// Messages are added after existing ones or in the middle of them (ordered by hash)
+	offset := time.Duration(existingMessages+1) * time.Millisecond
+	if !inOrder {
+		offset = time.Duration(existingMessages/2)*time.Millisecond + time.Microsecond
+	}
+	action := &channelActionRecord{genericIssuerId, genericCertifierId, openTime.Add(offset), nil}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if inOrder {
+			action.timestamp = openTime.Add(offset + time.Duration(i))
+		}
+		hash := make([]byte, 8)
+		binary.BigEndian.PutUint64(hash, uint64(i))
+		if _, ok := rec.addMessage(action, hash); !ok {
+			b.Fatal("Adding a valid message should not fail")
+		}
+	}
+}
+
+func BenchmarkChannelRecordAddMessage(b *testing.B) {
+	for _, existingMessages := range []int{100, 1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("append/%v", existingMessages), func(b *testing.B) {
+			benchmarkChannelRecordAddMessage(b, existingMessages, true)
+		})
+		b.Run(fmt.Sprintf("middle/%v", existingMessages), func(b *testing.B) {
+			benchmarkChannelRecordAddMessage(b, existingMessages, false)
+		})
+	}
 }
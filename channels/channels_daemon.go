@@ -1,17 +1,19 @@
 package channels
 
 import (
-	"errors"
+	"context"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
 	"sync"
+	"sync/atomic"
 )
 
 /*
 	Server definitions
 */
 
-type ChannelActionRequester func(request interface{}) (chan *ChannelsResponse, error)
+type ChannelActionRequester func(ctx context.Context, request interface{}) (chan *ChannelsResponse, error)
 
 type ChannelsServerConfig struct {
 	NumWorkers int
@@ -19,72 +21,77 @@ type ChannelsServerConfig struct {
 
 type channelsServer struct {
 	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
+	subsystem     *Subsystem
 }
 
-var (
-	channelsServerSingleton channelsServer
-	channelsServerHandler   *gofarm.ServerHandler
-	channelsStore           *memstore.Memstore
-)
-
 /*
 	Server API
 */
 
-func provisionChannelsServerOnce() {
-	if channelsServerHandler == nil {
-		channelsServerHandler = gofarm.ProvisionServer()
+func (subsystem *Subsystem) startChannelsServer(conf ChannelsServerConfig, serversWaitGroup *sync.WaitGroup) (err error) {
+	defer serversWaitGroup.Done()
+	sv := subsystem.channelsServer
+	if !sv.isInitialized {
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
 	}
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
-func startChannelsServer(conf ChannelsServerConfig, serversWaitGroup *sync.WaitGroup) (err error) {
-	defer serversWaitGroup.Done()
-	provisionChannelsServerOnce()
-	if !channelsServerSingleton.isInitialized {
-		channelsServerSingleton.isInitialized = true
-		channelsServerHandler.ResetServer()
-		channelsServerHandler.InitServer(&channelsServerSingleton)
-	}
-	return channelsServerHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+func (subsystem *Subsystem) shutdownChannelsServer() {
+	subsystem.channelsServer.handler.ShutdownServer()
 }
 
-func shutdownChannelsServer() {
-	provisionChannelsServerOnce()
-	channelsServerHandler.ShutdownServer()
+func (subsystem *Subsystem) resizeChannelsServer(conf ChannelsServerConfig) error {
+	return subsystem.channelsServer.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
 /*
 	Functional API
 */
 
-func ChannelAction(request interface{}) (chan *ChannelsResponse, error) {
+func (subsystem *Subsystem) ChannelAction(ctx context.Context, request interface{}) (chan *ChannelsResponse, error) {
 	// Sanitize and validate request
 	var sanitizingErr error
 	switch request.(type) {
 	case *ReadChannelRequest:
 		sanitizingErr = request.(*ReadChannelRequest).sanitizeAndValidate()
+	case *ListChannelsRequest:
+		sanitizingErr = request.(*ListChannelsRequest).sanitizeAndValidate()
 	case *OpenChannelRequest:
 		sanitizingErr = request.(*OpenChannelRequest).sanitizeAndValidate()
 	case *CloseChannelRequest:
 		sanitizingErr = request.(*CloseChannelRequest).sanitizeAndValidate()
 	default:
-		return nil, errors.New("Unrecognized channel action")
+		return nil, core.NewError(core.InvalidRequestErrorCode, "Unrecognized channel action")
 	}
 	if sanitizingErr != nil {
 		return nil, sanitizingErr
 	}
 
+	// Drop request if the requester is not waiting anymore
+	if err := core.ContextError(ctx); err != nil {
+		return nil, err
+	}
+
 	// Make request to server
-	nativeResponseChannel, err := channelsServerHandler.MakeRequest(request)
+	nativeResponseChannel, err := subsystem.channelsServer.handler.MakeRequest(request)
 	if err != nil {
 		return nil, err
 	}
+	subsystem.metrics.channelsRequests.Queued()
 
 	// Pass through result
 	responseChannel := make(chan *ChannelsResponse)
 	go func() {
 		nativeResponse := <-nativeResponseChannel
-		responseChannel <- (*nativeResponse).(*ChannelsResponse)
+		select {
+		case responseChannel <- (*nativeResponse).(*ChannelsResponse):
+		case <-ctx.Done():
+		}
 	}()
 
 	return responseChannel, nil
@@ -97,20 +104,36 @@ func ChannelAction(request interface{}) (chan *ChannelsResponse, error) {
 func (sv *channelsServer) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize store (only if starting for the first time)
 	if isFirstStart {
-		channelsStore = memstore.New(getChannelIndexes())
+		sv.subsystem.channelsStore = memstore.New(getChannelIndexes())
+		sv.subsystem.membersStore = memstore.New(getChannelMembersIndexes())
 	}
-	log.Debugf(channelsDaemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.subsystem.log.Debugf(channelsDaemonStartLogMsg)
 	return nil
 }
 
 func (sv *channelsServer) Shutdown() error {
-	log.Debugf(channelsDaemonShutdownLogMsg)
+	sv.state.SetRunning(false)
+	sv.subsystem.log.Debugf(channelsDaemonShutdownLogMsg)
 	return nil
 }
 
 func (sv *channelsServer) Work(rqInterface *gofarm.Request) (dummyReturnVal *gofarm.Response) {
-	log.Debugf(channelsRunningRequestLogMsg)
+	requestLog := sv.subsystem.requestLogger(*rqInterface)
+	requestLog.Debugf(channelsRunningRequestLogMsg)
+
+	observation := sv.subsystem.metrics.channelsRequests.Start(requestTypeLabel(*rqInterface))
+	resp := sv.doRequest(rqInterface)
+	observation.DoneWithSuccess(resp.Result == ChannelsSuccess)
+
+	// Log request done
+	requestLog.Debugf(channelsRequestDoneLogMsg)
 
+	var respInterface gofarm.Response = resp
+	return &respInterface
+}
+
+func (sv *channelsServer) doRequest(rqInterface *gofarm.Request) *ChannelsResponse {
 	resp := &ChannelsResponse{
 		Result: ChannelsSuccess,
 	}
@@ -120,7 +143,7 @@ func (sv *channelsServer) Work(rqInterface *gofarm.Request) (dummyReturnVal *gof
 		rq := (*rqInterface).(*ReadChannelRequest)
 
 		// Get/Lock channel
-		channelRecord := getChannel(channelsStore, rq.Id)
+		channelRecord := getChannel(sv.subsystem.channelsStore, rq.Id)
 		if channelRecord == nil {
 			resp.Result = ChannelsFailure
 			break
@@ -132,68 +155,24 @@ func (sv *channelsServer) Work(rqInterface *gofarm.Request) (dummyReturnVal *gof
 		resp.Channel = &ChannelObject{}
 		resp.Channel.buildFromRecord(channelRecord)
 
+	case *ListChannelsRequest:
+		rq := (*rqInterface).(*ListChannelsRequest)
+		resp.Channels = sv.listChannels(rq)
+
 	case *OpenChannelRequest:
 		rq := (*rqInterface).(*OpenChannelRequest)
-		channelRecord := createOrGetChannel(channelsStore, rq.Channel.Id)
-		channelRecord.Lock()
-		defer func() { channelRecord.Unlock() }()
-
-		// Try to open channel
-		actionRecord := &channelActionRecord{
-			issuerId:    rq.Signers.IssuerId,
-			certifierId: rq.Signers.CertifierId,
-			timestamp:   rq.Timestamp,
-		}
-		permissionsRecord := &channelPermissionsRecord{}
-		permissionsRecord.build(&rq.Channel.Permissions)
-		openSuccess := channelRecord.tryOpen(rq.Channel.Id, actionRecord, permissionsRecord, rq.Channel.KeyId)
-		if !openSuccess {
-			resp.Result = ChannelsFailure
-			break
-		}
+		bufferedOperations := sv.openChannel(rq, resp)
 
-		// Feed buffered operations into decryptor
-		// @TODO: move buffer queuer outside of server object
-		// @TODO: make requests concurrently
-		channelBuffer := createOrGetChannelBuffer(bufferStore, rq.Channel.Id)
-		channelBuffer.Lock()
-		defer func() { channelBuffer.Unlock() }()
-		for _, operationPtr := range channelBuffer.operations {
-			respChannel, _ := messagesServerSingleton.operationQueuer(operationPtr)
-			_, ok := <-respChannel
-			if !ok {
-				// This occurs when decryptor is shut down prematurely
-				resp.Result = BufferError
-				break
-			}
-		}
-		if resp.Result == BufferError {
-			break
+		// Feed buffered operations into decryptor (channel is not locked while they run)
+		if !sv.subsystem.replayBufferedOperations(rq.Channel.Id, bufferedOperations) {
+			resp.Result = BufferError
 		}
 
-		// Empty buffer
-		channelBuffer.operations = nil
-
-		// Remove unauthorized listeners
-		unsubscribeUnauthorized(channelRecord.id, channelRecord.permissions)
-
-		// Notify (early) listeners of channel opening
-		publish(rq.Channel.Id, makeOpenEvent(channelRecord.duration.opened))
-
-		// Apply early closures
-		if channelRecord.applyCloseAttempts() {
-			publish(rq.Channel.Id, makeCloseEvent(channelRecord.duration.closed, 0))
-		}
-
-		// Build object
-		resp.Channel = &ChannelObject{}
-		resp.Channel.buildFromRecord(channelRecord)
-
 	case *CloseChannelRequest:
 		rq := (*rqInterface).(*CloseChannelRequest)
 
 		// Get/Lock channel
-		channelRecord := createOrGetChannel(channelsStore, rq.Id)
+		channelRecord := createOrGetChannel(sv.subsystem.channelsStore, rq.Id)
 		channelRecord.Lock()
 		defer func() { channelRecord.Unlock() }()
 
@@ -202,16 +181,26 @@ func (sv *channelsServer) Work(rqInterface *gofarm.Request) (dummyReturnVal *gof
 			issuerId:    rq.Signers.IssuerId,
 			certifierId: rq.Signers.CertifierId,
 			timestamp:   rq.Timestamp,
+			clock:       rq.VectorClock,
 		}
-		remainingMessages, closeSuccess := channelRecord.tryClose(actionRecord)
+		retractedMessages, closeSuccess := channelRecord.tryClose(actionRecord)
 		if !closeSuccess {
 			resp.Result = ChannelsFailure
 			break
 		}
 
-		// Only notify if channel is closed now
+		// Certifiers of closure attempts can list buffered channels
+		if channelRecord.state == channelBufferedState {
+			sv.subsystem.indexChannelMembers(channelRecord)
+		}
+
+		// Only notify if channel is closed now (listeners are told which messages they should void)
 		if channelRecord.state == channelClosedState {
-			publish(rq.Id, makeCloseEvent(channelRecord.duration.closed, remainingMessages))
+			sv.subsystem.publish(rq.Id, channelRecord.makeCloseEvent(channelRecord.messages.len()))
+			if len(retractedMessages) > 0 {
+				sv.subsystem.metrics.retractedMessages.Add(float64(len(retractedMessages)))
+				sv.subsystem.publish(rq.Id, channelRecord.makeRetractionEvent(channelRecord.closure, retractedMessages))
+			}
 		}
 
 		// Build object
@@ -219,9 +208,155 @@ func (sv *channelsServer) Work(rqInterface *gofarm.Request) (dummyReturnVal *gof
 		resp.Channel.buildFromRecord(channelRecord)
 	}
 
-	// Log request done
-	log.Debugf(channelsRequestDoneLogMsg)
+	return resp
+}
 
-	var respInterface gofarm.Response = resp
-	return &respInterface
+/*
+	Lists channels matching request (sorted by id)
+	Candidates are channels where certifier (and member if set) are members
+*/
+func (sv *channelsServer) listChannels(rq *ListChannelsRequest) []*ChannelObject {
+	channelIds := getMemberChannelIds(sv.subsystem.membersStore, rq.Signers.CertifierId)
+	if len(rq.Member) != 0 {
+		memberChannels := map[string]bool{}
+		for _, channelId := range getMemberChannelIds(sv.subsystem.membersStore, rq.Member) {
+			memberChannels[channelId] = true
+		}
+		filtered := []string{}
+		for _, channelId := range channelIds {
+			if memberChannels[channelId] {
+				filtered = append(filtered, channelId)
+			}
+		}
+		channelIds = filtered
+	}
+
+	channelObjects := []*ChannelObject{}
+	for _, channelId := range channelIds {
+		channelRecord := getChannel(sv.subsystem.channelsStore, channelId)
+		if channelRecord == nil {
+			continue
+		}
+		channelRecord.RLock()
+		if channelRecord.matchesListRequest(rq) {
+			channelObject := &ChannelObject{}
+			channelObject.buildFromRecord(channelRecord)
+			channelObjects = append(channelObjects, channelObject)
+		}
+		channelRecord.RUnlock()
+	}
+	return channelObjects
+}
+
+/*
+	Opens channel and returns operations buffered until then
+*/
+func (sv *channelsServer) openChannel(rq *OpenChannelRequest, resp *ChannelsResponse) []*core.Operation {
+	channelRecord := createOrGetChannel(sv.subsystem.channelsStore, rq.Channel.Id)
+	channelRecord.Lock()
+	defer func() { channelRecord.Unlock() }()
+
+	// Try to open channel
+	actionRecord := &channelActionRecord{
+		issuerId:    rq.Signers.IssuerId,
+		certifierId: rq.Signers.CertifierId,
+		timestamp:   rq.Timestamp,
+	}
+	permissionsRecord := &channelPermissionsRecord{}
+	permissionsRecord.build(&rq.Channel.Permissions)
+
+	// Key is only added if opening is kept (keys of losing conflicting openings are never added)
+	if rq.KeyAdder != nil && channelRecord.keepsOpening(actionRecord, permissionsRecord, rq.Channel.KeyId) {
+		if err := rq.KeyAdder(rq.Channel.KeyId, rq.Key); err != nil {
+			resp.Result = KeyError
+			return nil
+		}
+	}
+
+	openSuccess := channelRecord.tryOpen(rq.Channel.Id, actionRecord, permissionsRecord, rq.Channel.KeyId)
+	if !openSuccess {
+		resp.Result = ChannelsFailure
+
+		// Conflicting opens are resolved to the winning opening (listeners are told which messages they should void)
+		if retractedMessages, conflicting := channelRecord.tryConflictingOpen(actionRecord, permissionsRecord, rq.Channel.KeyId); conflicting {
+			resp.Result = ChannelsConflict
+			sv.subsystem.indexChannelMembers(channelRecord)
+			sv.subsystem.unsubscribeUnauthorized(channelRecord.id, channelRecord.permissions)
+			sv.subsystem.publish(rq.Channel.Id, makeInconsistentEvent(channelRecord.duration.opened))
+			if len(retractedMessages) > 0 {
+				sv.subsystem.metrics.retractedMessages.Add(float64(len(retractedMessages)))
+				sv.subsystem.publish(rq.Channel.Id, channelRecord.makeRetractionEvent(channelRecord.opening, retractedMessages))
+			}
+			if channelRecord.state == channelClosedState {
+				sv.subsystem.publish(rq.Channel.Id, channelRecord.makeCloseEvent(0))
+			}
+			resp.Channel = &ChannelObject{}
+			resp.Channel.buildFromRecord(channelRecord)
+		}
+		return nil
+	}
+
+	/*
+		Take operations out of buffer
+		Operations buffered from now on are run directly since channel is not in buffered state anymore
+	*/
+	channelBuffer := lockChannelBuffer(sv.subsystem.bufferStore, rq.Channel.Id)
+	bufferedOperations := channelBuffer.operations
+	sv.subsystem.releaseBufferedOperations(channelBuffer)
+	channelBuffer.Unlock()
+
+	// Index members so channel can be listed
+	sv.subsystem.indexChannelMembers(channelRecord)
+
+	// Remove unauthorized listeners
+	sv.subsystem.unsubscribeUnauthorized(channelRecord.id, channelRecord.permissions)
+
+	// Notify (early) listeners of channel opening
+	sv.subsystem.publish(rq.Channel.Id, makeOpenEvent(channelRecord.duration.opened))
+
+	// Apply early closures
+	if channelRecord.applyCloseAttempts() {
+		sv.subsystem.publish(rq.Channel.Id, channelRecord.makeCloseEvent(0))
+	}
+
+	// Build object
+	resp.Channel = &ChannelObject{}
+	resp.Channel.buildFromRecord(channelRecord)
+
+	return bufferedOperations
+}
+
+/*
+	Queues operations concurrently and waits for all of them
+	Arrival order doesn't matter since messages are positioned by their ordering keys
+*/
+func (subsystem *Subsystem) replayBufferedOperations(channelId string, operations []*core.Operation) bool {
+	if len(operations) == 0 {
+		return true
+	}
+
+	var failed int64 = 0
+	wg := &sync.WaitGroup{}
+	wg.Add(len(operations))
+	for _, operation := range operations {
+		go func(operation *core.Operation) {
+			defer wg.Done()
+			respChannel, errs := subsystem.operationQueuer(operation)
+			if len(errs) != 0 {
+				atomic.AddInt64(&failed, 1)
+				return
+			}
+			if _, ok := <-respChannel; !ok {
+				// This occurs when decryptor is shut down prematurely
+				atomic.AddInt64(&failed, 1)
+			}
+		}(operation)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		subsystem.log.Errorf(bufferReplayFailedLogMsg, channelId, failed, len(operations))
+		return false
+	}
+	return true
 }
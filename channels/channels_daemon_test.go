@@ -8,5 +8,5 @@ func TestChannelsStartShutdown(t *testing.T) {
 	if !resetAndStartChannelsServer(t, multipleWorkersChannelsConfig()) {
 		return
 	}
-	shutdownChannelsServer()
+	defaultSubsystem.shutdownChannelsServer()
 }
@@ -2,7 +2,6 @@ package channels
 
 import (
 	"encoding/json"
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"time"
 )
@@ -16,11 +15,30 @@ const (
 	ChannelsSuccess ChannelsStatusCode = iota
 	ChannelsFailure
 	BufferError
+	ChannelsConflict
+	KeyError
 )
 
 type ChannelsResponse struct {
 	Result  ChannelsStatusCode `json:"result"`
 	Channel *ChannelObject     `json:"channel"`
+
+	// Only set for list channels requests
+	Channels []*ChannelObject `json:"channels,omitempty"`
+}
+
+/*
+	Errors corresponding to failed channel action results
+*/
+var channelsResultErrors map[ChannelsStatusCode]error = map[ChannelsStatusCode]error{
+	ChannelsFailure:  core.NewError(core.ChannelActionFailedErrorCode, "Channel action failed."),
+	BufferError:      core.NewError(core.BufferFailedErrorCode, "Replaying buffered operations failed."),
+	ChannelsConflict: core.NewError(core.ChannelActionFailedErrorCode, "Channel was opened differently (earliest opening is kept)."),
+	KeyError:         core.NewError(core.InvalidKeyErrorCode, "Adding channel key failed."),
+}
+
+func (resp *ChannelsResponse) GetError() error {
+	return channelsResultErrors[resp.Result]
 }
 
 // *ChannelsResponse -> Json
@@ -62,7 +80,53 @@ func (rq *ReadChannelRequest) Decode(stream []byte) error {
 */
 func (rq *ReadChannelRequest) sanitizeAndValidate() error {
 	if len(rq.Id) == 0 {
-		return errors.New("Read channel request is invalid.")
+		return core.NewError(core.InvalidRequestErrorCode, "Read channel request is invalid.")
+	}
+	return nil
+}
+
+/*
+	Structure for list channels request
+	Only channels the certifier can read are listed (filters are ignored if not set)
+	Buffered channels have no permissions yet, so they are only listed for certifiers of their pending closure attempts
+*/
+type ListChannelsRequest struct {
+	Member       string             `json:"member"`
+	State        ChannelObjectState `json:"state"`
+	OpenedAfter  time.Time          `json:"openedAfter"`
+	OpenedBefore time.Time          `json:"openedBefore"`
+	Signers      *core.VerifiedSigners
+}
+
+// *ListChannelsRequest -> Json
+func (rq *ListChannelsRequest) Encode() ([]byte, error) {
+	jsonStream, err := json.Marshal(rq)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonStream, nil
+}
+
+// Json -> *ListChannelsRequest
+func (rq *ListChannelsRequest) Decode(stream []byte) error {
+	return json.Unmarshal(stream, rq)
+}
+
+/*
+	Validates and sanitizes request
+*/
+func (rq *ListChannelsRequest) sanitizeAndValidate() error {
+	validState := len(rq.State) == 0
+	for _, state := range objectStateMapping {
+		validState = validState || rq.State == state
+	}
+	if rq.Signers == nil ||
+		len(rq.Signers.CertifierId) == 0 ||
+		!validState ||
+		!rq.OpenedAfter.IsZero() && !rq.OpenedBefore.IsZero() && !rq.OpenedAfter.Before(rq.OpenedBefore) {
+		return core.NewError(core.InvalidRequestErrorCode, "List channels request is invalid.")
 	}
 	return nil
 }
@@ -75,6 +139,9 @@ type OpenChannelRequest struct {
 	Signers   *core.VerifiedSigners
 	Key       []byte    `json:"key"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Used to add key if opening is kept (before buffered operations are run)
+	KeyAdder core.KeyAdder `json:"-"`
 }
 
 // *OpenChannelRequest -> Json
@@ -102,7 +169,7 @@ func (rq *OpenChannelRequest) sanitizeAndValidate() error {
 		len(rq.Channel.KeyId) == 0 ||
 		len(rq.Channel.Permissions.Users) == 0 ||
 		len(rq.Key) == 0 {
-		return errors.New("Open channel request is invalid.")
+		return core.NewError(core.InvalidRequestErrorCode, "Open channel request is invalid.")
 	}
 	return nil
 }
@@ -111,9 +178,10 @@ func (rq *OpenChannelRequest) sanitizeAndValidate() error {
 	Structure for close channel request
 */
 type CloseChannelRequest struct {
-	Id        string
-	Signers   *core.VerifiedSigners
-	Timestamp time.Time `json:"timestamp"`
+	Id          string
+	Signers     *core.VerifiedSigners
+	Timestamp   time.Time `json:"timestamp"`
+	VectorClock core.VectorClock
 }
 
 // *CloseChannelRequest -> Json
@@ -137,7 +205,7 @@ func (rq *CloseChannelRequest) Decode(stream []byte) error {
 */
 func (rq *CloseChannelRequest) sanitizeAndValidate() error {
 	if len(rq.Id) == 0 {
-		return errors.New("Close channel request is invalid.")
+		return core.NewError(core.InvalidRequestErrorCode, "Close channel request is invalid.")
 	}
 	return nil
 }
@@ -5,14 +5,65 @@
 package channels
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/memstore"
 	"sync"
 )
 
-var (
+/*
+	Channels instance (package functions use a default instance)
+*/
+type Subsystem struct {
+	channelsServer  *channelsServer
+	messagesServer  *messagesServer
+	listenersServer *listenersServer
+
+	// Stores shared by servers
+	channelsStore  *memstore.Memstore
+	bufferStore    *memstore.Memstore
+	membersStore   *memstore.Memstore
+	listenersStore *sync.Map
+
+	// Operations buffered across all channels
+	bufferedOperations int64
+
+	// Used to run operations (buffered operations are run once their channel opens)
+	operationQueuer core.OperationQueuer
+
+	// Logging and fatal error handling
 	log             *core.LoggingHandler
 	shutdownProgram core.ShutdownLambda
-)
+
+	// Request and channel state metrics
+	metrics *subsystemMetrics
+}
+
+func NewSubsystem(metricsRegistry *core.MetricsRegistry) *Subsystem {
+	subsystem := &Subsystem{
+		metrics: newSubsystemMetrics(metricsRegistry),
+	}
+	subsystem.channelsServer = &channelsServer{
+		subsystem: subsystem,
+		handler:   core.ProvisionServer(),
+	}
+	subsystem.messagesServer = &messagesServer{
+		subsystem: subsystem,
+		handler:   core.ProvisionServer(),
+	}
+	subsystem.listenersServer = &listenersServer{
+		subsystem: subsystem,
+		handler:   core.ProvisionServer(),
+	}
+	return subsystem
+}
+
+var defaultSubsystem *Subsystem = NewSubsystem(core.Metrics)
+
+// Instance used by package functions
+func DefaultSubsystem() *Subsystem {
+	return defaultSubsystem
+}
 
 /*
 	Servers API
@@ -25,25 +76,120 @@ func StartServers(
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) error {
-	log = loggingHandler
-	shutdownProgram = shutdownLambda
+	return defaultSubsystem.StartServers(channelsConfig, messagesConfig, listenersConfig, operationQueuer, loggingHandler, shutdownLambda)
+}
+
+func ShutdownServers() {
+	defaultSubsystem.ShutdownServers()
+}
+
+func ResizeServers(
+	channelsConfig ChannelsServerConfig,
+	messagesConfig MessagesServerConfig,
+	listenersConfig ListenersServerConfig,
+) error {
+	return defaultSubsystem.ResizeServers(channelsConfig, messagesConfig, listenersConfig)
+}
+
+func IsRunning() bool {
+	return defaultSubsystem.IsRunning()
+}
+
+func ChannelAction(ctx context.Context, request interface{}) (chan *ChannelsResponse, error) {
+	return defaultSubsystem.ChannelAction(ctx, request)
+}
+
+func AddMessage(ctx context.Context, request *AddMessageRequest) (chan *MessagesResponse, error) {
+	return defaultSubsystem.AddMessage(ctx, request)
+}
+
+func BufferOperation(ctx context.Context, request *BufferOperationRequest) (chan *MessagesResponse, error) {
+	return defaultSubsystem.BufferOperation(ctx, request)
+}
+
+func ListenerAction(ctx context.Context, request interface{}) (chan *ListenersResponse, error) {
+	return defaultSubsystem.ListenerAction(ctx, request)
+}
+
+/*
+	Instance API
+*/
+func (subsystem *Subsystem) StartServers(
+	channelsConfig ChannelsServerConfig,
+	messagesConfig MessagesServerConfig,
+	listenersConfig ListenersServerConfig,
+	operationQueuer core.OperationQueuer,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) error {
+	subsystem.log = loggingHandler
+	subsystem.shutdownProgram = shutdownLambda
 	serversWaitGroup := &sync.WaitGroup{}
 	serversWaitGroup.Add(3)
-	if err := startChannelsServer(channelsConfig, serversWaitGroup); err != nil {
+	if err := subsystem.startChannelsServer(channelsConfig, serversWaitGroup); err != nil {
 		return err
 	}
-	if err := startMessagesServer(messagesConfig, operationQueuer, serversWaitGroup); err != nil {
+	if err := subsystem.startMessagesServer(messagesConfig, operationQueuer, serversWaitGroup); err != nil {
 		return err
 	}
-	if err := startListenersServer(listenersConfig, serversWaitGroup); err != nil {
+	if err := subsystem.startListenersServer(listenersConfig, serversWaitGroup); err != nil {
 		return err
 	}
 	serversWaitGroup.Wait()
 	return nil
 }
 
-func ShutdownServers() {
-	shutdownListenersServer()
-	shutdownMessagesServer()
-	shutdownChannelsServer()
+func (subsystem *Subsystem) ShutdownServers() {
+	subsystem.shutdownListenersServer()
+	subsystem.shutdownMessagesServer()
+	subsystem.shutdownChannelsServer()
+}
+
+// Running requests are not dropped
+func (subsystem *Subsystem) ResizeServers(
+	channelsConfig ChannelsServerConfig,
+	messagesConfig MessagesServerConfig,
+	listenersConfig ListenersServerConfig,
+) error {
+	if err := subsystem.resizeChannelsServer(channelsConfig); err != nil {
+		return err
+	}
+	if err := subsystem.resizeMessagesServer(messagesConfig); err != nil {
+		return err
+	}
+	return subsystem.resizeListenersServer(listenersConfig)
+}
+
+// All servers are running
+func (subsystem *Subsystem) IsRunning() bool {
+	return subsystem.channelsServer.state.IsRunning() &&
+		subsystem.messagesServer.state.IsRunning() &&
+		subsystem.listenersServer.state.IsRunning()
+}
+
+/*
+	Logging handler with request fields
+*/
+func (subsystem *Subsystem) requestLogger(request interface{}) *core.LoggingHandler {
+	var channelId string
+	switch rq := request.(type) {
+	case *ReadChannelRequest:
+		channelId = rq.Id
+	case *OpenChannelRequest:
+		channelId = rq.Channel.Id
+	case *CloseChannelRequest:
+		channelId = rq.Id
+	case *AddMessageRequest:
+		channelId = rq.ChannelId
+	case *BufferOperationRequest:
+		channelId = rq.Operation.Meta.ChannelId
+	case *SubscribeRequest:
+		channelId = rq.ChannelId
+	case *UnsubscribeRequest:
+		channelId = rq.ChannelId
+	}
+	return subsystem.log.With(
+		core.RequestTypeLogField, requestTypeLabel(request),
+		core.ChannelLogField, channelId,
+	)
 }
@@ -2,6 +2,7 @@ package channels
 
 import (
 	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
 	"time"
 )
 
@@ -12,9 +13,11 @@ import (
 type EventType string
 
 const (
-	Open    EventType = "channel_open"
-	Message EventType = "new_message"
-	Close   EventType = "channel_close"
+	Open         EventType = "channel_open"
+	Message      EventType = "new_message"
+	Close        EventType = "channel_close"
+	Inconsistent EventType = "channel_inconsistent"
+	Retraction   EventType = "messages_retracted"
 )
 
 /*
@@ -26,6 +29,15 @@ type Event struct {
 	Position  int       `json:"position"`
 	Timestamp time.Time `json:"timestamp"`
 	Data      []byte    `json:"data"`
+
+	// Signers of the message (only set for message events)
+	Signers *core.VerifiedSigners `json:"signers,omitempty"`
+
+	// Causal metadata of the message or closure (if set by its operation)
+	VectorClock core.VectorClock `json:"vectorClock,omitempty"`
+
+	// Hashes of messages retracted by closure in channel order (only set for retraction events)
+	Retracted [][]byte `json:"retracted,omitempty"`
 }
 
 /*
@@ -62,11 +74,48 @@ func makeCloseEvent(timestamp time.Time, validMessages int) *Event {
 	}
 }
 
-func makeMessageEvent(timestamp time.Time, position int, message []byte) *Event {
+// Timestamp is the opening kept after resolving conflicting opens
+func makeInconsistentEvent(timestamp time.Time) *Event {
+	return &Event{
+		Type:      Inconsistent,
+		Position:  0,
+		Timestamp: timestamp,
+		Data:      nil,
+	}
+}
+
+// Close event from closed channel record
+func (rec *channelRecord) makeCloseEvent(validMessages int) *Event {
+	event := makeCloseEvent(rec.duration.closed, validMessages)
+	event.VectorClock = rec.closure.clock.Copy()
+	return event
+}
+
+/*
+	Retraction event from channel record after closing or a conflicting opening
+	Position is the position of the first retracted message (messages kept by channel)
+*/
+func (rec *channelRecord) makeRetractionEvent(action *channelActionRecord, retracted []messageKey) *Event {
+	hashes := make([][]byte, len(retracted))
+	for i := range retracted {
+		hashes[i] = retracted[i].hash
+	}
+	return &Event{
+		Type:        Retraction,
+		Position:    rec.messages.len(),
+		Timestamp:   action.timestamp,
+		Data:        nil,
+		VectorClock: action.clock.Copy(),
+		Retracted:   hashes,
+	}
+}
+
+func makeMessageEvent(timestamp time.Time, position int, signers *core.VerifiedSigners, message []byte) *Event {
 	return &Event{
 		Type:      Message,
 		Position:  position,
 		Timestamp: timestamp,
 		Data:      message,
+		Signers:   signers,
 	}
 }
@@ -95,7 +95,7 @@ func startChannelsServerAndTest(t *testing.T, conf ChannelsServerConfig) bool {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	defer wg.Wait()
-	if err := startChannelsServer(conf, wg); err != nil {
+	if err := defaultSubsystem.startChannelsServer(conf, wg); err != nil {
 		t.Errorf(err.Error())
 		return false
 	}
@@ -103,7 +103,7 @@ func startChannelsServerAndTest(t *testing.T, conf ChannelsServerConfig) bool {
 }
 
 func resetAndStartChannelsServer(t *testing.T, conf ChannelsServerConfig) bool {
-	channelsServerSingleton = channelsServer{}
+	defaultSubsystem.channelsServer.isInitialized = false
 	return startChannelsServerAndTest(t, conf)
 }
 
@@ -149,6 +149,33 @@ func createDummyOperationQueuerFunctor(ticketReturned status.Ticket, errsReturne
 	return requester, callsChannel
 }
 
+// Responds once all expected operations are queued (fails them after timeout)
+func createBarrierOperationQueuerFunctor(ticketReturned status.Ticket, expectedCalls int, timeout time.Duration) core.OperationQueuer {
+	callsLock := &sync.Mutex{}
+	calls := 0
+	release := make(chan bool)
+	return func(operation *core.Operation) (chan *gofarm.Response, []error) {
+		callsLock.Lock()
+		calls++
+		if calls == expectedCalls {
+			close(release)
+		}
+		callsLock.Unlock()
+
+		responseChannel := make(chan *gofarm.Response)
+		go func() {
+			select {
+			case <-release:
+				var ticketGeneric gofarm.Response = ticketReturned
+				responseChannel <- &ticketGeneric
+			case <-time.After(timeout):
+				close(responseChannel)
+			}
+		}()
+		return responseChannel, nil
+	}
+}
+
 /*
 	Messages server utilities
 */
@@ -157,7 +184,7 @@ func startMessagesServerAndTest(t *testing.T, conf MessagesServerConfig, operati
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	defer wg.Wait()
-	if err := startMessagesServer(conf, operationQueuer, wg); err != nil {
+	if err := defaultSubsystem.startMessagesServer(conf, operationQueuer, wg); err != nil {
 		t.Errorf(err.Error())
 		return false
 	}
@@ -165,7 +192,7 @@ func startMessagesServerAndTest(t *testing.T, conf MessagesServerConfig, operati
 }
 
 func resetAndStartMessagesServer(t *testing.T, conf MessagesServerConfig, operationQueuer core.OperationQueuer) bool {
-	messagesServerSingleton = messagesServer{}
+	defaultSubsystem.messagesServer.isInitialized = false
 	return startMessagesServerAndTest(t, conf, operationQueuer)
 }
 
@@ -219,7 +246,7 @@ func startListenersServerAndTest(t *testing.T, conf ListenersServerConfig) bool
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	defer wg.Wait()
-	if err := startListenersServer(conf, wg); err != nil {
+	if err := defaultSubsystem.startListenersServer(conf, wg); err != nil {
 		t.Errorf(err.Error())
 		return false
 	}
@@ -227,7 +254,7 @@ func startListenersServerAndTest(t *testing.T, conf ListenersServerConfig) bool
 }
 
 func resetAndStartListenersServer(t *testing.T, conf ListenersServerConfig) bool {
-	listenersServerSingleton = listenersServer{}
+	defaultSubsystem.listenersServer.isInitialized = false
 	return startListenersServerAndTest(t, conf)
 }
 
@@ -238,7 +265,7 @@ func multipleWorkersListenersConfig() ListenersServerConfig {
 }
 
 func waitUntilEmpty(id string) {
-	listenersRecInterface, _ := listenersStore.Load(id)
+	listenersRecInterface, _ := defaultSubsystem.listenersStore.Load(id)
 	listenersRecInterface.(*listenersRecord).eventQueue.WaitUntilEmpty()
 }
 
@@ -255,8 +282,8 @@ func startBothServersAndTest(t *testing.T, channelsConf ChannelsServerConfig, me
 }
 
 func resetAndStartBothServers(t *testing.T, channelsConf ChannelsServerConfig, messagesConf MessagesServerConfig, listenersConf ListenersServerConfig, operationQueuer core.OperationQueuer) bool {
-	channelsServerSingleton = channelsServer{}
-	messagesServerSingleton = messagesServer{}
-	listenersServerSingleton = listenersServer{}
+	defaultSubsystem.channelsServer.isInitialized = false
+	defaultSubsystem.messagesServer.isInitialized = false
+	defaultSubsystem.listenersServer.isInitialized = false
 	return startBothServersAndTest(t, channelsConf, messagesConf, listenersConf, operationQueuer)
 }
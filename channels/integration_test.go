@@ -6,6 +6,8 @@
 package channels
 
 import (
+	"context"
+	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/status"
 	"reflect"
@@ -88,7 +90,7 @@ func makeGenericAddMessageRequest(channelId string, time time.Time, userId strin
 }
 
 func makeAddMessageRequestAndWait(t *testing.T, request *AddMessageRequest) *MessagesResponse {
-	channel, err := AddMessage(request)
+	channel, err := AddMessage(context.Background(), request)
 	if err != nil {
 		t.Errorf("Valid add message request should not be rejected. err=%+v", err)
 	}
@@ -97,7 +99,7 @@ func makeAddMessageRequestAndWait(t *testing.T, request *AddMessageRequest) *Mes
 }
 
 func makeBufferOperationRequestAndWait(t *testing.T, request *BufferOperationRequest) *MessagesResponse {
-	channel, err := BufferOperation(request)
+	channel, err := BufferOperation(context.Background(), request)
 	if err != nil {
 		t.Errorf("Valid buffer operation request should not be rejected. err=%+v", err)
 	}
@@ -106,7 +108,7 @@ func makeBufferOperationRequestAndWait(t *testing.T, request *BufferOperationReq
 }
 
 func makeListenersRequestAndWait(t *testing.T, request interface{}) *ListenersResponse {
-	channel, err := ListenerAction(request)
+	channel, err := ListenerAction(context.Background(), request)
 	if err != nil {
 		t.Errorf("Valid listeners action request should not be rejected. err=%+v", err)
 	}
@@ -115,7 +117,7 @@ func makeListenersRequestAndWait(t *testing.T, request interface{}) *ListenersRe
 }
 
 func makeChannelsRequestAndWait(t *testing.T, request interface{}) *ChannelsResponse {
-	channel, err := ChannelAction(request)
+	channel, err := ChannelAction(context.Background(), request)
 	if err != nil {
 		t.Errorf("Valid channels action request should not be rejected. err=%+v", err)
 	}
@@ -374,12 +376,16 @@ func TestFullIntegration(t *testing.T) {
 	}
 
 	// Expect 5 events to be read in early subscriber: opening, early close, after opening closing, 2 messages
+	genericWriterSigners := &core.VerifiedSigners{
+		IssuerId:    genericWriterId,
+		CertifierId: genericWriterId,
+	}
 	eventsExpected := []*Event{
 		makeOpenEvent(openingTime),
 		makeCloseEvent(twoHoursAfterOpeningTime, 0),
 		makeCloseEvent(hourAfterOpeningTime, 0),
-		makeMessageEvent(minuteAfterOpeningTime, 0, genericMessages[2]),
-		makeMessageEvent(twoMinutesAfterOpeningTime, 1, genericMessages[3]),
+		makeMessageEvent(minuteAfterOpeningTime, 0, genericWriterSigners, genericMessages[2]),
+		makeMessageEvent(twoMinutesAfterOpeningTime, 1, genericWriterSigners, genericMessages[3]),
 	}
 	for i := 0; i < len(eventsExpected); i++ {
 		event := <-earlyValidSubResp.Channel
@@ -417,7 +423,7 @@ func TestFullIntegration(t *testing.T) {
 	}
 
 	// Expect to only send one message event in both subscribers
-	expectedPos0MessageEvent := makeMessageEvent(secondAfterOpeningTime, 0, genericMessages[5])
+	expectedPos0MessageEvent := makeMessageEvent(secondAfterOpeningTime, 0, genericWriterSigners, genericMessages[5])
 	subscriberChannels := []EventChannel{earlyValidSubResp.Channel, afterClosureValidSubResp.Channel}
 	for subscriberIdx, subscriberChannel := range subscriberChannels {
 		event, ok := <-subscriberChannel
@@ -438,21 +444,37 @@ func TestFullIntegration(t *testing.T) {
 		t.Errorf("Third closure attempt should succeed. response=%+v", thirdCloseResp)
 	}
 
-	// Expect to only send a close event in both subscribers
+	// Expect to only send a close event and a retraction of later messages in both subscribers
 	expectedThirdCloseEvent := makeCloseEvent(twoSecondsAfterOpeningTime, 1)
+	expectedRetractionEvent := &Event{
+		Type:      Retraction,
+		Position:  1,
+		Timestamp: twoSecondsAfterOpeningTime,
+		Retracted: [][]byte{core.Hash(genericMessages[2]), core.Hash(genericMessages[3])},
+	}
 	for subscriberIdx, subscriberChannel := range subscriberChannels {
 		event, ok := <-subscriberChannel
 		if !ok || !reflect.DeepEqual(event, expectedThirdCloseEvent) {
 			t.Errorf("Subscribers need to be notified of third closure. subscriberIdx=%v, event=%+v, expected=%+v", subscriberIdx, event, expectedThirdCloseEvent)
 		}
+		event, ok = <-subscriberChannel
+		if !ok || !reflect.DeepEqual(event, expectedRetractionEvent) {
+			t.Errorf("Subscribers need to be notified of retracted messages. subscriberIdx=%v, event=%+v, expected=%+v", subscriberIdx, event, expectedRetractionEvent)
+		}
 		select {
 		case <-subscriberChannel:
-			t.Errorf("Subscriber should only get one close event.")
+			t.Errorf("Subscriber should only get one close and one retraction event.")
 		default:
 			break
 		}
 	}
 
+	// Retracted messages can't be added again
+	retractedAddMessageResp := makeAddMessageRequestAndWait(t, afterOpeningPos1AddMessageReq)
+	if retractedAddMessageResp.Result != MessagesDropped {
+		t.Errorf("Adding retracted message again should be dropped. response=%+v", retractedAddMessageResp)
+	}
+
 	// Unsubscribe request to automatically unsubscribed
 	invalidIdUnsubscribeReq := makeGenericUnsubscribeRequest(genericChannelId, earlyUnauthorizedSubResp.SubscriberId)
 	invalidIdUnsubscribeResp := makeListenersRequestAndWait(t, invalidIdUnsubscribeReq)
@@ -596,3 +618,439 @@ func TestReadRequest(t *testing.T) {
 
 	ShutdownServers()
 }
+
+func TestConflictingOpenRequest(t *testing.T) {
+	operationQueuerDummy, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, false)
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), multipleWorkersMessagesConfig(), multipleWorkersListenersConfig(), operationQueuerDummy) {
+		return
+	}
+
+	perms := ChannelPermissionsObject{
+		Users: map[string]ChannelPermissionObject{
+			genericReaderId: {
+				Read:  true,
+				Write: false,
+				Close: false,
+			},
+			genericWriterId: {
+				Read:  false,
+				Write: true,
+				Close: false,
+			},
+		},
+	}
+	addedKeyIds := []string{}
+	keyAdder := func(keyId string, key []byte) error {
+		addedKeyIds = append(addedKeyIds, keyId)
+		return nil
+	}
+	makeOpenRequest := func(issuerId string, keyId string, timestamp time.Time) *OpenChannelRequest {
+		return &OpenChannelRequest{
+			Channel: &ChannelObject{
+				Id:          genericChannelId,
+				KeyId:       keyId,
+				Permissions: perms,
+			},
+			Signers: &core.VerifiedSigners{
+				IssuerId:    issuerId,
+				CertifierId: issuerId,
+			},
+			Key:       generateRandomBytes(core.SymmetricKeySize),
+			Timestamp: timestamp,
+			KeyAdder:  keyAdder,
+		}
+	}
+
+	// Open channel
+	openResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericNoopId, genericKeyId, openingTime))
+	if openResp.Result != ChannelsSuccess {
+		t.Errorf("Opening request should succeed. response=%+v", openResp)
+	}
+	subResp := makeListenersRequestAndWait(t, makeGenericSubscribeRequest(genericChannelId, genericReaderId))
+	if subResp.Result != ListenersSuccess {
+		t.Errorf("Subscribe request should succeed. response=%+v", subResp)
+	}
+
+	// Add message before any conflict
+	messageResp := makeAddMessageRequestAndWait(t, makeGenericAddMessageRequest(genericChannelId, hourAfterOpeningTime, genericWriterId, []byte("message")))
+	if messageResp.Result != MessagesSuccess {
+		t.Errorf("Adding message to open channel should succeed. response=%+v", messageResp)
+	}
+	if event := <-subResp.Channel; event.Type != Message {
+		t.Errorf("Subscriber should be notified of message. event=%+v", event)
+	}
+
+	// Opening again the same way is not a conflict
+	sameOpenResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericNoopId, genericKeyId, openingTime))
+	if sameOpenResp.Result != ChannelsFailure {
+		t.Errorf("Opening the same channel again should fail. response=%+v", sameOpenResp)
+	}
+
+	// Later conflicting opening is not kept
+	conflictingKeyId := genericKeyId + "_conflict"
+	laterOpenResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericNoopId, conflictingKeyId, hourAfterOpeningTime))
+	expectedObject := &ChannelObject{
+		Id:          genericChannelId,
+		KeyId:       genericKeyId,
+		Permissions: perms,
+		State:       ChannelObjectOpenState,
+	}
+	if laterOpenResp.Result != ChannelsConflict ||
+		!reflect.DeepEqual(laterOpenResp.Channel, expectedObject) {
+		t.Errorf("Later conflicting open should keep first opening. response=%+v, expected=%+v", laterOpenResp.Channel, expectedObject)
+	}
+
+	// Earlier conflicting opening is kept
+	earlierOpenResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericNoopId, conflictingKeyId, beforeOpeningTime))
+	expectedObject.KeyId = conflictingKeyId
+	if earlierOpenResp.Result != ChannelsConflict ||
+		!reflect.DeepEqual(earlierOpenResp.Channel, expectedObject) {
+		t.Errorf("Earlier conflicting open should be kept. response=%+v, expected=%+v", earlierOpenResp.Channel, expectedObject)
+	}
+
+	// Only keys of openings kept are added
+	if !reflect.DeepEqual(addedKeyIds, []string{genericKeyId, conflictingKeyId}) {
+		t.Errorf("Keys of conflicting openings not kept should not be added. addedKeyIds=%v", addedKeyIds)
+	}
+
+	// Channel stays usable under opening kept
+	addMessageResp := makeAddMessageRequestAndWait(t, makeGenericAddMessageRequest(genericChannelId, hourAfterOpeningTime, genericWriterId, []byte("message")))
+	if addMessageResp.Result != MessagesSuccess {
+		t.Errorf("Adding message after conflict is resolved should succeed. response=%+v", addMessageResp)
+	}
+
+	// Subscriber is notified of each conflict (message accepted before the first one is retracted)
+	eventsExpected := []*Event{
+		makeInconsistentEvent(openingTime),
+		{
+			Type:      Retraction,
+			Position:  0,
+			Timestamp: openingTime,
+			Retracted: [][]byte{core.Hash([]byte("message"))},
+		},
+		makeInconsistentEvent(beforeOpeningTime),
+	}
+	for i := 0; i < len(eventsExpected); i++ {
+		event := <-subResp.Channel
+		if !reflect.DeepEqual(event, eventsExpected[i]) {
+			t.Errorf("Subscriber event #%v does not match. event=%+v, expected=%+v", i, event, eventsExpected[i])
+		}
+	}
+	if event := <-subResp.Channel; event.Type != Message {
+		t.Errorf("Subscriber should be notified of message added after conflict. event=%+v", event)
+	}
+
+	ShutdownServers()
+}
+
+func TestClosureRetractionArrivalOrder(t *testing.T) {
+	operationQueuerDummy, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, false)
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), multipleWorkersMessagesConfig(), multipleWorkersListenersConfig(), operationQueuerDummy) {
+		return
+	}
+	defer ShutdownServers()
+
+	openChannel := func(channelId string) EventChannel {
+		openResp := makeChannelsRequestAndWait(t, &OpenChannelRequest{
+			Channel: &ChannelObject{
+				Id:    channelId,
+				KeyId: genericKeyId,
+				Permissions: ChannelPermissionsObject{
+					Users: map[string]ChannelPermissionObject{
+						genericReaderId: {Read: true},
+						genericWriterId: {Write: true},
+						genericCloserId: {Close: true},
+					},
+				},
+			},
+			Signers: &core.VerifiedSigners{
+				IssuerId:    genericNoopId,
+				CertifierId: genericNoopId,
+			},
+			Key:       generateRandomBytes(core.SymmetricKeySize),
+			Timestamp: openingTime,
+		})
+		if openResp.Result != ChannelsSuccess {
+			t.Errorf("Opening request should succeed. response=%+v", openResp)
+		}
+		subResp := makeListenersRequestAndWait(t, makeGenericSubscribeRequest(channelId, genericReaderId))
+		if subResp.Result != ListenersSuccess {
+			t.Errorf("Subscribe request should succeed. response=%+v", subResp)
+		}
+		return subResp.Channel
+	}
+	message := []byte("message at closure")
+	writerSigners := &core.VerifiedSigners{
+		IssuerId:    genericWriterId,
+		CertifierId: genericWriterId,
+	}
+	expectEvents := func(channelId string, events EventChannel, eventsExpected []*Event) {
+		for i := 0; i < len(eventsExpected); i++ {
+			event := <-events
+			if !reflect.DeepEqual(event, eventsExpected[i]) {
+				t.Errorf("Subscriber event #%v does not match. event=%+v, expected=%+v", i, event, eventsExpected[i])
+			}
+		}
+		waitUntilEmpty(channelId)
+		select {
+		case event := <-events:
+			t.Errorf("Subscriber should not get more events. event=%+v", event)
+		default:
+		}
+	}
+
+	// Message at closure timestamp then closure (message is retracted)
+	addFirstId := genericChannelId + "_add_first"
+	addFirstEvents := openChannel(addFirstId)
+	if resp := makeAddMessageRequestAndWait(t, makeGenericAddMessageRequest(addFirstId, hourAfterOpeningTime, genericWriterId, message)); resp.Result != MessagesSuccess {
+		t.Errorf("Adding message before closure arrives should succeed. response=%+v", resp)
+	}
+	if resp := makeChannelsRequestAndWait(t, makeGenericCloseRequest(addFirstId, genericCloserId, hourAfterOpeningTime)); resp.Result != ChannelsSuccess {
+		t.Errorf("Closing channel should succeed. response=%+v", resp)
+	}
+	expectEvents(addFirstId, addFirstEvents, []*Event{
+		makeMessageEvent(hourAfterOpeningTime, 0, writerSigners, message),
+		makeCloseEvent(hourAfterOpeningTime, 0),
+		{
+			Type:      Retraction,
+			Position:  0,
+			Timestamp: hourAfterOpeningTime,
+			Retracted: [][]byte{core.Hash(message)},
+		},
+	})
+
+	// Closure then message at closure timestamp (message is dropped and never published)
+	closeFirstId := genericChannelId + "_close_first"
+	closeFirstEvents := openChannel(closeFirstId)
+	if resp := makeChannelsRequestAndWait(t, makeGenericCloseRequest(closeFirstId, genericCloserId, hourAfterOpeningTime)); resp.Result != ChannelsSuccess {
+		t.Errorf("Closing channel should succeed. response=%+v", resp)
+	}
+	if resp := makeAddMessageRequestAndWait(t, makeGenericAddMessageRequest(closeFirstId, hourAfterOpeningTime, genericWriterId, message)); resp.Result != MessagesDropped {
+		t.Errorf("Adding message at closure timestamp after closure should be dropped. response=%+v", resp)
+	}
+	expectEvents(closeFirstId, closeFirstEvents, []*Event{
+		makeCloseEvent(hourAfterOpeningTime, 0),
+	})
+}
+
+func TestBufferReplay(t *testing.T) {
+	makeOpenRequest := func(channelId string) *OpenChannelRequest {
+		return &OpenChannelRequest{
+			Channel: &ChannelObject{
+				Id:    channelId,
+				KeyId: genericKeyId,
+				Permissions: ChannelPermissionsObject{
+					Users: map[string]ChannelPermissionObject{
+						genericReaderId: {Read: true},
+					},
+				},
+			},
+			Signers: &core.VerifiedSigners{
+				IssuerId:    genericNoopId,
+				CertifierId: genericNoopId,
+			},
+			Key:       generateRandomBytes(core.SymmetricKeySize),
+			Timestamp: openingTime,
+		}
+	}
+	bufferOperations := func(channelId string, operationsNumber int) {
+		for i := 0; i < operationsNumber; i++ {
+			if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(channelId)); resp.Result != MessagesSuccess {
+				t.Errorf("Buffering operation should succeed. response=%+v", resp)
+			}
+		}
+	}
+
+	// Buffered operations only get a response once all of them are queued (so replay must be concurrent)
+	operationsNumber := 20
+	barrierQueuer := createBarrierOperationQueuerFunctor(status.RequestNewTicket(), operationsNumber, time.Second)
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), multipleWorkersMessagesConfig(), multipleWorkersListenersConfig(), barrierQueuer) {
+		return
+	}
+	bufferOperations(genericChannelId, operationsNumber)
+	openResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericChannelId))
+	if openResp.Result != ChannelsSuccess {
+		t.Errorf("Opening request should succeed after replaying buffer. response=%+v", openResp)
+	}
+	if stats, _ := Admin(&AdminRequest{Action: BufferStatsAction}); stats.BufferedOperations != 0 {
+		t.Errorf("Replayed operations should not be buffered anymore. stats=%+v", stats)
+	}
+	ShutdownServers()
+
+	// Failed replay is reported but channel stays open
+	failingQueuer, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, true)
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), multipleWorkersMessagesConfig(), multipleWorkersListenersConfig(), failingQueuer) {
+		return
+	}
+	bufferOperations(genericChannelId, 2)
+	failedOpenResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericChannelId))
+	if failedOpenResp.Result != BufferError {
+		t.Errorf("Opening request should report failed replay. response=%+v", failedOpenResp)
+	}
+	readResp := makeChannelsRequestAndWait(t, makeGenericReadRequest(genericChannelId))
+	if readResp.Result != ChannelsSuccess || readResp.Channel.State != ChannelObjectOpenState {
+		t.Errorf("Channel should be open even if replay failed. response=%+v", readResp)
+	}
+	if stats, _ := Admin(&AdminRequest{Action: BufferStatsAction}); stats.BufferedOperations != 0 {
+		t.Errorf("Operations that failed to replay should not be buffered anymore. stats=%+v", stats)
+	}
+	ShutdownServers()
+
+	// Operation buffered after opening is queued directly (queuing errors are reported)
+	rejectingQueuer, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), []error{errors.New("Queuing failed")}, false)
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), multipleWorkersMessagesConfig(), multipleWorkersListenersConfig(), rejectingQueuer) {
+		return
+	}
+	if openResp := makeChannelsRequestAndWait(t, makeOpenRequest(genericChannelId)); openResp.Result != ChannelsSuccess {
+		t.Errorf("Opening request should succeed. response=%+v", openResp)
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesBufferError {
+		t.Errorf("Operation that failed to be queued should report buffer error. response=%+v", resp)
+	}
+	ShutdownServers()
+}
+
+func TestListChannelsRequest(t *testing.T) {
+	operationQueuerDummy, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, false)
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), multipleWorkersMessagesConfig(), multipleWorkersListenersConfig(), operationQueuerDummy) {
+		return
+	}
+	defer ShutdownServers()
+
+	// Reader and writer share first channel, reader can only read second one, writer can only read third one
+	firstChannelId := genericChannelId + "_1"
+	secondChannelId := genericChannelId + "_2"
+	thirdChannelId := genericChannelId + "_3"
+	fourthChannelId := genericChannelId + "_4"
+	bufferedChannelId := genericChannelId + "_buffered"
+	channelsPermissions := map[string]map[string]ChannelPermissionObject{
+		firstChannelId: {
+			genericReaderId: {Read: true},
+			genericWriterId: {Write: true},
+		},
+		secondChannelId: {
+			genericReaderId: {Read: true},
+			genericCloserId: {Close: true},
+		},
+		thirdChannelId: {
+			genericWriterId: {Read: true, Write: true},
+		},
+		fourthChannelId: {
+			genericReaderId: {Read: true},
+		},
+	}
+	channelsOpeningTime := map[string]time.Time{
+		firstChannelId:  openingTime,
+		secondChannelId: hourAfterOpeningTime,
+		thirdChannelId:  openingTime,
+		fourthChannelId: twoHoursAfterOpeningTime,
+	}
+	for _, channelId := range []string{firstChannelId, secondChannelId, thirdChannelId, fourthChannelId} {
+		openResp := makeChannelsRequestAndWait(t, &OpenChannelRequest{
+			Channel: &ChannelObject{
+				Id:    channelId,
+				KeyId: genericKeyId,
+				Permissions: ChannelPermissionsObject{
+					Users: channelsPermissions[channelId],
+				},
+			},
+			Signers: &core.VerifiedSigners{
+				IssuerId:    genericNoopId,
+				CertifierId: genericNoopId,
+			},
+			Key:       generateRandomBytes(core.SymmetricKeySize),
+			Timestamp: channelsOpeningTime[channelId],
+		})
+		if openResp.Result != ChannelsSuccess {
+			t.Errorf("Opening request should succeed. response=%+v", openResp)
+		}
+	}
+	closeResp := makeChannelsRequestAndWait(t, makeGenericCloseRequest(secondChannelId, genericCloserId, twoHoursAfterOpeningTime))
+	if closeResp.Result != ChannelsSuccess {
+		t.Errorf("Closing request should succeed. response=%+v", closeResp)
+	}
+
+	// Fourth channel has a conflicting opening that is not kept
+	conflictResp := makeChannelsRequestAndWait(t, &OpenChannelRequest{
+		Channel: &ChannelObject{
+			Id:    fourthChannelId,
+			KeyId: genericKeyId + "_conflicting",
+			Permissions: ChannelPermissionsObject{
+				Users: channelsPermissions[fourthChannelId],
+			},
+		},
+		Signers: &core.VerifiedSigners{
+			IssuerId:    genericNoopId,
+			CertifierId: genericNoopId,
+		},
+		Key:       generateRandomBytes(core.SymmetricKeySize),
+		Timestamp: twoHoursAfterOpeningTime,
+	})
+	if conflictResp.Result != ChannelsConflict {
+		t.Errorf("Conflicting opening request should be reported. response=%+v", conflictResp)
+	}
+
+	// Buffered channel (closure attempt before opening) is only listed for closure certifier
+	bufferedCloseResp := makeChannelsRequestAndWait(t, makeGenericCloseRequest(bufferedChannelId, genericReaderId, twoHoursAfterOpeningTime))
+	if bufferedCloseResp.Result != ChannelsSuccess {
+		t.Errorf("Closing request of buffered channel should succeed. response=%+v", bufferedCloseResp)
+	}
+
+	listChannelIds := func(rq *ListChannelsRequest) []string {
+		resp := makeChannelsRequestAndWait(t, rq)
+		if resp.Result != ChannelsSuccess {
+			t.Errorf("List request should succeed. response=%+v", resp)
+		}
+		channelIds := []string{}
+		for _, channelObject := range resp.Channels {
+			channelIds = append(channelIds, channelObject.Id)
+		}
+		return channelIds
+	}
+	readerSigners := &core.VerifiedSigners{
+		IssuerId:    genericReaderId,
+		CertifierId: genericReaderId,
+	}
+	writerSigners := &core.VerifiedSigners{
+		IssuerId:    genericWriterId,
+		CertifierId: genericWriterId,
+	}
+
+	testCases := []struct {
+		description string
+		request     *ListChannelsRequest
+		expected    []string
+	}{
+		{"Readable channels", &ListChannelsRequest{Signers: readerSigners}, []string{firstChannelId, secondChannelId, fourthChannelId, bufferedChannelId}},
+		{"Readable channels of other user", &ListChannelsRequest{Signers: writerSigners}, []string{thirdChannelId}},
+		{"Member filter", &ListChannelsRequest{Signers: readerSigners, Member: genericWriterId}, []string{firstChannelId}},
+		{"Unknown member filter", &ListChannelsRequest{Signers: readerSigners, Member: genericNoopId}, []string{}},
+		{"Open state filter", &ListChannelsRequest{Signers: readerSigners, State: ChannelObjectOpenState}, []string{firstChannelId, fourthChannelId}},
+		{"Closed state filter", &ListChannelsRequest{Signers: readerSigners, State: ChannelObjectClosedState}, []string{secondChannelId}},
+		{"Buffered state filter", &ListChannelsRequest{Signers: readerSigners, State: ChannelObjectBufferedState}, []string{bufferedChannelId}},
+		{"Buffered state filter of other user", &ListChannelsRequest{Signers: writerSigners, State: ChannelObjectBufferedState}, []string{}},
+		{"Buffered state and member filter", &ListChannelsRequest{Signers: readerSigners, State: ChannelObjectBufferedState, Member: genericReaderId}, []string{bufferedChannelId}},
+		{"Buffered state and other member filter", &ListChannelsRequest{Signers: readerSigners, State: ChannelObjectBufferedState, Member: genericWriterId}, []string{}},
+		{"Inconsistent state filter", &ListChannelsRequest{Signers: readerSigners, State: ChannelObjectInconsistentState}, []string{}},
+		{"Opened after filter", &ListChannelsRequest{Signers: readerSigners, OpenedAfter: openingTime}, []string{secondChannelId, fourthChannelId}},
+		{"Opened before filter", &ListChannelsRequest{Signers: readerSigners, OpenedBefore: hourAfterOpeningTime}, []string{firstChannelId}},
+		{"Opened between filter", &ListChannelsRequest{Signers: readerSigners, OpenedAfter: beforeOpeningTime, OpenedBefore: twoHoursAfterOpeningTime}, []string{firstChannelId, secondChannelId}},
+	}
+	for _, testCase := range testCases {
+		if channelIds := listChannelIds(testCase.request); !reflect.DeepEqual(channelIds, testCase.expected) {
+			t.Errorf("%v should list expected channels. found=%v, expected=%v", testCase.description, channelIds, testCase.expected)
+		}
+	}
+
+	// Invalid requests are rejected
+	invalidRequests := []*ListChannelsRequest{
+		{},
+		{Signers: readerSigners, State: "unknown"},
+		{Signers: readerSigners, OpenedAfter: hourAfterOpeningTime, OpenedBefore: openingTime},
+	}
+	for _, rq := range invalidRequests {
+		if _, err := ChannelAction(context.Background(), rq); err == nil {
+			t.Errorf("Invalid list request should be rejected. request=%+v", rq)
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package channels
 
 import (
-	"errors"
+	"context"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"sync"
 )
@@ -10,7 +11,7 @@ import (
 	Server definitions
 */
 
-type ListenersRequester func(request interface{}) (chan *ListenersResponse, error)
+type ListenersRequester func(ctx context.Context, request interface{}) (chan *ListenersResponse, error)
 
 type ListenersServerConfig struct {
 	NumWorkers int
@@ -18,44 +19,39 @@ type ListenersServerConfig struct {
 
 type listenersServer struct {
 	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
+	subsystem     *Subsystem
 }
 
-var (
-	listenersServerSingleton listenersServer
-	listenersServerHandler   *gofarm.ServerHandler
-)
-
 /*
 	Server API
 */
 
-func provisionListenersServerOnce() {
-	if listenersServerHandler == nil {
-		listenersServerHandler = gofarm.ProvisionServer()
+func (subsystem *Subsystem) startListenersServer(conf ListenersServerConfig, serversWaitGroup *sync.WaitGroup) (err error) {
+	defer serversWaitGroup.Done()
+	sv := subsystem.listenersServer
+	if !sv.isInitialized {
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
 	}
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
-func startListenersServer(conf ListenersServerConfig, serversWaitGroup *sync.WaitGroup) (err error) {
-	defer serversWaitGroup.Done()
-	provisionListenersServerOnce()
-	if !listenersServerSingleton.isInitialized {
-		listenersServerSingleton.isInitialized = true
-		listenersServerHandler.ResetServer()
-		listenersServerHandler.InitServer(&listenersServerSingleton)
-	}
-	return listenersServerHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+func (subsystem *Subsystem) shutdownListenersServer() {
+	subsystem.listenersServer.handler.ShutdownServer()
 }
 
-func shutdownListenersServer() {
-	provisionListenersServerOnce()
-	listenersServerHandler.ShutdownServer()
+func (subsystem *Subsystem) resizeListenersServer(conf ListenersServerConfig) error {
+	return subsystem.listenersServer.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
 /*
 	Functional API
 */
 
-func ListenerAction(request interface{}) (chan *ListenersResponse, error) {
+func (subsystem *Subsystem) ListenerAction(ctx context.Context, request interface{}) (chan *ListenersResponse, error) {
 	// Sanitize and validate request
 	var sanitizingErr error
 	switch request.(type) {
@@ -64,23 +60,32 @@ func ListenerAction(request interface{}) (chan *ListenersResponse, error) {
 	case *UnsubscribeRequest:
 		sanitizingErr = nil
 	default:
-		return nil, errors.New("Unrecognized listeners action")
+		return nil, core.NewError(core.InvalidRequestErrorCode, "Unrecognized listeners action")
 	}
 	if sanitizingErr != nil {
 		return nil, sanitizingErr
 	}
 
+	// Drop request if the requester is not waiting anymore
+	if err := core.ContextError(ctx); err != nil {
+		return nil, err
+	}
+
 	// Make request to server
-	nativeResponseChannel, err := listenersServerHandler.MakeRequest(request)
+	nativeResponseChannel, err := subsystem.listenersServer.handler.MakeRequest(request)
 	if err != nil {
 		return nil, err
 	}
+	subsystem.metrics.listenersRequests.Queued()
 
 	// Pass through result
 	responseChannel := make(chan *ListenersResponse)
 	go func() {
 		nativeResponse := <-nativeResponseChannel
-		responseChannel <- (*nativeResponse).(*ListenersResponse)
+		select {
+		case responseChannel <- (*nativeResponse).(*ListenersResponse):
+		case <-ctx.Done():
+		}
 	}()
 
 	return responseChannel, nil
@@ -92,20 +97,35 @@ func ListenerAction(request interface{}) (chan *ListenersResponse, error) {
 
 func (sv *listenersServer) Start(_ gofarm.Config, isFirstStart bool) error {
 	if isFirstStart {
-		listenersStore = &sync.Map{}
+		sv.subsystem.listenersStore = &sync.Map{}
 	}
-	log.Debugf(listenersDaemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.subsystem.log.Debugf(listenersDaemonStartLogMsg)
 	return nil
 }
 
 func (sv *listenersServer) Shutdown() error {
-	log.Debugf(listenersDaemonShutdownLogMsg)
+	sv.state.SetRunning(false)
+	sv.subsystem.log.Debugf(listenersDaemonShutdownLogMsg)
 	return nil
 }
 
 func (sv *listenersServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
-	log.Debugf(listenersRunningRequestLogMsg)
+	requestLog := sv.subsystem.requestLogger(*rqInterface)
+	requestLog.Debugf(listenersRunningRequestLogMsg)
+
+	observation := sv.subsystem.metrics.listenersRequests.Start(requestTypeLabel(*rqInterface))
+	resp := sv.doRequest(rqInterface)
+	observation.DoneWithSuccess(resp.Result == ListenersSuccess)
 
+	// Log request done
+	requestLog.Debugf(listenersRequestDoneLogMsg)
+
+	var nativeResponse gofarm.Response = resp
+	return &nativeResponse
+}
+
+func (sv *listenersServer) doRequest(rqInterface *gofarm.Request) *ListenersResponse {
 	resp := &ListenersResponse{
 		Result: ListenersSuccess,
 	}
@@ -117,7 +137,7 @@ func (sv *listenersServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
 		resp.ChannelId = rq.ChannelId
 
 		// Get/Lock channel record
-		channelRecord := createOrGetChannel(channelsStore, rq.ChannelId)
+		channelRecord := createOrGetChannel(sv.subsystem.channelsStore, rq.ChannelId)
 		channelRecord.Lock()
 		defer func() { channelRecord.Unlock() }()
 
@@ -132,7 +152,7 @@ func (sv *listenersServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
 			break
 		}
 
-		resp.Channel, resp.SubscriberId = subscribe(rq.ChannelId, rq.Signers.CertifierId)
+		resp.Channel, resp.SubscriberId = sv.subsystem.subscribe(rq.ChannelId, rq.Signers.CertifierId)
 
 	case *UnsubscribeRequest:
 		rq := (*rqInterface).(*UnsubscribeRequest)
@@ -140,19 +160,15 @@ func (sv *listenersServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
 		resp.ChannelId = rq.ChannelId
 
 		// Get/Lock channel record
-		channelRecord := createOrGetChannel(channelsStore, rq.ChannelId)
+		channelRecord := createOrGetChannel(sv.subsystem.channelsStore, rq.ChannelId)
 		channelRecord.Lock()
 		defer func() { channelRecord.Unlock() }()
 
-		if err := unsubscribe(rq.ChannelId, rq.SubscriberId); err != nil {
+		if err := sv.subsystem.unsubscribe(rq.ChannelId, rq.SubscriberId); err != nil {
 			resp.Result = ListenersFailure
 			break
 		}
 	}
 
-	// Log request done
-	log.Debugf(listenersRequestDoneLogMsg)
-
-	var nativeResponse gofarm.Response = resp
-	return &nativeResponse
+	return resp
 }
@@ -8,5 +8,5 @@ func TestListenersStartShutdown(t *testing.T) {
 	if !resetAndStartListenersServer(t, multipleWorkersListenersConfig()) {
 		return
 	}
-	shutdownListenersServer()
+	defaultSubsystem.shutdownListenersServer()
 }
@@ -1,9 +1,8 @@
 package channels
 
 import (
-	"errors"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/eventqueue"
-	"sync"
 )
 
 /*
@@ -11,17 +10,13 @@ import (
 */
 
 var (
-	unrecognizedChannelId error = errors.New("Unrecognized channel id")
+	unrecognizedChannelId error = core.NewError(core.InvalidRequestErrorCode, "Unrecognized channel id")
 )
 
 /*
 	Definitions
 */
 
-var (
-	listenersStore *sync.Map
-)
-
 type listenersRecord struct {
 	eventQueue        *eventqueue.EventQueue
 	listenerCertifier map[string]string
@@ -34,24 +29,25 @@ type EventChannel chan *Event
 	Pubsub operations
 */
 
-func getOrMakeListenersRecord(channelId string) *listenersRecord {
-	listenersRecInterface, _ := listenersStore.LoadOrStore(channelId, &listenersRecord{
+func (subsystem *Subsystem) getOrMakeListenersRecord(channelId string) *listenersRecord {
+	listenersRecInterface, _ := subsystem.listenersStore.LoadOrStore(channelId, &listenersRecord{
 		eventQueue:        eventqueue.New(),
 		listenerCertifier: make(map[string]string),
 	})
 	return listenersRecInterface.(*listenersRecord)
 }
 
-func subscribe(channelId string, certifierId string) (EventChannel, string) {
+func (subsystem *Subsystem) subscribe(channelId string, certifierId string) (EventChannel, string) {
 	// Make channel to be passed to daemon and back to the caller
 	channel := make(EventChannel, 0)
 
 	// Get or make listeners record
-	listenersRec := getOrMakeListenersRecord(channelId)
+	listenersRec := subsystem.getOrMakeListenersRecord(channelId)
 
 	// Subscribe and track subscriber certifier id
 	genericChannel, subscriberId := listenersRec.eventQueue.Subscribe()
 	listenersRec.listenerCertifier[subscriberId] = certifierId
+	subsystem.metrics.activeListeners.Inc()
 
 	// Pass through result
 	go func() {
@@ -64,22 +60,25 @@ func subscribe(channelId string, certifierId string) (EventChannel, string) {
 	return channel, subscriberId
 }
 
-func unsubscribe(channelId string, subscriberId string) error {
+func (subsystem *Subsystem) unsubscribe(channelId string, subscriberId string) error {
 	// Get listeners record
-	listenersRecInterface, ok := listenersStore.Load(channelId)
+	listenersRecInterface, ok := subsystem.listenersStore.Load(channelId)
 	if !ok {
 		return unrecognizedChannelId
 	}
 	listenersRec := listenersRecInterface.(*listenersRecord)
 
 	// Unsubscribe and delete certifier
+	if _, subscribed := listenersRec.listenerCertifier[subscriberId]; subscribed {
+		subsystem.metrics.activeListeners.Dec()
+	}
 	delete(listenersRec.listenerCertifier, subscriberId)
 	return listenersRec.eventQueue.Unsubscribe(subscriberId)
 }
 
-func unsubscribeUnauthorized(channelId string, permissions *channelPermissionsRecord) {
+func (subsystem *Subsystem) unsubscribeUnauthorized(channelId string, permissions *channelPermissionsRecord) {
 	// Get or make listeners record
-	listenersRec := getOrMakeListenersRecord(channelId)
+	listenersRec := subsystem.getOrMakeListenersRecord(channelId)
 
 	// Search for unauthorized subscribers
 	unauthorizedSubscriberIds := []string{}
@@ -93,10 +92,11 @@ func unsubscribeUnauthorized(channelId string, permissions *channelPermissionsRe
 	for _, subscriberId := range unauthorizedSubscriberIds {
 		delete(listenersRec.listenerCertifier, subscriberId)
 		listenersRec.eventQueue.Unsubscribe(subscriberId)
+		subsystem.metrics.activeListeners.Dec()
 	}
 }
 
-func publish(id string, event *Event) error {
-	listenersRecInterface, _ := listenersStore.Load(id)
+func (subsystem *Subsystem) publish(id string, event *Event) error {
+	listenersRecInterface, _ := subsystem.listenersStore.Load(id)
 	return listenersRecInterface.(*listenersRecord).eventQueue.Publish(event)
 }
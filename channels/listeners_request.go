@@ -1,7 +1,6 @@
 package channels
 
 import (
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 )
 
@@ -54,7 +53,7 @@ type SubscribeRequest struct {
 func (rq *SubscribeRequest) sanitizeAndValidate() error {
 	if len(rq.ChannelId) == 0 ||
 		rq.Signers == nil {
-		return errors.New("Listen request is invalid.")
+		return core.NewError(core.InvalidRequestErrorCode, "Listen request is invalid.")
 	}
 	return nil
 }
@@ -15,6 +15,10 @@ const (
 	messagesDaemonShutdownLogMsg string = "Channel messages daemon shutdown"
 	messagesRunningRequestLogMsg string = "Channel messages running request"
 	messagesRequestDoneLogMsg    string = "Channel messages request done"
+	bufferLimitLogMsg            string = "Operation for channel %v not buffered (%v reached)"
+	bufferExpiredLogMsg          string = "Buffer of channel %v expired with %v operations"
+	bufferReplayFailedLogMsg     string = "Replaying buffer of channel %v failed for %v of %v operations"
+	setBufferLimitsLogMsg        string = "Buffer limits set to %v per channel, %v in total and %v expiry"
 
 	// Listeners daemon
 	listenersDaemonStartLogMsg    string = "Channel listeners daemon started"
@@ -0,0 +1,130 @@
+package channels
+
+import (
+	"github.com/mngharbi/memstore"
+	"sort"
+	"sync"
+)
+
+/*
+	Structure of channel memberships of a user
+	Kept in a separate store since a channel has many members and channel store indexes are unique per record
+	Channels are added once the user shows up in their permissions (entries are never removed,
+	so permissions of channel records are checked again when listing)
+	Buffered channels have no permissions yet, so certifiers of their closure attempts are indexed until they open
+*/
+type channelMembersRecord struct {
+	userId   string
+	channels map[string]bool
+	lock     *sync.RWMutex
+}
+
+/*
+	Utilities
+*/
+
+func createEmptyChannelMembersRecord(userId string) *channelMembersRecord {
+	return &channelMembersRecord{
+		userId:   userId,
+		channels: map[string]bool{},
+		lock:     &sync.RWMutex{},
+	}
+}
+
+func createOrGetChannelMembers(membersStore *memstore.Memstore, userId string) *channelMembersRecord {
+	newRecord := createEmptyChannelMembersRecord(userId)
+	return membersStore.AddOrGet(newRecord).(*channelMembersRecord)
+}
+
+func getChannelMembers(membersStore *memstore.Memstore, userId string) *channelMembersRecord {
+	searchRecord := &channelMembersRecord{userId: userId}
+	membersRec := membersStore.Get(searchRecord, channelMembersIndexUserId)
+	if membersRec != nil {
+		return membersRec.(*channelMembersRecord)
+	}
+	return nil
+}
+
+// Ids of channels where user is a member (sorted)
+func getMemberChannelIds(membersStore *memstore.Memstore, userId string) []string {
+	membersRecord := getChannelMembers(membersStore, userId)
+	if membersRecord == nil {
+		return nil
+	}
+	membersRecord.RLock()
+	defer membersRecord.RUnlock()
+	channelIds := make([]string, 0, len(membersRecord.channels))
+	for channelId := range membersRecord.channels {
+		channelIds = append(channelIds, channelId)
+	}
+	sort.Strings(channelIds)
+	return channelIds
+}
+
+// Indexes members of channel (channel lock must be held)
+func (subsystem *Subsystem) indexChannelMembers(rec *channelRecord) {
+	userIds := []string{}
+	if rec.state == channelBufferedState {
+		for _, attempt := range rec.closureAttempts {
+			userIds = append(userIds, attempt.certifierId)
+		}
+	} else if rec.permissions != nil {
+		for userId := range rec.permissions.users {
+			userIds = append(userIds, userId)
+		}
+	}
+	for _, userId := range userIds {
+		membersRecord := createOrGetChannelMembers(subsystem.membersStore, userId)
+		membersRecord.Lock()
+		membersRecord.channels[rec.id] = true
+		membersRecord.Unlock()
+	}
+}
+
+/*
+	Comparison
+*/
+func (rec *channelMembersRecord) Less(index string, than interface{}) bool {
+	switch index {
+	case channelMembersIndexUserId:
+		return rec.userId < than.(*channelMembersRecord).userId
+	}
+	return false
+}
+
+/*
+	Channel members record locking
+*/
+func (rec *channelMembersRecord) Lock() {
+	rec.lock.Lock()
+}
+
+func (rec *channelMembersRecord) Unlock() {
+	rec.lock.Unlock()
+}
+
+func (rec *channelMembersRecord) RLock() {
+	rec.lock.RLock()
+}
+
+func (rec *channelMembersRecord) RUnlock() {
+	rec.lock.RUnlock()
+}
+
+/*
+	Indexing
+*/
+const (
+	channelMembersIndexUserId string = "userId"
+)
+
+var channelMembersIndexesMap map[string]bool = map[string]bool{
+	channelMembersIndexUserId: true,
+}
+
+func getChannelMembersIndexes() (res []string) {
+	for k := range channelMembersIndexesMap {
+		res = append(res, k)
+	}
+	return res
+}
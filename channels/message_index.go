@@ -0,0 +1,220 @@
+package channels
+
+import (
+	"bytes"
+	"github.com/mngharbi/DMPC/core"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+/*
+	Message ordering key (vector clock depth, then timestamp, then message hash as tiebreaker)
+	Depth grows along causal order, so causally related messages are always ordered by cause,
+	and every replica orders messages the same way regardless of arrival order
+	Clocks are not signed, so depth only orders messages that were accepted (closure cutoffs use timestamps)
+*/
+type messageKey struct {
+	depth     uint64
+	timestamp time.Time
+	hash      []byte
+}
+
+func makeMessageKey(clock core.VectorClock, timestamp time.Time, hash []byte) messageKey {
+	return messageKey{
+		depth:     clock.Depth(),
+		timestamp: timestamp,
+		hash:      hash,
+	}
+}
+
+func (key *messageKey) less(than *messageKey) bool {
+	if key.depth != than.depth {
+		return key.depth < than.depth
+	}
+	if !key.timestamp.Equal(than.timestamp) {
+		return key.timestamp.Before(than.timestamp)
+	}
+	return bytes.Compare(key.hash, than.hash) < 0
+}
+
+// Timestamp order (used to find messages cut off by a closure)
+func (key *messageKey) timestampLess(than *messageKey) bool {
+	if !key.timestamp.Equal(than.timestamp) {
+		return key.timestamp.Before(than.timestamp)
+	}
+	if hashComparison := bytes.Compare(key.hash, than.hash); hashComparison != 0 {
+		return hashComparison < 0
+	}
+	return key.depth < than.depth
+}
+
+/*
+	Ordered index of channel messages
+	Treaps with subtree sizes: one in channel order for positions, and one in timestamp order
+	for closure cutoffs (counts are O(log n) and removing k messages is O((k + 1) log n) expected)
+*/
+type messageIndexNode struct {
+	key      messageKey
+	priority int64
+	size     int
+	left     *messageIndexNode
+	right    *messageIndexNode
+}
+
+type messageIndex struct {
+	root        *messageIndexNode
+	byTimestamp *messageIndexNode
+}
+
+func (node *messageIndexNode) getSize() int {
+	if node == nil {
+		return 0
+	}
+	return node.size
+}
+
+func (node *messageIndexNode) update() {
+	node.size = 1 + node.left.getSize() + node.right.getSize()
+}
+
+/*
+	Splits nodes into those going left and the rest (keys going left must come first)
+*/
+func splitMessageIndex(node *messageIndexNode, goesLeft func(*messageKey) bool) (*messageIndexNode, *messageIndexNode) {
+	if node == nil {
+		return nil, nil
+	}
+	if goesLeft(&node.key) {
+		left, right := splitMessageIndex(node.right, goesLeft)
+		node.right = left
+		node.update()
+		return node, right
+	}
+	left, right := splitMessageIndex(node.left, goesLeft)
+	node.left = right
+	node.update()
+	return left, node
+}
+
+/*
+	Merges nodes (all keys in left come before keys in right)
+*/
+func mergeMessageIndex(left *messageIndexNode, right *messageIndexNode) *messageIndexNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority > right.priority {
+		left.right = mergeMessageIndex(left.right, right)
+		left.update()
+		return left
+	}
+	right.left = mergeMessageIndex(left, right.left)
+	right.update()
+	return right
+}
+
+/*
+	Index operations
+*/
+
+func (index *messageIndex) len() int {
+	return index.root.getSize()
+}
+
+// Inserts key in subtree and returns new subtree with number of keys ordered before it
+func insertMessageIndex(node *messageIndexNode, key messageKey, less func(*messageKey, *messageKey) bool) (*messageIndexNode, int) {
+	left, right := splitMessageIndex(node, func(nodeKey *messageKey) bool {
+		return less(nodeKey, &key)
+	})
+	position := left.getSize()
+	inserted := &messageIndexNode{
+		key:      key,
+		priority: rand.Int63(),
+		size:     1,
+	}
+	return mergeMessageIndex(mergeMessageIndex(left, inserted), right), position
+}
+
+// Removes one node with key from subtree
+func deleteMessageIndex(node *messageIndexNode, key messageKey, less func(*messageKey, *messageKey) bool) *messageIndexNode {
+	left, right := splitMessageIndex(node, func(nodeKey *messageKey) bool {
+		return less(nodeKey, &key)
+	})
+	equal, right := splitMessageIndex(right, func(nodeKey *messageKey) bool {
+		return !less(&key, nodeKey)
+	})
+	if equal != nil {
+		equal = mergeMessageIndex(equal.left, equal.right)
+	}
+	return mergeMessageIndex(mergeMessageIndex(left, equal), right)
+}
+
+func channelOrderLess(key *messageKey, than *messageKey) bool {
+	return key.less(than)
+}
+
+func timestampOrderLess(key *messageKey, than *messageKey) bool {
+	return key.timestampLess(than)
+}
+
+// Adds message and returns number of messages ordered before it
+func (index *messageIndex) add(key messageKey) int {
+	var position int
+	index.root, position = insertMessageIndex(index.root, key, channelOrderLess)
+	index.byTimestamp, _ = insertMessageIndex(index.byTimestamp, key, timestampOrderLess)
+	return position
+}
+
+// Number of messages strictly before timestamp
+func (index *messageIndex) countBefore(timestamp time.Time) int {
+	count := 0
+	node := index.byTimestamp
+	for node != nil {
+		if node.key.timestamp.Before(timestamp) {
+			count += node.left.getSize() + 1
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return count
+}
+
+// Removes messages from timestamp on and returns them in channel order
+// (late messages are split off the timestamp index, then removed one by one from the channel index)
+func (index *messageIndex) removeFrom(timestamp time.Time) []messageKey {
+	kept, late := splitMessageIndex(index.byTimestamp, func(nodeKey *messageKey) bool {
+		return nodeKey.timestamp.Before(timestamp)
+	})
+	index.byTimestamp = kept
+	removed := late.appendKeys(nil)
+	for _, key := range removed {
+		index.root = deleteMessageIndex(index.root, key, channelOrderLess)
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].less(&removed[j])
+	})
+	return removed
+}
+
+// Removes all messages and returns them in order
+func (index *messageIndex) clear() []messageKey {
+	keys := index.root.appendKeys(nil)
+	index.root = nil
+	index.byTimestamp = nil
+	return keys
+}
+
+// Appends keys of subtree in order
+func (node *messageIndexNode) appendKeys(keys []messageKey) []messageKey {
+	if node == nil {
+		return keys
+	}
+	keys = node.left.appendKeys(keys)
+	keys = append(keys, node.key)
+	return node.right.appendKeys(keys)
+}
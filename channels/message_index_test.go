@@ -0,0 +1,233 @@
+package channels
+
+import (
+	"fmt"
+	"github.com/mngharbi/DMPC/core"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMessageIndexPositions(t *testing.T) {
+	index := &messageIndex{}
+	baseTime := time.Now()
+
+	// Messages added in order
+	for i := 0; i < 3; i++ {
+		if pos := index.add(messageKey{timestamp: baseTime.Add(time.Duration(i) * time.Minute)}); pos != i {
+			t.Errorf("Message added in order should be at position %v, found %v", i, pos)
+		}
+	}
+
+	// Message added before all others
+	if pos := index.add(messageKey{timestamp: baseTime.Add(-time.Minute)}); pos != 0 {
+		t.Errorf("Earliest message should be at position 0, found %v", pos)
+	}
+
+	// Messages with the same timestamp are ordered by hash
+	sameTime := baseTime.Add(30 * time.Second)
+	if pos := index.add(messageKey{timestamp: sameTime, hash: []byte{2}}); pos != 2 {
+		t.Errorf("Message should be at position 2, found %v", pos)
+	}
+	if pos := index.add(messageKey{timestamp: sameTime, hash: []byte{1}}); pos != 2 {
+		t.Errorf("Message with lower hash should come first, found at position %v", pos)
+	}
+	if pos := index.add(messageKey{timestamp: sameTime, hash: []byte{3}}); pos != 4 {
+		t.Errorf("Message with higher hash should come last, found at position %v", pos)
+	}
+
+	if index.len() != 7 {
+		t.Errorf("Index should have 7 messages, found %v", index.len())
+	}
+}
+
+func TestMessageIndexRemoveFrom(t *testing.T) {
+	index := &messageIndex{}
+	baseTime := time.Now()
+
+	// Messages one second apart, added in random order
+	messagesNumber := 1000
+	for _, i := range rand.Perm(messagesNumber) {
+		index.add(messageKey{timestamp: baseTime.Add(time.Duration(i) * time.Second)})
+	}
+
+	// Counts only include messages strictly before timestamp
+	if count := index.countBefore(baseTime.Add(700 * time.Second)); count != 700 {
+		t.Errorf("Count before timestamp should be 700, found %v", count)
+	}
+	if count := index.countBefore(baseTime.Add(700*time.Second + time.Millisecond)); count != 701 {
+		t.Errorf("Count before timestamp should be 701, found %v", count)
+	}
+
+	// Removing keeps messages strictly before timestamp and returns the others in order
+	removed := index.removeFrom(baseTime.Add(700 * time.Second))
+	if len(removed) != 300 {
+		t.Errorf("Removing should remove 300 messages, found %v", len(removed))
+	}
+	for i := range removed {
+		if expected := baseTime.Add(time.Duration(700+i) * time.Second); !removed[i].timestamp.Equal(expected) {
+			t.Errorf("Removed message #%v should be at %v, found %v", i, expected, removed[i].timestamp)
+			break
+		}
+	}
+	if index.len() != 700 {
+		t.Error("Removed messages should be removed from the index")
+	}
+	if pos := index.add(messageKey{timestamp: baseTime.Add(time.Hour)}); pos != 700 {
+		t.Errorf("Message added after removal should be last, found at position %v", pos)
+	}
+	if removed := index.removeFrom(baseTime.Add(time.Hour + time.Millisecond)); len(removed) != 0 || index.len() != 701 {
+		t.Error("Removing after the latest message should keep the index")
+	}
+	if removed := index.removeFrom(baseTime); len(removed) != 701 || index.len() != 0 {
+		t.Error("Removing from the earliest message should empty the index")
+	}
+}
+
+func TestMessageIndexRemoveFromCausalOrder(t *testing.T) {
+	index := &messageIndex{}
+	baseTime := time.Now()
+
+	// Depth and timestamp orders differ (later messages can have shallower clocks)
+	keys := []messageKey{}
+	for i := 0; i < 500; i++ {
+		key := messageKey{
+			depth:     uint64(rand.Intn(10)),
+			timestamp: baseTime.Add(time.Duration(rand.Intn(100)) * time.Second),
+			hash:      []byte{byte(i >> 8), byte(i)},
+		}
+		keys = append(keys, key)
+		index.add(key)
+	}
+
+	// Removed and kept messages match a filter of all messages (both in channel order)
+	cutoff := baseTime.Add(50 * time.Second)
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].less(&keys[j])
+	})
+	expectedKept := []messageKey{}
+	expectedRemoved := []messageKey{}
+	for _, key := range keys {
+		if key.timestamp.Before(cutoff) {
+			expectedKept = append(expectedKept, key)
+		} else {
+			expectedRemoved = append(expectedRemoved, key)
+		}
+	}
+	if count := index.countBefore(cutoff); count != len(expectedKept) {
+		t.Errorf("Count before cutoff should be %v, found %v", len(expectedKept), count)
+	}
+	removed := index.removeFrom(cutoff)
+	if !reflect.DeepEqual(removed, expectedRemoved) {
+		t.Error("Removed messages should be all messages from cutoff on in channel order")
+	}
+	if kept := index.root.appendKeys(nil); !reflect.DeepEqual(kept, expectedKept) {
+		t.Error("Kept messages should be all messages before cutoff in channel order")
+	}
+	if index.byTimestamp.getSize() != len(expectedKept) {
+		t.Error("Both orders should hold the same messages")
+	}
+}
+
+func TestMessageIndexCausalOrder(t *testing.T) {
+	baseTime := time.Now()
+	first := core.VectorClock{"USER_A": 1}
+	reply := first.Increment("USER_B")
+	concurrent := core.VectorClock{"USER_C": 1}
+
+	// Keys are added in every order and should always end up at the same positions
+	keys := []messageKey{
+		makeMessageKey(reply, baseTime, []byte{1}),
+		makeMessageKey(first, baseTime.Add(time.Minute), []byte{2}),
+		makeMessageKey(concurrent, baseTime.Add(time.Minute), []byte{3}),
+		makeMessageKey(concurrent, baseTime.Add(time.Minute), []byte{0}),
+	}
+	expected := []int{3, 1, 2, 0}
+	for _, permutation := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {1, 3, 0, 2}, {2, 0, 3, 1}} {
+		for keyIndex := range keys {
+			// Other messages arrive first
+			index := &messageIndex{}
+			for _, otherIndex := range permutation {
+				if otherIndex != keyIndex {
+					index.add(keys[otherIndex])
+				}
+			}
+			if pos := index.add(keys[keyIndex]); pos != expected[keyIndex] {
+				t.Errorf("Message %v should be at position %v, found %v", keyIndex, expected[keyIndex], pos)
+			}
+		}
+	}
+
+	// Cause is before its reply even if the reply has an earlier timestamp
+	causeKey := keys[1]
+	if !causeKey.less(&keys[0]) || keys[0].less(&causeKey) {
+		t.Error("Causally earlier message should be ordered first")
+	}
+}
+
+/*
+	Benchmarks (against sorted slice insertion)
+*/
+func makeBenchmarkMessageKeys(existingMessages int) []messageKey {
+	baseTime := time.Now()
+	keys := make([]messageKey, existingMessages)
+	for i := range keys {
+		keys[i] = messageKey{timestamp: baseTime.Add(time.Duration(i) * time.Millisecond)}
+	}
+	return keys
+}
+
+func BenchmarkMessageIndexAdd(b *testing.B) {
+	for _, existingMessages := range []int{1000, 100000} {
+		keys := makeBenchmarkMessageKeys(existingMessages)
+		middle := keys[existingMessages/2].timestamp.Add(time.Microsecond)
+
+		b.Run(fmt.Sprintf("index/%v", existingMessages), func(b *testing.B) {
+			index := &messageIndex{}
+			for _, key := range keys {
+				index.add(key)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				index.add(messageKey{timestamp: middle.Add(time.Duration(i))})
+			}
+		})
+
+		b.Run(fmt.Sprintf("slice/%v", existingMessages), func(b *testing.B) {
+			sorted := append([]messageKey{}, keys...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := messageKey{timestamp: middle.Add(time.Duration(i))}
+				position := sort.Search(len(sorted), func(j int) bool {
+					return !sorted[j].less(&key)
+				})
+				sorted = append(sorted, messageKey{})
+				copy(sorted[position+1:], sorted[position:])
+				sorted[position] = key
+			}
+		})
+	}
+}
+
+func BenchmarkMessageIndexRemoveFrom(b *testing.B) {
+	for _, existingMessages := range []int{1000, 100000} {
+		keys := makeBenchmarkMessageKeys(existingMessages)
+
+		// Closure cuts off the last 10 messages (added back so every iteration removes the same ones)
+		cutoff := keys[existingMessages-10].timestamp
+		b.Run(fmt.Sprintf("index/%v", existingMessages), func(b *testing.B) {
+			index := &messageIndex{}
+			for _, key := range keys {
+				index.add(key)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, key := range index.removeFrom(cutoff) {
+					index.add(key)
+				}
+			}
+		})
+	}
+}
@@ -1,100 +1,123 @@
 package channels
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
 	Server definitions
 */
 
-type MessageAdder func(request *AddMessageRequest) (chan *MessagesResponse, error)
-type OperationBufferer func(request *BufferOperationRequest) (chan *MessagesResponse, error)
+type MessageAdder func(ctx context.Context, request *AddMessageRequest) (chan *MessagesResponse, error)
+type OperationBufferer func(ctx context.Context, request *BufferOperationRequest) (chan *MessagesResponse, error)
 
 type MessagesServerConfig struct {
 	NumWorkers int
+
+	// Limits on operations buffered until channels are opened (defaults are used if zero)
+	MaxBufferedPerChannel int
+	MaxBufferedTotal      int
+
+	// Buffers are dropped if their channel is not opened in time (default is used if zero)
+	BufferExpiry time.Duration
 }
 
 type messagesServer struct {
-	isInitialized   bool
-	operationQueuer core.OperationQueuer
+	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
+	subsystem     *Subsystem
+
+	// Buffer limits and expiry (can change while running)
+	limitsLock  sync.RWMutex
+	limits      bufferLimits
+	sweeperQuit chan bool
 }
 
-var (
-	messagesServerSingleton messagesServer
-	messagesServerHandler   *gofarm.ServerHandler
-	bufferStore             *memstore.Memstore
-)
-
 /*
 	Server API
 */
 
-func provisionMessagesServerOnce() {
-	if messagesServerHandler == nil {
-		messagesServerHandler = gofarm.ProvisionServer()
+func (subsystem *Subsystem) startMessagesServer(conf MessagesServerConfig, operationQueuer core.OperationQueuer, serversWaitGroup *sync.WaitGroup) (err error) {
+	defer serversWaitGroup.Done()
+	sv := subsystem.messagesServer
+	if !sv.isInitialized {
+		sv.isInitialized = true
+		subsystem.operationQueuer = operationQueuer
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
+	}
+	subsystem.setBufferLimits(makeBufferLimits(conf), false)
+	if err = sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers}); err != nil {
+		return err
 	}
+	subsystem.startBufferSweeper()
+	return nil
 }
 
-func startMessagesServer(conf MessagesServerConfig, operationQueuer core.OperationQueuer, serversWaitGroup *sync.WaitGroup) (err error) {
-	defer serversWaitGroup.Done()
-	provisionMessagesServerOnce()
-	if !messagesServerSingleton.isInitialized {
-		messagesServerSingleton.isInitialized = true
-		messagesServerSingleton.operationQueuer = operationQueuer
-		messagesServerHandler.ResetServer()
-		messagesServerHandler.InitServer(&messagesServerSingleton)
-	}
-	return messagesServerHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+func (subsystem *Subsystem) shutdownMessagesServer() {
+	subsystem.stopBufferSweeper()
+	subsystem.messagesServer.handler.ShutdownServer()
 }
 
-func shutdownMessagesServer() {
-	provisionMessagesServerOnce()
-	messagesServerHandler.ShutdownServer()
+func (subsystem *Subsystem) resizeMessagesServer(conf MessagesServerConfig) error {
+	return subsystem.messagesServer.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
 /*
 	Functional API
 */
 
-func genericPassthroughRequest(request interface{}) (chan *MessagesResponse, error) {
+func (subsystem *Subsystem) genericPassthroughRequest(ctx context.Context, request interface{}) (chan *MessagesResponse, error) {
+	// Drop request if the requester is not waiting anymore
+	if err := core.ContextError(ctx); err != nil {
+		return nil, err
+	}
+
 	// Make request to server
-	nativeResponseChannel, err := messagesServerHandler.MakeRequest(request)
+	nativeResponseChannel, err := subsystem.messagesServer.handler.MakeRequest(request)
 	if err != nil {
 		return nil, err
 	}
+	subsystem.metrics.messagesRequests.Queued()
 
 	// Pass through result
 	responseChannel := make(chan *MessagesResponse)
 	go func() {
 		nativeResponse := <-nativeResponseChannel
-		responseChannel <- (*nativeResponse).(*MessagesResponse)
+		select {
+		case responseChannel <- (*nativeResponse).(*MessagesResponse):
+		case <-ctx.Done():
+		}
 	}()
 
 	return responseChannel, nil
 }
 
-func AddMessage(request *AddMessageRequest) (chan *MessagesResponse, error) {
+func (subsystem *Subsystem) AddMessage(ctx context.Context, request *AddMessageRequest) (chan *MessagesResponse, error) {
 	// Sanitize and validate request
 	err := request.sanitizeAndValidate()
 	if err != nil {
 		return nil, err
 	}
 
-	return genericPassthroughRequest(request)
+	return subsystem.genericPassthroughRequest(ctx, request)
 }
 
-func BufferOperation(request *BufferOperationRequest) (chan *MessagesResponse, error) {
+func (subsystem *Subsystem) BufferOperation(ctx context.Context, request *BufferOperationRequest) (chan *MessagesResponse, error) {
 	// Sanitize and validate request
 	err := request.sanitizeAndValidate()
 	if err != nil {
 		return nil, err
 	}
 
-	return genericPassthroughRequest(request)
+	return subsystem.genericPassthroughRequest(ctx, request)
 }
 
 /*
@@ -104,20 +127,38 @@ func BufferOperation(request *BufferOperationRequest) (chan *MessagesResponse, e
 func (sv *messagesServer) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize store (only if starting for the first time)
 	if isFirstStart {
-		bufferStore = memstore.New(getChannelBufferIndexes())
+		sv.subsystem.bufferStore = memstore.New(getChannelBufferIndexes())
+		atomic.StoreInt64(&sv.subsystem.bufferedOperations, 0)
 	}
-	log.Debugf(messagesDaemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.subsystem.log.Debugf(messagesDaemonStartLogMsg)
 	return nil
 }
 
 func (sv *messagesServer) Shutdown() error {
-	log.Debugf(messagesDaemonShutdownLogMsg)
+	sv.state.SetRunning(false)
+	sv.subsystem.log.Debugf(messagesDaemonShutdownLogMsg)
 	return nil
 }
 
 func (sv *messagesServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
-	log.Debugf(messagesRunningRequestLogMsg)
+	requestLog := sv.subsystem.requestLogger(*rqInterface)
+	requestLog.Debugf(messagesRunningRequestLogMsg)
+
+	observation := sv.subsystem.metrics.messagesRequests.Start(requestTypeLabel(*rqInterface))
+	statusCode := sv.doRequest(rqInterface)
+	observation.DoneWithSuccess(statusCode == MessagesSuccess)
+
+	// Log request done
+	requestLog.Debugf(messagesRequestDoneLogMsg)
 
+	var resp gofarm.Response = &MessagesResponse{
+		Result: statusCode,
+	}
+	return &resp
+}
+
+func (sv *messagesServer) doRequest(rqInterface *gofarm.Request) MessagesStatusCode {
 	var statusCode MessagesStatusCode = MessagesSuccess
 
 	switch (*rqInterface).(type) {
@@ -125,7 +166,7 @@ func (sv *messagesServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
 		rq := (*rqInterface).(*AddMessageRequest)
 
 		// Get/Lock channel
-		channelRecord := createOrGetChannel(channelsStore, rq.ChannelId)
+		channelRecord := createOrGetChannel(sv.subsystem.channelsStore, rq.ChannelId)
 		channelRecord.Lock()
 		defer func() { channelRecord.Unlock() }()
 
@@ -134,21 +175,24 @@ func (sv *messagesServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
 			issuerId:    rq.Signers.IssuerId,
 			certifierId: rq.Signers.CertifierId,
 			timestamp:   rq.Timestamp,
+			clock:       rq.VectorClock,
 		}
-		messagePosition, addSuccess := channelRecord.addMessage(actionRecord)
+		messagePosition, addSuccess := channelRecord.addMessage(actionRecord, core.Hash(rq.rawMessage))
 		if !addSuccess {
 			statusCode = MessagesDropped
 			break
 		}
 
 		// Notify listeners of message
-		publish(rq.ChannelId, makeMessageEvent(rq.Timestamp, messagePosition, rq.rawMessage))
+		event := makeMessageEvent(rq.Timestamp, messagePosition, rq.Signers, rq.rawMessage)
+		event.VectorClock = rq.VectorClock.Copy()
+		sv.subsystem.publish(rq.ChannelId, event)
 
 	case *BufferOperationRequest:
 		rq := (*rqInterface).(*BufferOperationRequest)
 
 		// Get/Lock channel
-		channelRecord := createOrGetChannel(channelsStore, rq.Operation.Meta.ChannelId)
+		channelRecord := createOrGetChannel(sv.subsystem.channelsStore, rq.Operation.Meta.ChannelId)
 		channelRecord.Lock()
 		defer func() { channelRecord.Unlock() }()
 
@@ -157,28 +201,30 @@ func (sv *messagesServer) Work(rqInterface *gofarm.Request) *gofarm.Response {
 			Directly buffer it in that case
 		*/
 		if channelRecord.state != channelBufferedState {
-			respChannel, _ := messagesServerSingleton.operationQueuer(rq.Operation)
-			_, ok := <-respChannel
-			if !ok {
+			respChannel, errs := sv.subsystem.operationQueuer(rq.Operation)
+			if len(errs) != 0 {
+				statusCode = MessagesBufferError
+				break
+			}
+			if _, ok := <-respChannel; !ok {
 				// This occurs when decryptor is shut down prematurely
-				// @TODO: handle this gracefully
 				statusCode = MessagesBufferError
 			}
 			break
 		}
 
-		// Add operation to buffer record
-		bufferRecord := createOrGetChannelBuffer(bufferStore, rq.Operation.Meta.ChannelId)
-		bufferRecord.Lock()
+		// Add operation to buffer record (if limits allow it)
+		bufferRecord := lockChannelBuffer(sv.subsystem.bufferStore, rq.Operation.Meta.ChannelId)
 		defer func() { bufferRecord.Unlock() }()
+		if reserved, reason := sv.subsystem.reserveBufferedOperation(bufferRecord); !reserved {
+			sv.subsystem.log.Warnf(bufferLimitLogMsg, bufferRecord.id, reason)
+			sv.subsystem.metrics.rejectedBufferedOperations.Inc(reason)
+			statusCode = MessagesBufferFull
+			break
+		}
 		bufferRecord.operations = append(bufferRecord.operations, rq.Operation)
+		sv.subsystem.updateBufferedOperationsMetrics(bufferRecord)
 	}
 
-	// Log request done
-	log.Debugf(messagesRequestDoneLogMsg)
-
-	var resp gofarm.Response = &MessagesResponse{
-		Result: statusCode,
-	}
-	return &resp
+	return statusCode
 }
@@ -1,8 +1,12 @@
 package channels
 
 import (
+	"context"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/status"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMessagesStartShutdown(t *testing.T) {
@@ -10,7 +14,7 @@ func TestMessagesStartShutdown(t *testing.T) {
 	if !resetAndStartMessagesServer(t, multipleWorkersMessagesConfig(), operationQueuerDummy) {
 		return
 	}
-	shutdownMessagesServer()
+	defaultSubsystem.shutdownMessagesServer()
 }
 
 /*
@@ -18,7 +22,7 @@ func TestMessagesStartShutdown(t *testing.T) {
 */
 
 func TestAddMessageServerDown(t *testing.T) {
-	if ch, err := AddMessage(makeValidAddMessageRequest()); ch != nil || err == nil {
+	if ch, err := AddMessage(context.Background(), makeValidAddMessageRequest()); ch != nil || err == nil {
 		t.Error("Adding message while server is down should fail.")
 	}
 }
@@ -28,8 +32,8 @@ func TestAddMessageValid(t *testing.T) {
 	if !resetAndStartMessagesServer(t, multipleWorkersMessagesConfig(), operationQueuerDummy) {
 		return
 	}
-	defer shutdownMessagesServer()
-	if ch, err := AddMessage(makeValidAddMessageRequest()); ch == nil || err != nil {
+	defer defaultSubsystem.shutdownMessagesServer()
+	if ch, err := AddMessage(context.Background(), makeValidAddMessageRequest()); ch == nil || err != nil {
 		t.Error("Adding valid message should not fail.")
 	}
 }
@@ -39,12 +43,12 @@ func TestAddMessageInvalid(t *testing.T) {
 	if !resetAndStartMessagesServer(t, multipleWorkersMessagesConfig(), operationQueuerDummy) {
 		return
 	}
-	defer shutdownMessagesServer()
+	defer defaultSubsystem.shutdownMessagesServer()
 
 	// Invalid signers
 	invalid := makeValidAddMessageRequest()
 	invalid.Signers = nil
-	ch, err := AddMessage(invalid)
+	ch, err := AddMessage(context.Background(), invalid)
 	if ch != nil || err == nil {
 		t.Error("Adding message with invalid signers should fail.")
 	}
@@ -52,7 +56,7 @@ func TestAddMessageInvalid(t *testing.T) {
 	// Empty message
 	invalid = makeValidAddMessageRequest()
 	invalid.Message = []byte{}
-	ch, err = AddMessage(invalid)
+	ch, err = AddMessage(context.Background(), invalid)
 	if ch != nil || err == nil {
 		t.Error("Adding empty message should fail.")
 	}
@@ -60,7 +64,7 @@ func TestAddMessageInvalid(t *testing.T) {
 	// Empty channel id
 	invalid = makeValidAddMessageRequest()
 	invalid.ChannelId = ""
-	ch, err = AddMessage(invalid)
+	ch, err = AddMessage(context.Background(), invalid)
 	if ch != nil || err == nil {
 		t.Error("Adding message with empty channel id should fail.")
 	}
@@ -68,7 +72,7 @@ func TestAddMessageInvalid(t *testing.T) {
 	// Invalid message
 	invalid = makeValidAddMessageRequest()
 	invalid.Message = []byte("{}")
-	ch, err = AddMessage(invalid)
+	ch, err = AddMessage(context.Background(), invalid)
 	if ch != nil || err == nil {
 		t.Error("Adding message with invalid message should fail.")
 	}
@@ -79,7 +83,7 @@ func TestAddMessageInvalid(t *testing.T) {
 */
 
 func TestBufferOperationServerDown(t *testing.T) {
-	if ch, err := BufferOperation(makeValidBufferOperationRequest()); ch != nil || err == nil {
+	if ch, err := BufferOperation(context.Background(), makeValidBufferOperationRequest()); ch != nil || err == nil {
 		t.Error("Buffer operation while server is down should fail.")
 	}
 }
@@ -89,8 +93,8 @@ func TestBufferOperationValid(t *testing.T) {
 	if !resetAndStartMessagesServer(t, multipleWorkersMessagesConfig(), operationQueuerDummy) {
 		return
 	}
-	defer shutdownMessagesServer()
-	if ch, err := BufferOperation(makeValidBufferOperationRequest()); ch == nil || err != nil {
+	defer defaultSubsystem.shutdownMessagesServer()
+	if ch, err := BufferOperation(context.Background(), makeValidBufferOperationRequest()); ch == nil || err != nil {
 		t.Error("Buffering valid operation should not fail.")
 	}
 }
@@ -100,12 +104,12 @@ func TestBufferOperationInvalid(t *testing.T) {
 	if !resetAndStartMessagesServer(t, multipleWorkersMessagesConfig(), operationQueuerDummy) {
 		return
 	}
-	defer shutdownMessagesServer()
+	defer defaultSubsystem.shutdownMessagesServer()
 
 	// Nil operation
 	invalid := makeValidBufferOperationRequest()
 	invalid.Operation = nil
-	ch, err := BufferOperation(invalid)
+	ch, err := BufferOperation(context.Background(), invalid)
 	if ch != nil || err == nil {
 		t.Error("Buffer operation with nil operation should fail.")
 	}
@@ -113,8 +117,188 @@ func TestBufferOperationInvalid(t *testing.T) {
 	// Mark as buffered
 	invalid = makeValidBufferOperationRequest()
 	invalid.Operation.Meta.Buffered = false
-	ch, err = BufferOperation(invalid)
+	ch, err = BufferOperation(context.Background(), invalid)
 	if ch == nil || err != nil || invalid.Operation.Meta.Buffered == false {
 		t.Error("Buffer operation with not buffered operation should mark it as buffered.")
 	}
 }
+
+/*
+	Buffer limits and expiry
+*/
+
+func makeChannelBufferOperationRequest(channelId string) *BufferOperationRequest {
+	rq := makeValidBufferOperationRequest()
+	rq.Operation.Meta.ChannelId = channelId
+	return rq
+}
+
+func TestBufferOperationLimits(t *testing.T) {
+	operationQueuerDummy, operationsQueued := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, false)
+	messagesConfig := MessagesServerConfig{
+		NumWorkers:            6,
+		MaxBufferedPerChannel: 2,
+		MaxBufferedTotal:      3,
+	}
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), messagesConfig, multipleWorkersListenersConfig(), operationQueuerDummy) {
+		return
+	}
+	defer ShutdownServers()
+	firstChannelId := genericChannelId + "_first"
+	secondChannelId := genericChannelId + "_second"
+
+	// Channel limit
+	for i := 0; i < 2; i++ {
+		if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(firstChannelId)); resp.Result != MessagesSuccess {
+			t.Errorf("Buffering operation under limits should succeed. response=%+v", resp)
+		}
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(firstChannelId)); resp.Result != MessagesBufferFull {
+		t.Errorf("Buffering operation over channel limit should fail. response=%+v", resp)
+	}
+
+	// Total limit
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(secondChannelId)); resp.Result != MessagesSuccess {
+		t.Errorf("Buffering operation under limits should succeed. response=%+v", resp)
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(secondChannelId)); resp.Result != MessagesBufferFull {
+		t.Errorf("Buffering operation over total limit should fail. response=%+v", resp)
+	}
+
+	// Buffers are visible to admins
+	stats, err := Admin(&AdminRequest{Action: BufferStatsAction})
+	if err != nil ||
+		stats.BufferedOperations != 3 ||
+		stats.MaxBufferedPerChannel != 2 ||
+		stats.MaxBufferedTotal != 3 ||
+		!reflect.DeepEqual(stats.Buffers, []*BufferStats{
+			{ChannelId: firstChannelId, Operations: 2},
+			{ChannelId: secondChannelId, Operations: 1},
+		}) {
+		t.Errorf("Buffer stats do not match. stats=%+v, err=%v", stats, err)
+	}
+	if buffered, _ := core.Metrics.Value("dmpc_channel_buffered_operations", firstChannelId); buffered != 2 {
+		t.Errorf("Buffered operations metric should be set for channel. buffered=%v", buffered)
+	}
+	if _, err := Admin(&AdminRequest{Action: "unknown"}); err == nil {
+		t.Error("Unknown admin action should fail")
+	}
+
+	// Opening channel releases its buffer
+	openResp := makeChannelsRequestAndWait(t, &OpenChannelRequest{
+		Channel: &ChannelObject{
+			Id:    firstChannelId,
+			KeyId: genericKeyId,
+			Permissions: ChannelPermissionsObject{
+				Users: map[string]ChannelPermissionObject{
+					genericReaderId: {Read: true},
+				},
+			},
+		},
+		Signers: &core.VerifiedSigners{
+			IssuerId:    genericNoopId,
+			CertifierId: genericNoopId,
+		},
+		Key:       generateRandomBytes(core.SymmetricKeySize),
+		Timestamp: openingTime,
+	})
+	if openResp.Result != ChannelsSuccess {
+		t.Errorf("Opening request should succeed. response=%+v", openResp)
+	}
+	for i := 0; i < 2; i++ {
+		<-operationsQueued
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(secondChannelId)); resp.Result != MessagesSuccess {
+		t.Errorf("Buffering operation after buffer is released should succeed. response=%+v", resp)
+	}
+	if stats, _ := Admin(&AdminRequest{Action: BufferStatsAction}); stats.BufferedOperations != 2 || len(stats.Buffers) != 1 {
+		t.Errorf("Released buffer should not be counted. stats=%+v", stats)
+	}
+	if _, found := core.Metrics.Value("dmpc_channel_buffered_operations", firstChannelId); found {
+		t.Error("Buffered operations metric of released buffer should be deleted.")
+	}
+}
+
+func TestBufferExpiry(t *testing.T) {
+	operationQueuerDummy, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, false)
+	messagesConfig := MessagesServerConfig{
+		NumWorkers:   6,
+		BufferExpiry: time.Hour,
+	}
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), messagesConfig, multipleWorkersListenersConfig(), operationQueuerDummy) {
+		return
+	}
+	defer ShutdownServers()
+
+	for i := 0; i < 3; i++ {
+		if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesSuccess {
+			t.Errorf("Buffering operation should succeed. response=%+v", resp)
+		}
+	}
+
+	// Buffers are kept until expiry
+	if expired := defaultSubsystem.expireBuffers(time.Now()); expired != 0 {
+		t.Errorf("Buffers should not expire early, %v operations dropped", expired)
+	}
+	if expired := defaultSubsystem.expireBuffers(time.Now().Add(2 * time.Hour)); expired != 3 {
+		t.Errorf("Expired buffer should drop its 3 operations, %v dropped", expired)
+	}
+	if stats, _ := Admin(&AdminRequest{Action: BufferStatsAction}); stats.BufferedOperations != 0 || len(stats.Buffers) != 0 || stats.BufferExpiry != 3600 {
+		t.Errorf("Expired buffers should be removed. stats=%+v", stats)
+	}
+	if _, found := core.Metrics.Value("dmpc_channel_buffered_operations", genericChannelId); found {
+		t.Error("Buffered operations metric of expired buffer should be deleted.")
+	}
+
+	// Channel can be buffered again
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesSuccess {
+		t.Errorf("Buffering operation after expiry should succeed. response=%+v", resp)
+	}
+	if stats, _ := Admin(&AdminRequest{Action: ExpireBuffersAction}); stats.Expired != 0 || stats.BufferedOperations != 1 {
+		t.Errorf("New buffer should not expire. stats=%+v", stats)
+	}
+}
+
+func TestSetBufferLimits(t *testing.T) {
+	operationQueuerDummy, _ := createDummyOperationQueuerFunctor(status.RequestNewTicket(), nil, false)
+	messagesConfig := MessagesServerConfig{
+		NumWorkers:            6,
+		MaxBufferedPerChannel: 1,
+	}
+	if !resetAndStartBothServers(t, multipleWorkersChannelsConfig(), messagesConfig, multipleWorkersListenersConfig(), operationQueuerDummy) {
+		return
+	}
+	defer ShutdownServers()
+
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesSuccess {
+		t.Errorf("Buffering operation under limits should succeed. response=%+v", resp)
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesBufferFull {
+		t.Errorf("Buffering operation over channel limit should fail. response=%+v", resp)
+	}
+
+	// Invalid limits are rejected
+	if _, err := Admin(&AdminRequest{Action: SetBufferLimitsAction, MaxBufferedTotal: -1}); err == nil {
+		t.Error("Negative buffer limits should be rejected")
+	}
+
+	// New limits apply to running server (defaults are used if zero)
+	stats, err := Admin(&AdminRequest{
+		Action:                SetBufferLimitsAction,
+		MaxBufferedPerChannel: 2,
+		BufferExpiry:          60,
+	})
+	if err != nil ||
+		stats.MaxBufferedPerChannel != 2 ||
+		stats.MaxBufferedTotal != defaultMaxBufferedTotal ||
+		stats.BufferExpiry != 60 ||
+		stats.BufferedOperations != 1 {
+		t.Errorf("Buffer limits should be updated. stats=%+v, err=%v", stats, err)
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesSuccess {
+		t.Errorf("Buffering operation under new limits should succeed. response=%+v", resp)
+	}
+	if resp := makeBufferOperationRequestAndWait(t, makeChannelBufferOperationRequest(genericChannelId)); resp.Result != MessagesBufferFull {
+		t.Errorf("Buffering operation over new channel limit should fail. response=%+v", resp)
+	}
+}
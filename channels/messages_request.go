@@ -2,7 +2,6 @@ package channels
 
 import (
 	"encoding/json"
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"time"
 )
@@ -16,12 +15,26 @@ const (
 	MessagesSuccess MessagesStatusCode = iota
 	MessagesDropped
 	MessagesBufferError
+	MessagesBufferFull
 )
 
 type MessagesResponse struct {
 	Result MessagesStatusCode `json:"result"`
 }
 
+/*
+	Errors corresponding to failed message results
+*/
+var messagesResultErrors map[MessagesStatusCode]error = map[MessagesStatusCode]error{
+	MessagesDropped:     core.NewError(core.MessageDroppedErrorCode, "Message dropped (channel not open or certifier cannot write)."),
+	MessagesBufferError: core.NewError(core.BufferFailedErrorCode, "Buffering operation failed."),
+	MessagesBufferFull:  core.NewError(core.BufferFullErrorCode, "Operation not buffered (buffer limit reached)."),
+}
+
+func (resp *MessagesResponse) GetError() error {
+	return messagesResultErrors[resp.Result]
+}
+
 // *MessagesResponse -> Json
 func (resp *MessagesResponse) Encode() ([]byte, error) {
 	jsonStream, err := json.Marshal(resp)
@@ -42,6 +55,9 @@ type AddMessageRequest struct {
 	Signers    *core.VerifiedSigners
 	Message    []byte
 	rawMessage []byte
+
+	// Causal metadata from operation (optional)
+	VectorClock core.VectorClock
 }
 
 func (rq *AddMessageRequest) decodeMessage() error {
@@ -67,7 +83,7 @@ func (rq *AddMessageRequest) sanitizeAndValidate() error {
 		len(rq.ChannelId) > 0 &&
 		rq.decodeMessage() == nil
 	if !valid {
-		return errors.New("Add message request is invalid.")
+		return core.NewError(core.InvalidRequestErrorCode, "Add message request is invalid.")
 	}
 	return nil
 }
@@ -84,7 +100,7 @@ type BufferOperationRequest struct {
 */
 func (rq *BufferOperationRequest) sanitizeAndValidate() error {
 	if rq.Operation == nil {
-		return errors.New("Buffer operation request is invalid.")
+		return core.NewError(core.InvalidRequestErrorCode, "Buffer operation request is invalid.")
 	} else {
 		rq.Operation.Meta.Buffered = true
 		return nil
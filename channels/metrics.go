@@ -0,0 +1,71 @@
+package channels
+
+import (
+	"github.com/mngharbi/DMPC/core"
+)
+
+/*
+	Metrics of a channels instance (registered in the registry it is made with)
+*/
+type subsystemMetrics struct {
+	// Request metrics (one worker pool per server)
+	channelsRequests  *core.SubsystemMetrics
+	messagesRequests  *core.SubsystemMetrics
+	listenersRequests *core.SubsystemMetrics
+
+	// Channel state
+	activeListeners *core.Gauge
+
+	// Series of a channel are deleted once its buffer is released (at most one per buffered operation)
+	bufferedOperations         *core.Gauge
+	bufferedOperationsTotal    *core.Gauge
+	rejectedBufferedOperations *core.Counter
+	expiredBufferedOperations  *core.Counter
+
+	retractedMessages *core.Counter
+}
+
+func newSubsystemMetrics(registry *core.MetricsRegistry) *subsystemMetrics {
+	return &subsystemMetrics{
+		channelsRequests:  core.NewSubsystemMetrics(registry, "channels"),
+		messagesRequests:  core.NewSubsystemMetrics(registry, "messages"),
+		listenersRequests: core.NewSubsystemMetrics(registry, "channel_listeners"),
+
+		activeListeners: registry.Gauge("dmpc_channel_listeners", "Active channel listeners."),
+
+		bufferedOperations:         registry.Gauge("dmpc_channel_buffered_operations", "Operations buffered until a channel is opened.", "channel"),
+		bufferedOperationsTotal:    registry.Gauge("dmpc_channel_buffered_operations_total", "Operations buffered across all channels."),
+		rejectedBufferedOperations: registry.Counter("dmpc_channel_buffer_rejected_total", "Operations not buffered because a buffer limit was reached.", "reason"),
+		expiredBufferedOperations:  registry.Counter("dmpc_channel_buffer_expired_total", "Buffered operations dropped because their channel was not opened in time."),
+
+		retractedMessages: registry.Counter("dmpc_channel_messages_retracted_total", "Messages retracted because they fall after their channel closure or their channel had conflicting openings."),
+	}
+}
+
+func requestTypeLabel(request interface{}) string {
+	switch request.(type) {
+	case *ReadChannelRequest:
+		return "read_channel"
+	case *ListChannelsRequest:
+		return "list_channels"
+	case *OpenChannelRequest:
+		return "open_channel"
+	case *CloseChannelRequest:
+		return "close_channel"
+	case *AddMessageRequest:
+		return "add_message"
+	case *BufferOperationRequest:
+		return "buffer_operation"
+	case *SubscribeRequest:
+		return "subscribe"
+	case *UnsubscribeRequest:
+		return "unsubscribe"
+	}
+	return "unknown"
+}
+
+// Buffer limit reached (rejection reason label)
+const (
+	channelBufferLimitReason string = "channel_limit"
+	totalBufferLimitReason   string = "total_limit"
+)
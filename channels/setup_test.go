@@ -10,10 +10,20 @@ import (
 	"testing"
 )
 
+/*
+	Logging and shutdown passed to servers started in tests
+*/
+var (
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+)
+
 func TestMain(m *testing.M) {
 	log = core.InitializeLogging()
 	log.SetLogLevel(core.WARN)
 	shutdownProgram = core.ShutdownLambda(func() {})
+	defaultSubsystem.log = log
+	defaultSubsystem.shutdownProgram = shutdownProgram
 	retCode := m.Run()
 	os.Exit(retCode)
 }
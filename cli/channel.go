@@ -35,7 +35,7 @@ func WriteChannelObject(obj *channels.ChannelObject) {
 */
 func EncryptChannelOperation(op *core.Operation) {
 	opEncoded, _ := op.Encode()
-	signedEncyrptionOperation := WrapPayloadInRootSignedGenericOperation(opEncoded, core.ChannelEncryptType)
+	signedEncyrptionOperation := WrapPayloadInSignedGenericOperation(opEncoded, core.ChannelEncryptType)
 	signedEncyrptionOperation.Meta.ChannelId = op.Meta.ChannelId
 	encryptionTs := WrapOperationInResultOnlyTransaction(signedEncyrptionOperation)
 	encryptionTsEncoded, _ := encryptionTs.Encode()
@@ -117,7 +117,7 @@ func GenerateChannelOpenOperation(issue bool, certify bool) {
 
 	// Sign operation
 	if issue || certify {
-		RootSignOperation(op, issue, certify)
+		SignOperation(op, issue, certify)
 	}
 
 	// Write operation to stdout
@@ -158,7 +158,7 @@ func generateGenericChannelOperation(channelId string, issue bool, certify bool,
 
 	// Sign operation
 	if issue || certify {
-		RootSignOperation(op, issue, certify)
+		SignOperation(op, issue, certify)
 	}
 
 	if encrypt {
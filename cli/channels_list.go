@@ -0,0 +1,83 @@
+package cli
+
+/*
+	Listing of channels readable by current identity
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mngharbi/DMPC/channels"
+	"time"
+)
+
+/*
+	Error messages
+*/
+const (
+	listChannelsTimeFormatError string = "Opening times must be in RFC3339 format (e.g. 2006-01-02T15:04:05Z)"
+	listChannelsFailedError     string = "Failed to list channels. error: %v"
+)
+
+/*
+	List options (filters are ignored if empty)
+*/
+type ListChannelsOptions struct {
+	Member       string
+	State        string
+	OpenedAfter  string
+	OpenedBefore string
+}
+
+func parseListChannelsTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New(listChannelsTimeFormatError)
+	}
+	return parsed, nil
+}
+
+/*
+	Main list channels function (writes channel objects as JSON)
+*/
+func ListChannels(options ListChannelsOptions) error {
+	if !IsFunctional() {
+		return nil
+	}
+
+	// Build filter
+	filter := &channels.ListChannelsRequest{
+		Member: options.Member,
+		State:  channels.ChannelObjectState(options.State),
+	}
+	var err error
+	if filter.OpenedAfter, err = parseListChannelsTime(options.OpenedAfter); err != nil {
+		return err
+	}
+	if filter.OpenedBefore, err = parseListChannelsTime(options.OpenedBefore); err != nil {
+		return err
+	}
+
+	// Connect and list
+	cl, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	channelObjects, err := cl.ListChannels(context.Background(), filter)
+	if err != nil {
+		return fmt.Errorf(listChannelsFailedError, err)
+	}
+
+	encoded, err := json.MarshalIndent(channelObjects, "", "  ")
+	if err != nil {
+		return err
+	}
+	cliWrite(string(encoded) + "\n")
+	return nil
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/client"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	chatQuitCommand     string        = "/quit"
+	chatTimestampFormat string        = "15:04:05"
+	chatSendTimeout     time.Duration = 30 * time.Second
+)
+
+/*
+	Error messages
+*/
+const (
+	chatSubscribeError string = "Failed to subscribe to channel. error: %v"
+)
+
+/*
+	Formatting of channel events
+*/
+func formatChatEvent(event *channels.Event) string {
+	timestamp := event.Timestamp.Local().Format(chatTimestampFormat)
+	switch event.Type {
+	case channels.Open:
+		return fmt.Sprintf("[%v] * channel opened\n", timestamp)
+	case channels.Close:
+		return fmt.Sprintf("[%v] * channel closed after %v messages\n", timestamp, event.Position)
+	case channels.Retraction:
+		return fmt.Sprintf("[%v] * %v messages after closure retracted\n", timestamp, len(event.Retracted))
+	case channels.Inconsistent:
+		return fmt.Sprintf("[%v] * conflicting opens (channel opened at this time is kept)\n", timestamp)
+	case channels.Message:
+		sender := "unknown"
+		if event.Signers != nil {
+			sender = event.Signers.IssuerId
+		}
+		return fmt.Sprintf("[%v] %v: %v\n", timestamp, sender, string(event.Data))
+	default:
+		return fmt.Sprintf("[%v] * %v\n", timestamp, event.Type)
+	}
+}
+
+/*
+	Writes events until subscription ends
+*/
+func printChatEvents(sub *client.Subscription, done chan bool) {
+	for event := range sub.Events {
+		cliWrite(formatChatEvent(event))
+	}
+	if err := sub.Err(); err != nil {
+		cliWrite(fmt.Sprintf("* subscription ended: %v\n", err))
+	} else {
+		cliWrite("* subscription ended\n")
+	}
+	close(done)
+}
+
+/*
+	Sends typed lines until stdin is closed or quit command is typed
+*/
+func sendChatLines(cl *client.Client, channelId string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if line == chatQuitCommand {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), chatSendTimeout)
+		err := cl.SendMessage(ctx, channelId, []byte(line))
+		cancel()
+		if err != nil {
+			cliWrite(fmt.Sprintf("* message not sent: %v\n", err))
+		}
+	}
+}
+
+/*
+	Main chat function
+*/
+func Chat(channelId string) error {
+	if !IsFunctional() {
+		return nil
+	}
+
+	// Read channel id if none passed
+	if channelId == "" {
+		channelId = cliGetString("Enter channel id:")
+	}
+
+	// Connect and subscribe to channel
+	cl, err := connectClient()
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	sub, err := cl.Subscribe(context.Background(), channelId)
+	if err != nil {
+		return fmt.Errorf(chatSubscribeError, err)
+	}
+	cliWrite(fmt.Sprintf("* joined %v (type %v to leave)\n", channelId, chatQuitCommand))
+
+	// Print events in the background while sending typed lines
+	done := make(chan bool)
+	go printChatEvents(sub, done)
+	sendChatLines(cl, channelId)
+
+	sub.Close()
+	<-done
+	return nil
+}
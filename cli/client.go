@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/mngharbi/DMPC/client"
+)
+
+/*
+	Error messages
+*/
+const (
+	clientIdentityKeysError string = "Failed to load identity keys. error: %v"
+	clientConnectionError   string = "Failed to connect to pipeline. error: %v"
+)
+
+/*
+	Client options for the pipeline using identity
+*/
+func (id *Identity) GetClientOptions(conf *Config) (client.Options, error) {
+	options := client.Options{
+		Hostname: conf.Pipeline.Hostname,
+		Port:     conf.Pipeline.Port,
+		UserId:   id.UserId,
+	}
+
+	// Get identity signing key
+	var err error
+	options.SigningKey, err = id.GetPrivateSigningKey()
+	return options, err
+}
+
+/*
+	Connects to pipeline as current identity
+*/
+func connectClient() (*client.Client, error) {
+	options, err := GetIdentity().GetClientOptions(GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf(clientIdentityKeysError, err)
+	}
+	cl, err := client.Connect(options)
+	if err != nil {
+		return nil, fmt.Errorf(clientConnectionError, err)
+	}
+	return cl, nil
+}
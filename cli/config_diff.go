@@ -0,0 +1,50 @@
+package cli
+
+/*
+	Comparison of configurations (used when reloading)
+*/
+
+import (
+	"reflect"
+	"strings"
+)
+
+/*
+	Change of a single configuration field (named by its json path)
+*/
+type ConfigChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+func DiffConfigs(oldConf *Config, newConf *Config) []ConfigChange {
+	return diffConfigValues("", reflect.ValueOf(*oldConf), reflect.ValueOf(*newConf), []ConfigChange{})
+}
+
+func diffConfigValues(path string, oldValue reflect.Value, newValue reflect.Value, changes []ConfigChange) []ConfigChange {
+	// Go through nested structures field by field
+	if oldValue.Kind() == reflect.Struct {
+		for fieldIndex := 0; fieldIndex < oldValue.NumField(); fieldIndex++ {
+			field := oldValue.Type().Field(fieldIndex)
+			fieldName := strings.Split(field.Tag.Get("json"), ",")[0]
+			if fieldName == "" {
+				fieldName = field.Name
+			}
+			if path != "" {
+				fieldName = path + "." + fieldName
+			}
+			changes = diffConfigValues(fieldName, oldValue.Field(fieldIndex), newValue.Field(fieldIndex), changes)
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+		changes = append(changes, ConfigChange{
+			Field: path,
+			Old:   oldValue.Interface(),
+			New:   newValue.Interface(),
+		})
+	}
+	return changes
+}
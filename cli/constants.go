@@ -17,11 +17,25 @@ const (
 	EncryptionKeyFilename string = "encryption_rsa"
 	SigningKeyFilename    string = "signing_rsa"
 	PublicKeySuffix       string = ".pub"
+	IdentitiesDir         string = "identities"
+	IdentityFileSuffix    string = ".json"
+	KeyringFilename       string = "keyring.json"
 )
 
 /*
-	Default root user object
+	Name of identity defined by daemon configuration
 */
+const (
+	RootIdentityName string = "root"
+)
+
+/*
+	Default root user id and object
+*/
+const (
+	defaultRootUserId string = "root"
+)
+
 var defaultUserObject users.UserObject = users.UserObject{
 	Permissions: users.PermissionsObject{
 		Channel: users.ChannelPermissionsObject{
@@ -45,8 +59,13 @@ var defaultUserObject users.UserObject = users.UserObject{
 */
 var defaultDaemonConfig Config = Config{
 	LogLevel: core.INFO,
-	Locker: NumWorkersOnlyConfig{
-		NumWorkers: 4,
+	Logging: LoggingConfig{
+		Format:     core.TextLogFormat,
+		Subsystems: map[string]core.LogLevel{},
+	},
+	Locker: LockerSubsystemConfig{
+		NumWorkers:  4,
+		LockTimeout: 30000,
 	},
 	Users: NumWorkersOnlyConfig{
 		NumWorkers: 4,
@@ -61,6 +80,11 @@ var defaultDaemonConfig Config = Config{
 		Listeners: NumWorkersOnlyConfig{
 			NumWorkers: 2,
 		},
+		Buffers: ChannelBuffersConfig{
+			MaxPerChannel: 1000,
+			MaxTotal:      100000,
+			Expiry:        3600,
+		},
 	},
 	Status: StatusSubsystemConfig{
 		Update: NumWorkersOnlyConfig{
@@ -83,4 +107,8 @@ var defaultDaemonConfig Config = Config{
 		CheckOrigin: false,
 		Port:        64927,
 	},
+	Metrics: MetricsConfig{
+		Hostname: "localhost",
+		Port:     64928,
+	},
 }
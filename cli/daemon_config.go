@@ -6,6 +6,7 @@ package cli
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/decryptor"
@@ -16,6 +17,9 @@ import (
 	"github.com/mngharbi/DMPC/status"
 	"github.com/mngharbi/DMPC/users"
 	"log"
+	"net"
+	"strconv"
+	"time"
 )
 
 /*
@@ -38,11 +42,14 @@ type Config struct {
 	// Log level setting
 	LogLevel core.LogLevel `json:"logLevel"`
 
+	// Log format and level overrides by subsystem
+	Logging LoggingConfig `json:"logging"`
+
 	// All customizable paths
 	Paths ConfigPaths `json:"paths"`
 
 	// Configuration for locker subsystem
-	Locker NumWorkersOnlyConfig `json:"locker"`
+	Locker LockerSubsystemConfig `json:"locker"`
 
 	// Configuration for users subsystem
 	Users NumWorkersOnlyConfig `json:"users"`
@@ -64,6 +71,9 @@ type Config struct {
 
 	// Configuration for pipeline subsystem (websocket)
 	Pipeline PipelineSubsystemConfig `json:"pipeline"`
+
+	// Configuration for metrics endpoint (prometheus)
+	Metrics MetricsConfig `json:"metrics"`
 }
 
 /*
@@ -88,27 +98,42 @@ func (conf *Config) Decode(encoded []byte) error {
 /*
 	Get config structure from config file
 */
-func GetConfig() *Config {
+func ReadConfig() (*Config, error) {
 	raw, err := ReadFile(ConfigFilename)
 	if err != nil {
-		log.Fatalf(configurationNotFound)
-		return nil
+		return nil, errors.New(configurationNotFound)
 	}
 	var conf Config
 	if err := conf.Decode(raw); err != nil {
-		log.Fatalf(invalidConfigurationFormat)
+		return nil, errors.New(invalidConfigurationFormat)
+	}
+	return &conf, nil
+}
+
+func GetConfig() *Config {
+	conf, err := ReadConfig()
+	if err != nil {
+		log.Fatalf(err.Error())
 		return nil
 	}
-	return &conf
+	return conf
 }
 
 /*
 	Server confuration
 */
 
+type LockerSubsystemConfig struct {
+	NumWorkers int `json:"numWorkers"`
+
+	// Maximum time to wait for locks in milliseconds (no limit if zero)
+	LockTimeout int `json:"lockTimeout"`
+}
+
 func (conf *Config) GetLockerSubsystemConfig() locker.Config {
 	return locker.Config{
-		NumWorkers: conf.Users.NumWorkers,
+		NumWorkers:  conf.Locker.NumWorkers,
+		LockTimeout: conf.Locker.LockTimeout,
 	}
 }
 
@@ -122,13 +147,26 @@ type ChannelsSubsystemConfig struct {
 	Channels  NumWorkersOnlyConfig `json:"channels"`
 	Messages  NumWorkersOnlyConfig `json:"messages"`
 	Listeners NumWorkersOnlyConfig `json:"listeners"`
+	Buffers   ChannelBuffersConfig `json:"buffers"`
+}
+
+// Operations buffered for unopened channels (defaults used if zero)
+type ChannelBuffersConfig struct {
+	MaxPerChannel int `json:"maxPerChannel"`
+	MaxTotal      int `json:"maxTotal"`
+
+	// Time before buffers of channels that never open are dropped in seconds
+	Expiry int `json:"expiry"`
 }
 
 func (conf *Config) GetChannelsSubsystemConfig() (channels.ChannelsServerConfig, channels.MessagesServerConfig, channels.ListenersServerConfig) {
 	return channels.ChannelsServerConfig{
 			NumWorkers: conf.Channels.Channels.NumWorkers,
 		}, channels.MessagesServerConfig{
-			NumWorkers: conf.Channels.Messages.NumWorkers,
+			NumWorkers:            conf.Channels.Messages.NumWorkers,
+			MaxBufferedPerChannel: conf.Channels.Buffers.MaxPerChannel,
+			MaxBufferedTotal:      conf.Channels.Buffers.MaxTotal,
+			BufferExpiry:          time.Duration(conf.Channels.Buffers.Expiry) * time.Second,
 		}, channels.ListenersServerConfig{
 			NumWorkers: conf.Channels.Listeners.NumWorkers,
 		}
@@ -178,3 +216,21 @@ func (conf *Config) GetPipelineSubsystemConfig() pipeline.Config {
 		Port:        conf.Pipeline.Port,
 	}
 }
+
+type LoggingConfig struct {
+	Format     core.LogFormat           `json:"format"`
+	Subsystems map[string]core.LogLevel `json:"subsystems"`
+}
+
+type MetricsConfig struct {
+	// Metrics are not served if port is zero
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+}
+
+func (conf *Config) GetMetricsAddress() (string, bool) {
+	if conf.Metrics.Port == 0 {
+		return "", false
+	}
+	return net.JoinHostPort(conf.Metrics.Hostname, strconv.Itoa(conf.Metrics.Port)), true
+}
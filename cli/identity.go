@@ -0,0 +1,274 @@
+package cli
+
+/*
+	Identity profiles (user id and keys the CLI acts as)
+*/
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/users"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+	Error messages
+*/
+const (
+	identityNotFound        string = "Identity not found"
+	invalidIdentityFormat   string = "Invalid identity file format"
+	invalidIdentityName     string = "Identity name must be non empty, not reserved, and without path separators"
+	identityAlreadyExists   string = "Identity already exists"
+	identityUserIdMissing   string = "Identity requires a user id"
+	identityKeysIncomplete  string = "Both encryption and signing private keys are required to import keys"
+	rootIdentityNotEditable string = "Root identity is defined by the daemon configuration"
+)
+
+/*
+	Identity definition
+	Public keys are derived from private keys
+*/
+type Identity struct {
+	Name                     string `json:"name"`
+	UserId                   string `json:"userId"`
+	PrivateEncryptionKeyPath string `json:"privateEncryptionKeyPath"`
+	PrivateSigningKeyPath    string `json:"privateSigningKeyPath"`
+}
+
+/*
+	Identity used for signing and connecting (root user if none is selected)
+*/
+var currentIdentityName string = RootIdentityName
+
+func SetIdentity(name string) {
+	if name == "" {
+		name = RootIdentityName
+	}
+	currentIdentityName = name
+}
+
+/*
+	(En/De)coding
+*/
+func (id *Identity) Encode() ([]byte, error) {
+	return json.MarshalIndent(id, "", "  ")
+}
+
+func (id *Identity) Decode(encoded []byte) error {
+	return json.Unmarshal(encoded, id)
+}
+
+/*
+	Keys
+*/
+func (id *Identity) GetPrivateEncryptionKey() (*rsa.PrivateKey, error) {
+	return GetPrivateKey(id.PrivateEncryptionKeyPath)
+}
+
+func (id *Identity) GetPrivateSigningKey() (*rsa.PrivateKey, error) {
+	return GetPrivateKey(id.PrivateSigningKeyPath)
+}
+
+/*
+	User object with public keys of identity (no permissions)
+*/
+func (id *Identity) GetUserObject() (*users.UserObject, error) {
+	encKey, err := id.GetPrivateEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	signKey, err := id.GetPrivateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	currentTime := time.Now()
+	return &users.UserObject{
+		Id:        id.UserId,
+		EncKey:    core.PublicAsymKeyToString(&encKey.PublicKey),
+		SignKey:   core.PublicAsymKeyToString(&signKey.PublicKey),
+		Active:    true,
+		CreatedAt: currentTime,
+		UpdatedAt: currentTime,
+	}, nil
+}
+
+/*
+	Reading identities
+*/
+func isValidIdentityName(name string) bool {
+	return len(name) > 0 &&
+		name != RootIdentityName &&
+		!strings.ContainsAny(name, "/\\") &&
+		!strings.HasPrefix(name, ".")
+}
+
+func getIdentityFilename(name string) string {
+	return name + IdentityFileSuffix
+}
+
+func (conf *Config) getRootIdentity() (*Identity, error) {
+	userObj, err := conf.getRootUserObjectWithoutKeys()
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Name:                     RootIdentityName,
+		UserId:                   userObj.Id,
+		PrivateEncryptionKeyPath: conf.Paths.PrivateEncryptionKeyPath,
+		PrivateSigningKeyPath:    conf.Paths.PrivateSigningKeyPath,
+	}, nil
+}
+
+func ReadIdentity(name string) (*Identity, error) {
+	if name == RootIdentityName {
+		conf, err := ReadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return conf.getRootIdentity()
+	}
+	if !isValidIdentityName(name) {
+		return nil, errors.New(invalidIdentityName)
+	}
+	raw, err := ReadFile(IdentitiesDir, getIdentityFilename(name))
+	if err != nil {
+		return nil, errors.New(identityNotFound)
+	}
+	id := &Identity{}
+	if err := id.Decode(raw); err != nil {
+		return nil, errors.New(invalidIdentityFormat)
+	}
+	return id, nil
+}
+
+func GetIdentity() *Identity {
+	id, err := ReadIdentity(currentIdentityName)
+	if err != nil {
+		log.Fatalf("Unable to load identity %v. err=%v", currentIdentityName, err)
+		return nil
+	}
+	return id
+}
+
+func listIdentityNames() []string {
+	names := []string{}
+	files, err := ioutil.ReadDir(GetInstallPath(IdentitiesDir))
+	if err != nil {
+		return names
+	}
+	for _, file := range files {
+		if !file.Mode().IsRegular() || !strings.HasSuffix(file.Name(), IdentityFileSuffix) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(file.Name(), IdentityFileSuffix))
+	}
+	return names
+}
+
+/*
+	Saves identity (keys are generated in the identity directory if no paths are passed)
+*/
+func AddIdentity(name string, userId string, encKeyPath string, signKeyPath string) {
+	if !IsFunctional() {
+		return
+	}
+	if !isValidIdentityName(name) {
+		log.Fatalf(invalidIdentityName)
+	}
+	if PathExists(IdentitiesDir, getIdentityFilename(name)) {
+		log.Fatalf(identityAlreadyExists)
+	}
+	if userId == "" {
+		log.Fatalf(identityUserIdMissing)
+	}
+
+	id := &Identity{
+		Name:   name,
+		UserId: userId,
+	}
+
+	// Import or generate keys
+	if encKeyPath != "" || signKeyPath != "" {
+		if encKeyPath == "" || signKeyPath == "" {
+			log.Fatalf(identityKeysIncomplete)
+		}
+		id.PrivateEncryptionKeyPath, id.PrivateSigningKeyPath = encKeyPath, signKeyPath
+		if _, err := id.GetUserObject(); err != nil {
+			log.Fatalf("Unable to read identity keys. err=%v", err)
+		}
+	} else {
+		var err error
+		if _, id.PrivateEncryptionKeyPath, err = saveNewKeys(true, IdentitiesDir, name); err != nil {
+			log.Fatalf("Failed to save identity keys. err=%v", err)
+		}
+		if _, id.PrivateSigningKeyPath, err = saveNewKeys(false, IdentitiesDir, name); err != nil {
+			log.Fatalf("Failed to save identity keys. err=%v", err)
+		}
+	}
+
+	// Save identity file
+	encoded, err := id.Encode()
+	if err != nil {
+		log.Fatalf("Failed to encode identity. err=%v", err)
+	}
+	MkdirAll(IdentitiesDir)
+	if err := WriteFile(encoded, IdentitiesDir, getIdentityFilename(name)); err != nil {
+		log.Fatalf("Failed to save identity file. err=%v", err)
+	}
+}
+
+/*
+	Removes identity (generated keys are removed with it)
+*/
+func RemoveIdentity(name string) {
+	if name == RootIdentityName {
+		log.Fatalf(rootIdentityNotEditable)
+	}
+	if _, err := ReadIdentity(name); err != nil {
+		log.Fatalf(err.Error())
+	}
+	os.Remove(GetInstallPath(IdentitiesDir, getIdentityFilename(name)))
+	os.RemoveAll(GetInstallPath(IdentitiesDir, name))
+}
+
+/*
+	Lists identities (name and user id)
+*/
+func ListIdentities() {
+	names := append([]string{RootIdentityName}, listIdentityNames()...)
+	for _, name := range names {
+		id, err := ReadIdentity(name)
+		if err != nil {
+			continue
+		}
+		marker := " "
+		if name == currentIdentityName {
+			marker = "*"
+		}
+		cliWrite(marker + " " + id.Name + "\t" + id.UserId + "\n")
+	}
+}
+
+/*
+	Writes user object of identity to stdout (used to create user or share public keys)
+*/
+func ExportIdentityUserObject(name string) {
+	if name == "" {
+		name = currentIdentityName
+	}
+	id, err := ReadIdentity(name)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	obj, err := id.GetUserObject()
+	if err != nil {
+		log.Fatalf("Unable to read identity keys. err=%v", err)
+	}
+	WriteUserObject(obj)
+}
@@ -0,0 +1,320 @@
+package cli
+
+/*
+	Offline inspection of transactions and operations
+*/
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mngharbi/DMPC/core"
+	"io/ioutil"
+	"os"
+)
+
+/*
+	Error messages
+*/
+const (
+	inspectInputFormat       string = "Input is neither a transaction nor an operation"
+	inspectInvalidChannelKey string = "Channel key is not a valid base64 symmetric key"
+	inspectChecksFailed      string = "%v check(s) failed"
+)
+
+/*
+	Check results
+*/
+const (
+	inspectOk      string = "OK"
+	inspectFailed  string = "FAILED"
+	inspectSkipped string = "SKIPPED"
+)
+
+/*
+	Keys used for inspection (empty values fall back to identity and keyring)
+*/
+type InspectOptions struct {
+	// Private key used to decrypt transactions
+	PrivateKeyPath string
+
+	// Base64 encoded symmetric key used to decrypt channel encrypted operations
+	ChannelKey string
+
+	// Public keys used to verify signatures
+	IssuerKeyPath    string
+	CertifierKeyPath string
+}
+
+/*
+	Inspection state
+*/
+type inspector struct {
+	options  InspectOptions
+	identity *Identity
+	keyring  Keyring
+	failures int
+}
+
+func (insp *inspector) section(title string) {
+	cliWrite(fmt.Sprintf("\n== %v ==\n", title))
+}
+
+func (insp *inspector) field(name string, value interface{}) {
+	cliWrite(fmt.Sprintf("  %-22v %v\n", name+":", value))
+}
+
+func (insp *inspector) check(name string, err error) {
+	if err != nil {
+		insp.failures++
+		insp.field(name, fmt.Sprintf("%v (%v)", inspectFailed, err))
+		return
+	}
+	insp.field(name, inspectOk)
+}
+
+func (insp *inspector) skip(name string, reason string) {
+	insp.field(name, fmt.Sprintf("%v (%v)", inspectSkipped, reason))
+}
+
+/*
+	Key lookups
+*/
+
+// Identity and keyring are only used if the cli is installed
+func newInspector(options InspectOptions) *inspector {
+	insp := &inspector{
+		options: options,
+		keyring: Keyring{},
+	}
+	if !IsFunctional() {
+		return insp
+	}
+	if id, err := ReadIdentity(currentIdentityName); err == nil {
+		insp.identity = id
+	}
+	if kr, err := ReadKeyring(); err == nil {
+		insp.keyring = kr
+	}
+	return insp
+}
+
+func (insp *inspector) getPrivateKey() (*rsa.PrivateKey, string, error) {
+	if insp.options.PrivateKeyPath != "" {
+		key, err := GetPrivateKey(insp.options.PrivateKeyPath)
+		return key, insp.options.PrivateKeyPath, err
+	}
+	if insp.identity != nil {
+		key, err := insp.identity.GetPrivateEncryptionKey()
+		return key, fmt.Sprintf("identity %v", insp.identity.Name), err
+	}
+	return nil, "", nil
+}
+
+func (insp *inspector) getChannelDecryptor() (core.Decryptor, error) {
+	key, err := core.Base64DecodeString(insp.options.ChannelKey)
+	if err == nil {
+		err = core.ValidateSymmetricKey(key)
+	}
+	if err != nil {
+		return nil, errors.New(inspectInvalidChannelKey)
+	}
+	aead, _ := core.NewAead(key)
+	return func(_ string, nonce []byte, ciphertext []byte) ([]byte, error) {
+		return core.SymmetricDecrypt(aead, []byte{}, nonce, ciphertext)
+	}, nil
+}
+
+// Key given explicitly, then keyring entry, then current identity
+func (insp *inspector) getSigningKey(keyPath string, userId string) (*rsa.PublicKey, string, error) {
+	if keyPath != "" {
+		key, err := GetPublicKey(keyPath)
+		return key, keyPath, err
+	}
+	if entry, ok := insp.keyring[userId]; ok && entry.SignKey != "" {
+		key, err := core.PublicStringToAsymKey(entry.SignKey)
+		return key, "keyring", err
+	}
+	if insp.identity != nil && insp.identity.UserId == userId {
+		key, err := insp.identity.GetPrivateSigningKey()
+		if err != nil {
+			return nil, "", err
+		}
+		return &key.PublicKey, fmt.Sprintf("identity %v", insp.identity.Name), nil
+	}
+	return nil, "", nil
+}
+
+/*
+	Printing
+*/
+
+func (insp *inspector) printPayload(payload []byte) {
+	insp.section("Payload")
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, payload, "  ", "  "); err == nil {
+		cliWrite(fmt.Sprintf("  %v\n", indented.String()))
+		return
+	}
+	cliWrite(fmt.Sprintf("  %q\n", string(payload)))
+}
+
+func (insp *inspector) inspectTransaction(ts *core.Transaction) *core.Operation {
+	insp.section("Transaction")
+	insp.field("version", ts.Version)
+	insp.field("encrypted", ts.Encryption.Encrypted)
+	if ts.Encryption.Encrypted {
+		insp.field("recipients", len(ts.Encryption.Challenges))
+	}
+	insp.field("read status updates", ts.Pipeline.ReadStatusUpdates)
+	insp.field("read result", ts.Pipeline.ReadResult)
+	insp.field("keep alive", ts.Pipeline.KeepAlive)
+	if ts.Pipeline.Timeout > 0 {
+		insp.field("timeout (ms)", ts.Pipeline.Timeout)
+	}
+
+	// Decrypt transaction into operation
+	var key *rsa.PrivateKey
+	if ts.Encryption.Encrypted {
+		var source string
+		var err error
+		key, source, err = insp.getPrivateKey()
+		if err != nil {
+			insp.check("decryption", err)
+			return nil
+		}
+		if key == nil {
+			insp.skip("decryption", "no private key given")
+			return nil
+		}
+		insp.field("decryption key", source)
+	}
+	op, err := ts.Decrypt(key)
+	if ts.Encryption.Encrypted || err != nil {
+		insp.check("decryption", err)
+	}
+	return op
+}
+
+func (insp *inspector) inspectOperation(op *core.Operation) {
+	insp.section("Operation")
+	insp.field("request type", op.Meta.RequestType)
+	insp.field("timestamp", op.Meta.Timestamp)
+	if op.Meta.ChannelId != "" {
+		insp.field("channel", op.Meta.ChannelId)
+	}
+	if len(op.Meta.VectorClock) > 0 {
+		insp.field("vector clock", op.Meta.VectorClock)
+	}
+	insp.field("buffered", op.Meta.Buffered)
+	insp.field("encrypted", op.Encryption.Encrypted)
+
+	// Decrypt operation payload
+	var payload []byte
+	var err error
+	if op.Encryption.Encrypted {
+		insp.field("channel key id", op.Encryption.KeyId)
+		if insp.options.ChannelKey == "" {
+			insp.skip("decryption", "no channel key given")
+		} else {
+			var decrypt core.Decryptor
+			if decrypt, err = insp.getChannelDecryptor(); err == nil {
+				payload, err = op.Decrypt(decrypt)
+			}
+			insp.check("decryption", err)
+		}
+	} else {
+		payload, err = op.Decrypt(nil)
+		if err != nil {
+			insp.check("payload decoding", err)
+		}
+	}
+
+	// Verify signatures
+	insp.section("Signatures")
+	insp.inspectSigner("issuer", op.Issue, insp.options.IssuerKeyPath, payload, op.VerifyIssuer)
+	insp.inspectSigner("certifier", op.Certification, insp.options.CertifierKeyPath, payload, op.VerifyCertifier)
+
+	if payload != nil {
+		insp.printPayload(payload)
+	}
+}
+
+func (insp *inspector) inspectSigner(
+	role string,
+	fields core.OperationAuthenticationFields,
+	keyPath string,
+	payload []byte,
+	verify func(*rsa.PublicKey, []byte) error,
+) {
+	insp.field(role, fields.Id)
+	checkName := role + " signature"
+	if fields.Signature == "" {
+		insp.skip(checkName, "not signed")
+		return
+	}
+	if payload == nil {
+		insp.skip(checkName, "payload not decrypted")
+		return
+	}
+	key, source, err := insp.getSigningKey(keyPath, fields.Id)
+	if err != nil {
+		insp.check(checkName, err)
+		return
+	}
+	if key == nil {
+		insp.skip(checkName, "no public key given or in keyring")
+		return
+	}
+	insp.field(role+" key", source)
+	insp.check(checkName, verify(key, payload))
+}
+
+/*
+	Reads transaction or operation from stdin and prints its breakdown
+	(returns an error if any check failed)
+*/
+func Inspect(options InspectOptions) error {
+	raw, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	// Detect input type by its top level fields
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return errors.New(inspectInputFormat)
+	}
+	_, hasPipeline := fields["pipeline"]
+	_, hasMeta := fields["meta"]
+
+	insp := newInspector(options)
+	switch {
+	case hasPipeline:
+		ts := &core.Transaction{}
+		if err := ts.Decode(raw); err != nil {
+			return err
+		}
+		if op := insp.inspectTransaction(ts); op != nil {
+			insp.inspectOperation(op)
+		}
+	case hasMeta:
+		op := &core.Operation{}
+		if err := op.Decode(raw); err != nil {
+			return err
+		}
+		insp.inspectOperation(op)
+	default:
+		return errors.New(inspectInputFormat)
+	}
+
+	insp.section("Result")
+	if insp.failures > 0 {
+		cliWrite(fmt.Sprintf("  "+inspectChecksFailed+"\n", insp.failures))
+		return fmt.Errorf(inspectChecksFailed, insp.failures)
+	}
+	cliWrite("  all checks passed\n")
+	return nil
+}
@@ -4,9 +4,34 @@ import (
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/users"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 )
 
+/*
+	Install options (questions are only asked for choices not made by options)
+*/
+type InstallOptions struct {
+	// Answer yes to confirmations (re-install, default root user, generate keys)
+	Yes bool
+
+	// Root user id (default properties) or path to root user object file
+	RootUserId       string
+	RootUserFilePath string
+
+	// Directory with key files to import (named as generated keys)
+	ImportKeysDir string
+
+	// Ports (defaults are used if zero)
+	PipelinePort int
+	MetricsPort  int
+	NoMetrics    bool
+
+	// No output on success
+	Quiet bool
+}
+
 /*
 	Helpers
 */
@@ -16,7 +41,10 @@ func buildDaemonConfig() *Config {
 }
 
 func ensureCleanState() {
-	DeleteDmpcDir()
+	// Only remove directory if it holds an install (it may be user provided)
+	if IsInstalled() {
+		DeleteDmpcDir()
+	}
 	MakeDmpcDir()
 }
 
@@ -40,8 +68,11 @@ func getCliImportingKeys() bool {
 	return !cliConfirm("Would you like to generate new keys?")
 }
 
-func getCliRootUser() *users.UserObject {
-	userId := cliGetString("Enter the root user id you would like to use:")
+func getCliRootUserId() string {
+	return cliGetString("Enter the root user id you would like to use:")
+}
+
+func makeRootUser(userId string) *users.UserObject {
 	userObject := defaultUserObject
 	userObject.CreatedAt = time.Now()
 	userObject.UpdatedAt = time.Now()
@@ -80,34 +111,66 @@ func getCliSigningKeysPath() (string, string) {
 	return getCliKeysPath("signing")
 }
 
-func generateAndSaveKeys(isEncryption bool) (string, string) {
+/*
+	Generates key pair and saves it in directory (returns public and private paths)
+*/
+func saveNewKeys(isEncryption bool, dir ...string) (string, string, error) {
 	var baseFilename string = SigningKeyFilename
 	if isEncryption {
 		baseFilename = EncryptionKeyFilename
 	}
 
 	// Make directory containing keys
-	MkdirAll(KeysDir)
+	MkdirAll(dir...)
 
 	// Save private key to file
 	priv := core.GeneratePrivateKey()
 	privString := core.PrivateAsymKeyToString(priv)
-	if err := WriteFile([]byte(privString), KeysDir, baseFilename); err != nil {
-		MakeBadStateFile()
-		log.Fatalf("Failed to save private key file. err=%v", err)
+	privPath := append(append([]string{}, dir...), baseFilename)
+	if err := WriteFile([]byte(privString), privPath...); err != nil {
+		return "", "", err
 	}
 
 	// Save public key to file
 	public := &priv.PublicKey
 	publicString := core.PublicAsymKeyToString(public)
-	publicFilename := baseFilename + PublicKeySuffix
-	if err := WriteFile([]byte(publicString), KeysDir, publicFilename); err != nil {
-		MakeBadStateFile()
-		log.Fatalf("Failed to save public key file. err=%v", err)
+	publicPath := append(append([]string{}, dir...), baseFilename+PublicKeySuffix)
+	if err := WriteFile([]byte(publicString), publicPath...); err != nil {
+		return "", "", err
 	}
 
 	// Return paths
-	return GetInstallPath(KeysDir, publicFilename), GetInstallPath(KeysDir, baseFilename)
+	return GetInstallPath(publicPath...), GetInstallPath(privPath...), nil
+}
+
+func generateAndSaveKeys(isEncryption bool) (string, string) {
+	public, private, err := saveNewKeys(isEncryption, KeysDir)
+	if err != nil {
+		MakeBadStateFile()
+		log.Fatalf("Failed to save key files. err=%v", err)
+	}
+	return public, private
+}
+
+/*
+	Key paths in directory of keys to import
+*/
+func getImportedKeysPath(dir string, isEncryption bool) (string, string) {
+	var baseFilename string = SigningKeyFilename
+	if isEncryption {
+		baseFilename = EncryptionKeyFilename
+	}
+	private, err := filepath.Abs(filepath.Join(dir, baseFilename))
+	if err != nil {
+		log.Fatalf("Invalid keys directory. err=%v", err)
+	}
+	public := private + PublicKeySuffix
+	for _, keyPath := range []string{public, private} {
+		if file, err := os.Stat(keyPath); err != nil || !file.Mode().IsRegular() {
+			log.Fatalf("Key file not found: %v", keyPath)
+		}
+	}
+	return public, private
 }
 
 func generateAndSaveEncryptionKeys() (string, string) {
@@ -137,40 +200,69 @@ func informSuccess() {
 /*
 	Main install function
 */
-func Install() {
+func Install(options InstallOptions) {
 	// Check previous install
 	if IsInstalled() {
-		if !getCliWantToReinstall() {
+		if !options.Yes && !getCliWantToReinstall() {
 			return
 		}
 	}
 
+	// Check keys to import before removing anything
+	if options.ImportKeysDir != "" {
+		getImportedKeysPath(options.ImportKeysDir, true)
+		getImportedKeysPath(options.ImportKeysDir, false)
+	}
+
 	// Ensure everything is in a clean state
 	ensureCleanState()
 
 	// Prompt for configuration
 	conf := buildDaemonConfig()
+	if options.PipelinePort != 0 {
+		conf.Pipeline.Port = options.PipelinePort
+	}
+	if options.MetricsPort != 0 {
+		conf.Metrics.Port = options.MetricsPort
+	}
+	if options.NoMetrics {
+		conf.Metrics.Port = 0
+	}
 
 	// Build root user (except keys)
-	isImportingRootUser := getCliImportingRootUser()
-	if isImportingRootUser {
+	switch {
+	case options.RootUserFilePath != "":
+		rootUserFilePath, err := filepath.Abs(options.RootUserFilePath)
+		if err != nil {
+			log.Fatalf("Invalid root user file path. err=%v", err)
+		}
+		conf.Paths.RootUserFilePath = rootUserFilePath
+	case options.RootUserId != "":
+		conf.Paths.RootUserFilePath = saveRootUserObject(makeRootUser(options.RootUserId))
+	case options.Yes:
+		conf.Paths.RootUserFilePath = saveRootUserObject(makeRootUser(defaultRootUserId))
+	case getCliImportingRootUser():
 		conf.Paths.RootUserFilePath = getCliRootUserPath()
-	} else {
-		newRootUser := getCliRootUser()
-		conf.Paths.RootUserFilePath = saveRootUserObject(newRootUser)
+	default:
+		conf.Paths.RootUserFilePath = saveRootUserObject(makeRootUser(getCliRootUserId()))
 	}
 
 	// Build root user keys
-	isImportingKeys := getCliImportingKeys()
-	if isImportingKeys {
+	switch {
+	case options.ImportKeysDir != "":
+		conf.Paths.PublicEncryptionKeyPath, conf.Paths.PrivateEncryptionKeyPath = getImportedKeysPath(options.ImportKeysDir, true)
+		conf.Paths.PublicSigningKeyPath, conf.Paths.PrivateSigningKeyPath = getImportedKeysPath(options.ImportKeysDir, false)
+	case !options.Yes && getCliImportingKeys():
 		conf.Paths.PublicEncryptionKeyPath, conf.Paths.PrivateEncryptionKeyPath = getCliEncryptionKeysPath()
 		conf.Paths.PublicSigningKeyPath, conf.Paths.PrivateSigningKeyPath = getCliSigningKeysPath()
-	} else {
+	default:
 		conf.Paths.PublicEncryptionKeyPath, conf.Paths.PrivateEncryptionKeyPath = generateAndSaveEncryptionKeys()
 		conf.Paths.PublicSigningKeyPath, conf.Paths.PrivateSigningKeyPath = generateAndSaveSigningKeys()
 	}
 
 	saveConfig(conf)
 
-	informSuccess()
+	if !options.Quiet {
+		informSuccess()
+	}
 }
@@ -0,0 +1,183 @@
+package cli
+
+/*
+	Keyring of other users' public keys (used to encrypt transactions offline)
+*/
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"github.com/mngharbi/DMPC/core"
+	"log"
+	"sort"
+)
+
+/*
+	Error messages
+*/
+const (
+	invalidKeyringFormat   string = "Invalid keyring file format"
+	keyringEntryNotFound   string = "User not found in keyring"
+	keyringUserIdMissing   string = "Keyring entry requires a user id"
+	keyringEncKeyMissing   string = "Keyring entry requires a public encryption key"
+	keyringInvalidKeyError string = "Keyring entry has an invalid public key"
+)
+
+/*
+	Keyring definition (user id -> public keys)
+*/
+type KeyringEntry struct {
+	EncKey  string `json:"encKey"`
+	SignKey string `json:"signKey"`
+}
+
+type Keyring map[string]KeyringEntry
+
+/*
+	(En/De)coding
+*/
+func (kr Keyring) Encode() ([]byte, error) {
+	return json.MarshalIndent(kr, "", "  ")
+}
+
+/*
+	Reads keyring (empty if there is none yet)
+*/
+func ReadKeyring() (Keyring, error) {
+	kr := Keyring{}
+	if !PathExists(KeyringFilename) {
+		return kr, nil
+	}
+	raw, err := ReadFile(KeyringFilename)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &kr); err != nil {
+		return nil, errors.New(invalidKeyringFormat)
+	}
+	return kr, nil
+}
+
+func GetKeyring() Keyring {
+	kr, err := ReadKeyring()
+	if err != nil {
+		log.Fatalf(err.Error())
+		return nil
+	}
+	return kr
+}
+
+func (kr Keyring) save() {
+	encoded, err := kr.Encode()
+	if err != nil {
+		log.Fatalf("Failed to encode keyring. err=%v", err)
+	}
+	if err := WriteFile(encoded, KeyringFilename); err != nil {
+		log.Fatalf("Failed to save keyring file. err=%v", err)
+	}
+}
+
+/*
+	Returns encryption keys of users (false if at least one user is missing)
+*/
+func (kr Keyring) GetEncryptionKeys(userIds []string) ([]*rsa.PublicKey, bool) {
+	keys := []*rsa.PublicKey{}
+	for _, userId := range userIds {
+		entry, ok := kr[userId]
+		if !ok {
+			return nil, false
+		}
+		key, err := core.PublicStringToAsymKey(entry.EncKey)
+		if err != nil {
+			return nil, false
+		}
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+/*
+	Adds or replaces keyring entry
+*/
+func (kr Keyring) add(userId string, entry KeyringEntry) {
+	if userId == "" {
+		log.Fatalf(keyringUserIdMissing)
+	}
+	if entry.EncKey == "" {
+		log.Fatalf(keyringEncKeyMissing)
+	}
+	if _, err := core.PublicStringToAsymKey(entry.EncKey); err != nil {
+		log.Fatalf(keyringInvalidKeyError)
+	}
+	if entry.SignKey != "" {
+		if _, err := core.PublicStringToAsymKey(entry.SignKey); err != nil {
+			log.Fatalf(keyringInvalidKeyError)
+		}
+	}
+	kr[userId] = entry
+	kr.save()
+}
+
+/*
+	Adds user public keys from key files
+*/
+func AddKeyringEntry(userId string, encKeyPath string, signKeyPath string) {
+	if !IsFunctional() {
+		return
+	}
+	entry := KeyringEntry{}
+	var err error
+	if encKeyPath != "" {
+		if entry.EncKey, err = GetEncodedPublicKey(encKeyPath); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if signKeyPath != "" {
+		if entry.SignKey, err = GetEncodedPublicKey(signKeyPath); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	GetKeyring().add(userId, entry)
+}
+
+/*
+	Adds user public keys from user object read from stdin
+*/
+func ImportKeyringEntry() {
+	if !IsFunctional() {
+		return
+	}
+	obj := ReadUserObject()
+	GetKeyring().add(obj.Id, KeyringEntry{
+		EncKey:  obj.EncKey,
+		SignKey: obj.SignKey,
+	})
+}
+
+/*
+	Removes user from keyring
+*/
+func RemoveKeyringEntry(userId string) {
+	kr := GetKeyring()
+	if _, ok := kr[userId]; !ok {
+		log.Fatalf(keyringEntryNotFound)
+	}
+	delete(kr, userId)
+	kr.save()
+}
+
+/*
+	Lists users in keyring
+*/
+func ListKeyring() {
+	kr := GetKeyring()
+	userIds := []string{}
+	for userId := range kr {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+	for _, userId := range userIds {
+		cliWrite(userId + "\n")
+	}
+}
@@ -11,7 +11,7 @@ import (
 )
 
 /*
-   Generic public/private key parsing from file
+	Generic public/private key parsing from file
 */
 func GetPrivateKey(filePath string) (*rsa.PrivateKey, error) {
 	encodedKey, err := GetEncodedPrivateKey(filePath)
@@ -46,7 +46,7 @@ func GetEncodedPrivateKey(filePath string) (string, error) {
 }
 
 /*
-   Non encoded
+	Non encoded
 */
 func (conf *Config) GetPublicEncryptionKey() (*rsa.PublicKey, error) {
 	return GetPublicKey(conf.Paths.PublicEncryptionKeyPath)
@@ -65,7 +65,7 @@ func (conf *Config) GetPrivateSigningKey() (*rsa.PrivateKey, error) {
 }
 
 /*
-   Encoded
+	Encoded
 */
 func (conf *Config) GetEncodedPublicEncryptionKey() (string, error) {
 	return GetEncodedPublicKey(conf.Paths.PublicEncryptionKeyPath)
@@ -27,32 +27,26 @@ func WriteOperation(op *core.Operation) {
 }
 
 /*
-	Sign operation using root user
+	Sign operation using current identity (root user unless another identity is selected)
 */
-func RootSignOperation(op *core.Operation, issue bool, certify bool) {
-	// Get configuration structure
-	conf := GetConfig()
+func SignOperation(op *core.Operation, issue bool, certify bool) {
+	// Get identity
+	id := GetIdentity()
 
-	// Get root user object
-	userObj, err := conf.getRootUserObjectWithoutKeys()
-	if err != nil {
-		log.Fatalf(parseUserWithoutKeysError)
-	}
-
-	// Get root user signing key
-	key, err := conf.GetPrivateSigningKey()
+	// Get identity signing key
+	key, err := id.GetPrivateSigningKey()
 	if err != nil {
 		log.Fatalf(parseSigningError)
 	}
 
 	// Sign operation
 	if issue {
-		if err = op.IssuerSign(key, userObj.Id); err != nil {
+		if err = op.IssuerSign(key, id.UserId); err != nil {
 			log.Fatalf(err.Error())
 		}
 	}
 	if certify {
-		if err = op.CertifierSign(key, userObj.Id); err != nil {
+		if err = op.CertifierSign(key, id.UserId); err != nil {
 			log.Fatalf(err.Error())
 		}
 	}
@@ -70,7 +64,7 @@ func ReadAndSignOperation(issue bool, certify bool) {
 	op := ReadOperation()
 
 	// Do sign
-	RootSignOperation(op, issue, certify)
+	SignOperation(op, issue, certify)
 
 	// Write operation to stdout
 	WriteOperation(op)
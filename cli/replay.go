@@ -0,0 +1,343 @@
+package cli
+
+/*
+	Replay of recorded transactions (one JSON record or transaction per line)
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/pipeline"
+	"github.com/mngharbi/DMPC/status"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	Error messages
+*/
+const (
+	replayFileError   string = "Unable to read replay file. err=%v"
+	replayReportError string = "Unable to write replay report. err=%v"
+	replayLineInvalid string = "Line is neither a recorded transaction nor a transaction"
+)
+
+/*
+	Defaults
+*/
+const (
+	defaultReplayConcurrency int           = 16
+	defaultReplayTimeout     time.Duration = 30 * time.Second
+	replayMaxLineSize        int           = 16 * 1024 * 1024
+)
+
+/*
+	Outcomes of replayed transactions
+*/
+type ReplayOutcomeCode string
+
+const (
+	ReplaySuccess          ReplayOutcomeCode = "success"
+	ReplayFailed           ReplayOutcomeCode = "failed"
+	ReplayCancelled        ReplayOutcomeCode = "cancelled"
+	ReplayRejected         ReplayOutcomeCode = "rejected"
+	ReplayTimeout          ReplayOutcomeCode = "timeout"
+	ReplayConnectionFailed ReplayOutcomeCode = "connection_failed"
+	ReplayInvalid          ReplayOutcomeCode = "invalid"
+)
+
+/*
+	Replay options
+*/
+type ReplayOptions struct {
+	// Waits between transactions as recorded (max speed otherwise)
+	PreserveTiming bool
+
+	// Transactions in flight at once (defaults to 16)
+	Concurrency int
+
+	// Time allowed for each transaction (defaults to 30 seconds)
+	Timeout time.Duration
+
+	// File JSON report is written to (summary only if empty)
+	ReportPath string
+}
+
+/*
+	Report structure
+*/
+type ReplayOutcome struct {
+	Line      int               `json:"line"`
+	Ticket    status.Ticket     `json:"ticket,omitempty"`
+	Outcome   ReplayOutcomeCode `json:"outcome"`
+	Errors    []string          `json:"errors,omitempty"`
+	LatencyMs int64             `json:"latency_ms"`
+}
+
+type ReplayReport struct {
+	Started    time.Time                 `json:"started"`
+	DurationMs int64                     `json:"duration_ms"`
+	Total      int                       `json:"total"`
+	Counts     map[ReplayOutcomeCode]int `json:"counts"`
+	Outcomes   []*ReplayOutcome          `json:"outcomes"`
+}
+
+/*
+	Parsing
+*/
+
+type replayEntry struct {
+	line        int
+	time        time.Time
+	transaction *core.Transaction
+	err         error
+}
+
+// Lines are either records written by the server or plain transactions
+func parseReplayLine(line int, raw []byte) *replayEntry {
+	entry := &replayEntry{line: line}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		entry.err = fmt.Errorf(replayLineInvalid)
+		return entry
+	}
+	if _, isRecord := fields["transaction"]; isRecord {
+		record := &pipeline.RecordedTransaction{}
+		if err := json.Unmarshal(raw, record); err != nil || record.Transaction == nil {
+			entry.err = fmt.Errorf(replayLineInvalid)
+			return entry
+		}
+		entry.time = record.Time
+		entry.transaction = record.Transaction
+		return entry
+	}
+	if _, isTransaction := fields["pipeline"]; isTransaction {
+		entry.transaction = &core.Transaction{}
+		if err := entry.transaction.Decode(raw); err != nil {
+			entry.err = fmt.Errorf(replayLineInvalid)
+		}
+		return entry
+	}
+	entry.err = fmt.Errorf(replayLineInvalid)
+	return entry
+}
+
+func readReplayFile(path string) ([]*replayEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []*replayEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), replayMaxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		entries = append(entries, parseReplayLine(line, raw))
+	}
+	return entries, scanner.Err()
+}
+
+/*
+	Running one transaction (dedicated connection, status updates are read to get the ticket)
+*/
+
+func replayTransaction(connUrl string, ts *core.Transaction, timeout time.Duration) *ReplayOutcome {
+	outcome := &ReplayOutcome{}
+	ts.Pipeline.ReadStatusUpdates = true
+	ts.Pipeline.ReadResult = true
+	ts.Pipeline.KeepAlive = false
+	tsEncoded, err := ts.Encode()
+	if err != nil {
+		outcome.Outcome = ReplayInvalid
+		outcome.Errors = []string{err.Error()}
+		return outcome
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: timeout}
+	conn, _, err := dialer.Dial(connUrl, nil)
+	if err != nil {
+		outcome.Outcome = ReplayConnectionFailed
+		outcome.Errors = []string{err.Error()}
+		return outcome
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if err = doSendMessage(conn, tsEncoded); err != nil {
+		outcome.Outcome = ReplayConnectionFailed
+		outcome.Errors = []string{err.Error()}
+		return outcome
+	}
+
+	// Read until pipeline closes connection
+	for {
+		frame, err := doReadMessage(conn)
+		if err != nil {
+			setReplayConnectionOutcome(outcome, err)
+			return outcome
+		}
+		record := &status.StatusRecord{}
+		if err := record.UnmarshalJSON(frame); err != nil || len(record.Id) == 0 || len(record.Status) == 0 {
+			continue
+		}
+		outcome.Ticket = record.Id
+		switch record.Status {
+		case status.FailedStatus:
+			outcome.Outcome = ReplayFailed
+		case status.CancelledStatus:
+			outcome.Outcome = ReplayCancelled
+		}
+		for _, recordErr := range record.Errs {
+			outcome.Errors = append(outcome.Errors, recordErr.Error())
+		}
+	}
+}
+
+func setReplayConnectionOutcome(outcome *ReplayOutcome, err error) {
+	if len(outcome.Outcome) > 0 {
+		return
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		outcome.Outcome = ReplayTimeout
+		return
+	}
+	switch {
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure):
+		outcome.Outcome = ReplaySuccess
+	case websocket.IsCloseError(err, websocket.CloseUnsupportedData):
+		outcome.Outcome = ReplayRejected
+	default:
+		outcome.Outcome = ReplayConnectionFailed
+		outcome.Errors = []string{err.Error()}
+	}
+}
+
+/*
+	Report
+*/
+
+func (report *ReplayReport) write(path string) error {
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(encoded)
+	return err
+}
+
+func (report *ReplayReport) printSummary() {
+	for _, outcome := range report.Outcomes {
+		ticket := string(outcome.Ticket)
+		if len(ticket) == 0 {
+			ticket = "-"
+		}
+		line := fmt.Sprintf("line %-6v %-18v ticket=%v latency=%vms", outcome.Line, outcome.Outcome, ticket, outcome.LatencyMs)
+		if len(outcome.Errors) > 0 {
+			line += fmt.Sprintf(" errors=%v", outcome.Errors)
+		}
+		cliWrite(line + "\n")
+	}
+	cliWrite(fmt.Sprintf("\n%v transactions replayed in %vms\n", report.Total, report.DurationMs))
+	for _, code := range []ReplayOutcomeCode{ReplaySuccess, ReplayFailed, ReplayCancelled, ReplayRejected, ReplayTimeout, ReplayConnectionFailed, ReplayInvalid} {
+		if count := report.Counts[code]; count > 0 {
+			cliWrite(fmt.Sprintf("  %-18v %v\n", code, count))
+		}
+	}
+}
+
+/*
+	Streams recorded transactions into the pipeline and reports outcome of each one
+*/
+func Replay(path string, options ReplayOptions) {
+	if !IsFunctional() {
+		return
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultReplayConcurrency
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = defaultReplayTimeout
+	}
+
+	entries, err := readReplayFile(path)
+	if err != nil {
+		log.Fatalf(replayFileError, err)
+	}
+
+	conf := GetConfig()
+	connUrl := url.URL{
+		Scheme: "ws",
+		Host:   makeAddrString(conf.Pipeline.Hostname, conf.Pipeline.Port),
+		Path:   pipelinePath,
+	}
+
+	report := &ReplayReport{
+		Started:  time.Now(),
+		Total:    len(entries),
+		Counts:   map[ReplayOutcomeCode]int{},
+		Outcomes: make([]*ReplayOutcome, len(entries)),
+	}
+
+	// Dispatch transactions (keeping recorded gaps if timing is preserved)
+	var firstTime time.Time
+	waitGroup := &sync.WaitGroup{}
+	slots := make(chan bool, options.Concurrency)
+	for index, entry := range entries {
+		if entry.err != nil {
+			report.Outcomes[index] = &ReplayOutcome{
+				Line:    entry.line,
+				Outcome: ReplayInvalid,
+				Errors:  []string{entry.err.Error()},
+			}
+			continue
+		}
+		if options.PreserveTiming && !entry.time.IsZero() {
+			if firstTime.IsZero() {
+				firstTime = entry.time
+			}
+			time.Sleep(time.Until(report.Started.Add(entry.time.Sub(firstTime))))
+		}
+
+		slots <- true
+		waitGroup.Add(1)
+		go func(index int, entry *replayEntry) {
+			defer waitGroup.Done()
+			start := time.Now()
+			outcome := replayTransaction(connUrl.String(), entry.transaction, options.Timeout)
+			outcome.Line = entry.line
+			outcome.LatencyMs = int64(time.Since(start) / time.Millisecond)
+			report.Outcomes[index] = outcome
+			<-slots
+		}(index, entry)
+	}
+	waitGroup.Wait()
+
+	// Summarize
+	report.DurationMs = int64(time.Since(report.Started) / time.Millisecond)
+	for _, outcome := range report.Outcomes {
+		report.Counts[outcome.Outcome]++
+	}
+	report.printSummary()
+	if options.ReportPath != "" {
+		if err := report.write(options.ReportPath); err != nil {
+			log.Fatalf(replayReportError, err)
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 /*
-   Error messages
+	Error messages
 */
 const (
 	parseUserWithoutKeysError string = "Could not find user object file"
@@ -21,7 +21,7 @@ const (
 )
 
 /*
-   Utilities
+	Utilities
 */
 func (conf *Config) GetRootUserFilePath() string {
 	return conf.Paths.RootUserFilePath
@@ -76,9 +76,9 @@ func WrapPayloadInGenericOperation(payload []byte, requestType core.RequestType)
 	}
 }
 
-func WrapPayloadInRootSignedGenericOperation(payload []byte, requestType core.RequestType) *core.Operation {
+func WrapPayloadInSignedGenericOperation(payload []byte, requestType core.RequestType) *core.Operation {
 	op := WrapPayloadInGenericOperation(payload, requestType)
-	RootSignOperation(op, true, true)
+	SignOperation(op, true, true)
 	return op
 }
 
@@ -107,6 +107,15 @@ func GenerateTransaction(ignoreResult bool, statusUpdates bool, keepAlive bool,
 
 	// Encrypt for recepients if any
 	if len(recepients) > 0 {
+		// Encrypt offline if all recepients are in keyring
+		if keys, found := GetKeyring().GetEncryptionKeys(recepients); found {
+			if err := ts.Encrypt(keys); err != nil {
+				log.Fatal(err.Error())
+			}
+			WriteTransaction(ts)
+			return
+		}
+
 		// Set up challenges map for recepients
 		ts.Encryption.Challenges = make(map[string]string)
 		for _, recepient := range recepients {
@@ -116,7 +125,7 @@ func GenerateTransaction(ignoreResult bool, statusUpdates bool, keepAlive bool,
 		// Prepare transaction encrypt request transaction
 		tsEncoded, _ := ts.Encode()
 		encryptionTs := WrapOperationInResultOnlyTransaction(
-			WrapPayloadInRootSignedGenericOperation(tsEncoded, core.TransactionEncryptType),
+			WrapPayloadInSignedGenericOperation(tsEncoded, core.TransactionEncryptType),
 		)
 		encryptionTsEncoded, _ := encryptionTs.Encode()
 
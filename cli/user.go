@@ -82,6 +82,56 @@ func GenerateUserCreateOperation() {
 	// Generate request
 	requestEncoded, _ := users.GenerateCreateRequest(obj, currentTime).Encode()
 
+	writeUserOperation(requestEncoded, currentTime, false)
+}
+
+/*
+	Permission fields that can be updated from the CLI
+*/
+type UserPermissionFlag struct {
+	Name  string
+	Field string
+}
+
+var UserPermissionFlags []UserPermissionFlag = []UserPermissionFlag{
+	{"channel-add", "permissions.channel.add"},
+	{"channel-read", "permissions.channel.read"},
+	{"user-add", "permissions.user.add"},
+	{"user-read", "permissions.user.read"},
+	{"user-remove", "permissions.user.remove"},
+	{"user-enckey-update", "permissions.user.encKeyUpdate"},
+	{"user-signkey-update", "permissions.user.signKeyUpdate"},
+	{"user-permissions-update", "permissions.user.permissionsUpdate"},
+	{"active", "active"},
+}
+
+func setUserField(obj *users.UserObject, field string, value bool) {
+	switch field {
+	case "permissions.channel.add":
+		obj.Permissions.Channel.Add = value
+	case "permissions.channel.read":
+		obj.Permissions.Channel.Read = value
+	case "permissions.user.add":
+		obj.Permissions.User.Add = value
+	case "permissions.user.read":
+		obj.Permissions.User.Read = value
+	case "permissions.user.remove":
+		obj.Permissions.User.Remove = value
+	case "permissions.user.encKeyUpdate":
+		obj.Permissions.User.EncKeyUpdate = value
+	case "permissions.user.signKeyUpdate":
+		obj.Permissions.User.SignKeyUpdate = value
+	case "permissions.user.permissionsUpdate":
+		obj.Permissions.User.PermissionsUpdate = value
+	case "active":
+		obj.Active = value
+	}
+}
+
+/*
+	Generic user operation (written to stdout)
+*/
+func writeUserOperation(requestEncoded []byte, currentTime time.Time, sign bool) {
 	// Generate non-encrypted/unsigned operation
 	op := core.GenerateOperation(
 		false,
@@ -102,6 +152,96 @@ func GenerateUserCreateOperation() {
 	// Set timestamp
 	op.Meta.Timestamp = currentTime
 
+	// Sign operation
+	if sign {
+		SignOperation(op, true, true)
+	}
+
 	// Write operation to stdout
 	WriteOperation(op)
 }
+
+/*
+	Generate user update operation
+	Fields are set from permission values (by field name) and public key files if any
+*/
+func GenerateUserUpdateOperation(userId string, values map[string]bool, encKeyPath string, signKeyPath string, sign bool) {
+	// Read user id if none passed
+	if userId == "" {
+		userId = cliGetString("Enter the user id:")
+	}
+
+	currentTime := time.Now()
+	obj := &users.UserObject{
+		Id:        userId,
+		UpdatedAt: currentTime,
+	}
+	fields := []string{}
+
+	// Set permissions and active flag
+	for _, flag := range UserPermissionFlags {
+		if value, ok := values[flag.Field]; ok {
+			setUserField(obj, flag.Field, value)
+			fields = append(fields, flag.Field)
+		}
+	}
+
+	// Read keys from paths
+	var err error
+	if encKeyPath != "" {
+		if obj.EncKey, err = GetEncodedPublicKey(encKeyPath); err != nil {
+			log.Fatal(err.Error())
+		}
+		fields = append(fields, "encKey")
+	}
+	if signKeyPath != "" {
+		if obj.SignKey, err = GetEncodedPublicKey(signKeyPath); err != nil {
+			log.Fatal(err.Error())
+		}
+		fields = append(fields, "signKey")
+	}
+
+	if len(fields) == 0 {
+		log.Fatalf("No user fields to update")
+	}
+
+	// Generate request
+	requestEncoded, _ := users.GenerateUpdateRequest(obj, fields, currentTime).Encode()
+
+	writeUserOperation(requestEncoded, currentTime, sign)
+}
+
+/*
+	Generate user deactivation operation
+*/
+func GenerateUserDeactivateOperation(userId string, sign bool) {
+	GenerateUserUpdateOperation(userId, map[string]bool{"active": false}, "", "", sign)
+}
+
+/*
+	Generate user keys rotation operation
+*/
+func GenerateUserRotateKeysOperation(userId string, encKeyPath string, signKeyPath string, sign bool) {
+	if encKeyPath == "" && signKeyPath == "" {
+		encKeyPath = cliGetFilePath("Path to new encryption key file:")
+		signKeyPath = cliGetFilePath("Path to new signing key file:")
+	}
+	GenerateUserUpdateOperation(userId, nil, encKeyPath, signKeyPath, sign)
+}
+
+/*
+	Generate user read operation
+*/
+func GenerateUserReadOperation(userIds []string, sign bool) {
+	// Read user id if none passed
+	if len(userIds) == 0 {
+		userIds = []string{cliGetString("Enter the user id:")}
+	}
+
+	currentTime := time.Now()
+
+	// Generate request
+	requestEncoded, _ := users.GenerateReadRequest(userIds, currentTime).Encode()
+
+	writeUserOperation(requestEncoded, currentTime, sign)
+}
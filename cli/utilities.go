@@ -4,19 +4,41 @@ import (
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 )
 
+/*
+	Configuration directory (~/.dmpc unless overridden)
+*/
+var installRootOverride string = ""
+
+func SetInstallRoot(dir string) {
+	if dir == "" {
+		installRootOverride = ""
+		return
+	}
+
+	// Paths saved in configuration must not depend on working directory
+	if absDir, err := filepath.Abs(dir); err == nil {
+		dir = absDir
+	}
+	installRootOverride = dir
+}
+
 /*
 	Utilities for getting paths
 */
 func GetInstallPath(paths ...string) string {
-	full := []string{getRootDir(), ConfigDir}
+	full := []string{GetInstallRoot()}
 	full = append(full, paths...)
 	return path.Join(full...)
 }
 
 func GetInstallRoot() string {
-	return GetInstallPath()
+	if installRootOverride != "" {
+		return installRootOverride
+	}
+	return path.Join(getRootDir(), ConfigDir)
 }
 
 /*
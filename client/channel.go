@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/core"
+	"time"
+)
+
+/*
+	Errors
+*/
+var (
+	channelResponseFormatError    error = core.NewError(core.InvalidFormatErrorCode, "Channels response is invalid.")
+	messageResponseFormatError    error = core.NewError(core.InvalidFormatErrorCode, "Messages response is invalid.")
+	encryptedOperationFormatError error = core.NewError(core.InvalidFormatErrorCode, "Channel encryption response is invalid.")
+	channelObjectMissingError     error = core.NewError(core.InvalidRequestErrorCode, "Channel open requires a channel object with an id.")
+)
+
+/*
+	Runs channel action and returns channel object
+*/
+func (cl *Client) runChannelAction(ctx context.Context, requestType core.RequestType, channelId string, payload []byte, timestamp time.Time) (*channels.ChannelObject, error) {
+	frame, err := cl.runSigned(ctx, requestType, channelId, payload, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return parseChannelResponse(frame)
+}
+
+func parseChannelResponse(frame []byte) (*channels.ChannelObject, error) {
+	resp, err := parseChannelsResponse(frame)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Channel, nil
+}
+
+func parseChannelsResponse(frame []byte) (*channels.ChannelsResponse, error) {
+	resp := &channels.ChannelsResponse{}
+	if err := json.Unmarshal(frame, resp); err != nil {
+		return nil, channelResponseFormatError
+	}
+	if resp.Result != channels.ChannelsSuccess {
+		return nil, resp.GetError()
+	}
+	return resp, nil
+}
+
+/*
+	Opens channel with a newly generated key (key id is generated if missing)
+*/
+func (cl *Client) OpenChannel(ctx context.Context, ch *channels.ChannelObject) (*channels.ChannelObject, error) {
+	if ch == nil || len(ch.Id) == 0 {
+		return nil, channelObjectMissingError
+	}
+	if len(ch.KeyId) == 0 {
+		ch.KeyId = core.GenerateUniqueId()
+	}
+	ch.State = channels.ChannelObjectOpenState
+
+	// Make request
+	currentTime := time.Now()
+	rq := &channels.OpenChannelRequest{
+		Channel:   ch,
+		Key:       core.GenerateSymmetricKey(),
+		Timestamp: currentTime,
+	}
+	rqEncoded, err := rq.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return cl.runChannelAction(ctx, core.AddChannelType, ch.Id, rqEncoded, currentTime)
+}
+
+/*
+	Closes channel
+*/
+func (cl *Client) CloseChannel(ctx context.Context, channelId string) (*channels.ChannelObject, error) {
+	currentTime := time.Now()
+	rq := &channels.CloseChannelRequest{
+		Timestamp: currentTime,
+	}
+	rqEncoded, err := rq.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	// Closure carries clock so it is ordered with messages
+	op, err := cl.signedOperation(core.CloseChannelType, channelId, rqEncoded, currentTime)
+	if err != nil {
+		return nil, err
+	}
+	op.Meta.VectorClock = cl.tick(channelId)
+	frame, err := cl.runOperation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	return parseChannelResponse(frame)
+}
+
+/*
+	Reads channel
+*/
+func (cl *Client) ReadChannel(ctx context.Context, channelId string) (*channels.ChannelObject, error) {
+	rq := &channels.ReadChannelRequest{}
+	rqEncoded, err := rq.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return cl.runChannelAction(ctx, core.ReadChannelType, channelId, rqEncoded, time.Now())
+}
+
+/*
+	Lists channels readable by user (filters are ignored if not set)
+*/
+func (cl *Client) ListChannels(ctx context.Context, filter *channels.ListChannelsRequest) ([]*channels.ChannelObject, error) {
+	if filter == nil {
+		filter = &channels.ListChannelsRequest{}
+	}
+	rqEncoded, err := filter.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := cl.runSigned(ctx, core.ListChannelsType, "", rqEncoded, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := parseChannelsResponse(frame)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Channels == nil {
+		return []*channels.ChannelObject{}, nil
+	}
+	return resp.Channels, nil
+}
+
+/*
+	Encrypts operation with the channel key (the node holds channel keys)
+*/
+func (cl *Client) encryptForChannel(ctx context.Context, op *core.Operation) (*core.Operation, error) {
+	opEncoded, err := op.Encode()
+	if err != nil {
+		return nil, err
+	}
+	frame, err := cl.runSigned(ctx, core.ChannelEncryptType, op.Meta.ChannelId, opEncoded, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := &core.Operation{}
+	if err = encrypted.Decode(frame); err != nil || !encrypted.Encryption.Encrypted {
+		return nil, encryptedOperationFormatError
+	}
+	return encrypted, nil
+}
+
+/*
+	Signs message, encrypts it with the channel key, and adds it to the channel
+*/
+func (cl *Client) SendMessage(ctx context.Context, channelId string, message []byte) error {
+	// Make signed operation and encrypt it
+	op, err := cl.signedOperation(core.AddMessageType, channelId, channels.EncodeMessage(message), time.Now())
+	if err != nil {
+		return err
+	}
+	op.Meta.VectorClock = cl.tick(channelId)
+	encrypted, err := cl.encryptForChannel(ctx, op)
+	if err != nil {
+		return err
+	}
+
+	// Add encrypted message
+	frame, err := cl.runOperation(ctx, encrypted)
+	if err != nil {
+		return err
+	}
+
+	// Parse response
+	resp := &channels.MessagesResponse{}
+	if err = json.Unmarshal(frame, resp); err != nil {
+		return messageResponseFormatError
+	}
+	if resp.Result != channels.MessagesSuccess {
+		return resp.GetError()
+	}
+	return nil
+}
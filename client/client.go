@@ -0,0 +1,255 @@
+package client
+
+/*
+	Client for the pipeline (websocket API of a node)
+*/
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/status"
+	"net/url"
+	"sync"
+	"time"
+)
+
+/*
+	Errors
+*/
+var (
+	missingIdentityError  error = core.NewError(core.InvalidRequestErrorCode, "Client requires a user id and a signing key.")
+	clientClosedError     error = core.NewError(core.ConnectionFailedErrorCode, "Client is closed.")
+	connectionClosedError error = core.NewError(core.ConnectionFailedErrorCode, "Pipeline closed the connection.")
+	requestRejectedError  error = core.NewError(core.RequestRejectedErrorCode, "Pipeline rejected the transaction.")
+	unexpectedFrameError  error = core.NewError(core.InvalidFormatErrorCode, "Unexpected response from pipeline.")
+	requestFailedError    error = core.NewError(core.RequestFailedErrorCode, "Request failed.")
+	requestCancelledError error = core.NewError(core.CancelledErrorCode, "Request was cancelled.")
+)
+
+const (
+	pipelinePath       string        = "/"
+	defaultDialTimeout time.Duration = 10 * time.Second
+)
+
+/*
+	Client options
+*/
+type Options struct {
+	Hostname string
+	Port     int
+
+	// Identity used to sign operations (issuer and certifier)
+	UserId     string
+	SigningKey *rsa.PrivateKey
+
+	// Timeout for opening connections (defaults to 10 seconds)
+	DialTimeout time.Duration
+}
+
+/*
+	Client definition
+	Requests are run one at a time on a single connection kept alive between requests
+	(subscriptions use their own connection)
+*/
+type Client struct {
+	options Options
+	dialer  *websocket.Dialer
+
+	// Shared connection (opened lazily and reopened if it breaks)
+	lock   sync.Mutex
+	conn   *websocket.Conn
+	closed bool
+
+	// Vector clocks by channel (own operations and events observed)
+	clockLock sync.Mutex
+	clocks    map[string]core.VectorClock
+}
+
+/*
+	Makes a client and opens its connection
+*/
+func Connect(options Options) (*Client, error) {
+	if len(options.UserId) == 0 || options.SigningKey == nil {
+		return nil, missingIdentityError
+	}
+	if options.DialTimeout == 0 {
+		options.DialTimeout = defaultDialTimeout
+	}
+
+	cl := &Client{
+		options: options,
+		dialer: &websocket.Dialer{
+			HandshakeTimeout: options.DialTimeout,
+		},
+		clocks: map[string]core.VectorClock{},
+	}
+
+	// Open connection right away to report unreachable nodes early
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	if err := cl.ensureConnection(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return cl, nil
+}
+
+/*
+	Closes shared connection (subscriptions are left open)
+*/
+func (cl *Client) Close() error {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	cl.closed = true
+	return cl.dropConnection()
+}
+
+/*
+	Connection management
+*/
+
+func (cl *Client) url() string {
+	connUrl := url.URL{
+		Scheme: "ws",
+		Host:   fmt.Sprintf("%v:%v", cl.options.Hostname, cl.options.Port),
+		Path:   pipelinePath,
+	}
+	return connUrl.String()
+}
+
+func (cl *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := cl.dialer.DialContext(ctx, cl.url(), nil)
+	if err != nil {
+		return nil, core.NewError(core.ConnectionFailedErrorCode, err.Error())
+	}
+	return conn, nil
+}
+
+// Should be called with client locked
+func (cl *Client) ensureConnection(ctx context.Context) error {
+	if cl.closed {
+		return clientClosedError
+	}
+	if cl.conn != nil {
+		return nil
+	}
+	conn, err := cl.dial(ctx)
+	if err != nil {
+		return err
+	}
+	cl.conn = conn
+	return nil
+}
+
+// Should be called with client locked
+func (cl *Client) dropConnection() error {
+	if cl.conn == nil {
+		return nil
+	}
+	conn := cl.conn
+	cl.conn = nil
+	closeConnection(conn)
+	return conn.Close()
+}
+
+func closeConnection(conn *websocket.Conn) {
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+}
+
+/*
+	Unblocks reads on a connection when context is done (until stop is closed)
+*/
+func watchContext(ctx context.Context, conn *websocket.Conn, stop chan bool, done chan bool) {
+	select {
+	case <-ctx.Done():
+		conn.SetReadDeadline(time.Now())
+	case <-stop:
+	}
+	close(done)
+}
+
+/*
+	Runs one transaction on the shared connection and returns its result frame
+*/
+func (cl *Client) run(ctx context.Context, ts *core.Transaction) ([]byte, error) {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	if err := cl.ensureConnection(ctx); err != nil {
+		return nil, err
+	}
+
+	// Respect context deadline and cancellation while waiting for result
+	stop := make(chan bool)
+	done := make(chan bool)
+	go watchContext(ctx, cl.conn, stop, done)
+	frame, err := exchange(cl.conn, ts)
+	close(stop)
+	<-done
+
+	if err != nil {
+		// Connection state is unknown after a failed exchange
+		cl.dropConnection()
+		if ctx.Err() != nil {
+			return nil, core.ContextError(ctx)
+		}
+		return nil, err
+	}
+	cl.conn.SetReadDeadline(time.Time{})
+
+	return frame, parseFailure(frame)
+}
+
+func exchange(conn *websocket.Conn, ts *core.Transaction) ([]byte, error) {
+	tsEncoded, err := ts.Encode()
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.WriteMessage(websocket.TextMessage, tsEncoded); err != nil {
+		return nil, core.NewError(core.ConnectionFailedErrorCode, err.Error())
+	}
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		if websocket.IsCloseError(err, websocket.CloseUnsupportedData) {
+			return nil, requestRejectedError
+		}
+		return nil, connectionClosedError
+	}
+	return frame, nil
+}
+
+/*
+	Failed requests are reported as status records (results are written as is)
+	Only frames carrying both a ticket and a status are treated as status records,
+	so results and events that happen to decode as one are not mistaken for failures
+*/
+func parseFailure(frame []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(frame, &fields); err != nil {
+		return nil
+	}
+	if _, ok := fields["ticket"]; !ok {
+		return nil
+	}
+	if _, ok := fields["status"]; !ok {
+		return nil
+	}
+	record := &status.StatusRecord{}
+	if err := record.UnmarshalJSON(frame); err != nil {
+		return unexpectedFrameError
+	}
+	if record.Status != status.FailedStatus && record.Status != status.CancelledStatus {
+		return nil
+	}
+	if len(record.Errs) > 0 {
+		return record.Errs[0]
+	}
+	if record.Status == status.CancelledStatus {
+		return requestCancelledError
+	}
+	return requestFailedError
+}
@@ -0,0 +1,42 @@
+package client
+
+/*
+	Causal metadata of channel operations
+*/
+
+import (
+	"github.com/mngharbi/DMPC/core"
+)
+
+/*
+	Advances clock of channel for an operation by the client user
+*/
+func (cl *Client) tick(channelId string) core.VectorClock {
+	cl.clockLock.Lock()
+	defer cl.clockLock.Unlock()
+	clock := cl.clocks[channelId].Increment(cl.options.UserId)
+	cl.clocks[channelId] = clock
+	return clock.Copy()
+}
+
+/*
+	Merges clock of an operation seen in the channel
+	(subscriptions observe clocks of events automatically)
+*/
+func (cl *Client) ObserveClock(channelId string, clock core.VectorClock) {
+	if len(clock) == 0 {
+		return
+	}
+	cl.clockLock.Lock()
+	defer cl.clockLock.Unlock()
+	cl.clocks[channelId] = cl.clocks[channelId].Merge(clock)
+}
+
+/*
+	Current clock of channel
+*/
+func (cl *Client) Clock(channelId string) core.VectorClock {
+	cl.clockLock.Lock()
+	defer cl.clockLock.Unlock()
+	return cl.clocks[channelId].Copy()
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"github.com/mngharbi/DMPC/core"
+	"time"
+)
+
+/*
+	Generators
+*/
+
+func keepAliveTransaction(op *core.Operation) (*core.Transaction, error) {
+	opEncoded, err := op.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &core.Transaction{
+		Version: core.Version,
+		Encryption: core.TransactionEncryptionFields{
+			Encrypted:  false,
+			Challenges: nil,
+			Nonce:      "",
+		},
+		Pipeline: core.PipelineConfig{
+			ReadStatusUpdates: false,
+			ReadResult:        true,
+			KeepAlive:         true,
+		},
+		Payload: core.PlaintextEncode(opEncoded),
+	}, nil
+}
+
+/*
+	Makes operation signed by client user (as issuer and certifier)
+*/
+func (cl *Client) signedOperation(requestType core.RequestType, channelId string, payload []byte, timestamp time.Time) (*core.Operation, error) {
+	// Generate non-encrypted/unsigned operation
+	op := core.GenerateOperation(
+		false,
+		"",
+		nil,
+		false,
+		"",
+		nil,
+		false,
+		"",
+		nil,
+		false,
+		requestType,
+		payload,
+		false,
+	)
+	op.Meta.ChannelId = channelId
+	op.Meta.Timestamp = timestamp
+
+	// Sign operation
+	if err := op.IssuerSign(cl.options.SigningKey, cl.options.UserId); err != nil {
+		return nil, err
+	}
+	if err := op.CertifierSign(cl.options.SigningKey, cl.options.UserId); err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
+/*
+	Runs operation and returns its result
+*/
+func (cl *Client) runOperation(ctx context.Context, op *core.Operation) ([]byte, error) {
+	ts, err := keepAliveTransaction(op)
+	if err != nil {
+		return nil, err
+	}
+	return cl.run(ctx, ts)
+}
+
+/*
+	Makes, signs, and runs operation
+*/
+func (cl *Client) runSigned(ctx context.Context, requestType core.RequestType, channelId string, payload []byte, timestamp time.Time) ([]byte, error) {
+	op, err := cl.signedOperation(requestType, channelId, payload, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return cl.runOperation(ctx, op)
+}
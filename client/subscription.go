@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/core"
+	"sync"
+	"time"
+)
+
+/*
+	Errors
+*/
+var (
+	eventFormatError error = core.NewError(core.InvalidFormatErrorCode, "Channel event is invalid.")
+)
+
+/*
+	Subscription definition
+	Events are pushed until the channel is closed, the subscription is closed, or the connection breaks
+*/
+type Subscription struct {
+	ChannelId string
+	Events    chan *channels.Event
+
+	client    *Client
+	conn      *websocket.Conn
+	quit      chan bool
+	closeOnce sync.Once
+
+	// Reason events stopped (nil if closed by client or channel closure)
+	errLock sync.Mutex
+	err     error
+}
+
+/*
+	Decodes event written by the pipeline
+	(message data is decrypted by the node before it is published to subscribers)
+*/
+func DecodeEvent(frame []byte) (*channels.Event, error) {
+	event := &channels.Event{}
+	if err := json.Unmarshal(frame, event); err != nil || len(event.Type) == 0 {
+		return nil, eventFormatError
+	}
+	return event, nil
+}
+
+/*
+	Subscribes to channel events on a dedicated connection
+*/
+func (cl *Client) Subscribe(ctx context.Context, channelId string) (*Subscription, error) {
+	op, err := cl.signedOperation(core.SubscribeChannelType, channelId, []byte("{}"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ts, err := keepAliveTransaction(op)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pipeline closes connection once subscription ends
+	ts.Pipeline.KeepAlive = false
+	tsEncoded, err := ts.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	// Open connection and send subscription
+	conn, err := cl.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.WriteMessage(websocket.TextMessage, tsEncoded); err != nil {
+		conn.Close()
+		return nil, core.NewError(core.ConnectionFailedErrorCode, err.Error())
+	}
+
+	sub := &Subscription{
+		ChannelId: channelId,
+		Events:    make(chan *channels.Event),
+		client:    cl,
+		conn:      conn,
+		quit:      make(chan bool),
+	}
+	go sub.reader()
+
+	return sub, nil
+}
+
+/*
+	Reads events until connection is closed
+*/
+func (sub *Subscription) reader() {
+	defer close(sub.Events)
+	defer sub.conn.Close()
+	for {
+		_, frame, err := sub.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				sub.setErr(connectionClosedError)
+			}
+			return
+		}
+
+		// Last frame written when the event channel is closed
+		if bytes.Equal(bytes.TrimSpace(frame), []byte("null")) {
+			continue
+		}
+
+		// Failures are written as status records
+		if err = parseFailure(frame); err != nil {
+			sub.setErr(err)
+			return
+		}
+
+		event, err := DecodeEvent(frame)
+		if err != nil {
+			sub.setErr(err)
+			return
+		}
+		sub.client.ObserveClock(sub.ChannelId, event.VectorClock)
+		select {
+		case sub.Events <- event:
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+func (sub *Subscription) setErr(err error) {
+	sub.errLock.Lock()
+	defer sub.errLock.Unlock()
+	if sub.err == nil {
+		sub.err = err
+	}
+}
+
+/*
+	Returns reason events stopped (nil if still running or closed normally)
+*/
+func (sub *Subscription) Err() error {
+	sub.errLock.Lock()
+	defer sub.errLock.Unlock()
+	return sub.err
+}
+
+/*
+	Ends subscription (events channel is closed)
+*/
+func (sub *Subscription) Close() error {
+	var err error
+	sub.closeOnce.Do(func() {
+		close(sub.quit)
+		err = sub.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+	return err
+}
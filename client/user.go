@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/users"
+	"time"
+)
+
+/*
+	Errors
+*/
+var (
+	userResponseFormatError error = core.NewError(core.InvalidFormatErrorCode, "Users response is invalid.")
+)
+
+/*
+	Runs users request and returns the user affected
+*/
+func (cl *Client) runUserRequest(ctx context.Context, rq *users.UserRequest) (*users.UserObject, error) {
+	rqEncoded, err := rq.Encode()
+	if err != nil {
+		return nil, err
+	}
+	frame, err := cl.runSigned(ctx, core.UsersRequestType, "", rqEncoded, rq.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	resp := &users.UserResponse{}
+	if err = json.Unmarshal(frame, resp); err != nil {
+		return nil, userResponseFormatError
+	}
+	if resp.Result != users.Success {
+		return nil, resp.GetError()
+	}
+	if len(resp.Data) == 0 {
+		return nil, userResponseFormatError
+	}
+	return &resp.Data[0], nil
+}
+
+/*
+	Creates user
+*/
+func (cl *Client) CreateUser(ctx context.Context, obj *users.UserObject) (*users.UserObject, error) {
+	return cl.runUserRequest(ctx, users.GenerateCreateRequest(obj, time.Now()))
+}
+
+/*
+	Updates user fields listed (e.g. "encKey", "permissions.channel.add", "active")
+*/
+func (cl *Client) UpdateUser(ctx context.Context, obj *users.UserObject, fields []string) (*users.UserObject, error) {
+	return cl.runUserRequest(ctx, users.GenerateUpdateRequest(obj, fields, time.Now()))
+}
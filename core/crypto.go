@@ -8,7 +8,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"golang.org/x/crypto/chacha20poly1305"
 	"io"
 )
@@ -31,26 +30,26 @@ const (
 	Errors
 */
 var (
-	base64DecodeError              error = errors.New("Error decoding base64.")
-	invalidNonceError              error = errors.New("Invalid nonce provided.")
-	invalidSymmetricKeyError       error = errors.New("Invalid key provided.")
-	invalidAsymmetricKeyError      error = errors.New("Invalid key provided.")
-	aeadCreationError              error = errors.New("Aead creation failed.")
-	noSymmetricKeyFoundError       error = errors.New("No symmetric key passed the challenge.")
-	noAsymmetricKeyFoundError      error = errors.New("No asymmetric key found.")
-	signError                      error = errors.New("Signing failed.")
-	asymmetrictEncryptionError     error = errors.New("Asymmetric encryption failed.")
-	asymmetrictDecryptionError     error = errors.New("Asymmetric decryption failed.")
-	symmetrictDecryptionError      error = errors.New("Symmetric decryption failed.")
-	payloadDecodeError             error = errors.New("Payload decoding failed.")
-	payloadDecryptionError         error = errors.New("Payload decryption failed.")
-	invalidPayloadError            error = errors.New("Invalid payload provided.")
-	keyNotFoundError               error = errors.New("Symmetric Key not found by ID.")
-	invalidSignatureEncodingError  error = errors.New("Invalid signature encoding.")
-	invalidIssuerSignatureError    error = errors.New("Invalid issuer signature provided.")
-	invalidCertifierSignatureError error = errors.New("Invalid certifier signature provided.")
-	encryptedSignatureError        error = errors.New("Cannot sign encrypted payload.")
-	transactionAlreadyEncrypted    error = errors.New("Cannot encrypt encrypted transaction.")
+	base64DecodeError              error = NewError(DecodingFailedErrorCode, "Error decoding base64.")
+	invalidNonceError              error = NewError(InvalidFormatErrorCode, "Invalid nonce provided.")
+	invalidSymmetricKeyError       error = NewError(InvalidKeyErrorCode, "Invalid key provided.")
+	invalidAsymmetricKeyError      error = NewError(InvalidKeyErrorCode, "Invalid key provided.")
+	aeadCreationError              error = NewError(InvalidKeyErrorCode, "Aead creation failed.")
+	noSymmetricKeyFoundError       error = NewError(KeyNotFoundErrorCode, "No symmetric key passed the challenge.")
+	noAsymmetricKeyFoundError      error = NewError(KeyNotFoundErrorCode, "No asymmetric key found.")
+	signError                      error = NewError(SigningFailedErrorCode, "Signing failed.")
+	asymmetrictEncryptionError     error = NewError(EncryptionFailedErrorCode, "Asymmetric encryption failed.")
+	asymmetrictDecryptionError     error = NewError(DecryptionFailedErrorCode, "Asymmetric decryption failed.")
+	symmetrictDecryptionError      error = NewError(DecryptionFailedErrorCode, "Symmetric decryption failed.")
+	payloadDecodeError             error = NewError(DecodingFailedErrorCode, "Payload decoding failed.")
+	payloadDecryptionError         error = NewError(DecryptionFailedErrorCode, "Payload decryption failed.")
+	invalidPayloadError            error = NewError(InvalidFormatErrorCode, "Invalid payload provided.")
+	keyNotFoundError               error = NewError(KeyNotFoundErrorCode, "Symmetric Key not found by ID.")
+	invalidSignatureEncodingError  error = NewError(DecodingFailedErrorCode, "Invalid signature encoding.")
+	invalidIssuerSignatureError    error = NewError(InvalidSignatureErrorCode, "Invalid issuer signature provided.")
+	invalidCertifierSignatureError error = NewError(InvalidSignatureErrorCode, "Invalid certifier signature provided.")
+	encryptedSignatureError        error = NewError(SigningFailedErrorCode, "Cannot sign encrypted payload.")
+	transactionAlreadyEncrypted    error = NewError(AlreadyEncryptedErrorCode, "Cannot encrypt encrypted transaction.")
 )
 
 /*
@@ -449,13 +448,25 @@ func (op *Operation) Verify(
 	certifierSigningKey *rsa.PublicKey,
 	payload []byte,
 ) (verified error) {
-	verified = decodeAndVerifySignature(issuerSigningKey, op.Issue.Signature, payload, invalidIssuerSignatureError)
+	verified = op.VerifyIssuer(issuerSigningKey, payload)
 	if verified != nil {
 		return
 	}
-	verified = decodeAndVerifySignature(certifierSigningKey, op.Certification.Signature, payload, invalidCertifierSignatureError)
+	verified = op.VerifyCertifier(certifierSigningKey, payload)
 	return
 }
+func (op *Operation) VerifyIssuer(
+	issuerSigningKey *rsa.PublicKey,
+	payload []byte,
+) error {
+	return decodeAndVerifySignature(issuerSigningKey, op.Issue.Signature, payload, invalidIssuerSignatureError)
+}
+func (op *Operation) VerifyCertifier(
+	certifierSigningKey *rsa.PublicKey,
+	payload []byte,
+) error {
+	return decodeAndVerifySignature(certifierSigningKey, op.Certification.Signature, payload, invalidCertifierSignatureError)
+}
 func decodeAndVerifySignature(
 	signingKey *rsa.PublicKey,
 	signatureEncoded string,
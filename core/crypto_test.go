@@ -794,3 +794,50 @@ func TestOperationCertifierSign(t *testing.T) {
 		t.Errorf("CertifierSign should update certifier id. id=%+v", op.Certification.Id)
 	}
 }
+
+func TestOperationVerifySigners(t *testing.T) {
+	// Make operation signed by issuer only
+	payload := generateRandomBytes(30)
+	issuerKey := GeneratePrivateKey()
+	certifierKey := GeneratePrivateKey()
+	op := GenerateOperation(
+		false,
+		"",
+		nil,
+		false,
+		"",
+		nil,
+		false,
+		"",
+		nil,
+		false,
+		1,
+		[]byte(payload),
+		false,
+	)
+	if err := op.IssuerSign(issuerKey, "ISSUER"); err != nil {
+		t.Errorf("IssuerSign should not fail. err=%+v", err)
+	}
+
+	// Issuer signature is checked independently of certifier signature
+	if err := op.VerifyIssuer(&issuerKey.PublicKey, payload); err != nil {
+		t.Errorf("VerifyIssuer should pass with issuer key. err=%+v", err)
+	}
+	if err := op.VerifyIssuer(&certifierKey.PublicKey, payload); err == nil {
+		t.Error("VerifyIssuer should fail with another key.")
+	}
+	if err := op.VerifyCertifier(&certifierKey.PublicKey, payload); err == nil {
+		t.Error("VerifyCertifier should fail if operation is not certifier signed.")
+	}
+
+	// Certifier signature passes after signing
+	if err := op.CertifierSign(certifierKey, "CERTIFIER"); err != nil {
+		t.Errorf("CertifierSign should not fail. err=%+v", err)
+	}
+	if err := op.VerifyCertifier(&certifierKey.PublicKey, payload); err != nil {
+		t.Errorf("VerifyCertifier should pass with certifier key. err=%+v", err)
+	}
+	if err := op.Verify(&issuerKey.PublicKey, &certifierKey.PublicKey, payload); err != nil {
+		t.Errorf("Verify should pass with both signatures. err=%+v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package core
+
+/*
+	Error codes shared by all subsystems
+*/
+
+import (
+	"context"
+	"errors"
+)
+
+/*
+	Error code catalogue
+*/
+type ErrorCode string
+
+const (
+	// Fallback for errors without a code
+	UnknownErrorCode ErrorCode = "unknown"
+
+	// Request format
+	InvalidFormatErrorCode      ErrorCode = "invalid_format"
+	InvalidRequestErrorCode     ErrorCode = "invalid_request"
+	InvalidRequestTypeErrorCode ErrorCode = "invalid_request_type"
+	UnverifiedRequestErrorCode  ErrorCode = "unverified_request"
+
+	// Cryptography
+	DecodingFailedErrorCode     ErrorCode = "decoding_failed"
+	DecryptionFailedErrorCode   ErrorCode = "decryption_failed"
+	EncryptionFailedErrorCode   ErrorCode = "encryption_failed"
+	SigningFailedErrorCode      ErrorCode = "signing_failed"
+	InvalidSignatureErrorCode   ErrorCode = "invalid_signature"
+	InvalidKeyErrorCode         ErrorCode = "invalid_key"
+	KeyNotFoundErrorCode        ErrorCode = "key_not_found"
+	AlreadyEncryptedErrorCode   ErrorCode = "already_encrypted"
+	VerificationFailedErrorCode ErrorCode = "verification_failed"
+
+	// Users
+	IssuerUnknownErrorCode         ErrorCode = "issuer_unknown"
+	CertifierUnknownErrorCode      ErrorCode = "certifier_unknown"
+	SubjectUnknownErrorCode        ErrorCode = "subject_unknown"
+	CertifierPermissionsErrorCode  ErrorCode = "certifier_permissions"
+	ChannelAddPermissionErrorCode  ErrorCode = "certifier_lacks_channel_add"
+	ChannelReadPermissionErrorCode ErrorCode = "certifier_lacks_channel_read"
+
+	// Channels
+	ChannelNotOpenErrorCode         ErrorCode = "channel_not_open"
+	ChannelWritePermissionErrorCode ErrorCode = "channel_write_unauthorized"
+	ChannelActionFailedErrorCode    ErrorCode = "channel_action_failed"
+	MessageDroppedErrorCode         ErrorCode = "message_dropped"
+	BufferFailedErrorCode           ErrorCode = "buffer_failed"
+	BufferFullErrorCode             ErrorCode = "buffer_full"
+
+	// Subsystems
+	SubsystemShutdownErrorCode ErrorCode = "subsystem_shutdown"
+	RequestRejectedErrorCode   ErrorCode = "request_rejected"
+	RequestFailedErrorCode     ErrorCode = "request_failed"
+
+	// Deadlines and cancellation
+	CancelledErrorCode        ErrorCode = "cancelled"
+	DeadlineExceededErrorCode ErrorCode = "deadline_exceeded"
+	TicketNotFoundErrorCode   ErrorCode = "ticket_not_found"
+
+	// Pipeline clients
+	ConnectionFailedErrorCode ErrorCode = "connection_failed"
+)
+
+/*
+	Error carrying a stable code along with a human readable message
+*/
+type CodedError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func NewError(code ErrorCode, message string) *CodedError {
+	return &CodedError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (err *CodedError) Error() string {
+	return err.Message
+}
+
+/*
+	Errors of requests with a done context
+*/
+var (
+	RequestCancelledError error = NewError(CancelledErrorCode, "Request was cancelled.")
+	DeadlineExceededError error = NewError(DeadlineExceededErrorCode, "Request deadline exceeded.")
+)
+
+func ContextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return DeadlineExceededError
+	default:
+		return RequestCancelledError
+	}
+}
+
+/*
+	Returns the code of an error, looking through wrapped errors (unknown if no error is coded)
+*/
+func GetErrorCode(err error) ErrorCode {
+	var coded *CodedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return UnknownErrorCode
+}
+
+/*
+	Converts any error into a coded error
+	Wrapped coded errors keep their code and get the message of the wrapping error
+*/
+func ToCodedError(err error) *CodedError {
+	if err == nil {
+		return nil
+	}
+	if coded, ok := err.(*CodedError); ok {
+		return coded
+	}
+	return NewError(GetErrorCode(err), err.Error())
+}
+
+/*
+	Conversion of error lists (used for encoding)
+*/
+
+type CodedErrors []*CodedError
+
+func ToCodedErrors(errs []error) CodedErrors {
+	if errs == nil {
+		return nil
+	}
+	res := CodedErrors{}
+	for _, err := range errs {
+		res = append(res, ToCodedError(err))
+	}
+	return res
+}
+
+func (errs CodedErrors) Errors() []error {
+	if errs == nil {
+		return nil
+	}
+	res := []error{}
+	for _, err := range errs {
+		res = append(res, err)
+	}
+	return res
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	codedError := NewError(ChannelNotOpenErrorCode, "Channel is not open.")
+	if codedError.Error() != "Channel is not open." ||
+		GetErrorCode(codedError) != ChannelNotOpenErrorCode {
+		t.Errorf("Coded error should keep its code and message. err=%+v", codedError)
+	}
+
+	plainError := errors.New("Plain error.")
+	if GetErrorCode(plainError) != UnknownErrorCode {
+		t.Errorf("Error without code should have the unknown code.")
+	}
+	if converted := ToCodedError(plainError); converted.Code != UnknownErrorCode || converted.Message != plainError.Error() {
+		t.Errorf("Converting an error without code should keep its message. converted=%+v", converted)
+	}
+	if ToCodedError(codedError) != codedError {
+		t.Errorf("Converting a coded error should return the same error.")
+	}
+}
+
+func TestWrappedErrorCodes(t *testing.T) {
+	codedError := NewError(ChannelNotOpenErrorCode, "Channel is not open.")
+	wrappedError := fmt.Errorf("Encrypting failed: %w", codedError)
+	if GetErrorCode(wrappedError) != ChannelNotOpenErrorCode {
+		t.Errorf("Wrapped coded error should keep its code. code=%v", GetErrorCode(wrappedError))
+	}
+	if GetErrorCode(fmt.Errorf("Outer: %w", wrappedError)) != ChannelNotOpenErrorCode {
+		t.Errorf("Coded error wrapped twice should keep its code.")
+	}
+	converted := ToCodedError(wrappedError)
+	if converted.Code != ChannelNotOpenErrorCode || converted.Message != wrappedError.Error() {
+		t.Errorf("Converting a wrapped coded error should keep its code and the wrapping message. converted=%+v", converted)
+	}
+	if GetErrorCode(nil) != UnknownErrorCode {
+		t.Errorf("Nil error should have the unknown code.")
+	}
+}
+
+func TestErrorListConversion(t *testing.T) {
+	if ToCodedErrors(nil) != nil || CodedErrors(nil).Errors() != nil {
+		t.Errorf("Converting nil error lists should return nil.")
+	}
+
+	codedError := NewError(KeyNotFoundErrorCode, "Key not found.")
+	errs := []error{codedError, errors.New("Plain error.")}
+	converted := ToCodedErrors(errs)
+	expected := CodedErrors{
+		codedError,
+		NewError(UnknownErrorCode, "Plain error."),
+	}
+	if !reflect.DeepEqual(converted, expected) {
+		t.Errorf("Error list conversion failed. converted=%+v expected=%+v", converted, expected)
+	}
+	if !reflect.DeepEqual(converted.Errors(), []error{expected[0], expected[1]}) {
+		t.Errorf("Error list conversion back to errors failed.")
+	}
+}
@@ -5,12 +5,19 @@ package core
 */
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
-   Log levels
+	Log levels
 */
 type LogLevel int
 
@@ -22,77 +29,265 @@ const (
 	DEBUG
 )
 
+var logLevelNames map[LogLevel]string = map[LogLevel]string{
+	FATAL: "fatal",
+	ERROR: "error",
+	WARN:  "warn",
+	INFO:  "info",
+	DEBUG: "debug",
+}
+
+/*
+	Log output formats
+*/
+type LogFormat string
+
+const (
+	TextLogFormat LogFormat = "text"
+	JSONLogFormat LogFormat = "json"
+)
+
+/*
+	Common structured fields
+*/
+const (
+	SubsystemLogField   string = "subsystem"
+	TicketLogField      string = "ticket"
+	ChannelLogField     string = "channel"
+	RequestTypeLogField string = "requestType"
+)
+
 /*
 	Generates a logging handler
 	with new stdout/stderr streams
 */
 func InitializeLogging() *LoggingHandler {
+	return NewLoggingHandler(os.Stdout, os.Stderr)
+}
+
+func NewLoggingHandler(stdoutStream io.Writer, stderrStream io.Writer) *LoggingHandler {
+	output := &logOutput{
+		logLevel:     int32(FATAL),
+		stdoutStream: stdoutStream,
+		stderrStream: stderrStream,
+	}
+	output.format.Store(TextLogFormat)
+	output.subsystemLevels.Store(map[string]LogLevel{})
 	return &LoggingHandler{
-		logLevel:     FATAL,
-		stderrStream: log.New(os.Stderr, "", log.LstdFlags),
-		stdoutStream: log.New(os.Stdout, "", log.LstdFlags),
+		output: output,
 	}
 }
 
 /*
-	Changes log level for a logging handler
+	Output shared by a handler and all handlers derived from it
 */
-func (logHandler *LoggingHandler) SetLogLevel(logLevel LogLevel) {
-	logHandler.logLevel = logLevel
+type logOutput struct {
+	lock         sync.Mutex
+	stdoutStream io.Writer
+	stderrStream io.Writer
+
+	// Settings (safe to change while logging)
+	logLevel        int32
+	format          atomic.Value
+	subsystemLevels atomic.Value
+
+	// Called by Fatalf instead of exiting (if set)
+	shutdownLambda atomic.Value
 }
 
 /*
-   Constants for logging
+	Structure that keeps streams
+	used to use the same streams across packages
 */
-const (
-	fatalPrefix string = "FATAL: "
-	errorPrefix string = "ERROR: "
-	warnPrefix  string = "WARN: "
-	infoPrefix  string = "INFO: "
-	debugPrefix string = "DEBUG: "
-)
+type LoggingHandler struct {
+	output    *logOutput
+	subsystem string
+	fields    []logField
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
 
 /*
-   Structure that keeps streams
-   used to use the same streams across packages
+	Settings (shared by derived handlers)
 */
-type LoggingHandler struct {
-	logLevel     LogLevel
-	stderrStream *log.Logger
-	stdoutStream *log.Logger
+
+// Changes default log level (safe while logging)
+func (logHandler *LoggingHandler) SetLogLevel(logLevel LogLevel) {
+	atomic.StoreInt32(&logHandler.output.logLevel, int32(logLevel))
+}
+
+// Log level used by this handler (subsystem overrides take precedence)
+func (logHandler *LoggingHandler) GetLogLevel() LogLevel {
+	if logHandler.subsystem != "" {
+		subsystemLevels := logHandler.output.subsystemLevels.Load().(map[string]LogLevel)
+		if logLevel, ok := subsystemLevels[logHandler.subsystem]; ok {
+			return logLevel
+		}
+	}
+	return LogLevel(atomic.LoadInt32(&logHandler.output.logLevel))
+}
+
+// Replaces log level overrides by subsystem name
+func (logHandler *LoggingHandler) SetSubsystemLogLevels(subsystemLevels map[string]LogLevel) {
+	levelsCopy := map[string]LogLevel{}
+	for subsystem, logLevel := range subsystemLevels {
+		levelsCopy[subsystem] = logLevel
+	}
+	logHandler.output.subsystemLevels.Store(levelsCopy)
+}
+
+func (logHandler *LoggingHandler) SetLogFormat(format LogFormat) {
+	if format != JSONLogFormat {
+		format = TextLogFormat
+	}
+	logHandler.output.format.Store(format)
+}
+
+func (logHandler *LoggingHandler) SetShutdownLambda(shutdownLambda ShutdownLambda) {
+	logHandler.output.shutdownLambda.Store(shutdownLambda)
 }
 
 /*
-   Utilities for logging
+	Derived handlers
 */
+
+// Handler for a subsystem (tagged with the subsystem and using its level override)
+func (logHandler *LoggingHandler) ForSubsystem(subsystem string) *LoggingHandler {
+	return &LoggingHandler{
+		output:    logHandler.output,
+		subsystem: subsystem,
+		fields:    logHandler.fields,
+	}
+}
+
+// Handler adding key/value pairs to all entries
+func (logHandler *LoggingHandler) With(keyValues ...interface{}) *LoggingHandler {
+	fields := make([]logField, len(logHandler.fields), len(logHandler.fields)+len(keyValues)/2)
+	copy(fields, logHandler.fields)
+	for fieldIndex := 0; fieldIndex+1 < len(keyValues); fieldIndex += 2 {
+		fields = append(fields, logField{
+			key:   fmt.Sprint(keyValues[fieldIndex]),
+			value: keyValues[fieldIndex+1],
+		})
+	}
+	return &LoggingHandler{
+		output:    logHandler.output,
+		subsystem: logHandler.subsystem,
+		fields:    fields,
+	}
+}
+
+/*
+	Utilities for logging
+*/
+
+// Logs and requests a graceful shutdown (does not return)
 func (logHandler *LoggingHandler) Fatalf(format string, v ...interface{}) {
-	logHandler.stderrStream.Fatalf(fatalPrefix+format, v...)
+	logHandler.write(FATAL, format, v)
+	if shutdownLambda, ok := logHandler.output.shutdownLambda.Load().(ShutdownLambda); ok && shutdownLambda != nil {
+		shutdownLambda()
+		select {}
+	}
+	os.Exit(1)
 }
 
 func (logHandler *LoggingHandler) Errorf(format string, v ...interface{}) {
-	if logHandler.logLevel < ERROR {
+	if logHandler.GetLogLevel() < ERROR {
 		return
 	}
-	logHandler.stderrStream.Printf(errorPrefix+format, v...)
+	logHandler.write(ERROR, format, v)
 }
 
 func (logHandler *LoggingHandler) Warnf(format string, v ...interface{}) {
-	if logHandler.logLevel < WARN {
+	if logHandler.GetLogLevel() < WARN {
 		return
 	}
-	logHandler.stdoutStream.Printf(warnPrefix+format, v...)
+	logHandler.write(WARN, format, v)
 }
 
 func (logHandler *LoggingHandler) Infof(format string, v ...interface{}) {
-	if logHandler.logLevel < INFO {
+	if logHandler.GetLogLevel() < INFO {
 		return
 	}
-	logHandler.stdoutStream.Printf(infoPrefix+format, v...)
+	logHandler.write(INFO, format, v)
 }
 
 func (logHandler *LoggingHandler) Debugf(format string, v ...interface{}) {
-	if logHandler.logLevel < DEBUG {
+	if logHandler.GetLogLevel() < DEBUG {
 		return
 	}
-	logHandler.stdoutStream.Printf(debugPrefix+format, v...)
+	logHandler.write(DEBUG, format, v)
+}
+
+/*
+	Formatting
+*/
+
+func (logHandler *LoggingHandler) write(logLevel LogLevel, format string, v []interface{}) {
+	now := time.Now()
+	message := fmt.Sprintf(format, v...)
+
+	fields := logHandler.fields
+	if logHandler.subsystem != "" {
+		fields = append([]logField{{SubsystemLogField, logHandler.subsystem}}, fields...)
+	}
+
+	var entry string
+	if logHandler.output.format.Load().(LogFormat) == JSONLogFormat {
+		entry = formatJSONEntry(now, logLevel, message, fields)
+	} else {
+		entry = formatTextEntry(now, logLevel, message, fields)
+	}
+
+	// Errors go to stderr
+	stream := logHandler.output.stdoutStream
+	if logLevel <= ERROR {
+		stream = logHandler.output.stderrStream
+	}
+	logHandler.output.lock.Lock()
+	io.WriteString(stream, entry)
+	logHandler.output.lock.Unlock()
+}
+
+func formatTextEntry(now time.Time, logLevel LogLevel, message string, fields []logField) string {
+	var builder strings.Builder
+	builder.WriteString(now.Format("2006/01/02 15:04:05 "))
+	builder.WriteString(strings.ToUpper(logLevelNames[logLevel]))
+	builder.WriteString(": ")
+	builder.WriteString(strings.TrimRight(message, "\n"))
+	for _, field := range fields {
+		value := fmt.Sprint(field.value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		builder.WriteString(" " + field.key + "=" + value)
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+func formatJSONEntry(now time.Time, logLevel LogLevel, message string, fields []logField) string {
+	var builder strings.Builder
+	builder.WriteString("{\"time\":" + marshalLogValue(now.Format(time.RFC3339Nano)))
+	builder.WriteString(",\"level\":" + marshalLogValue(logLevelNames[logLevel]))
+	builder.WriteString(",\"msg\":" + marshalLogValue(strings.TrimRight(message, "\n")))
+	for _, field := range fields {
+		builder.WriteString("," + marshalLogValue(field.key) + ":" + marshalLogValue(field.value))
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+func marshalLogValue(value interface{}) string {
+	if err, isError := value.(error); isError {
+		value = err.Error()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return string(encoded)
 }
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logHandler := NewLoggingHandler(&stdout, &stderr)
+	logHandler.SetLogLevel(WARN)
+
+	logHandler.Infof("hidden")
+	logHandler.Warnf("shown")
+	logHandler.Errorf("error")
+	if strings.Contains(stdout.String(), "hidden") || !strings.Contains(stdout.String(), "WARN: shown") {
+		t.Errorf("Entries should be filtered by log level. stdout=%v", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "ERROR: error") {
+		t.Errorf("Errors should be written to stderr. stderr=%v", stderr.String())
+	}
+
+	// Subsystem overrides
+	stdout.Reset()
+	logHandler.SetSubsystemLogLevels(map[string]LogLevel{
+		"verbose": DEBUG,
+	})
+	verbose := logHandler.ForSubsystem("verbose")
+	quiet := logHandler.ForSubsystem("quiet")
+	verbose.Debugf("verbose debug")
+	quiet.Debugf("quiet debug")
+	quiet.Warnf("quiet warn")
+	if !strings.Contains(stdout.String(), "verbose debug subsystem=verbose") ||
+		strings.Contains(stdout.String(), "quiet debug") ||
+		!strings.Contains(stdout.String(), "quiet warn subsystem=quiet") {
+		t.Errorf("Subsystem level overrides should take precedence. stdout=%v", stdout.String())
+	}
+
+	// Default level changes apply to subsystems without override
+	stdout.Reset()
+	logHandler.SetLogLevel(DEBUG)
+	quiet.Debugf("quiet debug")
+	if !strings.Contains(stdout.String(), "quiet debug") {
+		t.Errorf("Subsystem without override should use default level. stdout=%v", stdout.String())
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logHandler := NewLoggingHandler(&stdout, &stderr)
+	logHandler.SetLogLevel(INFO)
+
+	requestLog := logHandler.ForSubsystem("executor").With(TicketLogField, "TICKET", ChannelLogField, "with space")
+	requestLog.Infof("message %v", 1)
+	if !strings.HasSuffix(stdout.String(), "INFO: message 1 subsystem=executor ticket=TICKET channel=\"with space\"\n") {
+		t.Errorf("Text entries should end with fields. stdout=%v", stdout.String())
+	}
+
+	// Derived handlers don't change parent fields
+	stdout.Reset()
+	requestLog.With(RequestTypeLogField, "users")
+	requestLog.Infof("message")
+	if strings.Contains(stdout.String(), RequestTypeLogField) {
+		t.Errorf("Adding fields should not change parent handler. stdout=%v", stdout.String())
+	}
+
+	// JSON format
+	stdout.Reset()
+	logHandler.SetLogFormat(JSONLogFormat)
+	requestLog.With(RequestTypeLogField, "users").Infof("message")
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(stdout.Bytes(), &entry); err != nil {
+		t.Errorf("JSON entry should be valid. err=%v entry=%v", err, stdout.String())
+		return
+	}
+	if entry["level"] != "info" ||
+		entry["msg"] != "message" ||
+		entry[SubsystemLogField] != "executor" ||
+		entry[TicketLogField] != "TICKET" ||
+		entry[ChannelLogField] != "with space" ||
+		entry[RequestTypeLogField] != "users" ||
+		entry["time"] == nil {
+		t.Errorf("JSON entry should include message and fields. entry=%v", entry)
+	}
+}
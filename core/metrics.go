@@ -0,0 +1,397 @@
+/*
+	Metrics registry (counters, gauges and histograms with labels)
+	Exposed in Prometheus text format
+*/
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Metric kinds
+*/
+type metricKind string
+
+const (
+	counterKind   metricKind = "counter"
+	gaugeKind     metricKind = "gauge"
+	histogramKind metricKind = "histogram"
+)
+
+/*
+	Default latency buckets (seconds)
+*/
+var DefaultLatencyBuckets []float64 = []float64{
+	0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+/*
+	Registry structures
+*/
+type MetricsRegistry struct {
+	lock     sync.Mutex
+	families map[string]*metricFamily
+
+	// Holds the request observer of the registry (if any)
+	requestObserver atomic.Value
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	kind       metricKind
+	labelNames []string
+	buckets    []float64
+	series     map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues  []string
+	value        float64
+	bucketCounts []uint64
+	count        uint64
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		families: map[string]*metricFamily{},
+	}
+}
+
+/*
+	Registry of the instances behind package functions (nodes make their own)
+*/
+var Metrics *MetricsRegistry = NewMetricsRegistry()
+
+/*
+	Metric handles (registering an existing name returns the same family)
+*/
+type Counter struct {
+	registry *MetricsRegistry
+	family   *metricFamily
+}
+
+type Gauge struct {
+	registry *MetricsRegistry
+	family   *metricFamily
+}
+
+type Histogram struct {
+	registry *MetricsRegistry
+	family   *metricFamily
+}
+
+func (registry *MetricsRegistry) getFamily(name string, help string, kind metricKind, buckets []float64, labelNames []string) *metricFamily {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if family, exists := registry.families[name]; exists {
+		return family
+	}
+	family := &metricFamily{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*metricSeries{},
+	}
+	registry.families[name] = family
+	return family
+}
+
+func (registry *MetricsRegistry) Counter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{
+		registry: registry,
+		family:   registry.getFamily(name, help, counterKind, nil, labelNames),
+	}
+}
+
+func (registry *MetricsRegistry) Gauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{
+		registry: registry,
+		family:   registry.getFamily(name, help, gaugeKind, nil, labelNames),
+	}
+}
+
+func (registry *MetricsRegistry) Histogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	sortedBuckets := append([]float64{}, buckets...)
+	sort.Float64s(sortedBuckets)
+	return &Histogram{
+		registry: registry,
+		family:   registry.getFamily(name, help, histogramKind, sortedBuckets, labelNames),
+	}
+}
+
+/*
+	Series lookup (registry lock must be held)
+	Missing label values are left empty and extra ones are ignored
+*/
+func (family *metricFamily) getSeries(labelValues []string) *metricSeries {
+	values := make([]string, len(family.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+	series, exists := family.series[key]
+	if !exists {
+		series = &metricSeries{
+			labelValues:  values,
+			bucketCounts: make([]uint64, len(family.buckets)),
+		}
+		family.series[key] = series
+	}
+	return series
+}
+
+/*
+	Updates
+*/
+func (counter *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	counter.registry.lock.Lock()
+	counter.family.getSeries(labelValues).value += delta
+	counter.registry.lock.Unlock()
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.registry.lock.Lock()
+	gauge.family.getSeries(labelValues).value = value
+	gauge.registry.lock.Unlock()
+}
+
+func (gauge *Gauge) Add(delta float64, labelValues ...string) {
+	gauge.registry.lock.Lock()
+	gauge.family.getSeries(labelValues).value += delta
+	gauge.registry.lock.Unlock()
+}
+
+func (gauge *Gauge) Inc(labelValues ...string) {
+	gauge.Add(1, labelValues...)
+}
+
+func (gauge *Gauge) Dec(labelValues ...string) {
+	gauge.Add(-1, labelValues...)
+}
+
+// Removes a series (used for labels that go away, like closed channels)
+func (gauge *Gauge) Delete(labelValues ...string) {
+	gauge.registry.lock.Lock()
+	defer gauge.registry.lock.Unlock()
+	values := make([]string, len(gauge.family.labelNames))
+	copy(values, labelValues)
+	delete(gauge.family.series, strings.Join(values, "\xff"))
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.registry.lock.Lock()
+	defer histogram.registry.lock.Unlock()
+	series := histogram.family.getSeries(labelValues)
+	for bucketIndex, upperBound := range histogram.family.buckets {
+		if value <= upperBound {
+			series.bucketCounts[bucketIndex]++
+		}
+	}
+	series.value += value
+	series.count++
+}
+
+/*
+	Reads a value (histograms return the number of observations)
+*/
+func (registry *MetricsRegistry) Value(name string, labelValues ...string) (float64, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	family, exists := registry.families[name]
+	if !exists {
+		return 0, false
+	}
+	values := make([]string, len(family.labelNames))
+	copy(values, labelValues)
+	series, exists := family.series[strings.Join(values, "\xff")]
+	if !exists {
+		return 0, false
+	}
+	if family.kind == histogramKind {
+		return float64(series.count), true
+	}
+	return series.value, true
+}
+
+/*
+	Prometheus text exposition format
+*/
+func (registry *MetricsRegistry) WritePrometheus(writer io.Writer) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	buffered := bufio.NewWriter(writer)
+
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := registry.families[name]
+		fmt.Fprintf(buffered, "# HELP %s %s\n", name, escapeHelp(family.help))
+		fmt.Fprintf(buffered, "# TYPE %s %s\n", name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			series := family.series[key]
+			if family.kind != histogramKind {
+				fmt.Fprintf(buffered, "%s%s %s\n", name, formatLabels(family.labelNames, series.labelValues, "", ""), formatValue(series.value))
+				continue
+			}
+			for bucketIndex, upperBound := range family.buckets {
+				fmt.Fprintf(buffered, "%s_bucket%s %d\n", name, formatLabels(family.labelNames, series.labelValues, "le", formatValue(upperBound)), series.bucketCounts[bucketIndex])
+			}
+			fmt.Fprintf(buffered, "%s_bucket%s %d\n", name, formatLabels(family.labelNames, series.labelValues, "le", "+Inf"), series.count)
+			fmt.Fprintf(buffered, "%s_sum%s %s\n", name, formatLabels(family.labelNames, series.labelValues, "", ""), formatValue(series.value))
+			fmt.Fprintf(buffered, "%s_count%s %d\n", name, formatLabels(family.labelNames, series.labelValues, "", ""), series.count)
+		}
+	}
+
+	return buffered.Flush()
+}
+
+func formatLabels(labelNames []string, labelValues []string, extraName string, extraValue string) string {
+	pairs := []string{}
+	for labelIndex, labelName := range labelNames {
+		pairs = append(pairs, labelName+"=\""+escapeLabelValue(labelValues[labelIndex])+"\"")
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"=\""+extraValue+"\"")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"").Replace(value)
+}
+
+/*
+	Request metrics shared by worker pool subsystems
+*/
+const (
+	SuccessMetricsResult string = "success"
+	FailureMetricsResult string = "failure"
+)
+
+/*
+	Hook called with the duration of every request handled (used by benchmarks)
+*/
+type RequestObserver func(subsystem string, requestType string, duration time.Duration)
+
+type requestObserverHolder struct {
+	observer RequestObserver
+}
+
+// Replaces hook of registry (nil removes it)
+func (registry *MetricsRegistry) SetRequestObserver(observer RequestObserver) {
+	registry.requestObserver.Store(requestObserverHolder{observer: observer})
+}
+
+func (registry *MetricsRegistry) observeRequest(subsystem string, requestType string, duration time.Duration) {
+	if holder, ok := registry.requestObserver.Load().(requestObserverHolder); ok && holder.observer != nil {
+		holder.observer(subsystem, requestType, duration)
+	}
+}
+
+type SubsystemMetrics struct {
+	subsystem          string
+	registry           *MetricsRegistry
+	requestsTotal      *Counter
+	requestDuration    *Histogram
+	requestsQueued     *Gauge
+	requestsInProgress *Gauge
+}
+
+func NewSubsystemMetrics(registry *MetricsRegistry, subsystem string) *SubsystemMetrics {
+	return &SubsystemMetrics{
+		subsystem:          subsystem,
+		registry:           registry,
+		requestsTotal:      registry.Counter("dmpc_requests_total", "Requests handled by subsystem, type and result.", "subsystem", "type", "result"),
+		requestDuration:    registry.Histogram("dmpc_request_duration_seconds", "Time spent handling requests by subsystem and type.", DefaultLatencyBuckets, "subsystem", "type"),
+		requestsQueued:     registry.Gauge("dmpc_requests_queued", "Requests waiting for a worker by subsystem.", "subsystem"),
+		requestsInProgress: registry.Gauge("dmpc_requests_in_progress", "Requests being handled by subsystem.", "subsystem"),
+	}
+}
+
+/*
+	Called once a request is accepted by the worker pool
+*/
+func (metrics *SubsystemMetrics) Queued() {
+	metrics.requestsQueued.Inc(metrics.subsystem)
+}
+
+/*
+	Observation of a request from the time a worker picks it up
+*/
+type RequestObservation struct {
+	metrics     *SubsystemMetrics
+	requestType string
+	start       time.Time
+}
+
+func (metrics *SubsystemMetrics) Start(requestType string) *RequestObservation {
+	metrics.requestsQueued.Dec(metrics.subsystem)
+	metrics.requestsInProgress.Inc(metrics.subsystem)
+	return &RequestObservation{
+		metrics:     metrics,
+		requestType: requestType,
+		start:       time.Now(),
+	}
+}
+
+func (observation *RequestObservation) Done(result string) {
+	metrics := observation.metrics
+	duration := time.Since(observation.start)
+	metrics.requestsInProgress.Dec(metrics.subsystem)
+	metrics.requestsTotal.Inc(metrics.subsystem, observation.requestType, result)
+	metrics.requestDuration.Observe(duration.Seconds(), metrics.subsystem, observation.requestType)
+	metrics.registry.observeRequest(metrics.subsystem, observation.requestType, duration)
+}
+
+func (observation *RequestObservation) DoneWithSuccess(success bool) {
+	if success {
+		observation.Done(SuccessMetricsResult)
+	} else {
+		observation.Done(FailureMetricsResult)
+	}
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsUpdates(t *testing.T) {
+	registry := NewMetricsRegistry()
+
+	counter := registry.Counter("test_total", "Test counter.", "kind")
+	counter.Inc("a")
+	counter.Add(2, "a")
+	counter.Add(-1, "a")
+	if value, ok := registry.Value("test_total", "a"); !ok || value != 3 {
+		t.Errorf("Counter should only be incremented. value=%v ok=%v", value, ok)
+	}
+
+	gauge := registry.Gauge("test_gauge", "Test gauge.", "kind")
+	gauge.Inc("a")
+	gauge.Inc("a")
+	gauge.Dec("a")
+	gauge.Set(5, "b")
+	if value, ok := registry.Value("test_gauge", "a"); !ok || value != 1 {
+		t.Errorf("Gauge should be incremented and decremented. value=%v ok=%v", value, ok)
+	}
+	gauge.Delete("b")
+	if _, ok := registry.Value("test_gauge", "b"); ok {
+		t.Errorf("Deleted gauge series should not exist.")
+	}
+
+	// Same name returns the same family
+	registry.Gauge("test_gauge", "Test gauge.", "kind").Inc("a")
+	if value, _ := registry.Value("test_gauge", "a"); value != 2 {
+		t.Errorf("Registering existing metric should reuse it. value=%v", value)
+	}
+
+	histogram := registry.Histogram("test_seconds", "Test histogram.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+	if value, ok := registry.Value("test_seconds"); !ok || value != 3 {
+		t.Errorf("Histogram should count observations. value=%v ok=%v", value, ok)
+	}
+}
+
+func TestMetricsPrometheusFormat(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.Counter("test_total", "Test counter.", "kind").Inc("a\"b")
+	histogram := registry.Histogram("test_seconds", "Test histogram.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var buffer bytes.Buffer
+	if err := registry.WritePrometheus(&buffer); err != nil {
+		t.Errorf("Writing metrics should not fail. err=%v", err)
+		return
+	}
+
+	expected := strings.Join([]string{
+		"# HELP test_seconds Test histogram.",
+		"# TYPE test_seconds histogram",
+		"test_seconds_bucket{le=\"0.1\"} 1",
+		"test_seconds_bucket{le=\"1\"} 2",
+		"test_seconds_bucket{le=\"+Inf\"} 3",
+		"test_seconds_sum 5.55",
+		"test_seconds_count 3",
+		"# HELP test_total Test counter.",
+		"# TYPE test_total counter",
+		"test_total{kind=\"a\\\"b\"} 1",
+		"",
+	}, "\n")
+	if buffer.String() != expected {
+		t.Errorf("Metrics should be written in prometheus text format.\nfound=\n%v\nexpected=\n%v", buffer.String(), expected)
+	}
+}
+
+func TestSubsystemMetrics(t *testing.T) {
+	registry := NewMetricsRegistry()
+	otherRegistry := NewMetricsRegistry()
+	metrics := NewSubsystemMetrics(registry, "test_subsystem")
+	otherMetrics := NewSubsystemMetrics(otherRegistry, "test_subsystem")
+	metrics.Queued()
+	metrics.Queued()
+	otherMetrics.Queued()
+	metrics.Start("read").Done(SuccessMetricsResult)
+	metrics.Start("read").DoneWithSuccess(false)
+
+	if value, _ := registry.Value("dmpc_requests_total", "test_subsystem", "read", SuccessMetricsResult); value != 1 {
+		t.Errorf("Successful request should be counted. value=%v", value)
+	}
+	if value, _ := registry.Value("dmpc_requests_total", "test_subsystem", "read", FailureMetricsResult); value != 1 {
+		t.Errorf("Failed request should be counted. value=%v", value)
+	}
+	if value, _ := registry.Value("dmpc_request_duration_seconds", "test_subsystem", "read"); value != 2 {
+		t.Errorf("Request latency should be observed. value=%v", value)
+	}
+	if queued, _ := registry.Value("dmpc_requests_queued", "test_subsystem"); queued != 0 {
+		t.Errorf("Started requests should not be queued. value=%v", queued)
+	}
+	if inProgress, _ := registry.Value("dmpc_requests_in_progress", "test_subsystem"); inProgress != 0 {
+		t.Errorf("Done requests should not be in progress. value=%v", inProgress)
+	}
+
+	// Registries do not share series
+	if queued, _ := otherRegistry.Value("dmpc_requests_queued", "test_subsystem"); queued != 1 {
+		t.Errorf("Other registry should only count its own requests. value=%v", queued)
+	}
+	if _, exists := otherRegistry.Value("dmpc_requests_total", "test_subsystem", "read", SuccessMetricsResult); exists {
+		t.Error("Other registry should not have requests done in another registry")
+	}
+}
+
+func TestRequestObserver(t *testing.T) {
+	observed := map[string]int{}
+	registry := NewMetricsRegistry()
+	registry.SetRequestObserver(func(subsystem string, requestType string, duration time.Duration) {
+		if duration < 0 {
+			t.Errorf("Observed duration should not be negative. duration=%v", duration)
+		}
+		observed[subsystem+"/"+requestType]++
+	})
+	metrics := NewSubsystemMetrics(registry, "observed_subsystem")
+	metrics.Start("read").Done(SuccessMetricsResult)
+	metrics.Start("read").DoneWithSuccess(false)
+	metrics.Start("write").Done(SuccessMetricsResult)
+	if observed["observed_subsystem/read"] != 2 || observed["observed_subsystem/write"] != 1 {
+		t.Errorf("Observer should be called for every request done. observed=%+v", observed)
+	}
+
+	// Requests of other registries are not observed
+	NewSubsystemMetrics(NewMetricsRegistry(), "observed_subsystem").Start("read").Done(SuccessMetricsResult)
+	if observed["observed_subsystem/read"] != 2 {
+		t.Errorf("Observer should only be called for requests of its registry. observed=%+v", observed)
+	}
+
+	// Removing observer stops calls
+	registry.SetRequestObserver(nil)
+	metrics.Start("read").Done(SuccessMetricsResult)
+	if observed["observed_subsystem/read"] != 2 {
+		t.Errorf("Removed observer should not be called. observed=%+v", observed)
+	}
+}
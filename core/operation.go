@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/json"
+	"strconv"
 	"time"
 )
 
@@ -19,8 +20,35 @@ const (
 	SubscribeChannelType
 	ChannelEncryptType
 	TransactionEncryptType
+	CancelTicketType
+	LockerAdminType
+	ChannelsAdminType
+	ListChannelsType
 )
 
+var requestTypeNames map[RequestType]string = map[RequestType]string{
+	UsersRequestType:       "users",
+	AddMessageType:         "add_message",
+	ReadChannelType:        "read_channel",
+	AddChannelType:         "add_channel",
+	CloseChannelType:       "close_channel",
+	SubscribeChannelType:   "subscribe_channel",
+	ChannelEncryptType:     "channel_encrypt",
+	TransactionEncryptType: "transaction_encrypt",
+	CancelTicketType:       "cancel_ticket",
+	LockerAdminType:        "locker_admin",
+	ChannelsAdminType:      "channels_admin",
+	ListChannelsType:       "list_channels",
+}
+
+// Name of request type (custom types are named by their number)
+func (requestType RequestType) String() string {
+	if name, ok := requestTypeNames[requestType]; ok {
+		return name
+	}
+	return "custom_" + strconv.Itoa(int(requestType))
+}
+
 /*
 	Structure of an operation before permanent encryption
 */
@@ -38,6 +66,9 @@ type OperationMetaFields struct {
 	Timestamp   time.Time   `json:"timestamp"`
 	ChannelId   string      `json:"channelId"`
 	Buffered    bool
+
+	// Causal metadata (operations seen by each user in the channel)
+	VectorClock VectorClock `json:"vectorClock,omitempty"`
 }
 type Operation struct {
 	Encryption    OperationEncryptionFields     `json:"encryption"`
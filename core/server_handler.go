@@ -0,0 +1,158 @@
+/*
+	Worker pools that can be resized while running
+*/
+
+package core
+
+import (
+	"github.com/mngharbi/gofarm"
+	"sync"
+)
+
+/*
+	Errors
+*/
+var (
+	serverHandlerNotInitializedError error = NewError(InvalidRequestErrorCode, "Server is not initialized.")
+	serverHandlerRunningError        error = NewError(InvalidRequestErrorCode, "Server is already running.")
+	serverHandlerNotRunningError     error = NewError(SubsystemShutdownErrorCode, "Server is not running.")
+	invalidWorkersNumberError        error = NewError(InvalidRequestErrorCode, "Server needs at least one worker.")
+)
+
+/*
+	Same API as gofarm server handlers, with resizing
+	Workers run in a gofarm pool that only forwards work, so resizing starts a new pool
+	and drains the previous one without starting or shutting down the server itself
+	(requests are never rejected while resizing)
+*/
+type ServerHandler struct {
+	lock    sync.RWMutex
+	server  gofarm.ProtoServer
+	pool    *gofarm.ServerHandler
+	running bool
+	started bool
+}
+
+func ProvisionServer() *ServerHandler {
+	return &ServerHandler{}
+}
+
+/*
+	Pool server (server is started and shut down by handler)
+*/
+type poolServer struct {
+	server gofarm.ProtoServer
+}
+
+func (pool *poolServer) Start(_ gofarm.Config, _ bool) error {
+	return nil
+}
+
+func (pool *poolServer) Shutdown() error {
+	return nil
+}
+
+func (pool *poolServer) Work(rq *gofarm.Request) *gofarm.Response {
+	return pool.server.Work(rq)
+}
+
+func (handler *ServerHandler) startPool(conf gofarm.Config) (*gofarm.ServerHandler, error) {
+	if conf.NumWorkers <= 0 {
+		return nil, invalidWorkersNumberError
+	}
+	pool := gofarm.ProvisionServer()
+	pool.InitServer(&poolServer{server: handler.server})
+	if err := pool.StartServer(conf); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+/*
+	Handler API
+*/
+
+func (handler *ServerHandler) ResetServer() {
+	handler.ShutdownServer()
+	handler.lock.Lock()
+	handler.server = nil
+	handler.started = false
+	handler.lock.Unlock()
+}
+
+func (handler *ServerHandler) InitServer(server gofarm.ProtoServer) {
+	handler.lock.Lock()
+	handler.server = server
+	handler.lock.Unlock()
+}
+
+func (handler *ServerHandler) StartServer(conf gofarm.Config) error {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	if handler.server == nil {
+		return serverHandlerNotInitializedError
+	}
+	if handler.running {
+		return serverHandlerRunningError
+	}
+	if conf.NumWorkers <= 0 {
+		return invalidWorkersNumberError
+	}
+	if err := handler.server.Start(conf, !handler.started); err != nil {
+		return err
+	}
+	pool, err := handler.startPool(conf)
+	if err != nil {
+		handler.server.Shutdown()
+		return err
+	}
+	handler.pool = pool
+	handler.started = true
+	handler.running = true
+	return nil
+}
+
+// Requests already queued are handled before server is shut down
+func (handler *ServerHandler) ShutdownServer() {
+	handler.lock.Lock()
+	if !handler.running {
+		handler.lock.Unlock()
+		return
+	}
+	handler.running = false
+	pool := handler.pool
+	handler.pool = nil
+	handler.lock.Unlock()
+
+	pool.ShutdownServer()
+	handler.server.Shutdown()
+}
+
+// New requests go to a pool with the new number of workers while the previous pool is drained
+func (handler *ServerHandler) Resize(conf gofarm.Config) error {
+	handler.lock.Lock()
+	if !handler.running {
+		handler.lock.Unlock()
+		return serverHandlerNotRunningError
+	}
+	pool, err := handler.startPool(conf)
+	if err != nil {
+		handler.lock.Unlock()
+		return err
+	}
+	previousPool := handler.pool
+	handler.pool = pool
+	handler.lock.Unlock()
+
+	previousPool.ShutdownServer()
+	return nil
+}
+
+func (handler *ServerHandler) MakeRequest(rq gofarm.Request) (chan *gofarm.Response, error) {
+	handler.lock.RLock()
+	defer handler.lock.RUnlock()
+	if !handler.running {
+		return nil, serverHandlerNotRunningError
+	}
+	return handler.pool.MakeRequest(rq)
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"github.com/mngharbi/gofarm"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+	Test structure
+*/
+
+type testPoolServer struct {
+	starts    int32
+	shutdowns int32
+	release   chan bool
+	inflight  sync.WaitGroup
+}
+
+func (sv *testPoolServer) Start(_ gofarm.Config, _ bool) error {
+	atomic.AddInt32(&sv.starts, 1)
+	return nil
+}
+
+func (sv *testPoolServer) Shutdown() error {
+	atomic.AddInt32(&sv.shutdowns, 1)
+	return nil
+}
+
+func (sv *testPoolServer) Work(rq *gofarm.Request) *gofarm.Response {
+	sv.inflight.Done()
+	<-sv.release
+	var resp gofarm.Response = (*rq).(int)
+	return &resp
+}
+
+func makeTestPoolServer() *testPoolServer {
+	return &testPoolServer{
+		release: make(chan bool),
+	}
+}
+
+/*
+	Tests
+*/
+
+func TestServerHandlerResize(t *testing.T) {
+	sv := makeTestPoolServer()
+	handler := ProvisionServer()
+	handler.InitServer(sv)
+	if err := handler.StartServer(gofarm.Config{NumWorkers: 1}); err != nil {
+		t.Fatalf("Server should start. Error: %v", err)
+	}
+
+	// Request blocked on single worker
+	sv.inflight.Add(1)
+	firstChannel, err := handler.MakeRequest(1)
+	if err != nil {
+		t.Fatalf("Request should be accepted. Error: %v", err)
+	}
+	sv.inflight.Wait()
+
+	// Resizing waits for running request
+	handler.lock.RLock()
+	previousPool := handler.pool
+	handler.lock.RUnlock()
+	resized := make(chan error)
+	go func() {
+		resized <- handler.Resize(gofarm.Config{NumWorkers: 2})
+	}()
+	for swapped := false; !swapped; {
+		handler.lock.RLock()
+		swapped = handler.pool != previousPool
+		handler.lock.RUnlock()
+	}
+
+	// New requests run on new workers while resizing
+	sv.inflight.Add(2)
+	secondChannel, err := handler.MakeRequest(2)
+	if err != nil {
+		t.Fatalf("Request should be accepted while resizing. Error: %v", err)
+	}
+	thirdChannel, err := handler.MakeRequest(3)
+	if err != nil {
+		t.Fatalf("Request should be accepted while resizing. Error: %v", err)
+	}
+	sv.inflight.Wait()
+	select {
+	case <-resized:
+		t.Errorf("Resizing should wait for running requests.")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// All requests are handled
+	close(sv.release)
+	for expected, responseChannel := range []chan *gofarm.Response{firstChannel, secondChannel, thirdChannel} {
+		resp := <-responseChannel
+		if resp == nil || (*resp).(int) != expected+1 {
+			t.Errorf("Request should be handled. Expected=%v Found=%v", expected+1, resp)
+		}
+	}
+	if err := <-resized; err != nil {
+		t.Errorf("Resizing should succeed. Error: %v", err)
+	}
+
+	// Server itself is not restarted
+	if atomic.LoadInt32(&sv.starts) != 1 || atomic.LoadInt32(&sv.shutdowns) != 0 {
+		t.Errorf("Resizing should not restart server. Starts=%v Shutdowns=%v", sv.starts, sv.shutdowns)
+	}
+
+	handler.ShutdownServer()
+	if atomic.LoadInt32(&sv.shutdowns) != 1 {
+		t.Errorf("Server should be shut down once.")
+	}
+}
+
+func TestServerHandlerResizeInvalid(t *testing.T) {
+	sv := makeTestPoolServer()
+	close(sv.release)
+	handler := ProvisionServer()
+	handler.InitServer(sv)
+
+	// Not running
+	if err := handler.Resize(gofarm.Config{NumWorkers: 1}); err == nil {
+		t.Errorf("Resizing should fail before server is started.")
+	}
+
+	// No workers
+	if err := handler.StartServer(gofarm.Config{NumWorkers: 1}); err != nil {
+		t.Fatalf("Server should start. Error: %v", err)
+	}
+	if err := handler.Resize(gofarm.Config{NumWorkers: 0}); err == nil {
+		t.Errorf("Resizing to no workers should fail.")
+	}
+	sv.inflight.Add(1)
+	responseChannel, err := handler.MakeRequest(1)
+	if err != nil {
+		t.Fatalf("Request should be accepted after failed resize. Error: %v", err)
+	}
+	if resp := <-responseChannel; resp == nil {
+		t.Errorf("Request should be handled after failed resize.")
+	}
+
+	// Shut down
+	handler.ShutdownServer()
+	if _, err := handler.MakeRequest(1); err == nil {
+		t.Errorf("Requests should be rejected after shutdown.")
+	}
+}
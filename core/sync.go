@@ -7,6 +7,7 @@ package core
 import (
 	"github.com/mngharbi/memstore"
 	"sort"
+	"sync/atomic"
 )
 
 /*
@@ -43,11 +44,8 @@ func (s lockNeedCollection) Len() int           { return len(s) }
 func (s lockNeedCollection) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s lockNeedCollection) Less(i, j int) bool { return s[i].Less(s[j]) }
 
-// Order: read low id < read high id < write low id < write high id
+// Order: low id < high id whatever the lock type (ids are unique once sanitized)
 func (a LockNeed) Less(b LockNeed) bool {
-	if a.LockType != b.LockType {
-		return a.LockType == ReadLockType
-	}
 	return a.Id < b.Id
 }
 
@@ -132,6 +130,23 @@ func doLocking(reader RecordReader, lockNeeds []LockNeed, lockingType LockingTyp
 	}
 
 	// Read records
+	records, ok := readLockRecords(reader, sanitizedLockNeeds)
+	if !ok {
+		return false
+	}
+
+	// Perform locking
+	for lockNeedIndex, lockNeed := range sanitizedLockNeeds {
+		rwLock(records[lockNeedIndex].(RWLocker), lockNeed.LockType, lockingType)
+	}
+
+	return true
+}
+
+/*
+	Reads records corresponding to sanitized lock needs (fails if any is missing)
+*/
+func readLockRecords(reader RecordReader, sanitizedLockNeeds []LockNeed) ([]memstore.Item, bool) {
 	var recordIds []string
 	for _, lockNeed := range sanitizedLockNeeds {
 		recordIds = append(recordIds, lockNeed.Id)
@@ -141,16 +156,11 @@ func doLocking(reader RecordReader, lockNeeds []LockNeed, lockingType LockingTyp
 	// Check if any are nil
 	for _, record := range records {
 		if record == nil {
-			return false
+			return nil, false
 		}
 	}
 
-	// Perform locking
-	for lockNeedIndex, lockNeed := range sanitizedLockNeeds {
-		rwLock(records[lockNeedIndex].(RWLocker), lockNeed.LockType, lockingType)
-	}
-
-	return true
+	return records, true
 }
 
 /*
@@ -207,3 +217,22 @@ func RecordReaderFunctor(
 		return memstoreItems
 	}
 }
+
+/*
+	Running state of a worker pool server (safe to read while starting or shutting down)
+*/
+type ServerState struct {
+	running int32
+}
+
+func (state *ServerState) SetRunning(running bool) {
+	var value int32
+	if running {
+		value = 1
+	}
+	atomic.StoreInt32(&state.running, value)
+}
+
+func (state *ServerState) IsRunning() bool {
+	return atomic.LoadInt32(&state.running) == 1
+}
@@ -0,0 +1,214 @@
+/*
+	Locking utilities with cancellable acquisition
+	Lock holders and waiters are tracked for diagnostics
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+	Lock holder/waiter description
+*/
+type LockMode string
+
+const (
+	ReadLockMode  LockMode = "read"
+	WriteLockMode LockMode = "write"
+)
+
+func (lockType LockType) Mode() LockMode {
+	if lockType == WriteLockType {
+		return WriteLockMode
+	}
+	return ReadLockMode
+}
+
+type LockOwner struct {
+	Owner string    `json:"owner"`
+	Mode  LockMode  `json:"mode"`
+	Since time.Time `json:"since"`
+}
+
+/*
+	Read/write mutex where acquisition stops when the context is done
+	Waiting writers block new readers (same as sync.RWMutex)
+*/
+type TimedRWMutex struct {
+	lock           sync.Mutex
+	readers        int
+	writer         bool
+	writersWaiting int
+	released       chan bool
+	holders        []LockOwner
+	waiters        []LockOwner
+}
+
+func NewTimedRWMutex() *TimedRWMutex {
+	return &TimedRWMutex{
+		released: make(chan bool),
+	}
+}
+
+// Wakes up all waiters (lock must be held)
+func (mutex *TimedRWMutex) broadcast() {
+	close(mutex.released)
+	mutex.released = make(chan bool)
+}
+
+func (mutex *TimedRWMutex) canAcquire(lockType LockType) bool {
+	if lockType == WriteLockType {
+		return !mutex.writer && mutex.readers == 0
+	}
+	return !mutex.writer && mutex.writersWaiting == 0
+}
+
+func removeLockOwner(owners []LockOwner, owner string, mode LockMode) ([]LockOwner, bool) {
+	for index, lockOwner := range owners {
+		if lockOwner.Owner == owner && lockOwner.Mode == mode {
+			return append(owners[:index], owners[index+1:]...), true
+		}
+	}
+	return owners, false
+}
+
+func (mutex *TimedRWMutex) LockContext(ctx context.Context, owner string, lockType LockType) bool {
+	mode := lockType.Mode()
+	mutex.lock.Lock()
+	isWaiting := false
+	for !mutex.canAcquire(lockType) {
+		// Register as waiter
+		if !isWaiting {
+			isWaiting = true
+			mutex.waiters = append(mutex.waiters, LockOwner{Owner: owner, Mode: mode, Since: time.Now()})
+			if lockType == WriteLockType {
+				mutex.writersWaiting++
+			}
+		}
+		released := mutex.released
+		mutex.lock.Unlock()
+
+		select {
+		case <-released:
+			mutex.lock.Lock()
+		case <-ctx.Done():
+			// Give up waiting and let others retry (waiting writers may be blocking readers)
+			mutex.lock.Lock()
+			mutex.waiters, _ = removeLockOwner(mutex.waiters, owner, mode)
+			if lockType == WriteLockType {
+				mutex.writersWaiting--
+				mutex.broadcast()
+			}
+			mutex.lock.Unlock()
+			return false
+		}
+	}
+
+	// Acquire
+	if isWaiting {
+		mutex.waiters, _ = removeLockOwner(mutex.waiters, owner, mode)
+		if lockType == WriteLockType {
+			mutex.writersWaiting--
+		}
+	}
+	if lockType == WriteLockType {
+		mutex.writer = true
+	} else {
+		mutex.readers++
+	}
+	mutex.holders = append(mutex.holders, LockOwner{Owner: owner, Mode: mode, Since: time.Now()})
+	mutex.lock.Unlock()
+	return true
+}
+
+func (mutex *TimedRWMutex) UnlockOwner(owner string, lockType LockType) bool {
+	mode := lockType.Mode()
+	mutex.lock.Lock()
+	defer mutex.lock.Unlock()
+
+	// Check lock is held in the mode requested
+	if (lockType == WriteLockType && !mutex.writer) || (lockType == ReadLockType && mutex.readers == 0) {
+		return false
+	}
+
+	// Remove holder (owners that don't hold the lock can't release it)
+	var found bool
+	if mutex.holders, found = removeLockOwner(mutex.holders, owner, mode); !found {
+		return false
+	}
+
+	if lockType == WriteLockType {
+		mutex.writer = false
+	} else {
+		mutex.readers--
+	}
+	mutex.broadcast()
+	return true
+}
+
+/*
+	Snapshot of current holders and waiters
+*/
+func (mutex *TimedRWMutex) State() (holders []LockOwner, waiters []LockOwner) {
+	mutex.lock.Lock()
+	defer mutex.lock.Unlock()
+	holders = append(holders, mutex.holders...)
+	waiters = append(waiters, mutex.waiters...)
+	return
+}
+
+/*
+	Defines an object that can be (un)locked by an owner with cancellable locking
+*/
+type TimedLocker interface {
+	LockContext(context.Context, string, LockType) bool
+	UnlockOwner(string, LockType) bool
+}
+
+/*
+	Generic locking function with cancellation
+	Locks partially held are rolled back if the context is done before all are acquired
+*/
+func LockContext(ctx context.Context, reader RecordReader, lockNeeds []LockNeed, owner string) bool {
+	sanitizedLockNeeds := sanitizeLockNeeds(lockNeeds)
+	records, ok := readLockRecords(reader, sanitizedLockNeeds)
+	if !ok {
+		return false
+	}
+
+	for lockNeedIndex, lockNeed := range sanitizedLockNeeds {
+		if !records[lockNeedIndex].(TimedLocker).LockContext(ctx, owner, lockNeed.LockType) {
+			// Roll back in reverse order
+			for heldIndex := lockNeedIndex - 1; heldIndex >= 0; heldIndex-- {
+				records[heldIndex].(TimedLocker).UnlockOwner(owner, sanitizedLockNeeds[heldIndex].LockType)
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+	Generic unlocking function for locks taken with LockContext
+*/
+func UnlockOwner(reader RecordReader, lockNeeds []LockNeed, owner string) bool {
+	sanitizedLockNeeds := sanitizeUnlockNeeds(lockNeeds)
+	records, ok := readLockRecords(reader, sanitizedLockNeeds)
+	if !ok {
+		return false
+	}
+
+	success := true
+	for lockNeedIndex, lockNeed := range sanitizedLockNeeds {
+		if !records[lockNeedIndex].(TimedLocker).UnlockOwner(owner, lockNeed.LockType) {
+			success = false
+		}
+	}
+
+	return success
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"github.com/mngharbi/memstore"
+	"testing"
+	"time"
+)
+
+/*
+	Test structure
+*/
+
+type testTimedLocker struct {
+	id    string
+	mutex *TimedRWMutex
+
+	// Pause after locking (lets other owners interleave)
+	lockDelay time.Duration
+}
+
+func (l *testTimedLocker) LockContext(ctx context.Context, owner string, lockType LockType) bool {
+	if !l.mutex.LockContext(ctx, owner, lockType) {
+		return false
+	}
+	time.Sleep(l.lockDelay)
+	return true
+}
+
+func (l *testTimedLocker) UnlockOwner(owner string, lockType LockType) bool {
+	return l.mutex.UnlockOwner(owner, lockType)
+}
+
+func (l *testTimedLocker) Less(string, interface{}) bool {
+	return true
+}
+
+func makeTimedLockersReader(lockers map[string]*testTimedLocker) RecordReader {
+	return func(ids []string) []memstore.Item {
+		var res []memstore.Item
+		for _, id := range ids {
+			res = append(res, lockers[id])
+		}
+		return res
+	}
+}
+
+/*
+	Tests
+*/
+
+func TestTimedRWMutex(t *testing.T) {
+	mutex := NewTimedRWMutex()
+
+	// Readers share lock
+	if !mutex.LockContext(context.Background(), "READER_1", ReadLockType) ||
+		!mutex.LockContext(context.Background(), "READER_2", ReadLockType) {
+		t.Errorf("Read locks should be shared.")
+	}
+
+	// Writer times out while readers hold lock
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if mutex.LockContext(ctx, "WRITER", WriteLockType) {
+		t.Errorf("Write lock should not be acquired while read locks are held.")
+	}
+
+	// Holders are tracked
+	holders, waiters := mutex.State()
+	if len(holders) != 2 || len(waiters) != 0 {
+		t.Errorf("Mutex state should list holders and no waiters. holders=%+v, waiters=%+v", holders, waiters)
+	}
+
+	// Owners that don't hold lock can't release it
+	if mutex.UnlockOwner("UNKNOWN", ReadLockType) {
+		t.Errorf("Unlocking by an unknown owner should fail.")
+	}
+	if holders, _ = mutex.State(); len(holders) != 2 {
+		t.Errorf("Unlocking by an unknown owner should not release holders. holders=%+v", holders)
+	}
+
+	// Writer acquires lock once readers release
+	done := make(chan bool)
+	go func() {
+		done <- mutex.LockContext(context.Background(), "WRITER", WriteLockType)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, waiters = mutex.State(); len(waiters) != 1 || waiters[0].Owner != "WRITER" || waiters[0].Mode != WriteLockMode {
+		t.Errorf("Mutex state should list waiting writer. waiters=%+v", waiters)
+	}
+	mutex.UnlockOwner("READER_1", ReadLockType)
+	mutex.UnlockOwner("READER_2", ReadLockType)
+	if !<-done {
+		t.Errorf("Write lock should be acquired after read locks are released.")
+	}
+
+	// Unlock
+	if !mutex.UnlockOwner("WRITER", WriteLockType) {
+		t.Errorf("Write unlock should succeed.")
+	}
+	if mutex.UnlockOwner("WRITER", WriteLockType) || mutex.UnlockOwner("READER_1", ReadLockType) {
+		t.Errorf("Unlocking a lock not held should fail.")
+	}
+}
+
+func TestLockContextRollback(t *testing.T) {
+	lockers := map[string]*testTimedLocker{
+		"1": {id: "1", mutex: NewTimedRWMutex()},
+		"2": {id: "2", mutex: NewTimedRWMutex()},
+	}
+	reader := makeTimedLockersReader(lockers)
+
+	// Hold second resource
+	if !LockContext(context.Background(), reader, []LockNeed{{WriteLockType, "2"}}, "HOLDER") {
+		t.Errorf("Lock should be acquired.")
+	}
+
+	// Locking both times out and rolls back first resource
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if LockContext(ctx, reader, []LockNeed{{WriteLockType, "2"}, {WriteLockType, "1"}}, "WAITER") {
+		t.Errorf("Lock should not be acquired while resource is held.")
+	}
+	if holders, _ := lockers["1"].mutex.State(); len(holders) != 0 {
+		t.Errorf("Partially held locks should be rolled back. holders=%+v", holders)
+	}
+
+	// Unlock
+	if !UnlockOwner(reader, []LockNeed{{WriteLockType, "2"}}, "HOLDER") {
+		t.Errorf("Unlock should succeed.")
+	}
+}
+
+func TestLockContextCrossedNeeds(t *testing.T) {
+	lockers := map[string]*testTimedLocker{
+		"A": {id: "A", mutex: NewTimedRWMutex(), lockDelay: time.Millisecond},
+		"B": {id: "B", mutex: NewTimedRWMutex(), lockDelay: time.Millisecond},
+	}
+	reader := makeTimedLockersReader(lockers)
+
+	// A updates B while B updates A (signer read locked and subject write locked)
+	crossedNeeds := map[string][]LockNeed{
+		"A_UPDATES_B": {{ReadLockType, "A"}, {WriteLockType, "B"}},
+		"B_UPDATES_A": {{ReadLockType, "B"}, {WriteLockType, "A"}},
+	}
+	results := make(chan bool, len(crossedNeeds))
+	for owner, lockNeeds := range crossedNeeds {
+		go func(owner string, lockNeeds []LockNeed) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			for i := 0; i < 50; i++ {
+				if !LockContext(ctx, reader, lockNeeds, owner) {
+					results <- false
+					return
+				}
+				UnlockOwner(reader, lockNeeds, owner)
+			}
+			results <- true
+		}(owner, lockNeeds)
+	}
+	for range crossedNeeds {
+		if !<-results {
+			t.Errorf("Crossed lock needs should not deadlock.")
+		}
+	}
+}
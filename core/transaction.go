@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 )
 
 /*
@@ -12,6 +14,19 @@ type PipelineConfig struct {
 	ReadStatusUpdates bool `json:"read_status_updates"`
 	ReadResult        bool `json:"read_result"`
 	KeepAlive         bool `json:"keep_alive"`
+
+	// Time allowed to run the transaction in milliseconds (no deadline if zero)
+	Timeout int `json:"timeout"`
+}
+
+/*
+	Builds the context carried by the transaction through the subsystems
+*/
+func (conf *PipelineConfig) GetContext() (context.Context, context.CancelFunc) {
+	if conf.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(conf.Timeout)*time.Millisecond)
 }
 
 type TransactionEncryptionFields struct {
@@ -0,0 +1,106 @@
+/*
+	Vector clocks (causal metadata carried by operations)
+*/
+
+package core
+
+/*
+	Clock definition: number of operations seen by user id
+*/
+type VectorClock map[string]uint64
+
+/*
+	Causal relation between clocks
+*/
+type ClockRelation int
+
+const (
+	ClockEqual ClockRelation = iota
+	ClockBefore
+	ClockAfter
+	ClockConcurrent
+)
+
+/*
+	Compares clocks (missing entries count as zero)
+*/
+func (vc VectorClock) Compare(other VectorClock) ClockRelation {
+	before := false
+	after := false
+	for id, count := range vc {
+		if count > other[id] {
+			after = true
+		} else if count < other[id] {
+			before = true
+		}
+	}
+	for id, count := range other {
+		if _, ok := vc[id]; !ok && count > 0 {
+			before = true
+		}
+	}
+
+	switch {
+	case before && after:
+		return ClockConcurrent
+	case before:
+		return ClockBefore
+	case after:
+		return ClockAfter
+	}
+	return ClockEqual
+}
+
+/*
+	Depth of clock (sum of all entries)
+	Strictly increases along causal order, so ordering by depth never contradicts causality
+*/
+func (vc VectorClock) Depth() uint64 {
+	var depth uint64 = 0
+	for _, count := range vc {
+		depth += count
+	}
+	return depth
+}
+
+/*
+	Copy of clock (nil if empty)
+*/
+func (vc VectorClock) Copy() VectorClock {
+	if len(vc) == 0 {
+		return nil
+	}
+	res := VectorClock{}
+	for id, count := range vc {
+		res[id] = count
+	}
+	return res
+}
+
+/*
+	Copy of clock with entry of user incremented
+*/
+func (vc VectorClock) Increment(id string) VectorClock {
+	res := vc.Copy()
+	if res == nil {
+		res = VectorClock{}
+	}
+	res[id]++
+	return res
+}
+
+/*
+	Copy of clock with highest entries from both clocks
+*/
+func (vc VectorClock) Merge(other VectorClock) VectorClock {
+	res := vc.Copy()
+	if res == nil && len(other) > 0 {
+		res = VectorClock{}
+	}
+	for id, count := range other {
+		if count > res[id] {
+			res[id] = count
+		}
+	}
+	return res
+}
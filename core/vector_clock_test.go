@@ -0,0 +1,47 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVectorClockCompare(t *testing.T) {
+	a := VectorClock{"USER_A": 1}
+	b := a.Increment("USER_B")
+	c := a.Increment("USER_A")
+
+	if a.Compare(a.Copy()) != ClockEqual || VectorClock(nil).Compare(VectorClock{"USER_A": 0}) != ClockEqual {
+		t.Error("Clocks with the same entries should be equal")
+	}
+	if a.Compare(b) != ClockBefore || b.Compare(a) != ClockAfter {
+		t.Error("Incremented clock should be after the original")
+	}
+	if VectorClock(nil).Compare(a) != ClockBefore {
+		t.Error("Empty clock should be before any other")
+	}
+	if b.Compare(c) != ClockConcurrent || c.Compare(b) != ClockConcurrent {
+		t.Error("Clocks incremented by different users should be concurrent")
+	}
+	if a.Depth() != 1 || b.Depth() != 2 || VectorClock(nil).Depth() != 0 {
+		t.Error("Clock depth should be the sum of its entries")
+	}
+}
+
+func TestVectorClockMerge(t *testing.T) {
+	a := VectorClock{"USER_A": 3, "USER_B": 1}
+	b := VectorClock{"USER_B": 2, "USER_C": 1}
+
+	merged := a.Merge(b)
+	if !reflect.DeepEqual(merged, VectorClock{"USER_A": 3, "USER_B": 2, "USER_C": 1}) {
+		t.Errorf("Merged clock should keep highest entries, found %v", merged)
+	}
+	if merged.Compare(a) != ClockAfter || merged.Compare(b) != ClockAfter {
+		t.Error("Merged clock should be after both clocks")
+	}
+	if a["USER_B"] != 1 {
+		t.Error("Merging should not modify clocks")
+	}
+	if VectorClock(nil).Merge(nil) != nil {
+		t.Error("Merging empty clocks should be empty")
+	}
+}
@@ -1,131 +1,142 @@
 package daemon
 
 import (
-	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/cli"
 	"github.com/mngharbi/DMPC/core"
-	"github.com/mngharbi/DMPC/decryptor"
-	"github.com/mngharbi/DMPC/executor"
-	"github.com/mngharbi/DMPC/keys"
-	"github.com/mngharbi/DMPC/locker"
-	"github.com/mngharbi/DMPC/pipeline"
 	"github.com/mngharbi/DMPC/status"
-	"github.com/mngharbi/DMPC/users"
 )
 
-func startDaemons(conf *cli.Config, shutdownLambda core.ShutdownLambda) {
+func (node *Node) startDaemons(conf *cli.Config, shutdownLambda core.ShutdownLambda) {
 	// Start locker subsystem
-	log.Debugf(startingLockerSubsystemLogMsg)
+	node.log.Debugf(startingLockerSubsystemLogMsg)
 	lockerSubsystemConfig := conf.GetLockerSubsystemConfig()
-	locker.StartServer(lockerSubsystemConfig, log, shutdownLambda)
+	node.Locker.StartServer(lockerSubsystemConfig, node.log.ForSubsystem(lockerSubsystemName), shutdownLambda)
 
 	// Start users subsystem
-	log.Debugf(startingUsersSubsystemLogMsg)
+	node.log.Debugf(startingUsersSubsystemLogMsg)
 	usersSubsystemConfig := conf.GetUsersSubsystemConfig()
-	users.StartServer(usersSubsystemConfig, log, shutdownLambda)
+	node.Users.StartServer(usersSubsystemConfig, node.log.ForSubsystem(usersSubsystemName), shutdownLambda)
 
 	// Start channels subsystem
-	log.Debugf(startingChannelsSubsystemLogMsg)
+	node.log.Debugf(startingChannelsSubsystemLogMsg)
 	channelsMainSubsystemConfig, channelsMessagesSubsystemConfig, channelsListenersSubsystemConfig := conf.GetChannelsSubsystemConfig()
-	channels.StartServers(channelsMainSubsystemConfig, channelsMessagesSubsystemConfig, channelsListenersSubsystemConfig, decryptor.MakeOperationRequest, log, shutdownLambda)
+	node.Channels.StartServers(channelsMainSubsystemConfig, channelsMessagesSubsystemConfig, channelsListenersSubsystemConfig, node.Decryptor.MakeOperationRequest, node.log.ForSubsystem(channelsSubsystemName), shutdownLambda)
 
 	// Start status systems (status update and listeners servers)
-	log.Debugf(startingStatusSubsystemLogMsg)
+	node.log.Debugf(startingStatusSubsystemLogMsg)
 	statusUpdateConfig, statusListenersConfig := conf.GetStatusSubsystemConfig()
-	status.StartServers(statusUpdateConfig, statusListenersConfig, log, shutdownLambda)
+	node.Status.StartServers(statusUpdateConfig, statusListenersConfig, node.log.ForSubsystem(statusSubsystemName), shutdownLambda)
 
 	// Start keys subsystem
-	log.Debugf(startingKeysSubsystemLogMsg)
+	node.log.Debugf(startingKeysSubsystemLogMsg)
 	keysSubsystemConfig := conf.GetKeysSubsystemConfig()
-	keys.StartServer(keysSubsystemConfig, log, shutdownLambda)
+	node.Keys.StartServer(keysSubsystemConfig, node.log.ForSubsystem(keysSubsystemName), shutdownLambda)
 
 	// Start executor subsystem
-	log.Debugf(startingExecutorSubsystemLogMsg)
-	executor.InitializeServer(
-		users.MakeRequest,
-		users.MakeUnverifiedRequest,
-		channels.AddMessage,
-		channels.BufferOperation,
-		channels.ChannelAction,
-		channels.ListenerAction,
-		locker.RequestLock,
-		keys.AddKey,
-		keys.Encrypt,
-		status.UpdateStatus,
+	node.log.Debugf(startingExecutorSubsystemLogMsg)
+	node.Executor.InitializeServer(
+		node.Users.MakeRequest,
+		node.Users.MakeUnverifiedRequest,
+		node.Channels.AddMessage,
+		node.Channels.BufferOperation,
+		node.Channels.ChannelAction,
+		node.Channels.ListenerAction,
+		node.Locker.RequestLock,
+		node.Locker.Admin,
+		node.Channels.Admin,
+		node.Keys.AddKey,
+		node.Keys.Encrypt,
+		node.Status.UpdateStatus,
 		status.RequestNewTicket,
-		log,
+		node.log.ForSubsystem(executorSubsystemName),
 		shutdownLambda,
 	)
 	executorSubsystemConfig := conf.GetExecutorSubsystemConfig()
-	executor.StartServer(executorSubsystemConfig)
+	node.Executor.StartServer(executorSubsystemConfig)
 
 	// Start decryptor subsystem
-	log.Debugf(startingDecryptorSubsystemLogMsg)
+	node.log.Debugf(startingDecryptorSubsystemLogMsg)
 	privateEncryptionKey, err := conf.GetPrivateEncryptionKey()
 	if err != nil {
-		log.Fatalf(inaccessiblePrivateEncryptionKeyErrorMsg, err.Error())
+		node.log.Fatalf(inaccessiblePrivateEncryptionKeyErrorMsg, err.Error())
 	}
-	decryptor.InitializeServer(
+	node.Decryptor.InitializeServer(
 		privateEncryptionKey,
-		users.GetSigningKeysById,
-		keys.Decrypt,
-		executor.MakeRequest,
-		log,
+		node.Users.GetSigningKeysById,
+		node.Keys.Decrypt,
+		node.Executor.MakeRequest,
+		node.log.ForSubsystem(decryptorSubsystemName),
 		shutdownLambda,
 	)
 	decryptorSubsystemConfig := conf.GetDecryptorSubsystemConfig()
-	decryptor.StartServer(decryptorSubsystemConfig)
+	node.Decryptor.StartServer(decryptorSubsystemConfig)
 
 	// Start pipeline subsystem (websocket server)
-	log.Debugf(startingPipelineSubsystemLogMsg)
+	node.log.Debugf(startingPipelineSubsystemLogMsg)
 	pipelineSubsystemConfig := conf.GetPipelineSubsystemConfig()
-	pipeline.StartServer(pipelineSubsystemConfig, decryptor.MakeTransactionRequest, channels.ListenerAction, status.AddListener, log)
+	node.Pipeline.SetHealthReporter(node.healthReport)
+	node.Pipeline.StartServer(pipelineSubsystemConfig, node.Decryptor.MakeTransactionRequest, node.Channels.ListenerAction, node.Status.AddListener, node.log.ForSubsystem(pipelineSubsystemName))
+
+	// Start metrics server
+	node.log.Debugf(startingMetricsLogMsg)
+	node.startMetricsServer(conf)
 }
 
-func shutdownDaemons() {
-	log.Debugf(shutdownPipelineSubsystemLogMsg)
-	pipeline.ShutdownServer()
+func (node *Node) shutdownDaemons() {
+	node.log.Debugf(shutdownMetricsLogMsg)
+	node.shutdownMetricsServer()
+
+	node.log.Debugf(shutdownPipelineSubsystemLogMsg)
+	node.Pipeline.ShutdownServer()
 
-	log.Debugf(shutdownDecryptorSubsystemLogMsg)
-	decryptor.ShutdownServer()
+	node.log.Debugf(shutdownDecryptorSubsystemLogMsg)
+	node.Decryptor.ShutdownServer()
 
-	log.Debugf(shutdownKeysSubsystemLogMsg)
-	keys.ShutdownServer()
+	node.log.Debugf(shutdownKeysSubsystemLogMsg)
+	node.Keys.ShutdownServer()
 
-	log.Debugf(shutdownUsersSubsystemLogMsg)
-	users.ShutdownServer()
+	node.log.Debugf(shutdownUsersSubsystemLogMsg)
+	node.Users.ShutdownServer()
 
-	log.Debugf(shutdownChannelsSubsystemLogMsg)
-	channels.ShutdownServers()
+	node.log.Debugf(shutdownChannelsSubsystemLogMsg)
+	node.Channels.ShutdownServers()
 
-	log.Debugf(shutdownExecutorSubsystemLogMsg)
-	executor.ShutdownServer()
+	node.log.Debugf(shutdownExecutorSubsystemLogMsg)
+	node.Executor.ShutdownServer()
 
-	log.Debugf(shutdownStatusSubsystemLogMsg)
-	status.ShutdownServers()
+	node.log.Debugf(shutdownStatusSubsystemLogMsg)
+	node.Status.ShutdownServers()
+
+	node.log.Debugf(shutdownLockerSubsystemLogMsg)
+	node.Locker.ShutdownServer()
+}
 
-	log.Debugf(shutdownLockerSubsystemLogMsg)
-	locker.ShutdownServer()
+/*
+	Options for starting the daemon
+*/
+type Options struct {
+	// File accepted transactions are appended to (no recording if empty)
+	RecordPath string
 }
 
-func Start() {
+func Start(options Options) {
 	// Setup listening on shutdown signals
 	terminationChannel, shutdownLambda := setupShutdown()
 	go shutdownWhenSignaled(terminationChannel)
 
 	// Parse confuration and setup logging
-	conf := doSetup()
-
-	// Build user object from confuration files
-	rootUserOperation := buildRootUserOperation(conf)
-
-	// Start all subsystems
-	log.Infof(startingUpSubsystemsInfoMsg)
-	startDaemons(conf, shutdownLambda)
+	conf := doSetup(shutdownLambda)
+
+	// Record accepted transactions
+	if options.RecordPath != "" {
+		if err := defaultNode.Record(options.RecordPath); err != nil {
+			log.Fatalf(recordFileErrorMsg, options.RecordPath, err)
+		}
+		log.Infof(recordingInfoMsg, options.RecordPath)
+	}
 
-	// Make root user request
-	log.Infof(createRootUserInfoMsg)
-	createRootUser(rootUserOperation)
+	// Start default node
+	defaultNode.Start(conf, shutdownLambda)
 
 	// Sleep forever (program is terminated by shutdown goroutine)
 	select {}
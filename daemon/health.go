@@ -0,0 +1,29 @@
+package daemon
+
+/*
+	Node health reported on the pipeline server
+*/
+
+import (
+	"github.com/mngharbi/DMPC/pipeline"
+	"sync/atomic"
+)
+
+func (node *Node) setReady() {
+	atomic.StoreInt32(&node.isReady, 1)
+}
+
+func (node *Node) healthReport() *pipeline.HealthReport {
+	return &pipeline.HealthReport{
+		Ready: atomic.LoadInt32(&node.isReady) == 1,
+		Subsystems: map[string]bool{
+			lockerSubsystemName:    node.Locker.IsRunning(),
+			usersSubsystemName:     node.Users.IsRunning(),
+			channelsSubsystemName:  node.Channels.IsRunning(),
+			statusSubsystemName:    node.Status.IsRunning(),
+			keysSubsystemName:      node.Keys.IsRunning(),
+			executorSubsystemName:  node.Executor.IsRunning(),
+			decryptorSubsystemName: node.Decryptor.IsRunning(),
+		},
+	}
+}
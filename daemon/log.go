@@ -24,16 +24,35 @@ const (
 	shutdownDecryptorSubsystemLogMsg string = "Shutting down decryptor subsystem"
 	shutdownPipelineSubsystemLogMsg  string = "Shutting down pipeline subsystem"
 
+	startingMetricsLogMsg      string = "Starting metrics server"
+	shutdownMetricsLogMsg      string = "Shutting down metrics server"
 	checkingInstallLogMsg      string = "Checking DMPC install configuration"
 	parsingConfigurationLogMsg string = "Parsing configuration"
 )
 
+/*
+	Configuration reload messages
+*/
+const (
+	reloadingConfigInfoMsg             string = "Reloading configuration"
+	noConfigChangesInfoMsg             string = "Configuration has not changed"
+	configChangeInfoMsg                string = "Configuration changed: %v (%v -> %v)"
+	configChangeRequiresRestartWarnMsg string = "Configuration changed: %v (%v -> %v), change requires a restart"
+	reloadBeforeStartupWarnMsg         string = "Configuration reload requested before startup, ignoring"
+	reloadConfigErrorMsg               string = "Configuration not reloaded. Error: %v"
+	applyConfigErrorMsg                string = "Unable to apply configuration to %v subsystem. Error: %v"
+	invalidWorkerCountErrorMsg         string = " subsystem needs at least one worker"
+)
+
 /*
 	Info messages
 */
 const (
 	startingUpSubsystemsInfoMsg string = "Starting up subsystems"
 	createRootUserInfoMsg       string = "Initializing root user"
+	readyInfoMsg                string = "Node is ready"
+	servingMetricsInfoMsg       string = "Serving metrics on %v"
+	recordingInfoMsg            string = "Recording accepted transactions to %v"
 )
 
 /*
@@ -41,4 +60,7 @@ const (
 */
 const (
 	inaccessiblePrivateEncryptionKeyErrorMsg string = "Unable to access private encryption key. Error: %v"
+	metricsCannotListenErrorMsg              string = "Unable to serve metrics on %v. Error: %v"
+	metricsWriteWarnMsg                      string = "Unable to write metrics. Error: %v"
+	recordFileErrorMsg                       string = "Unable to open record file %v. Error: %v"
 )
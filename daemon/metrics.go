@@ -0,0 +1,55 @@
+package daemon
+
+/*
+	Metrics endpoint (prometheus text format)
+*/
+
+import (
+	"github.com/mngharbi/DMPC/cli"
+	"net"
+	"net/http"
+)
+
+const (
+	metricsPath        string = "/metrics"
+	metricsContentType string = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+func (node *Node) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	if err := node.Metrics.WritePrometheus(w); err != nil {
+		node.log.Warnf(metricsWriteWarnMsg, err)
+	}
+}
+
+/*
+	Starts serving metrics if enabled (failing to listen is not fatal)
+*/
+func (node *Node) startMetricsServer(conf *cli.Config) {
+	addr, enabled := conf.GetMetricsAddress()
+	if !enabled {
+		return
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		node.log.Errorf(metricsCannotListenErrorMsg, addr, err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, node.serveMetrics)
+	node.metricsServer = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	go node.metricsServer.Serve(listener)
+	node.log.Infof(servingMetricsInfoMsg, addr)
+}
+
+func (node *Node) shutdownMetricsServer() {
+	if node.metricsServer != nil {
+		node.metricsServer.Close()
+		node.metricsServer = nil
+	}
+}
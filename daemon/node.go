@@ -0,0 +1,132 @@
+package daemon
+
+/*
+	Node (subsystem instances wired together)
+*/
+
+import (
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/cli"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/decryptor"
+	"github.com/mngharbi/DMPC/executor"
+	"github.com/mngharbi/DMPC/keys"
+	"github.com/mngharbi/DMPC/locker"
+	"github.com/mngharbi/DMPC/pipeline"
+	"github.com/mngharbi/DMPC/status"
+	"github.com/mngharbi/DMPC/users"
+	"net/http"
+	"sync"
+)
+
+type Node struct {
+	Locker    *locker.Server
+	Users     *users.Server
+	Channels  *channels.Subsystem
+	Status    *status.Subsystem
+	Keys      *keys.Server
+	Executor  *executor.Server
+	Decryptor *decryptor.Server
+	Pipeline  *pipeline.Server
+
+	// Registry of the metrics of all subsystems of the node
+	Metrics *core.MetricsRegistry
+
+	log *core.LoggingHandler
+
+	// Set once the root user is created
+	isReady int32
+
+	// Metrics endpoint (if enabled)
+	metricsServer *http.Server
+
+	// Accepted transactions are appended to file (if enabled)
+	recorder *pipeline.Recorder
+
+	// Configuration of running subsystems
+	runningConfigLock sync.Mutex
+	runningConfig     *cli.Config
+}
+
+/*
+	Makes a node with new subsystem instances (metrics are not shared with other nodes)
+*/
+func NewNode(loggingHandler *core.LoggingHandler) *Node {
+	metricsRegistry := core.NewMetricsRegistry()
+	return &Node{
+		Locker:    locker.NewServer(metricsRegistry),
+		Users:     users.NewServer(metricsRegistry),
+		Channels:  channels.NewSubsystem(metricsRegistry),
+		Status:    status.NewSubsystem(metricsRegistry),
+		Keys:      keys.NewServer(metricsRegistry),
+		Executor:  executor.NewServer(metricsRegistry),
+		Decryptor: decryptor.NewServer(metricsRegistry),
+		Pipeline:  pipeline.NewServer(metricsRegistry),
+		Metrics:   metricsRegistry,
+		log:       loggingHandler,
+	}
+}
+
+/*
+	Node using the instances behind package functions
+*/
+var defaultNode *Node = &Node{
+	Locker:    locker.DefaultServer(),
+	Users:     users.DefaultServer(),
+	Channels:  channels.DefaultSubsystem(),
+	Status:    status.DefaultSubsystem(),
+	Keys:      keys.DefaultServer(),
+	Executor:  executor.DefaultServer(),
+	Decryptor: decryptor.DefaultServer(),
+	Pipeline:  pipeline.DefaultServer(),
+	Metrics:   core.Metrics,
+}
+
+/*
+	Starts all subsystems and creates the root user
+*/
+func (node *Node) Start(conf *cli.Config, shutdownLambda core.ShutdownLambda) {
+	// Build user object from configuration files
+	rootUserOperation := node.buildRootUserOperation(conf)
+
+	// Start all subsystems
+	node.log.Infof(startingUpSubsystemsInfoMsg)
+	node.startDaemons(conf, shutdownLambda)
+	node.setRunningConfig(conf)
+
+	// Make root user request
+	node.log.Infof(createRootUserInfoMsg)
+	node.createRootUser(rootUserOperation)
+	node.setReady()
+	node.log.Infof(readyInfoMsg)
+}
+
+/*
+	Soft shuts down all subsystems
+*/
+func (node *Node) Shutdown() {
+	node.shutdownDaemons()
+	if node.recorder != nil {
+		node.recorder.Close()
+	}
+}
+
+/*
+	Appends transactions accepted by the pipeline to file (for replay)
+*/
+func (node *Node) Record(path string) error {
+	recorder, err := pipeline.NewRecorder(path)
+	if err != nil {
+		return err
+	}
+	node.recorder = recorder
+	node.Pipeline.SetRecorder(recorder)
+	return nil
+}
+
+/*
+	Re-reads configuration and applies changes that are safe at runtime
+*/
+func (node *Node) Reload() {
+	node.reloadConfig()
+}
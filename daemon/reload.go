@@ -0,0 +1,194 @@
+package daemon
+
+/*
+	Configuration reloading (triggered by SIGHUP)
+*/
+
+import (
+	"errors"
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/cli"
+	"github.com/mngharbi/DMPC/locker"
+	"strings"
+)
+
+func (node *Node) setRunningConfig(conf *cli.Config) {
+	node.runningConfigLock.Lock()
+	node.runningConfig = conf
+	node.runningConfigLock.Unlock()
+}
+
+/*
+	Fields only applied on startup (prefixes of json paths)
+*/
+var restartRequiredFields []string = []string{
+	"paths.",
+	"pipeline.hostname",
+	"pipeline.port",
+	"metrics.",
+}
+
+func requiresRestart(field string) bool {
+	for _, prefix := range restartRequiredFields {
+		if field == prefix || strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Re-reads configuration and applies changes that are safe at runtime
+*/
+func (node *Node) reloadConfig() {
+	node.runningConfigLock.Lock()
+	defer node.runningConfigLock.Unlock()
+
+	if node.runningConfig == nil {
+		node.log.Warnf(reloadBeforeStartupWarnMsg)
+		return
+	}
+
+	node.log.Infof(reloadingConfigInfoMsg)
+	conf, err := cli.ReadConfig()
+	if err == nil {
+		err = checkWorkerCounts(conf)
+	}
+	if err != nil {
+		node.log.Errorf(reloadConfigErrorMsg, err)
+		return
+	}
+
+	// Log diff
+	changes := cli.DiffConfigs(node.runningConfig, conf)
+	if len(changes) == 0 {
+		node.log.Infof(noConfigChangesInfoMsg)
+		return
+	}
+	for _, change := range changes {
+		if requiresRestart(change.Field) {
+			node.log.Warnf(configChangeRequiresRestartWarnMsg, change.Field, change.Old, change.New)
+		} else {
+			node.log.Infof(configChangeInfoMsg, change.Field, change.Old, change.New)
+		}
+	}
+
+	node.applyConfig(node.runningConfig, conf)
+	node.runningConfig = conf
+}
+
+/*
+	Configurations with empty worker pools are rejected
+*/
+func checkWorkerCounts(conf *cli.Config) error {
+	channelsConfig, messagesConfig, channelListenersConfig := conf.GetChannelsSubsystemConfig()
+	statusUpdateConfig, statusListenersConfig := conf.GetStatusSubsystemConfig()
+	workerCounts := map[string]int{
+		"locker":             conf.GetLockerSubsystemConfig().NumWorkers,
+		"users":              conf.GetUsersSubsystemConfig().NumWorkers,
+		"channels.channels":  channelsConfig.NumWorkers,
+		"channels.messages":  messagesConfig.NumWorkers,
+		"channels.listeners": channelListenersConfig.NumWorkers,
+		"status.update":      statusUpdateConfig.NumWorkers,
+		"status.listeners":   statusListenersConfig.NumWorkers,
+		"keys":               conf.GetKeysSubsystemConfig().NumWorkers,
+		"executor":           conf.GetExecutorSubsystemConfig().NumWorkers,
+		"decryptor":          conf.GetDecryptorSubsystemConfig().NumWorkers,
+	}
+	for subsystem, numWorkers := range workerCounts {
+		if numWorkers <= 0 {
+			return errors.New(subsystem + invalidWorkerCountErrorMsg)
+		}
+	}
+	return nil
+}
+
+/*
+	Applies changes that are safe at runtime (running requests are not affected)
+*/
+func (node *Node) applyConfig(oldConf *cli.Config, newConf *cli.Config) {
+	// Log levels and format
+	applyLoggingConfig(node.log, newConf)
+
+	// Lock timeout
+	if oldConf.Locker.LockTimeout != newConf.Locker.LockTimeout {
+		if _, err := node.Locker.Admin(&locker.AdminRequest{
+			Action:      locker.SetLockTimeoutAction,
+			LockTimeout: newConf.Locker.LockTimeout,
+		}); err != nil {
+			node.log.Errorf(applyConfigErrorMsg, "locker", err)
+		}
+	}
+
+	// Channel buffer limits
+	if oldConf.Channels.Buffers != newConf.Channels.Buffers {
+		if _, err := node.Channels.Admin(&channels.AdminRequest{
+			Action:                channels.SetBufferLimitsAction,
+			MaxBufferedPerChannel: newConf.Channels.Buffers.MaxPerChannel,
+			MaxBufferedTotal:      newConf.Channels.Buffers.MaxTotal,
+			BufferExpiry:          newConf.Channels.Buffers.Expiry,
+		}); err != nil {
+			node.log.Errorf(applyConfigErrorMsg, "channels", err)
+		}
+	}
+
+	// Worker pools
+	node.resizeWorkerPools(oldConf, newConf)
+
+	// Pipeline (listening address needs restart)
+	node.Pipeline.ReloadConfig(newConf.GetPipelineSubsystemConfig())
+}
+
+/*
+	Resizes worker pools with changed worker counts (queued requests are handled by previous workers)
+*/
+func (node *Node) resizeWorkerPools(oldConf *cli.Config, newConf *cli.Config) {
+	resize := func(subsystem string, changed bool, resizer func() error) {
+		if !changed {
+			return
+		}
+		if err := resizer(); err != nil {
+			node.log.Errorf(applyConfigErrorMsg, subsystem, err)
+		}
+	}
+
+	lockerConfig := newConf.GetLockerSubsystemConfig()
+	resize("locker", oldConf.GetLockerSubsystemConfig().NumWorkers != lockerConfig.NumWorkers, func() error {
+		return node.Locker.ResizeServer(lockerConfig)
+	})
+
+	usersConfig := newConf.GetUsersSubsystemConfig()
+	resize("users", oldConf.GetUsersSubsystemConfig().NumWorkers != usersConfig.NumWorkers, func() error {
+		return node.Users.ResizeServer(usersConfig)
+	})
+
+	oldChannelsConfig, oldMessagesConfig, oldChannelListenersConfig := oldConf.GetChannelsSubsystemConfig()
+	channelsConfig, messagesConfig, channelListenersConfig := newConf.GetChannelsSubsystemConfig()
+	resize("channels", oldChannelsConfig.NumWorkers != channelsConfig.NumWorkers ||
+		oldMessagesConfig.NumWorkers != messagesConfig.NumWorkers ||
+		oldChannelListenersConfig.NumWorkers != channelListenersConfig.NumWorkers, func() error {
+		return node.Channels.ResizeServers(channelsConfig, messagesConfig, channelListenersConfig)
+	})
+
+	oldStatusUpdateConfig, oldStatusListenersConfig := oldConf.GetStatusSubsystemConfig()
+	statusUpdateConfig, statusListenersConfig := newConf.GetStatusSubsystemConfig()
+	resize("status", oldStatusUpdateConfig.NumWorkers != statusUpdateConfig.NumWorkers ||
+		oldStatusListenersConfig.NumWorkers != statusListenersConfig.NumWorkers, func() error {
+		return node.Status.ResizeServers(statusUpdateConfig, statusListenersConfig)
+	})
+
+	keysConfig := newConf.GetKeysSubsystemConfig()
+	resize("keys", oldConf.GetKeysSubsystemConfig().NumWorkers != keysConfig.NumWorkers, func() error {
+		return node.Keys.ResizeServer(keysConfig)
+	})
+
+	executorConfig := newConf.GetExecutorSubsystemConfig()
+	resize("executor", oldConf.GetExecutorSubsystemConfig().NumWorkers != executorConfig.NumWorkers, func() error {
+		return node.Executor.ResizeServer(executorConfig)
+	})
+
+	decryptorConfig := newConf.GetDecryptorSubsystemConfig()
+	resize("decryptor", oldConf.GetDecryptorSubsystemConfig().NumWorkers != decryptorConfig.NumWorkers, func() error {
+		return node.Decryptor.ResizeServer(decryptorConfig)
+	})
+}
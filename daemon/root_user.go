@@ -14,7 +14,7 @@ import (
 )
 
 /*
-   Error messages
+	Error messages
 */
 const (
 	encodeRootUserOperationError string = "Unable to encode root user operation"
@@ -24,17 +24,17 @@ const (
 )
 
 /*
-   Utilities
+	Utilities
 */
-func buildRootUserOperation(conf *cli.Config) *core.Transaction {
+func (node *Node) buildRootUserOperation(conf *cli.Config) *core.Transaction {
 	// Get root user object from confuration
-	log.Debugf("Parsing root user object from confuration")
+	node.log.Debugf("Parsing root user object from confuration")
 	rootUserObject := conf.GetRootUserObject()
 
 	// Build user request
 	encodedCreateRequest, err := users.GenerateCreateRequest(rootUserObject, time.Now()).Encode()
 	if err != nil {
-		log.Fatalf(encodeRootUserOperationError)
+		node.log.Fatalf(encodeRootUserOperationError)
 	}
 
 	// Build transaction
@@ -49,7 +49,7 @@ func buildRootUserOperation(conf *cli.Config) *core.Transaction {
 		core.UsersRequestType, encodedCreateRequest, false,
 	).Encode()
 	if err != nil {
-		log.Fatalf(encodeRootUserOperationError)
+		node.log.Fatalf(encodeRootUserOperationError)
 	}
 	return core.GenerateTransaction(
 		// Non encrypted
@@ -59,36 +59,36 @@ func buildRootUserOperation(conf *cli.Config) *core.Transaction {
 	)
 }
 
-func createRootUser(transaction *core.Transaction) {
+func (node *Node) createRootUser(transaction *core.Transaction) {
 	// Make unverified request
-	log.Debugf("Requesting to add root user")
-	rootUserChannel, errs := decryptor.MakeUnverifiedTransactionRequest(transaction)
+	node.log.Debugf("Requesting to add root user")
+	rootUserChannel, errs := node.Decryptor.MakeUnverifiedTransactionRequest(transaction)
 	if len(errs) != 0 {
-		log.Fatalf(createRootUserRequestError)
+		node.log.Fatalf(createRootUserRequestError)
 	}
 
 	// Wait for decryptor to return ticket
-	log.Debugf("Root user request made. Waiting for ticket")
+	node.log.Debugf("Root user request made. Waiting for ticket")
 	rootUserNativeResp := <-rootUserChannel
 	rootUserResp := (*rootUserNativeResp).(*decryptor.DecryptorResponse)
 	if rootUserResp.Result != decryptor.Success {
-		log.Fatalf(createRootUserRequestError)
+		node.log.Fatalf(createRootUserRequestError)
 	}
 
 	// Wait until ticket status is success
-	log.Debugf("Adding listener on user creation ticket")
-	updateChannel, err := status.AddListener(rootUserResp.Ticket)
+	node.log.Debugf("Adding listener on user creation ticket")
+	updateChannel, err := node.Status.AddListener(rootUserResp.Ticket)
 	if err != nil {
-		log.Fatalf(listenOnRootUserRequestError)
+		node.log.Fatalf(listenOnRootUserRequestError)
 	}
 
-	log.Debugf("Waiting for user creation to be executed")
+	node.log.Debugf("Waiting for user creation to be executed")
 	var statusUpdate *status.StatusRecord
 	for statusUpdate = range updateChannel {
 	}
 	if statusUpdate.Status != status.SuccessStatus {
-		log.Fatalf(createRootUserFailedError)
+		node.log.Fatalf(createRootUserFailedError)
 	}
 
-	log.Debugf("Root user successfully created")
+	node.log.Debugf("Root user successfully created")
 }
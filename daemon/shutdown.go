@@ -30,6 +30,7 @@ const (
 	FatalError
 	UserInterrupted
 	SystemTerminated
+	ReloadRequested
 )
 
 /*
@@ -37,7 +38,7 @@ const (
 */
 var signalMapping map[os.Signal]TerminationCause = map[os.Signal]TerminationCause{
 	os.Interrupt:    UserInterrupted,
-	syscall.SIGHUP:  SystemTerminated,
+	syscall.SIGHUP:  ReloadRequested,
 	syscall.SIGINT:  UserInterrupted,
 	syscall.SIGTERM: SystemTerminated,
 	syscall.SIGQUIT: SystemTerminated,
@@ -47,7 +48,7 @@ func mapSystemSignal(sig os.Signal) TerminationCause {
 	return signalMapping[sig]
 }
 func isTerminal(terminationCause TerminationCause) bool {
-	return terminationCause != NoTermination
+	return terminationCause != NoTermination && terminationCause != ReloadRequested
 }
 
 func listenForSystemTermination(terminationChannel chan TerminationCause) {
@@ -70,6 +71,9 @@ func listenForTermination(terminationChannel chan TerminationCause) {
 	// Keep waiting on causes until a terminal cause is sent
 	for {
 		terminationCause := <-terminationChannel
+		if terminationCause == ReloadRequested {
+			go defaultNode.Reload()
+		}
 		if isTerminal(terminationCause) {
 			log.Errorf(terminationCauseMessageMapping[terminationCause])
 			return
@@ -96,7 +100,7 @@ func shutdownWhenSignaled(terminationChannel chan TerminationCause) {
 	listenForTermination(terminationChannel)
 
 	// Soft shutdown all subsystems
-	shutdownDaemons()
+	defaultNode.Shutdown()
 
 	// Terminate program
 	os.Exit(1)
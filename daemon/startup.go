@@ -30,6 +30,20 @@ const (
 	initialLogLevel core.LogLevel = core.INFO
 )
 
+/*
+	Subsystem names (used for log fields and level overrides)
+*/
+const (
+	lockerSubsystemName    string = "locker"
+	usersSubsystemName     string = "users"
+	channelsSubsystemName  string = "channels"
+	statusSubsystemName    string = "status"
+	keysSubsystemName      string = "keys"
+	executorSubsystemName  string = "executor"
+	decryptorSubsystemName string = "decryptor"
+	pipelineSubsystemName  string = "pipeline"
+)
+
 // Checks if DMPC was set up
 func checkInstall() {
 	if !cli.IsFunctional() {
@@ -38,10 +52,12 @@ func checkInstall() {
 }
 
 // Main function for startup
-func doSetup() (conf *cli.Config) {
-	// Initialize logging
+func doSetup(shutdownLambda core.ShutdownLambda) (conf *cli.Config) {
+	// Initialize logging (fatal errors shut down gracefully)
 	log = core.InitializeLogging()
-	log.SetLogLevel(core.INFO)
+	log.SetLogLevel(initialLogLevel)
+	log.SetShutdownLambda(shutdownLambda)
+	defaultNode.log = log
 
 	// Check DMPC was configured
 	log.Debugf(checkingInstallLogMsg)
@@ -51,8 +67,14 @@ func doSetup() (conf *cli.Config) {
 	log.Debugf(parsingConfigurationLogMsg)
 	conf = cli.GetConfig()
 
-	// Set log level from configuration
-	log.SetLogLevel(conf.LogLevel)
+	// Set log levels and format from configuration
+	applyLoggingConfig(log, conf)
 
 	return
 }
+
+func applyLoggingConfig(logHandler *core.LoggingHandler, conf *cli.Config) {
+	logHandler.SetLogLevel(conf.LogLevel)
+	logHandler.SetSubsystemLogLevels(conf.Logging.Subsystems)
+	logHandler.SetLogFormat(conf.Logging.Format)
+}
@@ -1,6 +1,7 @@
 package decryptor
 
 import (
+	"context"
 	"crypto/rsa"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/executor"
@@ -13,14 +14,6 @@ import (
 */
 type Requester func(*core.Transaction) (chan *gofarm.Response, []error)
 
-/*
-	Logging
-*/
-var (
-	log             *core.LoggingHandler
-	shutdownProgram core.ShutdownLambda
-)
-
 /*
 	Server configuration
 */
@@ -34,17 +27,13 @@ type Config struct {
 */
 
 type decryptorRequest struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
 	isVerified  bool
 	transaction *core.Transaction
 	operation   *core.Operation
 }
 
-func provisionServerOnce() {
-	if serverHandler == nil {
-		serverHandler = gofarm.ProvisionServer()
-	}
-}
-
 func InitializeServer(
 	globalKey *rsa.PrivateKey,
 	usersSignKeyRequester core.UsersSignKeyRequester,
@@ -53,38 +42,95 @@ func InitializeServer(
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) {
-	provisionServerOnce()
-	serverSingleton.globalKey = globalKey
-	serverSingleton.usersSignKeyRequester = usersSignKeyRequester
-	serverSingleton.keyDecryptor = keyDecryptor
-	serverSingleton.executorRequester = executorRequester
-	log = loggingHandler
-	shutdownProgram = shutdownLambda
-	serverHandler.InitServer(&serverSingleton)
+	defaultServer.InitializeServer(globalKey, usersSignKeyRequester, keyDecryptor, executorRequester, loggingHandler, shutdownLambda)
 }
 
 func StartServer(conf Config) error {
-	provisionServerOnce()
-	return serverHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	return defaultServer.StartServer(conf)
 }
 
 func ShutdownServer() {
-	provisionServerOnce()
-	serverHandler.ShutdownServer()
+	defaultServer.ShutdownServer()
+}
+
+func ResizeServer(conf Config) error {
+	return defaultServer.ResizeServer(conf)
+}
+
+func IsRunning() bool {
+	return defaultServer.IsRunning()
+}
+
+func MakeUnverifiedEncodedTransactionRequest(encodedRequest []byte) (chan *gofarm.Response, []error) {
+	return defaultServer.MakeUnverifiedEncodedTransactionRequest(encodedRequest)
+}
+
+func MakeEncodedTransactionRequest(encodedRequest []byte) (chan *gofarm.Response, []error) {
+	return defaultServer.MakeEncodedTransactionRequest(encodedRequest)
+}
+
+func MakeUnverifiedTransactionRequest(transaction *core.Transaction) (chan *gofarm.Response, []error) {
+	return defaultServer.MakeUnverifiedTransactionRequest(transaction)
+}
+
+func MakeTransactionRequest(transaction *core.Transaction) (chan *gofarm.Response, []error) {
+	return defaultServer.MakeTransactionRequest(transaction)
+}
+
+func MakeOperationRequest(operation *core.Operation) (chan *gofarm.Response, []error) {
+	return defaultServer.MakeOperationRequest(operation)
+}
+
+/*
+	Instance API
+*/
+
+func (sv *Server) InitializeServer(
+	globalKey *rsa.PrivateKey,
+	usersSignKeyRequester core.UsersSignKeyRequester,
+	keyDecryptor core.Decryptor,
+	executorRequester executor.Requester,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) {
+	sv.globalKey = globalKey
+	sv.usersSignKeyRequester = usersSignKeyRequester
+	sv.keyDecryptor = keyDecryptor
+	sv.executorRequester = executorRequester
+	sv.log = loggingHandler
+	sv.shutdownProgram = shutdownLambda
+	sv.handler.InitServer(sv)
+}
+
+func (sv *Server) StartServer(conf Config) error {
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) ShutdownServer() {
+	sv.handler.ShutdownServer()
+}
+
+// Running requests are not dropped
+func (sv *Server) ResizeServer(conf Config) error {
+	return sv.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) IsRunning() bool {
+	return sv.state.IsRunning()
 }
 
 /*
 	Transaction requests
 */
-func MakeUnverifiedEncodedTransactionRequest(encodedRequest []byte) (chan *gofarm.Response, []error) {
-	return makeEncodedTransactionRequest(encodedRequest, true)
+func (sv *Server) MakeUnverifiedEncodedTransactionRequest(encodedRequest []byte) (chan *gofarm.Response, []error) {
+	return sv.makeEncodedTransactionRequest(encodedRequest, true)
 }
 
-func MakeEncodedTransactionRequest(encodedRequest []byte) (chan *gofarm.Response, []error) {
-	return makeEncodedTransactionRequest(encodedRequest, false)
+func (sv *Server) MakeEncodedTransactionRequest(encodedRequest []byte) (chan *gofarm.Response, []error) {
+	return sv.makeEncodedTransactionRequest(encodedRequest, false)
 }
 
-func makeEncodedTransactionRequest(encodedRequest []byte, skipPermissions bool) (chan *gofarm.Response, []error) {
+func (sv *Server) makeEncodedTransactionRequest(encodedRequest []byte, skipPermissions bool) (chan *gofarm.Response, []error) {
 	// Decode payload
 	transaction := &core.Transaction{}
 	err := transaction.Decode(encodedRequest)
@@ -92,26 +138,34 @@ func makeEncodedTransactionRequest(encodedRequest []byte, skipPermissions bool)
 		return nil, []error{err}
 	}
 
-	return makeTransactionRequest(transaction, skipPermissions)
+	return sv.makeTransactionRequest(transaction, skipPermissions)
 }
 
-func MakeUnverifiedTransactionRequest(transaction *core.Transaction) (chan *gofarm.Response, []error) {
-	return makeTransactionRequest(transaction, true)
+func (sv *Server) MakeUnverifiedTransactionRequest(transaction *core.Transaction) (chan *gofarm.Response, []error) {
+	return sv.makeTransactionRequest(transaction, true)
 }
 
-func MakeTransactionRequest(transaction *core.Transaction) (chan *gofarm.Response, []error) {
-	return makeTransactionRequest(transaction, false)
+func (sv *Server) MakeTransactionRequest(transaction *core.Transaction) (chan *gofarm.Response, []error) {
+	return sv.makeTransactionRequest(transaction, false)
 }
 
-func makeTransactionRequest(transaction *core.Transaction, skipPermissions bool) (chan *gofarm.Response, []error) {
-	log.Debugf(receivedRequestLogMsg)
-	nativeResponseChannel, err := serverHandler.MakeRequest(&decryptorRequest{
+func (sv *Server) makeTransactionRequest(transaction *core.Transaction, skipPermissions bool) (chan *gofarm.Response, []error) {
+	sv.log.Debugf(receivedRequestLogMsg)
+
+	// Deadline starts when the transaction is received
+	ctx, cancel := transaction.Pipeline.GetContext()
+
+	nativeResponseChannel, err := sv.handler.MakeRequest(&decryptorRequest{
+		ctx:         ctx,
+		cancel:      cancel,
 		isVerified:  !skipPermissions,
 		transaction: transaction,
 	})
 	if err != nil {
+		cancel()
 		return nil, []error{err}
 	}
+	sv.metrics.Queued()
 
 	return nativeResponseChannel, nil
 }
@@ -119,15 +173,20 @@ func makeTransactionRequest(transaction *core.Transaction, skipPermissions bool)
 /*
 	Operation requests
 */
-func MakeOperationRequest(operation *core.Operation) (chan *gofarm.Response, []error) {
-	log.Debugf(receivedRequestLogMsg)
-	nativeResponseChannel, err := serverHandler.MakeRequest(&decryptorRequest{
+func (sv *Server) MakeOperationRequest(operation *core.Operation) (chan *gofarm.Response, []error) {
+	sv.log.Debugf(receivedRequestLogMsg)
+	ctx, cancel := context.WithCancel(context.Background())
+	nativeResponseChannel, err := sv.handler.MakeRequest(&decryptorRequest{
+		ctx:        ctx,
+		cancel:     cancel,
 		isVerified: true,
 		operation:  operation,
 	})
 	if err != nil {
+		cancel()
 		return nil, []error{err}
 	}
+	sv.metrics.Queued()
 
 	return nativeResponseChannel, nil
 }
@@ -136,12 +195,12 @@ func MakeOperationRequest(operation *core.Operation) (chan *gofarm.Response, []e
 	Server implementation
 */
 
-var (
-	serverSingleton server
-	serverHandler   *gofarm.ServerHandler
-)
+/*
+	Decryptor instance (package functions use a default instance)
+*/
+type Server struct {
+	handler *core.ServerHandler
 
-type server struct {
 	// Asymmetric key
 	globalKey *rsa.PrivateKey
 
@@ -149,15 +208,41 @@ type server struct {
 	usersSignKeyRequester core.UsersSignKeyRequester
 	keyDecryptor          core.Decryptor
 	executorRequester     executor.Requester
+
+	// Logging and fatal error handling
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+
+	// Request metrics
+	metrics *core.SubsystemMetrics
+
+	// Set when started and cleared when shut down
+	state core.ServerState
+}
+
+func NewServer(metricsRegistry *core.MetricsRegistry) *Server {
+	return &Server{
+		handler: core.ProvisionServer(),
+		metrics: core.NewSubsystemMetrics(metricsRegistry, "decryptor"),
+	}
+}
+
+var defaultServer *Server = NewServer(core.Metrics)
+
+// Instance used by package functions
+func DefaultServer() *Server {
+	return defaultServer
 }
 
-func (sv *server) Start(_ gofarm.Config, _ bool) error {
-	log.Debugf(daemonStartLogMsg)
+func (sv *Server) Start(_ gofarm.Config, _ bool) error {
+	sv.state.SetRunning(true)
+	sv.log.Debugf(daemonStartLogMsg)
 	return nil
 }
 
-func (sv *server) Shutdown() error {
-	log.Debugf(daemonShutdownLogMsg)
+func (sv *Server) Shutdown() error {
+	sv.state.SetRunning(false)
+	sv.log.Debugf(daemonShutdownLogMsg)
 	return nil
 }
 
@@ -191,17 +276,30 @@ func verifyPayload(operation *core.Operation, payload []byte, usersSignKeyReques
 	return verification == nil
 }
 
-func (sv *server) Work(nativeRequest *gofarm.Request) *gofarm.Response {
-	log.Debugf(runningRequestLogMsg)
+func (sv *Server) Work(nativeRequest *gofarm.Request) *gofarm.Response {
+	sv.log.Debugf(runningRequestLogMsg)
 	decryptorWrapped := (*nativeRequest).(*decryptorRequest)
 
+	requestType := transactionRequestLabel
+	if decryptorWrapped.operation != nil {
+		requestType = operationRequestLabel
+	}
+	observation := sv.metrics.Start(requestType)
+	response := sv.doRequest(decryptorWrapped)
+	observation.DoneWithSuccess((*response).(*DecryptorResponse).Result == Success)
+
+	return response
+}
+
+func (sv *Server) doRequest(decryptorWrapped *decryptorRequest) *gofarm.Response {
 	var operation *core.Operation = decryptorWrapped.operation
 
 	// Decrypt transaction if any
 	if operation == nil {
 		var success bool
 		if operation, success = decryptTransaction(decryptorWrapped.transaction, sv.globalKey); !success {
-			return failRequest(TransactionDecryptionError)
+			decryptorWrapped.cancel()
+			return sv.failRequest(TransactionDecryptionError)
 		}
 	}
 
@@ -211,7 +309,8 @@ func (sv *server) Work(nativeRequest *gofarm.Request) *gofarm.Response {
 	// Determine if we should fail
 	droppable := operation.ShouldDrop()
 	if !decryptionSuccess && droppable {
-		return failRequest(PermanentDecryptionError)
+		decryptorWrapped.cancel()
+		return sv.failRequest(PermanentDecryptionError)
 	}
 
 	// Verify signatures if not skipping verification
@@ -222,7 +321,8 @@ func (sv *server) Work(nativeRequest *gofarm.Request) *gofarm.Response {
 
 		// Only drop request if it's droppable (otherwise skip verification)
 		if !verificationSuccess && droppable {
-			return failRequest(VerificationError)
+			decryptorWrapped.cancel()
+			return sv.failRequest(VerificationError)
 		}
 
 		// Build signers structure
@@ -242,8 +342,9 @@ func (sv *server) Work(nativeRequest *gofarm.Request) *gofarm.Response {
 		failedEncryptedOperation.Meta.Buffered = true
 	}
 
-	// Send raw bytes and metadata to executor
+	// Send raw bytes and metadata to executor (context is released when its deadline passes)
 	ticket, err := sv.executorRequester(
+		decryptorWrapped.ctx,
 		decryptorWrapped.isVerified,
 		&operation.Meta,
 		signers,
@@ -251,24 +352,26 @@ func (sv *server) Work(nativeRequest *gofarm.Request) *gofarm.Response {
 		failedEncryptedOperation,
 	)
 	if err != nil {
-		return failRequest(ExecutorError)
+		decryptorWrapped.cancel()
+		return sv.failRequest(ExecutorError)
 	}
 
-	return successRequest(ticket)
+	return sv.successRequest(ticket)
 }
 
-func failRequest(errorType int) *gofarm.Response {
-	log.Infof(failRequestLogMsg)
+func (sv *Server) failRequest(errorType int) *gofarm.Response {
+	sv.log.Infof(failRequestLogMsg)
 	decryptorRespPtr := &DecryptorResponse{
 		Result: errorType,
+		Error:  resultErrors[errorType],
 	}
 
 	var nativeResp gofarm.Response = decryptorRespPtr
 	return &nativeResp
 }
 
-func successRequest(ticket status.Ticket) *gofarm.Response {
-	log.Debugf(successRequestLogMsg)
+func (sv *Server) successRequest(ticket status.Ticket) *gofarm.Response {
+	sv.log.Debugf(successRequestLogMsg)
 	decryptorRespPtr := &DecryptorResponse{
 		Result: Success,
 		Ticket: ticket,
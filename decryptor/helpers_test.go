@@ -5,6 +5,7 @@
 package decryptor
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"errors"
@@ -27,7 +28,7 @@ func resetAndStartServer(
 	keyDecryptor core.Decryptor,
 	executorRequester executor.Requester,
 ) bool {
-	serverSingleton = server{}
+	defaultServer = NewServer(core.Metrics)
 	InitializeServer(globalKey, usersSignKeyRequester, keyDecryptor, executorRequester, log, shutdownProgram)
 	err := StartServer(conf)
 	if err != nil {
@@ -42,7 +43,7 @@ func makeTransactionRequestAndGetResult(
 	requestBytes []byte,
 	isVerified bool,
 ) (*DecryptorResponse, bool) {
-	channel, errs := makeEncodedTransactionRequest(requestBytes, !isVerified)
+	channel, errs := defaultServer.makeEncodedTransactionRequest(requestBytes, !isVerified)
 	if len(errs) != 0 {
 		t.Errorf("Decryptor should pass along request.")
 		return nil, false
@@ -166,7 +167,7 @@ func createDummyExecutorRequesterFunctor() (*dummyExecutorRegistry, executor.Req
 		data: map[status.Ticket]dummyExecutorEntry{},
 		lock: &sync.Mutex{},
 	}
-	requester := func(isVerified bool, meta *core.OperationMetaFields, signers *core.VerifiedSigners, payload []byte, failedOperation *core.Operation) (status.Ticket, error) {
+	requester := func(_ context.Context, isVerified bool, meta *core.OperationMetaFields, signers *core.VerifiedSigners, payload []byte, failedOperation *core.Operation) (status.Ticket, error) {
 		reg.lock.Lock()
 		ticketCopy := status.RequestNewTicket()
 		reg.data[ticketCopy] = dummyExecutorEntry{
@@ -0,0 +1,9 @@
+package decryptor
+
+/*
+	Request type labels of request metrics
+*/
+const (
+	transactionRequestLabel string = "transaction"
+	operationRequestLabel   string = "operation"
+)
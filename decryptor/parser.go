@@ -1,6 +1,7 @@
 package decryptor
 
 import (
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/status"
 )
 
@@ -17,6 +18,17 @@ const (
 
 type DecryptorResponse struct {
 	// @TODO: Result should be typed
-	Result int           `json:"result"`
-	Ticket status.Ticket `json:"ticket"`
+	Result int              `json:"result"`
+	Ticket status.Ticket    `json:"ticket"`
+	Error  *core.CodedError `json:"error,omitempty"`
+}
+
+/*
+	Errors corresponding to failed response results
+*/
+var resultErrors map[int]*core.CodedError = map[int]*core.CodedError{
+	TransactionDecryptionError: core.NewError(core.DecryptionFailedErrorCode, "Transaction decryption failed."),
+	PermanentDecryptionError:   core.NewError(core.DecryptionFailedErrorCode, "Operation decryption failed permanently."),
+	VerificationError:          core.NewError(core.VerificationFailedErrorCode, "Operation signature verification failed."),
+	ExecutorError:              core.NewError(core.RequestRejectedErrorCode, "Executor rejected the operation."),
 }
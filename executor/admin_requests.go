@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/locker"
+	"github.com/mngharbi/DMPC/status"
+)
+
+/*
+	Errors
+*/
+
+var (
+	lockerAdminFormatError       error = core.NewError(core.InvalidFormatErrorCode, "Locker admin request format invalid.")
+	lockerAdminUnverifiedError   error = core.NewError(core.UnverifiedRequestErrorCode, "Locker admin request must be signed.")
+	lockerAdminUnauthorizedError error = core.NewError(core.CertifierPermissionsErrorCode, "Locker admin request is not authorized.")
+
+	channelsAdminFormatError       error = core.NewError(core.InvalidFormatErrorCode, "Channels admin request format invalid.")
+	channelsAdminUnverifiedError   error = core.NewError(core.UnverifiedRequestErrorCode, "Channels admin request must be signed.")
+	channelsAdminUnauthorizedError error = core.NewError(core.CertifierPermissionsErrorCode, "Channels admin request is not authorized.")
+)
+
+/*
+	Locker administration (lock timeout and wait-for graph)
+	Verified requests need a certifier allowed to update permissions (checked by the handler)
+*/
+
+func (sv *Server) doLockerAdmin(wrappedRequest *executorRequest) {
+	// Parse request
+	request := &locker.AdminRequest{}
+	if err := request.Decode(wrappedRequest.request); err != nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{lockerAdminFormatError})
+		return
+	}
+
+	// Run admin action
+	response, err := sv.lockerAdminRequester(request)
+	if err != nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{err})
+		return
+	}
+
+	responseEncoded, _ := response.Encode()
+	sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, responseEncoded, nil)
+}
+
+/*
+	Channels administration (operation buffers)
+	Verified requests need a certifier allowed to update permissions (checked by the handler)
+*/
+
+func (sv *Server) doChannelsAdmin(wrappedRequest *executorRequest) {
+	// Parse request
+	request := &channels.AdminRequest{}
+	if err := request.Decode(wrappedRequest.request); err != nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{channelsAdminFormatError})
+		return
+	}
+
+	// Run admin action
+	response, err := sv.channelsAdminRequester(request)
+	if err != nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{err})
+		return
+	}
+
+	responseEncoded, _ := response.Encode()
+	sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, responseEncoded, nil)
+}
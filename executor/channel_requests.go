@@ -1,12 +1,9 @@
 package executor
 
 import (
-	"errors"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
-	"github.com/mngharbi/DMPC/locker"
 	"github.com/mngharbi/DMPC/status"
-	"github.com/mngharbi/DMPC/users"
 )
 
 /*
@@ -14,38 +11,47 @@ import (
 */
 
 var (
-	unverifiedChannelOpenError             error = errors.New("Channel open request cannot be unverified.")
-	channelOpenUnauthorizedError           error = errors.New("Channel open request is not authorized.")
-	channelOpenNilChannelError             error = errors.New("Channel open request must have channel object.")
-	unverifiedChannelSubscribeError        error = errors.New("Channel subscribe request cannot be unverified.")
-	channelReadUnauthorizedError           error = errors.New("Channel read request is not authorized.")
-	channelEncryptUnauthorizedError        error = errors.New("Channel encrypt request is not authorized.")
-	channelEncryptOperationFormatError     error = errors.New("Channel encrypt requires a valid operation as payload.")
-	transactionEncryptUnauthorizedError    error = errors.New("Transaction encryption request is not authorized.")
-	transactionEncryptOperationFormatError error = errors.New("Transaction encryption requires a valid transaction as payload.")
+	unverifiedChannelOpenError             error = core.NewError(core.UnverifiedRequestErrorCode, "Channel open request cannot be unverified.")
+	channelOpenUnauthorizedError           error = core.NewError(core.ChannelAddPermissionErrorCode, "Channel open request is not authorized.")
+	channelOpenNilChannelError             error = core.NewError(core.InvalidRequestErrorCode, "Channel open request must have channel object.")
+	unverifiedChannelSubscribeError        error = core.NewError(core.UnverifiedRequestErrorCode, "Channel subscribe request cannot be unverified.")
+	channelReadUnauthorizedError           error = core.NewError(core.ChannelReadPermissionErrorCode, "Channel read request is not authorized.")
+	unverifiedChannelListError             error = core.NewError(core.UnverifiedRequestErrorCode, "Channel list request cannot be unverified.")
+	channelEncryptUnauthorizedError        error = core.NewError(core.ChannelWritePermissionErrorCode, "Channel encrypt request is not authorized.")
+	channelNotOpenError                    error = core.NewError(core.ChannelNotOpenErrorCode, "Channel is not open.")
+	channelEncryptOperationFormatError     error = core.NewError(core.InvalidFormatErrorCode, "Channel encrypt requires a valid operation as payload.")
+	transactionEncryptUnauthorizedError    error = core.NewError(core.CertifierPermissionsErrorCode, "Transaction encryption request is not authorized.")
+	transactionEncryptOperationFormatError error = core.NewError(core.InvalidFormatErrorCode, "Transaction encryption requires a valid transaction as payload.")
 )
 
 /*
 	Helpers
 */
 
-func (sv *server) makeChannelActionAndWait(wrappedRequest *executorRequest, request interface{}) *channels.ChannelsResponse {
-	channelResponseChannel, err := sv.channelActionRequester(request)
+func (sv *Server) makeChannelActionAndWait(wrappedRequest *executorRequest, request interface{}) *channels.ChannelsResponse {
+	channelResponseChannel, err := sv.channelActionRequester(wrappedRequest.ctx, request)
 	if err != nil {
 		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{err})
 		return nil
 	}
-	channelResponsePtr, ok := <-channelResponseChannel
-	if !ok ||
-		channelResponsePtr.Result != channels.ChannelsSuccess {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+	select {
+	case channelResponsePtr, ok := <-channelResponseChannel:
+		if !ok {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+			return nil
+		} else if channelResponsePtr.Result != channels.ChannelsSuccess {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{channelResponsePtr.GetError()})
+			return nil
+		} else {
+			return channelResponsePtr
+		}
+	case <-wrappedRequest.ctx.Done():
+		sv.reportContextDone(wrappedRequest)
 		return nil
-	} else {
-		return channelResponsePtr
 	}
 }
 
-func (sv *server) channelActionPassthrough(wrappedRequest *executorRequest, request interface{}) {
+func (sv *Server) channelActionPassthrough(wrappedRequest *executorRequest, request interface{}) {
 	channelResponsePtr := sv.makeChannelActionAndWait(wrappedRequest, request)
 	if channelResponsePtr != nil {
 		channelResponseEncoded, _ := channelResponsePtr.Encode()
@@ -53,57 +59,11 @@ func (sv *server) channelActionPassthrough(wrappedRequest *executorRequest, requ
 	}
 }
 
-func generateLockChannelRequest(channelId string, lockingType core.LockingType, lockType core.LockType) *locker.LockerRequest {
-	return &locker.LockerRequest{
-		Type:        locker.ChannelLock,
-		LockingType: lockingType,
-		Needs: []core.LockNeed{
-			{
-				LockType: lockType,
-				Id:       channelId,
-			},
-		},
-	}
-}
-
-func (sv *server) makeLockChannelRequest(wrappedRequest *executorRequest, channelId string, lockingType core.LockingType, lockType core.LockType) bool {
-	// Make lock request
-	lockRequest := generateLockChannelRequest(channelId, lockingType, lockType)
-	lockChannel, errs := sv.lockerRequester(lockRequest)
-	if len(errs) != 0 {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, errs)
-		return false
-	}
-
-	// Wait for lock
-	if lockResult := <-lockChannel; !lockResult {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
-		return false
-	}
-	return true
-}
-
-func (sv *server) lockChannel(wrappedRequest *executorRequest, channelId string) bool {
-	return sv.makeLockChannelRequest(wrappedRequest, channelId, core.Locking, core.WriteLockType)
-}
-
-func (sv *server) unlockChannel(wrappedRequest *executorRequest, channelId string) bool {
-	return sv.makeLockChannelRequest(wrappedRequest, channelId, core.Unlocking, core.WriteLockType)
-}
-
-func (sv *server) rlockChannel(wrappedRequest *executorRequest, channelId string) bool {
-	return sv.makeLockChannelRequest(wrappedRequest, channelId, core.Locking, core.ReadLockType)
-}
-
-func (sv *server) runlockChannel(wrappedRequest *executorRequest, channelId string) bool {
-	return sv.makeLockChannelRequest(wrappedRequest, channelId, core.Unlocking, core.ReadLockType)
-}
-
 /*
 	Read channel
 */
 
-func (sv *server) doReadChannel(wrappedRequest *executorRequest) {
+func (sv *Server) doReadChannel(wrappedRequest *executorRequest) {
 	// Parse request
 	request := &channels.ReadChannelRequest{}
 	err := request.Decode(wrappedRequest.request)
@@ -112,52 +72,28 @@ func (sv *server) doReadChannel(wrappedRequest *executorRequest) {
 		return
 	}
 
-	// Read lock/Unlock channel
-	channelId := wrappedRequest.metaFields.ChannelId
-	if !sv.rlockChannel(wrappedRequest, channelId) {
-		return
-	}
-	defer func() {
-		if !sv.runlockChannel(wrappedRequest, channelId) {
-			return
-		}
-	}()
+	// Set channel id
+	request.Id = wrappedRequest.metaFields.ChannelId
 
-	// Read Lock/Unlock certifier user object
-	usersRequest := &users.UserRequest{
-		Type:      users.ReadRequest,
-		Timestamp: wrappedRequest.metaFields.Timestamp,
-		Fields:    []string{wrappedRequest.signers.CertifierId},
-	}
-	encodedUsersRequest, _ := usersRequest.Encode()
-	usersSubsystemResponse, errs := sv.usersRequesterUnverified(nil, true, false, encodedUsersRequest)
-	if len(errs) != 0 {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
-		return
-	}
-	userResponsePtr, ok := <-usersSubsystemResponse
-	if !ok {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
-		return
-	}
-	if userResponsePtr.Result != users.Success {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
-		return
-	}
-	defer func() {
-		usersSubsystemResponse, _ = sv.usersRequesterUnverified(nil, false, true, encodedUsersRequest)
-		_ = <-usersSubsystemResponse
-	}()
-
-	// Check read channels permission
-	certifierCheckSuccess := len(userResponsePtr.Data) == 1 && userResponsePtr.Data[0].Permissions.Channel.Read
-	if !certifierCheckSuccess {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{channelReadUnauthorizedError})
+	// Pass request through to channels subsystem
+	sv.channelActionPassthrough(wrappedRequest, request)
+}
+
+/*
+	List channels
+*/
+
+func (sv *Server) doListChannels(wrappedRequest *executorRequest) {
+	// Parse request
+	request := &channels.ListChannelsRequest{}
+	err := request.Decode(wrappedRequest.request)
+	if err != nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{err})
 		return
 	}
 
-	// Set channel id
-	request.Id = channelId
+	// Set signers from decryptor (channels are listed for certifier)
+	request.Signers = wrappedRequest.signers
 
 	// Pass request through to channels subsystem
 	sv.channelActionPassthrough(wrappedRequest, request)
@@ -167,7 +103,7 @@ func (sv *server) doReadChannel(wrappedRequest *executorRequest) {
 	Add channel
 */
 
-func (sv *server) doAddChannel(wrappedRequest *executorRequest) {
+func (sv *Server) doAddChannel(wrappedRequest *executorRequest) {
 	// Parse request
 	request := &channels.OpenChannelRequest{}
 	err := request.Decode(wrappedRequest.request)
@@ -183,63 +119,13 @@ func (sv *server) doAddChannel(wrappedRequest *executorRequest) {
 	}
 
 	// Set channel id from operation meta fields
-	channelId := wrappedRequest.metaFields.ChannelId
-	request.Channel.Id = channelId
+	request.Channel.Id = wrappedRequest.metaFields.ChannelId
 
 	// Set signers from decryptor
-	if wrappedRequest.signers == nil {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{unverifiedChannelOpenError})
-		return
-	}
 	request.Signers = wrappedRequest.signers
 
-	// Lock/Unlock channel
-	if !sv.lockChannel(wrappedRequest, channelId) {
-		return
-	}
-	defer func() {
-		if !sv.unlockChannel(wrappedRequest, channelId) {
-			return
-		}
-	}()
-
-	// Read Lock/Unlock certifier user object
-	usersRequest := &users.UserRequest{
-		Type:      users.ReadRequest,
-		Timestamp: wrappedRequest.metaFields.Timestamp,
-		Fields:    []string{wrappedRequest.signers.CertifierId},
-	}
-	encodedUsersRequest, _ := usersRequest.Encode()
-	usersSubsystemResponse, errs := sv.usersRequesterUnverified(nil, true, false, encodedUsersRequest)
-	if len(errs) != 0 {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
-		return
-	}
-	userResponsePtr, ok := <-usersSubsystemResponse
-	if !ok {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
-		return
-	}
-	if userResponsePtr.Result != users.Success {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
-		return
-	}
-	defer func() {
-		usersSubsystemResponse, _ = sv.usersRequesterUnverified(nil, false, true, encodedUsersRequest)
-		<-usersSubsystemResponse
-	}()
-
-	certifierCheckSuccess := len(userResponsePtr.Data) == 1 && userResponsePtr.Data[0].Permissions.Channel.Add
-	if !certifierCheckSuccess {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{channelOpenUnauthorizedError})
-		return
-	}
-
-	// Add key to keys subsystems
-	if keyAddError := sv.keyAdder(request.Channel.KeyId, request.Key); keyAddError != nil {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{keyAddError})
-		return
-	}
+	// Key is added by channels subsystem if opening is kept
+	request.KeyAdder = sv.keyAdder
 
 	// Send request through to channels subsystem
 	sv.channelActionPassthrough(wrappedRequest, request)
@@ -249,7 +135,7 @@ func (sv *server) doAddChannel(wrappedRequest *executorRequest) {
 	Close channel
 */
 
-func (sv *server) doCloseChannel(wrappedRequest *executorRequest) {
+func (sv *Server) doCloseChannel(wrappedRequest *executorRequest) {
 	// Parse request
 	request := &channels.CloseChannelRequest{}
 	err := request.Decode(wrappedRequest.request)
@@ -258,26 +144,13 @@ func (sv *server) doCloseChannel(wrappedRequest *executorRequest) {
 		return
 	}
 
-	// Set channel id from operation meta fields
+	// Set channel id and causal metadata from operation meta fields
 	request.Id = wrappedRequest.metaFields.ChannelId
+	request.VectorClock = wrappedRequest.metaFields.VectorClock
 
 	// Set signers from decryptor
-	if wrappedRequest.signers == nil {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{unverifiedChannelOpenError})
-		return
-	}
 	request.Signers = wrappedRequest.signers
 
-	// Lock/Unlock channel
-	if !sv.lockChannel(wrappedRequest, request.Id) {
-		return
-	}
-	defer func() {
-		if !sv.unlockChannel(wrappedRequest, request.Id) {
-			return
-		}
-	}()
-
 	// Send request through to channels subsystem
 	sv.channelActionPassthrough(wrappedRequest, request)
 }
@@ -286,30 +159,20 @@ func (sv *server) doCloseChannel(wrappedRequest *executorRequest) {
 	Add message
 */
 
-func (sv *server) doAddMessage(wrappedRequest *executorRequest) {
-	// Lock/Unlock channel
-	channelId := wrappedRequest.metaFields.ChannelId
-	if !sv.lockChannel(wrappedRequest, channelId) {
-		return
-	}
-	defer func() {
-		if !sv.unlockChannel(wrappedRequest, channelId) {
-			return
-		}
-	}()
-
+func (sv *Server) doAddMessage(wrappedRequest *executorRequest) {
 	// Send request to channels subsystem based on type (operation buffering/ add message)
 	var messageChannel chan *channels.MessagesResponse
 	var requestErr error
 	if wrappedRequest.failedOperation == nil {
-		messageChannel, requestErr = sv.messageAdder(&channels.AddMessageRequest{
-			ChannelId: wrappedRequest.metaFields.ChannelId,
-			Timestamp: wrappedRequest.metaFields.Timestamp,
-			Signers:   wrappedRequest.signers,
-			Message:   wrappedRequest.request,
+		messageChannel, requestErr = sv.messageAdder(wrappedRequest.ctx, &channels.AddMessageRequest{
+			ChannelId:   wrappedRequest.metaFields.ChannelId,
+			Timestamp:   wrappedRequest.metaFields.Timestamp,
+			Signers:     wrappedRequest.signers,
+			Message:     wrappedRequest.request,
+			VectorClock: wrappedRequest.metaFields.VectorClock,
 		})
 	} else {
-		messageChannel, requestErr = sv.operationBufferer(&channels.BufferOperationRequest{
+		messageChannel, requestErr = sv.operationBufferer(wrappedRequest.ctx, &channels.BufferOperationRequest{
 			Operation: wrappedRequest.failedOperation,
 		})
 	}
@@ -321,15 +184,22 @@ func (sv *server) doAddMessage(wrappedRequest *executorRequest) {
 	}
 
 	// Wait for response and handle premature channel closure
-	messageResponse, ok := <-messageChannel
-	if !ok {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+	var messageResponse *channels.MessagesResponse
+	var ok bool
+	select {
+	case messageResponse, ok = <-messageChannel:
+		if !ok {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+			return
+		}
+	case <-wrappedRequest.ctx.Done():
+		sv.reportContextDone(wrappedRequest)
 		return
 	}
 
 	// Handle response
 	if messageResponse.Result != channels.MessagesSuccess {
-		sv.responseReporter(wrappedRequest.ticket, status.FailedStatus, status.FailedReason, messageResponse, nil)
+		sv.responseReporter(wrappedRequest.ticket, status.FailedStatus, status.FailedReason, messageResponse, []error{messageResponse.GetError()})
 	} else {
 		sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, messageResponse, nil)
 	}
@@ -339,41 +209,30 @@ func (sv *server) doAddMessage(wrappedRequest *executorRequest) {
 	Subscribe to channel
 */
 
-func (sv *server) doSubscribeChannel(wrappedRequest *executorRequest) {
+func (sv *Server) doSubscribeChannel(wrappedRequest *executorRequest) {
 	request := &channels.SubscribeRequest{}
 
 	// Set channel id from operation meta fields
-	channelId := wrappedRequest.metaFields.ChannelId
-	request.ChannelId = channelId
+	request.ChannelId = wrappedRequest.metaFields.ChannelId
 
 	// Set signers from decryptor
-	if wrappedRequest.signers == nil {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{unverifiedChannelSubscribeError})
-		return
-	}
 	request.Signers = wrappedRequest.signers
 
-	// Read Lock/Unlock channel
-	if !sv.rlockChannel(wrappedRequest, channelId) {
-		return
-	}
-	defer func() {
-		if !sv.runlockChannel(wrappedRequest, channelId) {
-			return
-		}
-	}()
-
 	// Make request to channels subsystem
-	listenersResponseChannel, err := sv.channelListenersRequester(request)
+	listenersResponseChannel, err := sv.channelListenersRequester(wrappedRequest.ctx, request)
 	if err != nil {
 		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
 		return
 	}
-	listenersResponsePtr, ok := <-listenersResponseChannel
-	if !ok {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
-	} else {
-		sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, listenersResponsePtr, nil)
+	select {
+	case listenersResponsePtr, ok := <-listenersResponseChannel:
+		if !ok {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+		} else {
+			sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, listenersResponsePtr, nil)
+		}
+	case <-wrappedRequest.ctx.Done():
+		sv.reportContextDone(wrappedRequest)
 	}
 }
 
@@ -381,7 +240,7 @@ func (sv *server) doSubscribeChannel(wrappedRequest *executorRequest) {
 	Encrypt operation based on channel key
 */
 
-func (sv *server) doChannelEncrypt(wrappedRequest *executorRequest) {
+func (sv *Server) doChannelEncrypt(wrappedRequest *executorRequest) {
 	// Interpret payload as operation json string
 	op := &core.Operation{}
 	err := op.Decode([]byte(wrappedRequest.request))
@@ -397,30 +256,25 @@ func (sv *server) doChannelEncrypt(wrappedRequest *executorRequest) {
 		return
 	}
 
-	// Read Lock/Unlock channel
-	channelId := wrappedRequest.metaFields.ChannelId
-	if !sv.rlockChannel(wrappedRequest, channelId) {
-		return
-	}
-	defer func() {
-		if !sv.runlockChannel(wrappedRequest, channelId) {
-			return
-		}
-	}()
-
 	// Read channel
 	request := &channels.ReadChannelRequest{
-		Id: channelId,
+		Id: wrappedRequest.metaFields.ChannelId,
 	}
 	channelResponse := sv.makeChannelActionAndWait(wrappedRequest, request)
 	if channelResponse == nil {
 		return
 	}
 
-	// Check that channel was opened and certifier has write permissions
+	// Check that channel was opened
 	channelOpened := channelResponse.Channel.State == channels.ChannelObjectOpenState || channelResponse.Channel.State == channels.ChannelObjectClosedState
+	if !channelOpened {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{channelNotOpenError})
+		return
+	}
+
+	// Check that certifier has write permissions
 	certifierChannelPermisisons, isMemberOfChannel := channelResponse.Channel.Permissions.Users[wrappedRequest.signers.CertifierId]
-	authorized := channelOpened && isMemberOfChannel && certifierChannelPermisisons.Write
+	authorized := isMemberOfChannel && certifierChannelPermisisons.Write
 	if !authorized {
 		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{channelEncryptUnauthorizedError})
 		return
@@ -1,7 +1,6 @@
 package executor
 
 import (
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/status"
 	"github.com/mngharbi/gofarm"
@@ -12,56 +11,85 @@ import (
 */
 
 var (
-	invalidRequestTypeError error = errors.New("Invalid request type.")
-	subsystemChannelClosed  error = errors.New("Corresponding subsystem shutdown during the request.")
-	requestRejectedError    error = errors.New("Corresponding subsystem rejected the request.")
+	invalidRequestTypeError error = core.NewError(core.InvalidRequestTypeErrorCode, "Invalid request type.")
+	subsystemChannelClosed  error = core.NewError(core.SubsystemShutdownErrorCode, "Corresponding subsystem shutdown during the request.")
+	requestRejectedError    error = core.NewError(core.RequestRejectedErrorCode, "Corresponding subsystem rejected the request.")
 )
 
 /*
 	Server implementation
 */
 
-func (sv *server) Start(_ gofarm.Config, _ bool) error {
-	log.Debugf(daemonStartLogMsg)
+// Logging handler with request fields
+func (sv *Server) requestLogger(wrappedRequest *executorRequest) *core.LoggingHandler {
+	requestLog := sv.log.With(
+		core.TicketLogField, wrappedRequest.ticket,
+		core.RequestTypeLogField, wrappedRequest.metaFields.RequestType,
+	)
+	if wrappedRequest.metaFields.ChannelId != "" {
+		requestLog = requestLog.With(core.ChannelLogField, wrappedRequest.metaFields.ChannelId)
+	}
+	return requestLog
+}
+
+func (sv *Server) Start(_ gofarm.Config, _ bool) error {
+	sv.state.SetRunning(true)
+	sv.log.Debugf(daemonStartLogMsg)
 	return nil
 }
 
-func (sv *server) Shutdown() error {
-	log.Debugf(daemonShutdownLogMsg)
+func (sv *Server) Shutdown() error {
+	sv.state.SetRunning(false)
+	sv.log.Debugf(daemonShutdownLogMsg)
 	return nil
 }
 
-func (sv *server) Work(nativeRequest *gofarm.Request) (dummyResponsePtr *gofarm.Response) {
-	log.Debugf(runningRequestLogMsg)
+func (sv *Server) Work(nativeRequest *gofarm.Request) (dummyResponsePtr *gofarm.Response) {
 	dummyResponsePtr = nil
 
 	wrappedRequest := (*nativeRequest).(*executorRequest)
+	sv.requestLogger(wrappedRequest).Debugf(runningRequestLogMsg)
+	defer sv.removePendingRequest(wrappedRequest.ticket)
+
+	// Observe request until the last status is reported
+	observation := sv.metrics.Start(wrappedRequest.metaFields.RequestType.String())
+	if pending := sv.getPendingRequest(wrappedRequest.ticket); pending != nil {
+		defer func() { observation.Done(string(pending.getLastStatus())) }()
+	} else {
+		defer observation.Done(string(status.NoStatus))
+	}
+
+	// Stop if request was cancelled or timed out while queued
+	if core.ContextError(wrappedRequest.ctx) != nil {
+		sv.reportContextDone(wrappedRequest)
+		return
+	}
 
 	// Report running status
 	sv.responseReporter(wrappedRequest.ticket, status.RunningStatus, status.NoReason, nil, nil)
 
-	switch wrappedRequest.metaFields.RequestType {
-	case core.UsersRequestType:
-		sv.doGenericUsersRequest(wrappedRequest)
-	case core.TransactionEncryptType:
-		sv.doTransactionEncrypt(wrappedRequest)
-	case core.ReadChannelType:
-		sv.doReadChannel(wrappedRequest)
-	case core.AddChannelType:
-		sv.doAddChannel(wrappedRequest)
-	case core.CloseChannelType:
-		sv.doCloseChannel(wrappedRequest)
-	case core.AddMessageType:
-		sv.doAddMessage(wrappedRequest)
-	case core.SubscribeChannelType:
-		sv.doSubscribeChannel(wrappedRequest)
-	case core.ChannelEncryptType:
-		sv.doChannelEncrypt(wrappedRequest)
+	// Run handler of request type
+	handler := sv.registry.get(wrappedRequest.metaFields.RequestType)
+	if handler == nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{invalidRequestTypeError})
+		return
 	}
+	sv.runHandler(handler, wrappedRequest)
 
 	return
 }
 
-func (sv *server) reportRejection(ticketId status.Ticket, reason status.FailReasonCode, errs []error) {
+func (sv *Server) reportRejection(ticketId status.Ticket, reason status.FailReasonCode, errs []error) {
 	sv.responseReporter(ticketId, status.FailedStatus, reason, nil, errs)
 }
+
+func (sv *Server) reportContextDone(wrappedRequest *executorRequest) {
+	err := core.ContextError(wrappedRequest.ctx)
+	if err == core.RequestCancelledError {
+		sv.requestLogger(wrappedRequest).Debugf(cancelledRequestLogMsg)
+		sv.responseReporter(wrappedRequest.ticket, status.CancelledStatus, status.NoReason, nil, []error{err})
+	} else {
+		sv.requestLogger(wrappedRequest).Debugf(deadlineExceededLogMsg)
+		sv.reportRejection(wrappedRequest.ticket, status.FailedReason, []error{err})
+	}
+}
@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"context"
+	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/locker"
+	"github.com/mngharbi/DMPC/status"
+	"github.com/mngharbi/DMPC/users"
+	"testing"
+)
+
+/*
+	Locker admin request
+*/
+
+func TestLockerAdminRequest(t *testing.T) {
+	_, _, _, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	adminUsers := []users.UserObject{
+		{
+			Permissions: users.PermissionsObject{
+				User: users.UserPermissionsObject{
+					PermissionsUpdate: true,
+				},
+			},
+		},
+	}
+	usersRequesterAdmin, _ := createDummyUsersRequesterFunctor(users.Success, adminUsers, nil, false)
+	usersRequesterNonAdmin, _ := createDummyUsersRequesterFunctor(users.Success, userObjectsWithPermissions, nil, false)
+
+	graphRequest := &locker.AdminRequest{Action: locker.WaitForGraphAction}
+	graphRequestEncoded, _ := graphRequest.Encode()
+	invalidRequest := &locker.AdminRequest{Action: locker.SetLockTimeoutAction}
+	invalidRequestEncoded, _ := invalidRequest.Encode()
+	meta := &core.OperationMetaFields{
+		RequestType: core.LockerAdminType,
+		Timestamp:   nowTime,
+	}
+
+	// Certifier allowed to update permissions
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequesterAdmin, usersRequesterAdmin, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	graphTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), graphRequestEncoded, nil)
+	failingTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), invalidRequestEncoded, nil)
+	unsignedTicket, _ := MakeRequest(context.Background(), true, meta, nil, graphRequestEncoded, nil)
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[graphTicket]; len(logs) != 3 ||
+		logs[2].status != status.SuccessStatus {
+		t.Errorf("Locker admin request from authorized certifier should succeed. logs=%+v", logs)
+	} else {
+		response := &locker.AdminResponse{}
+		if err := response.Decode(logs[2].result.([]byte)); err != nil || response.Graph == nil {
+			t.Errorf("Locker admin response should include wait-for graph. response=%+v", response)
+		}
+	}
+	if logs := reg.ticketLogs[failingTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus {
+		t.Errorf("Locker admin request failing in locker should fail. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[unsignedTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != lockerAdminUnverifiedError {
+		t.Errorf("Locker admin request without signers should be rejected. logs=%+v", logs)
+	}
+
+	// Certifier not allowed to update permissions
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequesterNonAdmin, usersRequesterNonAdmin, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	unauthorizedTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), graphRequestEncoded, nil)
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[unauthorizedTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != lockerAdminUnauthorizedError {
+		t.Errorf("Locker admin request from unauthorized certifier should be rejected. logs=%+v", logs)
+	}
+}
+
+/*
+	Channels admin request
+*/
+
+func TestChannelsAdminRequest(t *testing.T) {
+	_, _, _, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	adminUsers := []users.UserObject{
+		{
+			Permissions: users.PermissionsObject{
+				User: users.UserPermissionsObject{
+					PermissionsUpdate: true,
+				},
+			},
+		},
+	}
+	usersRequesterAdmin, _ := createDummyUsersRequesterFunctor(users.Success, adminUsers, nil, false)
+	usersRequesterNonAdmin, _ := createDummyUsersRequesterFunctor(users.Success, userObjectsWithPermissions, nil, false)
+
+	statsRequest := &channels.AdminRequest{Action: channels.BufferStatsAction}
+	statsRequestEncoded, _ := statsRequest.Encode()
+	failingRequest := &channels.AdminRequest{Action: channels.ExpireBuffersAction}
+	failingRequestEncoded, _ := failingRequest.Encode()
+	meta := &core.OperationMetaFields{
+		RequestType: core.ChannelsAdminType,
+		Timestamp:   nowTime,
+	}
+
+	// Certifier allowed to update permissions
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequesterAdmin, usersRequesterAdmin, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	statsTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), statsRequestEncoded, nil)
+	failingTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), failingRequestEncoded, nil)
+	malformedTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), []byte("{"), nil)
+	unsignedTicket, _ := MakeRequest(context.Background(), true, meta, nil, statsRequestEncoded, nil)
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[statsTicket]; len(logs) != 3 ||
+		logs[2].status != status.SuccessStatus {
+		t.Errorf("Channels admin request from authorized certifier should succeed. logs=%+v", logs)
+	} else {
+		response := &channels.AdminResponse{}
+		if err := response.Decode(logs[2].result.([]byte)); err != nil || response.BufferedOperations != 1 || len(response.Buffers) != 1 {
+			t.Errorf("Channels admin response should include buffer stats. response=%+v", response)
+		}
+	}
+	if logs := reg.ticketLogs[failingTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus {
+		t.Errorf("Channels admin request failing in channels subsystem should fail. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[malformedTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != channelsAdminFormatError {
+		t.Errorf("Malformed channels admin request should be rejected. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[unsignedTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != channelsAdminUnverifiedError {
+		t.Errorf("Channels admin request without signers should be rejected. logs=%+v", logs)
+	}
+
+	// Certifier not allowed to update permissions
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequesterNonAdmin, usersRequesterNonAdmin, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	unauthorizedTicket, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), statsRequestEncoded, nil)
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[unauthorizedTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != channelsAdminUnauthorizedError {
+		t.Errorf("Channels admin request from unauthorized certifier should be rejected. logs=%+v", logs)
+	}
+}
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/keys"
@@ -8,12 +9,14 @@ import (
 	"github.com/mngharbi/DMPC/status"
 	"github.com/mngharbi/DMPC/users"
 	"github.com/mngharbi/gofarm"
+	"sync"
+	"sync/atomic"
 )
 
 /*
 	Function to send in a decrypted request into the executor and returns a ticket
 */
-type Requester func(bool, *core.OperationMetaFields, *core.VerifiedSigners, []byte, *core.Operation) (status.Ticket, error)
+type Requester func(context.Context, bool, *core.OperationMetaFields, *core.VerifiedSigners, []byte, *core.Operation) (status.Ticket, error)
 
 /*
 	Daemon configuration
@@ -24,23 +27,11 @@ type Config struct {
 }
 
 /*
-	Logging
+	Executor instance (package functions use a default instance)
 */
-var (
-	log             *core.LoggingHandler
-	shutdownProgram core.ShutdownLambda
-)
+type Server struct {
+	handler *core.ServerHandler
 
-/*
-	Server API
-*/
-
-var (
-	serverSingleton server
-	serverHandler   *gofarm.ServerHandler
-)
-
-type server struct {
 	// Requester lambdas
 	usersRequester            users.Requester
 	usersRequesterUnverified  users.Requester
@@ -49,12 +40,102 @@ type server struct {
 	channelActionRequester    channels.ChannelActionRequester
 	channelListenersRequester channels.ListenersRequester
 	lockerRequester           locker.Requester
+	lockerAdminRequester      locker.AdminRequester
+	channelsAdminRequester    channels.AdminRequester
 	keyAdder                  core.KeyAdder
 	keyEncryptor              keys.Encryptor
 	responseReporter          status.Reporter
 	ticketGenerator           status.TicketGenerator
+
+	// Cancellation functions of pending requests (indexed by ticket)
+	pendingRequests sync.Map
+
+	// Handlers indexed by request type
+	registry handlerRegistry
+
+	// Logging and fatal error handling
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+
+	// Request metrics (results are the last status reported)
+	metrics *core.SubsystemMetrics
+
+	// Set when started and cleared when shut down
+	state core.ServerState
+}
+
+func NewServer(metricsRegistry *core.MetricsRegistry) *Server {
+	return &Server{
+		handler: core.ProvisionServer(),
+		metrics: core.NewSubsystemMetrics(metricsRegistry, "executor"),
+	}
+}
+
+var defaultServer *Server = NewServer(core.Metrics)
+
+// Instance used by package functions
+func DefaultServer() *Server {
+	return defaultServer
+}
+
+/*
+	Pending request cancellation
+*/
+type pendingRequest struct {
+	cancel   context.CancelFunc
+	issuerId string
+
+	// Last status reported (used for metrics)
+	lastStatus atomic.Value
+}
+
+func (pending *pendingRequest) getLastStatus() status.StatusCode {
+	if statusCode, ok := pending.lastStatus.Load().(status.StatusCode); ok {
+		return statusCode
+	}
+	return status.NoStatus
+}
+
+func (sv *Server) addPendingRequest(ticketId status.Ticket, cancel context.CancelFunc, signers *core.VerifiedSigners) {
+	pending := &pendingRequest{
+		cancel: cancel,
+	}
+	if signers != nil {
+		pending.issuerId = signers.IssuerId
+	}
+	sv.pendingRequests.Store(ticketId, pending)
+}
+
+func (sv *Server) removePendingRequest(ticketId status.Ticket) {
+	if pendingGeneric, ok := sv.pendingRequests.Load(ticketId); ok {
+		pendingGeneric.(*pendingRequest).cancel()
+		sv.pendingRequests.Delete(ticketId)
+	}
+}
+
+func (sv *Server) getPendingRequest(ticketId status.Ticket) *pendingRequest {
+	if pendingGeneric, ok := sv.pendingRequests.Load(ticketId); ok {
+		return pendingGeneric.(*pendingRequest)
+	}
+	return nil
+}
+
+/*
+	Keeps track of the last status reported for pending requests
+*/
+func (sv *Server) trackingReporter(responseReporter status.Reporter) status.Reporter {
+	return func(ticketId status.Ticket, statusCode status.StatusCode, reason status.FailReasonCode, payload interface{}, errs []error) error {
+		if pending := sv.getPendingRequest(ticketId); pending != nil {
+			pending.lastStatus.Store(statusCode)
+		}
+		return responseReporter(ticketId, statusCode, reason, payload, errs)
+	}
 }
 
+/*
+	Server API
+*/
+
 func InitializeServer(
 	usersRequester users.Requester,
 	usersRequesterUnverified users.Requester,
@@ -63,6 +144,8 @@ func InitializeServer(
 	channelActionRequester channels.ChannelActionRequester,
 	channelListenersRequester channels.ListenersRequester,
 	lockerRequester locker.Requester,
+	lockerAdminRequester locker.AdminRequester,
+	channelsAdminRequester channels.AdminRequester,
 	keyAdder core.KeyAdder,
 	keyEncryptor keys.Encryptor,
 	responseReporter status.Reporter,
@@ -70,62 +153,138 @@ func InitializeServer(
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) {
-	provisionServerOnce()
-	serverSingleton.usersRequester = usersRequester
-	serverSingleton.usersRequesterUnverified = usersRequesterUnverified
-	serverSingleton.messageAdder = messageAdder
-	serverSingleton.operationBufferer = operationBufferer
-	serverSingleton.channelActionRequester = channelActionRequester
-	serverSingleton.channelListenersRequester = channelListenersRequester
-	serverSingleton.lockerRequester = lockerRequester
-	serverSingleton.keyAdder = keyAdder
-	serverSingleton.keyEncryptor = keyEncryptor
-	serverSingleton.responseReporter = responseReporter
-	serverSingleton.ticketGenerator = ticketGenerator
-	log = loggingHandler
-	shutdownProgram = shutdownLambda
-	serverHandler.InitServer(&serverSingleton)
+	defaultServer.InitializeServer(
+		usersRequester,
+		usersRequesterUnverified,
+		messageAdder,
+		operationBufferer,
+		channelActionRequester,
+		channelListenersRequester,
+		lockerRequester,
+		lockerAdminRequester,
+		channelsAdminRequester,
+		keyAdder,
+		keyEncryptor,
+		responseReporter,
+		ticketGenerator,
+		loggingHandler,
+		shutdownLambda,
+	)
 }
 
 func StartServer(conf Config) error {
-	provisionServerOnce()
-	return serverHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	return defaultServer.StartServer(conf)
 }
 
 func ShutdownServer() {
-	provisionServerOnce()
-	serverHandler.ShutdownServer()
+	defaultServer.ShutdownServer()
 }
 
-func provisionServerOnce() {
-	if serverHandler == nil {
-		serverHandler = gofarm.ProvisionServer()
-	}
+func ResizeServer(conf Config) error {
+	return defaultServer.ResizeServer(conf)
+}
+
+func IsRunning() bool {
+	return defaultServer.IsRunning()
 }
 
 func MakeRequest(
+	ctx context.Context,
+	isVerified bool,
+	metaFields *core.OperationMetaFields,
+	signers *core.VerifiedSigners,
+	request []byte,
+	failedOperation *core.Operation,
+) (status.Ticket, error) {
+	return defaultServer.MakeRequest(ctx, isVerified, metaFields, signers, request, failedOperation)
+}
+
+/*
+	Instance API
+*/
+
+func (sv *Server) InitializeServer(
+	usersRequester users.Requester,
+	usersRequesterUnverified users.Requester,
+	messageAdder channels.MessageAdder,
+	operationBufferer channels.OperationBufferer,
+	channelActionRequester channels.ChannelActionRequester,
+	channelListenersRequester channels.ListenersRequester,
+	lockerRequester locker.Requester,
+	lockerAdminRequester locker.AdminRequester,
+	channelsAdminRequester channels.AdminRequester,
+	keyAdder core.KeyAdder,
+	keyEncryptor keys.Encryptor,
+	responseReporter status.Reporter,
+	ticketGenerator status.TicketGenerator,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) {
+	sv.usersRequester = usersRequester
+	sv.usersRequesterUnverified = usersRequesterUnverified
+	sv.messageAdder = messageAdder
+	sv.operationBufferer = operationBufferer
+	sv.channelActionRequester = channelActionRequester
+	sv.channelListenersRequester = channelListenersRequester
+	sv.lockerRequester = lockerRequester
+	sv.lockerAdminRequester = lockerAdminRequester
+	sv.channelsAdminRequester = channelsAdminRequester
+	sv.keyAdder = keyAdder
+	sv.keyEncryptor = keyEncryptor
+	sv.responseReporter = sv.trackingReporter(responseReporter)
+	sv.ticketGenerator = ticketGenerator
+	sv.log = loggingHandler
+	sv.shutdownProgram = shutdownLambda
+	sv.registerBuiltinHandlers()
+	sv.handler.InitServer(sv)
+}
+
+func (sv *Server) StartServer(conf Config) error {
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) ShutdownServer() {
+	sv.handler.ShutdownServer()
+}
+
+// Running requests are not dropped
+func (sv *Server) ResizeServer(conf Config) error {
+	return sv.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) IsRunning() bool {
+	return sv.state.IsRunning()
+}
+
+func (sv *Server) MakeRequest(
+	ctx context.Context,
 	isVerified bool,
 	metaFields *core.OperationMetaFields,
 	signers *core.VerifiedSigners,
 	request []byte,
 	failedOperation *core.Operation,
 ) (status.Ticket, error) {
-	log.Debugf(receivedRequestLogMsg)
+	sv.log.Debugf(receivedRequestLogMsg)
 
 	// Check type
-	if !isValidRequestType(metaFields.RequestType) {
+	if sv.registry.get(metaFields.RequestType) == nil {
 		return "", invalidRequestTypeError
 	}
 
 	// Generate ticket
-	ticketId := serverSingleton.ticketGenerator()
-	err := serverSingleton.responseReporter(ticketId, status.QueuedStatus, status.NoReason, nil, nil)
+	ticketId := sv.ticketGenerator()
+	err := sv.responseReporter(ticketId, status.QueuedStatus, status.NoReason, nil, nil)
 	if err != nil {
 		return ticketId, err
 	}
 
+	// Make request cancellable using its ticket
+	ctx, cancel := context.WithCancel(ctx)
+	sv.addPendingRequest(ticketId, cancel, signers)
+
 	// Make request
-	_, err = serverHandler.MakeRequest(&executorRequest{
+	_, err = sv.handler.MakeRequest(&executorRequest{
+		ctx:             ctx,
 		isVerified:      isVerified,
 		metaFields:      metaFields,
 		signers:         signers,
@@ -134,9 +293,11 @@ func MakeRequest(
 		failedOperation: failedOperation,
 	})
 	if err != nil {
-		serverSingleton.reportRejection(ticketId, status.RejectedReason, []error{err})
+		sv.removePendingRequest(ticketId)
+		sv.reportRejection(ticketId, status.RejectedReason, []error{err})
 		return ticketId, err
 	}
+	sv.metrics.Queued()
 
 	return ticketId, nil
 }
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"context"
 	"errors"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
@@ -32,7 +33,7 @@ func TestReadChannelRequest(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), rqEncoded, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), rqEncoded, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		ShutdownServer()
@@ -49,11 +50,11 @@ func TestReadChannelRequest(t *testing.T) {
 		t.Errorf("Request should succeed and statuses should be reported correctly.")
 	}
 
-	// Check channel read lock/unlock
-	checkChannelLocking(t, lockerCalls, core.ReadLockType)
+	// Check channel and certifier read lock/unlock
+	checkChannelLocking(t, lockerCalls, core.ReadLockType, genericCertifierId)
 
-	// Expect user read locking
-	checkUserLocking(t, userCalls)
+	// Expect certifier read
+	checkUserRead(t, userCalls)
 
 	// Check channel subsystem call
 	channelActionCall := (<-channelActionCalls).(*channels.ReadChannelRequest)
@@ -65,6 +66,66 @@ func TestReadChannelRequest(t *testing.T) {
 	}
 }
 
+/*
+	List channels request
+*/
+
+func TestListChannelsRequest(t *testing.T) {
+	// Set up context needed
+	usersRequester, _, usersRequesterUnverified, userCalls, messageAdder, _, operationBufferer, _, channelActionRequester, channelActionCalls, channelListenersRequester, _, lockerRequester, lockerCalls, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+
+	rq := &channels.ListChannelsRequest{
+		Member: genericIssuerId,
+		State:  channels.ChannelObjectOpenState,
+	}
+	meta := &core.OperationMetaFields{
+		RequestType: core.ListChannelsType,
+		Timestamp:   nowTime,
+	}
+	rqEncoded, _ := rq.Encode()
+
+	// Test valid and unsigned requests
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), rqEncoded, nil)
+	if err != nil {
+		t.Error("Request should not fail.")
+		ShutdownServer()
+		return
+	}
+	unsignedTicketId, _ := MakeRequest(context.Background(), true, meta, nil, rqEncoded, nil)
+	ShutdownServer()
+
+	// Check status
+	if logs := reg.ticketLogs[ticketId]; len(logs) != 3 ||
+		logs[2].status != status.SuccessStatus {
+		t.Errorf("Request should succeed and statuses should be reported correctly. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[unsignedTicketId]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != unverifiedChannelListError {
+		t.Errorf("Unsigned list request should be rejected. logs=%+v", logs)
+	}
+
+	// Check certifier read lock/unlock (no channel is locked)
+	checkUserLocking(t, lockerCalls, genericCertifierId)
+
+	// Expect certifier read
+	checkUserRead(t, userCalls)
+
+	// Check channel subsystem call
+	channelActionCall := (<-channelActionCalls).(*channels.ListChannelsRequest)
+	expectedRq := &channels.ListChannelsRequest{
+		Member:  genericIssuerId,
+		State:   channels.ChannelObjectOpenState,
+		Signers: generateGenericSigners(),
+	}
+	if !reflect.DeepEqual(channelActionCall, expectedRq) {
+		t.Errorf("Channel list request should be forwarded to channel action subsystem. expected=%+v, found=%+v", expectedRq, channelActionCall)
+	}
+}
+
 /*
 	Add channel request
 */
@@ -92,7 +153,7 @@ func TestAddChannelRequest(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), rqEncoded, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), rqEncoded, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		ShutdownServer()
@@ -108,19 +169,26 @@ func TestAddChannelRequest(t *testing.T) {
 		t.Errorf("Request should succeed and statuses should be reported correctly.")
 	}
 
-	// Check user read lock/unlock
-	checkUserLocking(t, userCalls)
+	// Check certifier read
+	checkUserRead(t, userCalls)
 
-	// Check channel write lock/unlock
-	checkChannelLocking(t, lockerCalls, core.WriteLockType)
+	// Check channel write lock/unlock and certifier read lock/unlock
+	checkChannelLocking(t, lockerCalls, core.WriteLockType, genericCertifierId)
+
+	channelActionCall := (<-channelActionCalls).(*channels.OpenChannelRequest)
 
+	// Key is added by channels subsystem (only if opening is kept)
+	if channelActionCall.KeyAdder == nil {
+		t.Fatal("Channel add request should pass key adder.")
+	}
+	channelActionCall.KeyAdder(channelActionCall.Channel.KeyId, channelActionCall.Key)
 	keyAdderCall := (<-keyAdderCalls).(keyAdderCall)
 	if keyAdderCall.keyId != genericKeyId ||
 		!reflect.DeepEqual(keyAdderCall.key, genericKey) {
-		t.Error("Channel add request should add key.")
+		t.Error("Channel add request should pass key adder of executor.")
 	}
+	channelActionCall.KeyAdder = nil
 
-	channelActionCall := (<-channelActionCalls).(*channels.OpenChannelRequest)
 	expectedRq := &channels.OpenChannelRequest{}
 	expectedRq.Decode(rqEncoded)
 	expectedRq.Channel.Id = genericChannelId
@@ -150,7 +218,7 @@ func TestInvalidAddChannelRequest(t *testing.T) {
 	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
 		return
 	}
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), rqEncoded, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), rqEncoded, nil)
 	if err != nil {
 		t.Error("Request should not be rejected.")
 		ShutdownServer()
@@ -189,7 +257,7 @@ func TestCloseChannelRequest(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), rqEncoded, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), rqEncoded, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		ShutdownServer()
@@ -258,7 +326,7 @@ func doMessagesTesting(t *testing.T, isVerified bool, isBuffered bool) {
 			return
 		}
 	}
-	ticketId, err := MakeRequest(isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
+	ticketId, err := MakeRequest(context.Background(), isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -291,7 +359,7 @@ func doMessagesTesting(t *testing.T, isVerified bool, isBuffered bool) {
 			return
 		}
 	}
-	ticketId, err = MakeRequest(isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
+	ticketId, err = MakeRequest(context.Background(), isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -324,7 +392,7 @@ func doMessagesTesting(t *testing.T, isVerified bool, isBuffered bool) {
 			return
 		}
 	}
-	ticketId, err = MakeRequest(isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
+	ticketId, err = MakeRequest(context.Background(), isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -337,7 +405,8 @@ func doMessagesTesting(t *testing.T, isVerified bool, isBuffered bool) {
 		reg.ticketLogs[ticketId][1].status != status.RunningStatus ||
 		reg.ticketLogs[ticketId][2].status != status.FailedStatus ||
 		reg.ticketLogs[ticketId][2].failureReason != status.FailedReason ||
-		reg.ticketLogs[ticketId][2].errors != nil {
+		len(reg.ticketLogs[ticketId][2].errors) != 1 ||
+		core.GetErrorCode(reg.ticketLogs[ticketId][2].errors[0]) != core.MessageDroppedErrorCode {
 		t.Error("Request should run but fail, and statuses should be reported correctly when the request failed.")
 	}
 
@@ -357,7 +426,7 @@ func doMessagesTesting(t *testing.T, isVerified bool, isBuffered bool) {
 			return
 		}
 	}
-	ticketId, err = MakeRequest(isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
+	ticketId, err = MakeRequest(context.Background(), isVerified, &metaFields, generateGenericSigners(), []byte{}, requestOperation)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -400,10 +469,10 @@ func doMessagesTesting(t *testing.T, isVerified bool, isBuffered bool) {
 				payload := []byte(strconv.Itoa(copyI))
 				op := requestOperationDefault
 				op.Payload = payload
-				_, _ = MakeRequest(isVerified, &op.Meta, generateGenericSigners(), []byte{}, &op)
+				_, _ = MakeRequest(context.Background(), isVerified, &op.Meta, generateGenericSigners(), []byte{}, &op)
 			} else {
 				payload := []byte(strconv.Itoa(copyI))
-				_, _ = MakeRequest(isVerified, &metaFields, generateGenericSigners(), payload, nil)
+				_, _ = MakeRequest(context.Background(), isVerified, &metaFields, generateGenericSigners(), payload, nil)
 			}
 			wg.Done()
 		})()
@@ -470,7 +539,7 @@ func TestSubscribeRequest(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), nil, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), nil, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		ShutdownServer()
@@ -534,7 +603,7 @@ func TestChannelEncryptRequest(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), opEncoded, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), opEncoded, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		ShutdownServer()
@@ -0,0 +1,160 @@
+package executor
+
+import (
+	"context"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/status"
+	"github.com/mngharbi/DMPC/users"
+	"reflect"
+	"testing"
+)
+
+/*
+	Request handler registry
+*/
+
+const (
+	customRequestType core.RequestType = 1000
+)
+
+func TestRegisterHandlerBeforeInitialization(t *testing.T) {
+	sv := NewServer(core.NewMetricsRegistry())
+	handler := &RequestHandler{
+		Handle: func(rq *Request) {},
+	}
+	if err := sv.RegisterHandler(customRequestType, handler); err != uninitializedRegistryError {
+		t.Errorf("Registering handler before initializing server should fail. err=%v", err)
+	}
+}
+
+func TestRegisterHandler(t *testing.T) {
+	usersRequester, _, usersRequesterUnverified, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, _, ticketGenerator := createDummies(true)
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	defer ShutdownServer()
+
+	handler := &RequestHandler{
+		Handle: func(rq *Request) {},
+	}
+	if err := RegisterHandler(core.UsersRequestType, handler); err != duplicateHandlerError {
+		t.Errorf("Registering handler for built-in request type should fail. err=%v", err)
+	}
+	if err := RegisterHandler(customRequestType, &RequestHandler{}); err != nilHandlerError {
+		t.Errorf("Registering handler without handling function should fail. err=%v", err)
+	}
+	if err := RegisterHandler(customRequestType, handler); err != nil {
+		t.Errorf("Registering handler for custom request type should succeed. err=%v", err)
+	}
+	if err := RegisterHandler(customRequestType, handler); err != duplicateHandlerError {
+		t.Errorf("Registering handler twice should fail. err=%v", err)
+	}
+}
+
+func TestCustomRequestHandler(t *testing.T) {
+	usersRequester, _, usersRequesterUnverified, userCalls, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, lockerCalls, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+
+	// Custom handler echoing payload back
+	handler := &RequestHandler{
+		RequireSigners: true,
+		CheckCertifier: func(certifier *users.UserObject) bool {
+			return certifier.Permissions.Channel.Read
+		},
+		LockNeeds: func(rq *Request) (*LockNeeds, error) {
+			return &LockNeeds{
+				Channels: []core.LockNeed{
+					{
+						LockType: core.WriteLockType,
+						Id:       rq.MetaFields().ChannelId,
+					},
+				},
+			}, nil
+		},
+		Handle: func(rq *Request) {
+			if rq.Certifier() == nil {
+				rq.Reject([]error{unauthorizedRequestError})
+				return
+			}
+			rq.Succeed(rq.Payload())
+		},
+	}
+	if err := RegisterHandler(customRequestType, handler); err != nil {
+		t.Errorf("Registering handler for custom request type should succeed. err=%v", err)
+		ShutdownServer()
+		return
+	}
+
+	meta := &core.OperationMetaFields{
+		RequestType: customRequestType,
+		ChannelId:   genericChannelId,
+		Timestamp:   nowTime,
+	}
+	payload := []byte("PAYLOAD")
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), payload, nil)
+	if err != nil {
+		t.Errorf("Request with custom type should not fail. err=%v", err)
+		ShutdownServer()
+		return
+	}
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[ticketId]; len(logs) != 3 ||
+		logs[2].status != status.SuccessStatus ||
+		!reflect.DeepEqual(logs[2].result, payload) {
+		t.Errorf("Request with custom type should be handled by registered handler. logs=%+v", logs)
+	}
+
+	// Lock needs are batched with certifier read lock
+	checkChannelLocking(t, lockerCalls, core.WriteLockType, genericCertifierId)
+	checkUserRead(t, userCalls)
+
+	// Unsigned request should be rejected before handling
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+	RegisterHandler(customRequestType, handler)
+	unsignedTicketId, _ := MakeRequest(context.Background(), true, meta, nil, payload, nil)
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[unsignedTicketId]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != unverifiedRequestError {
+		t.Errorf("Unsigned request with custom type requiring signers should be rejected. logs=%+v", logs)
+	}
+}
+
+func TestCustomRequestHandlerUnauthorized(t *testing.T) {
+	usersRequester, _, usersRequesterUnverified, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+
+	// Certifier lacks permission checked by handler
+	handled := false
+	RegisterHandler(customRequestType, &RequestHandler{
+		CheckCertifier: func(certifier *users.UserObject) bool {
+			return certifier.Permissions.User.PermissionsUpdate
+		},
+		Handle: func(rq *Request) {
+			handled = true
+			rq.Succeed(nil)
+		},
+	})
+
+	meta := &core.OperationMetaFields{
+		RequestType: customRequestType,
+		Timestamp:   nowTime,
+	}
+	ticketId, _ := MakeRequest(context.Background(), true, meta, generateGenericSigners(), []byte{}, nil)
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[ticketId]; handled ||
+		len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != unauthorizedRequestError {
+		t.Errorf("Request from unauthorized certifier should be rejected before handling. logs=%+v", logs)
+	}
+}
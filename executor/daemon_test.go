@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/keys"
@@ -8,6 +9,7 @@ import (
 	"github.com/mngharbi/DMPC/status"
 	"github.com/mngharbi/DMPC/users"
 	"testing"
+	"time"
 )
 
 /*
@@ -68,7 +70,7 @@ func TestInvalidRequestType(t *testing.T) {
 		return
 	}
 
-	_, err := MakeRequest(false, &core.OperationMetaFields{RequestType: core.UsersRequestType - 1, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	_, err := MakeRequest(context.Background(), false, &core.OperationMetaFields{RequestType: core.UsersRequestType - 1, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err != invalidRequestTypeError {
 		t.Error("Request with invalid type should be rejected.")
 	}
@@ -82,7 +84,7 @@ func TestReponseReporterQueueError(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(false, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	ticketId, err := MakeRequest(context.Background(), false, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err != responseReporterError {
 		t.Error("Request should fail with response reporter error while queueing.")
 	}
@@ -102,7 +104,7 @@ func TestRequestWhileNotRunning(t *testing.T) {
 
 	ShutdownServer()
 
-	ticketId, err := MakeRequest(false, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	ticketId, err := MakeRequest(context.Background(), false, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err == nil {
 		t.Error("Request should fail if made while server is down.")
 	}
@@ -114,3 +116,119 @@ func TestRequestWhileNotRunning(t *testing.T) {
 		t.Error("Status for ticket number should be updated if failing when server is down.")
 	}
 }
+
+func TestRequestContextDone(t *testing.T) {
+	usersRequester, _, usersRequesterUnverified, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+
+	// Cancelled before running
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelledTicket, err := MakeRequest(cancelledCtx, true, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	if err != nil {
+		t.Error("Request with cancelled context should be queued.")
+		return
+	}
+
+	// Deadline passed before running
+	expiredCtx, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+	expiredTicket, err := MakeRequest(expiredCtx, true, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	if err != nil {
+		t.Error("Request with expired context should be queued.")
+		return
+	}
+
+	ShutdownServer()
+
+	if len(reg.ticketLogs[cancelledTicket]) != 2 ||
+		reg.ticketLogs[cancelledTicket][1].status != status.CancelledStatus ||
+		core.GetErrorCode(reg.ticketLogs[cancelledTicket][1].errors[0]) != core.CancelledErrorCode {
+		t.Errorf("Request with cancelled context should be reported as cancelled. logs=%+v", reg.ticketLogs[cancelledTicket])
+	}
+	if len(reg.ticketLogs[expiredTicket]) != 2 ||
+		reg.ticketLogs[expiredTicket][1].status != status.FailedStatus ||
+		core.GetErrorCode(reg.ticketLogs[expiredTicket][1].errors[0]) != core.DeadlineExceededErrorCode {
+		t.Errorf("Request with expired context should fail with deadline exceeded. logs=%+v", reg.ticketLogs[expiredTicket])
+	}
+}
+
+func TestDeadlineWhileRunning(t *testing.T) {
+	_, _, _, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	usersRequester := createBlockingUsersRequesterFunctor()
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequester, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ticketId, err := MakeRequest(ctx, true, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	if err != nil {
+		t.Error("Request should not fail.")
+		return
+	}
+
+	ShutdownServer()
+
+	if len(reg.ticketLogs[ticketId]) != 3 ||
+		reg.ticketLogs[ticketId][1].status != status.RunningStatus ||
+		reg.ticketLogs[ticketId][2].status != status.FailedStatus ||
+		core.GetErrorCode(reg.ticketLogs[ticketId][2].errors[0]) != core.DeadlineExceededErrorCode {
+		t.Errorf("Request blocked past its deadline should fail with deadline exceeded. logs=%+v", reg.ticketLogs[ticketId])
+	}
+}
+
+func TestCancelTicket(t *testing.T) {
+	_, _, _, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	usersRequester := createBlockingUsersRequesterFunctor()
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequester, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+
+	// Request blocking until cancelled
+	blockedTicket, err := MakeRequest(context.Background(), true, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	if err != nil {
+		t.Error("Request should not fail.")
+		return
+	}
+	cancelRequest := &CancelTicketRequest{Ticket: blockedTicket}
+	cancelRequestEncoded, _ := cancelRequest.Encode()
+	cancelMeta := &core.OperationMetaFields{RequestType: core.CancelTicketType, Timestamp: nowTime}
+
+	// Cancellation from another issuer
+	otherIssuerTicket, _ := MakeRequest(context.Background(), true, cancelMeta, generateSigners("OTHER_ISSUER", genericCertifierId), cancelRequestEncoded, nil)
+
+	// Cancellation of unknown ticket
+	unknownRequest := &CancelTicketRequest{Ticket: status.RequestNewTicket()}
+	unknownRequestEncoded, _ := unknownRequest.Encode()
+	unknownTicket, _ := MakeRequest(context.Background(), true, cancelMeta, generateGenericSigners(), unknownRequestEncoded, nil)
+
+	// Wait for rejections before cancelling
+	waitForRandomDuration()
+
+	// Cancellation from the issuer
+	cancelTicket, _ := MakeRequest(context.Background(), true, cancelMeta, generateGenericSigners(), cancelRequestEncoded, nil)
+
+	ShutdownServer()
+
+	if logs := reg.ticketLogs[otherIssuerTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		logs[2].errors[0] != cancelTicketPermissionError {
+		t.Errorf("Cancellation from another issuer should be rejected. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[unknownTicket]; len(logs) != 3 ||
+		logs[2].status != status.FailedStatus ||
+		core.GetErrorCode(logs[2].errors[0]) != core.TicketNotFoundErrorCode {
+		t.Errorf("Cancellation of unknown ticket should fail. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[cancelTicket]; len(logs) != 3 ||
+		logs[2].status != status.SuccessStatus {
+		t.Errorf("Cancellation from the issuer should succeed. logs=%+v", logs)
+	}
+	if logs := reg.ticketLogs[blockedTicket]; len(logs) == 0 ||
+		logs[len(logs)-1].status != status.CancelledStatus {
+		t.Errorf("Cancelled request should be reported as cancelled. logs=%+v", logs)
+	}
+}
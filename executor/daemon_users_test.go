@@ -1,9 +1,11 @@
 package executor
 
 import (
+	"context"
 	"errors"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/locker"
 	"github.com/mngharbi/DMPC/status"
 	"github.com/mngharbi/DMPC/users"
 	"reflect"
@@ -18,7 +20,7 @@ import (
 
 func TestTransactionEncryptRequest(t *testing.T) {
 	// Set up context needed
-	usersRequester, userCalls, usersRequesterUnverified, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, _, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+	usersRequester, userCalls, usersRequesterUnverified, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, lockerCalls, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
 
 	// Create inner operation
 	innerPlaintextBytes := []byte("{}")
@@ -58,7 +60,7 @@ func TestTransactionEncryptRequest(t *testing.T) {
 		return
 	}
 
-	ticketId, err := MakeRequest(true, meta, generateGenericSigners(), tsEncoded, nil)
+	ticketId, err := MakeRequest(context.Background(), true, meta, generateGenericSigners(), tsEncoded, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		ShutdownServer()
@@ -75,8 +77,9 @@ func TestTransactionEncryptRequest(t *testing.T) {
 		t.Errorf("Request should succeed and statuses should be reported correctly.")
 	}
 
-	// Expect user read locking
-	checkUserLocking(t, userCalls)
+	// Expect receipient read lock/unlock and read
+	checkUserLocking(t, lockerCalls, genericCertifierId)
+	checkUserRead(t, userCalls)
 
 	// Decrypt result
 	tsEncrypted := &core.Transaction{}
@@ -119,7 +122,7 @@ func doUserRequestTesting(t *testing.T, isVerified bool) {
 		return
 	}
 
-	ticketId, err := MakeRequest(isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	ticketId, err := MakeRequest(context.Background(), isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -146,7 +149,7 @@ func doUserRequestTesting(t *testing.T, isVerified bool) {
 	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterVerified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
 		return
 	}
-	ticketId, err = MakeRequest(isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	ticketId, err = MakeRequest(context.Background(), isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -173,7 +176,7 @@ func doUserRequestTesting(t *testing.T, isVerified bool) {
 	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterVerified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
 		return
 	}
-	ticketId, err = MakeRequest(isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	ticketId, err = MakeRequest(context.Background(), isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -186,7 +189,8 @@ func doUserRequestTesting(t *testing.T, isVerified bool) {
 		reg.ticketLogs[ticketId][1].status != status.RunningStatus ||
 		reg.ticketLogs[ticketId][2].status != status.FailedStatus ||
 		reg.ticketLogs[ticketId][2].failureReason != status.FailedReason ||
-		reg.ticketLogs[ticketId][2].errors != nil {
+		len(reg.ticketLogs[ticketId][2].errors) != 1 ||
+		core.GetErrorCode(reg.ticketLogs[ticketId][2].errors[0]) != core.IssuerUnknownErrorCode {
 		t.Error("Request should run but fail, and statuses should be reported correctly when the request failed.")
 	}
 
@@ -200,7 +204,7 @@ func doUserRequestTesting(t *testing.T, isVerified bool) {
 	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterVerified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
 		return
 	}
-	ticketId, err = MakeRequest(isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
+	ticketId, err = MakeRequest(context.Background(), isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), []byte{}, nil)
 	if err != nil {
 		t.Error("Request should not fail.")
 		return
@@ -235,7 +239,7 @@ func doUserRequestTesting(t *testing.T, isVerified bool) {
 		go (func() {
 			waitForRandomDuration()
 			payload := []byte(strconv.Itoa(copyI))
-			_, _ = MakeRequest(isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), payload, nil)
+			_, _ = MakeRequest(context.Background(), isVerified, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), payload, nil)
 			wg.Done()
 		})()
 	}
@@ -267,3 +271,50 @@ func TestUnverifiedUserRequest(t *testing.T) {
 func TestVerifiedUserRequest(t *testing.T) {
 	doUserRequestTesting(t, true)
 }
+
+func TestUserUpdateRequestLocking(t *testing.T) {
+	// Set up context needed
+	usersRequester, userCalls, usersRequesterUnverified, _, messageAdder, _, operationBufferer, _, channelActionRequester, _, channelListenersRequester, _, lockerRequester, lockerCalls, keyAdder, _, keyEncryptor, _, responseReporter, reg, ticketGenerator := createDummies(true)
+
+	if !resetAndStartServer(t, multipleWorkersConfig(), usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator) {
+		return
+	}
+
+	subjectId := "SUBJECT_ID"
+	usersRequest := users.GenerateUpdateRequest(&users.UserObject{Id: subjectId}, []string{"active"}, nowTime)
+	payload, _ := usersRequest.Encode()
+	ticketId, err := MakeRequest(context.Background(), true, &core.OperationMetaFields{RequestType: core.UsersRequestType, Timestamp: nowTime}, generateGenericSigners(), payload, nil)
+	if err != nil {
+		t.Error("Request should not fail.")
+		ShutdownServer()
+		return
+	}
+
+	ShutdownServer()
+
+	if len(reg.ticketLogs[ticketId]) != 3 ||
+		reg.ticketLogs[ticketId][2].status != status.SuccessStatus {
+		t.Error("Request should succeed.")
+	}
+
+	// Expect signers read locked and subject write locked by the executor
+	expectedNeeds := []core.LockNeed{
+		{LockType: core.ReadLockType, Id: genericIssuerId},
+		{LockType: core.ReadLockType, Id: genericCertifierId},
+		{LockType: core.WriteLockType, Id: subjectId},
+	}
+	for i := 0; i < 2; i++ {
+		lockCall := (<-lockerCalls).(*locker.LockerRequest)
+		if lockCall.Type != locker.UserLock ||
+			len(lockCall.Batch) != 0 ||
+			!reflect.DeepEqual(lockCall.Needs, expectedNeeds) {
+			t.Errorf("Request should lock/unlock signers and subject. lockCall=%+v", lockCall)
+		}
+	}
+
+	// Expect request passed to users subsystem
+	userCall := <-userCalls
+	if !reflect.DeepEqual(userCall.request, payload) {
+		t.Errorf("Request should be passed to users subsystem. userCall=%+v", userCall)
+	}
+}
@@ -5,6 +5,7 @@
 package executor
 
 import (
+	"context"
 	"crypto/rsa"
 	"errors"
 	"github.com/mngharbi/DMPC/channels"
@@ -58,10 +59,8 @@ func waitForRandomDuration() {
 */
 
 type userRequesterCall struct {
-	signers    *core.VerifiedSigners
-	readLock   bool
-	readUnlock bool
-	request    []byte
+	signers *core.VerifiedSigners
+	request []byte
 }
 
 var (
@@ -90,13 +89,11 @@ func sendUserResponseAfterRandomDelay(channel chan *users.UserResponse, response
 
 func createDummyUsersRequesterFunctor(responseCodeReturned int, data []users.UserObject, errsReturned []error, closeChannel bool) (users.Requester, chan userRequesterCall) {
 	callsChannel := make(chan userRequesterCall, 0)
-	requester := func(signers *core.VerifiedSigners, readLock bool, readUnlock bool, request []byte) (chan *users.UserResponse, []error) {
+	requester := func(_ context.Context, signers *core.VerifiedSigners, request []byte) (chan *users.UserResponse, []error) {
 		go (func() {
 			callsChannel <- userRequesterCall{
-				signers:    signers,
-				readLock:   readLock,
-				readUnlock: readUnlock,
-				request:    request,
+				signers: signers,
+				request: request,
 			}
 		})()
 		if errsReturned != nil {
@@ -113,6 +110,12 @@ func createDummyUsersRequesterFunctor(responseCodeReturned int, data []users.Use
 	return requester, callsChannel
 }
 
+func createBlockingUsersRequesterFunctor() users.Requester {
+	return func(_ context.Context, _ *core.VerifiedSigners, _ []byte) (chan *users.UserResponse, []error) {
+		return make(chan *users.UserResponse), nil
+	}
+}
+
 /*
 	Ticket dummy
 */
@@ -181,7 +184,7 @@ func sendMessageResponseAfterRandomDelay(channel chan *channels.MessagesResponse
 
 func createDummyMessageAdderFunctor(responseCodeReturned channels.MessagesStatusCode, errReturned error, closeChannel bool) (channels.MessageAdder, chan interface{}) {
 	callsChannel := make(chan interface{}, 0)
-	requester := func(addMessageRequest *channels.AddMessageRequest) (chan *channels.MessagesResponse, error) {
+	requester := func(_ context.Context, addMessageRequest *channels.AddMessageRequest) (chan *channels.MessagesResponse, error) {
 		go (func() {
 			callsChannel <- addMessageRequest
 		})()
@@ -205,7 +208,7 @@ func createDummyMessageAdderFunctor(responseCodeReturned channels.MessagesStatus
 
 func createDummyOperationBuffererFunctor(responseCodeReturned channels.MessagesStatusCode, errReturned error, closeChannel bool) (channels.OperationBufferer, chan interface{}) {
 	callsChannel := make(chan interface{}, 0)
-	requester := func(bufferOperationRequest *channels.BufferOperationRequest) (chan *channels.MessagesResponse, error) {
+	requester := func(_ context.Context, bufferOperationRequest *channels.BufferOperationRequest) (chan *channels.MessagesResponse, error) {
 		go (func() {
 			callsChannel <- bufferOperationRequest
 		})()
@@ -249,7 +252,7 @@ func sendChannelsResponseAfterRandomDelay(channel chan *channels.ChannelsRespons
 
 func createDummyChannelActionFunctor(responseCodeReturned channels.ChannelsStatusCode, errReturned error, closeChannel bool) (channels.ChannelActionRequester, chan interface{}) {
 	callsChannel := make(chan interface{}, 0)
-	requester := func(request interface{}) (chan *channels.ChannelsResponse, error) {
+	requester := func(_ context.Context, request interface{}) (chan *channels.ChannelsResponse, error) {
 		go (func() {
 			callsChannel <- request
 		})()
@@ -281,7 +284,7 @@ func sendListenersResponseAfterRandomDelay(channel chan *channels.ListenersRespo
 
 func createDummyListenersRequesterFunctor(responseCodeReturned channels.ListenersStatusCode, errReturned error, closeChannel bool) (channels.ListenersRequester, chan interface{}) {
 	callsChannel := make(chan interface{}, 0)
-	requester := func(request interface{}) (chan *channels.ListenersResponse, error) {
+	requester := func(_ context.Context, request interface{}) (chan *channels.ListenersResponse, error) {
 		go (func() {
 			callsChannel <- request
 		})()
@@ -310,7 +313,7 @@ func sendLockerResponseAfterRandomDelay(channel chan bool, response bool) {
 
 func createDummyLockerFunctor(responseReturned bool, errsReturned []error, closeChannel bool) (locker.Requester, chan interface{}) {
 	callsChannel := make(chan interface{}, 0)
-	requester := func(request *locker.LockerRequest) (chan bool, []error) {
+	requester := func(_ context.Context, request *locker.LockerRequest) (chan bool, []error) {
 		go (func() {
 			callsChannel <- request
 		})()
@@ -328,6 +331,31 @@ func createDummyLockerFunctor(responseReturned bool, errsReturned []error, close
 	return requester, callsChannel
 }
 
+func createDummyLockerAdminFunctor() locker.AdminRequester {
+	return func(request *locker.AdminRequest) (*locker.AdminResponse, error) {
+		if request.Action != locker.WaitForGraphAction {
+			return nil, errors.New("Locker admin error")
+		}
+		return &locker.AdminResponse{
+			Graph: &locker.WaitForGraph{},
+		}, nil
+	}
+}
+
+func createDummyChannelsAdminFunctor() channels.AdminRequester {
+	return func(request *channels.AdminRequest) (*channels.AdminResponse, error) {
+		if request.Action != channels.BufferStatsAction {
+			return nil, errors.New("Channels admin error")
+		}
+		return &channels.AdminResponse{
+			BufferedOperations: 1,
+			Buffers: []*channels.BufferStats{
+				{ChannelId: "CHANNEL_ID", Operations: 1},
+			},
+		}, nil
+	}
+}
+
 /*
 	Key adder dummies
 */
@@ -380,36 +408,63 @@ func createDummyKeyEncryptorFunctor(response error) (keys.Encryptor, chan interf
 	Locking calls check
 */
 
-func checkChannelLocking(t *testing.T, lockerCalls chan interface{}, expectedLockType core.LockType) bool {
+func checkUserReadLockNeeds(needs []core.LockNeed, expectedUserIds []string) bool {
+	if len(needs) != len(expectedUserIds) {
+		return false
+	}
+	for needIndex, need := range needs {
+		if need.Id != expectedUserIds[needIndex] || need.LockType != core.ReadLockType {
+			return false
+		}
+	}
+	return true
+}
+
+func checkChannelLocking(t *testing.T, lockerCalls chan interface{}, expectedLockType core.LockType, expectedUserIds ...string) bool {
 	for i := 0; i < 2; i++ {
 		lockCall := (<-lockerCalls).(*locker.LockerRequest)
+		usersBatched := len(expectedUserIds) == 0 && len(lockCall.Batch) == 0 ||
+			len(lockCall.Batch) == 1 &&
+				lockCall.Batch[0].Type == locker.UserLock &&
+				checkUserReadLockNeeds(lockCall.Batch[0].Needs, expectedUserIds)
 		if lockCall.Type != locker.ChannelLock ||
 			len(lockCall.Needs) != 1 ||
 			lockCall.Needs[0].Id != genericChannelId ||
-			lockCall.Needs[0].LockType != expectedLockType {
-			t.Error("Channel add request should lock/unlock channel properly.")
+			lockCall.Needs[0].LockType != expectedLockType ||
+			!usersBatched {
+			t.Errorf("Request should lock/unlock channel and users properly. lockCall=%+v", lockCall)
 			return false
 		}
 	}
 	return true
 }
 
-func checkUserLocking(t *testing.T, userCalls chan userRequesterCall) bool {
+func checkUserLocking(t *testing.T, lockerCalls chan interface{}, expectedUserIds ...string) bool {
 	for i := 0; i < 2; i++ {
-		userCall := <-userCalls
-		userCallRq := &users.UserRequest{}
-		userCallRq.Decode(userCall.request)
-		if userCallRq.Type != users.ReadRequest ||
-			len(userCallRq.Fields) != 1 ||
-			userCallRq.Fields[0] != genericCertifierId ||
-			userCall.readLock && userCall.readUnlock ||
-			!userCall.readLock && !userCall.readUnlock {
-			t.Errorf("Request should read lock/unlock user. userCall=%+v", userCall)
+		lockCall := (<-lockerCalls).(*locker.LockerRequest)
+		if lockCall.Type != locker.UserLock ||
+			len(lockCall.Batch) != 0 ||
+			!checkUserReadLockNeeds(lockCall.Needs, expectedUserIds) {
+			t.Errorf("Request should read lock/unlock users. lockCall=%+v", lockCall)
+			return false
 		}
 	}
 	return true
 }
 
+func checkUserRead(t *testing.T, userCalls chan userRequesterCall) bool {
+	userCall := <-userCalls
+	userCallRq := &users.UserRequest{}
+	userCallRq.Decode(userCall.request)
+	if userCallRq.Type != users.ReadRequest ||
+		len(userCallRq.Fields) != 1 ||
+		userCallRq.Fields[0] != genericCertifierId {
+		t.Errorf("Request should read user. userCall=%+v", userCall)
+		return false
+	}
+	return true
+}
+
 /*
 	Server
 */
@@ -429,8 +484,8 @@ func resetAndStartServer(
 	responseReporter status.Reporter,
 	ticketGenerator status.TicketGenerator,
 ) bool {
-	serverSingleton = server{}
-	InitializeServer(usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, keyAdder, keyEncryptor, responseReporter, ticketGenerator, log, shutdownProgram)
+	defaultServer = NewServer(core.Metrics)
+	InitializeServer(usersRequester, usersRequesterUnverified, messageAdder, operationBufferer, channelActionRequester, channelListenersRequester, lockerRequester, createDummyLockerAdminFunctor(), createDummyChannelsAdminFunctor(), keyAdder, keyEncryptor, responseReporter, ticketGenerator, log, shutdownProgram)
 	err := StartServer(conf)
 	if err != nil {
 		t.Errorf(err.Error())
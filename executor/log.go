@@ -4,8 +4,12 @@ package executor
 	Logging messages
 */
 const (
-	daemonStartLogMsg     string = "Executor daemon started"
-	daemonShutdownLogMsg  string = "Executor daemon shutdown"
-	receivedRequestLogMsg string = "Executor received request"
-	runningRequestLogMsg  string = "Executor running request"
+	daemonStartLogMsg       string = "Executor daemon started"
+	daemonShutdownLogMsg    string = "Executor daemon shutdown"
+	receivedRequestLogMsg   string = "Executor received request"
+	runningRequestLogMsg    string = "Executor running request"
+	cancelledRequestLogMsg  string = "Executor request cancelled"
+	deadlineExceededLogMsg  string = "Executor request deadline exceeded"
+	cancelTicketLogMsg      string = "Executor cancelling ticket %v"
+	registeredHandlerLogMsg string = "Executor registered handler for request type %v"
 )
@@ -1,25 +1,40 @@
 package executor
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/status"
+	"github.com/mngharbi/DMPC/users"
 )
 
 /*
 	Internal request structure
 */
 type executorRequest struct {
+	ctx             context.Context
 	isVerified      bool
 	metaFields      *core.OperationMetaFields
 	signers         *core.VerifiedSigners
 	ticket          status.Ticket
 	request         []byte
 	failedOperation *core.Operation
+
+	// Set if the request handler checks certifier permissions
+	certifier *users.UserObject
 }
 
 /*
-	Utilities
+	Ticket cancellation request structure
 */
-func isValidRequestType(requestType core.RequestType) bool {
-	return core.UsersRequestType <= requestType && requestType <= core.TransactionEncryptType
+type CancelTicketRequest struct {
+	Ticket status.Ticket `json:"ticket"`
+}
+
+func (rq *CancelTicketRequest) Decode(stream []byte) error {
+	return json.Unmarshal(stream, rq)
+}
+
+func (rq *CancelTicketRequest) Encode() ([]byte, error) {
+	return json.Marshal(rq)
 }
@@ -0,0 +1,405 @@
+/*
+	Registry of request type handlers
+	Handlers declare their lock needs, signers requirement and certifier permissions check
+*/
+
+package executor
+
+import (
+	"context"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/locker"
+	"github.com/mngharbi/DMPC/status"
+	"github.com/mngharbi/DMPC/users"
+	"sync"
+)
+
+/*
+	Errors
+*/
+
+var (
+	nilHandlerError            error = core.NewError(core.InvalidRequestErrorCode, "Request handler must define a handling function.")
+	duplicateHandlerError      error = core.NewError(core.InvalidRequestTypeErrorCode, "Request type already has a handler.")
+	uninitializedRegistryError error = core.NewError(core.InvalidRequestErrorCode, "Handlers can only be registered after the server is initialized.")
+	unverifiedRequestError     error = core.NewError(core.UnverifiedRequestErrorCode, "Request must be signed.")
+	unauthorizedRequestError   error = core.NewError(core.CertifierPermissionsErrorCode, "Request is not authorized.")
+)
+
+/*
+	Records to lock while a request is handled (locked as one ordered batch)
+*/
+type LockNeeds struct {
+	Channels []core.LockNeed
+	Users    []core.LockNeed
+}
+
+/*
+	Request as seen by handlers
+*/
+type Request struct {
+	wrapped *executorRequest
+	sv      *Server
+}
+
+func (rq *Request) Context() context.Context {
+	return rq.wrapped.ctx
+}
+
+func (rq *Request) IsVerified() bool {
+	return rq.wrapped.isVerified
+}
+
+func (rq *Request) MetaFields() *core.OperationMetaFields {
+	return rq.wrapped.metaFields
+}
+
+func (rq *Request) Signers() *core.VerifiedSigners {
+	return rq.wrapped.signers
+}
+
+func (rq *Request) Ticket() status.Ticket {
+	return rq.wrapped.ticket
+}
+
+func (rq *Request) Payload() []byte {
+	return rq.wrapped.request
+}
+
+// Certifier user object (only set if the handler checks certifier permissions)
+func (rq *Request) Certifier() *users.UserObject {
+	return rq.wrapped.certifier
+}
+
+func (rq *Request) Succeed(result interface{}) {
+	rq.sv.responseReporter(rq.wrapped.ticket, status.SuccessStatus, status.NoReason, result, nil)
+}
+
+func (rq *Request) Fail(result interface{}, errs []error) {
+	rq.sv.responseReporter(rq.wrapped.ticket, status.FailedStatus, status.FailedReason, result, errs)
+}
+
+func (rq *Request) Reject(errs []error) {
+	rq.sv.reportRejection(rq.wrapped.ticket, status.RejectedReason, errs)
+}
+
+/*
+	Definition of a request type handler
+*/
+type Handler func(*Request)
+
+type RequestHandler struct {
+	// Requests without signers are rejected (with UnverifiedError if set)
+	RequireSigners  bool
+	UnverifiedError error
+
+	// Certifier is read locked and read, then checked before handling (rejected with UnauthorizedError if set)
+	CheckCertifier    func(*users.UserObject) bool
+	UnauthorizedError error
+
+	// Unverified requests skip signers and certifier checks
+	TrustUnverified bool
+
+	// Records locked before handling and unlocked after
+	LockNeeds func(*Request) (*LockNeeds, error)
+
+	Handle Handler
+}
+
+/*
+	Registry
+*/
+
+type handlerRegistry struct {
+	lock     sync.RWMutex
+	handlers map[core.RequestType]*RequestHandler
+}
+
+func (registry *handlerRegistry) reset() {
+	registry.lock.Lock()
+	registry.handlers = map[core.RequestType]*RequestHandler{}
+	registry.lock.Unlock()
+}
+
+func (registry *handlerRegistry) register(requestType core.RequestType, handler *RequestHandler) error {
+	if handler == nil || handler.Handle == nil {
+		return nilHandlerError
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if registry.handlers == nil {
+		return uninitializedRegistryError
+	}
+	if _, exists := registry.handlers[requestType]; exists {
+		return duplicateHandlerError
+	}
+	registry.handlers[requestType] = handler
+	return nil
+}
+
+func (registry *handlerRegistry) get(requestType core.RequestType) *RequestHandler {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	return registry.handlers[requestType]
+}
+
+/*
+	Adds a handler for a request type
+	Server must be initialized first (initializing registers built-in handlers and drops any other handler)
+*/
+func RegisterHandler(requestType core.RequestType, handler *RequestHandler) error {
+	return defaultServer.RegisterHandler(requestType, handler)
+}
+
+func (sv *Server) RegisterHandler(requestType core.RequestType, handler *RequestHandler) error {
+	err := sv.registry.register(requestType, handler)
+	if err == nil {
+		sv.log.Debugf(registeredHandlerLogMsg, requestType)
+	}
+	return err
+}
+
+/*
+	Built-in handlers
+*/
+
+func wrapHandler(do func(*executorRequest)) Handler {
+	return func(rq *Request) {
+		do(rq.wrapped)
+	}
+}
+
+func channelLockNeeds(lockType core.LockType) func(*Request) (*LockNeeds, error) {
+	return func(rq *Request) (*LockNeeds, error) {
+		return &LockNeeds{
+			Channels: []core.LockNeed{
+				{
+					LockType: lockType,
+					Id:       rq.wrapped.metaFields.ChannelId,
+				},
+			},
+		}, nil
+	}
+}
+
+func (sv *Server) registerBuiltinHandlers() {
+	sv.registry.reset()
+	builtinHandlers := map[core.RequestType]*RequestHandler{
+		core.UsersRequestType: {
+			LockNeeds: usersRequestLockNeeds,
+			Handle:    wrapHandler(sv.doGenericUsersRequest),
+		},
+		core.AddMessageType: {
+			LockNeeds: channelLockNeeds(core.WriteLockType),
+			Handle:    wrapHandler(sv.doAddMessage),
+		},
+		core.ReadChannelType: {
+			CheckCertifier: func(certifier *users.UserObject) bool {
+				return certifier.Permissions.Channel.Read
+			},
+			UnauthorizedError: channelReadUnauthorizedError,
+			LockNeeds:         channelLockNeeds(core.ReadLockType),
+			Handle:            wrapHandler(sv.doReadChannel),
+		},
+		core.ListChannelsType: {
+			RequireSigners:  true,
+			UnverifiedError: unverifiedChannelListError,
+			CheckCertifier: func(certifier *users.UserObject) bool {
+				return certifier.Permissions.Channel.Read
+			},
+			UnauthorizedError: channelReadUnauthorizedError,
+			Handle:            wrapHandler(sv.doListChannels),
+		},
+		core.AddChannelType: {
+			RequireSigners:  true,
+			UnverifiedError: unverifiedChannelOpenError,
+			CheckCertifier: func(certifier *users.UserObject) bool {
+				return certifier.Permissions.Channel.Add
+			},
+			UnauthorizedError: channelOpenUnauthorizedError,
+			LockNeeds:         channelLockNeeds(core.WriteLockType),
+			Handle:            wrapHandler(sv.doAddChannel),
+		},
+		core.CloseChannelType: {
+			RequireSigners:  true,
+			UnverifiedError: unverifiedChannelOpenError,
+			LockNeeds:       channelLockNeeds(core.WriteLockType),
+			Handle:          wrapHandler(sv.doCloseChannel),
+		},
+		core.SubscribeChannelType: {
+			RequireSigners:  true,
+			UnverifiedError: unverifiedChannelSubscribeError,
+			LockNeeds:       channelLockNeeds(core.ReadLockType),
+			Handle:          wrapHandler(sv.doSubscribeChannel),
+		},
+		core.ChannelEncryptType: {
+			RequireSigners: true,
+			LockNeeds:      channelLockNeeds(core.ReadLockType),
+			Handle:         wrapHandler(sv.doChannelEncrypt),
+		},
+		core.TransactionEncryptType: {
+			LockNeeds: transactionEncryptLockNeeds,
+			Handle:    wrapHandler(sv.doTransactionEncrypt),
+		},
+		core.CancelTicketType: {
+			RequireSigners:  true,
+			UnverifiedError: cancelTicketUnverifiedError,
+			TrustUnverified: true,
+			Handle:          wrapHandler(sv.doCancelTicket),
+		},
+		core.LockerAdminType: {
+			RequireSigners:  true,
+			UnverifiedError: lockerAdminUnverifiedError,
+			CheckCertifier: func(certifier *users.UserObject) bool {
+				return certifier.Permissions.User.PermissionsUpdate
+			},
+			UnauthorizedError: lockerAdminUnauthorizedError,
+			TrustUnverified:   true,
+			Handle:            wrapHandler(sv.doLockerAdmin),
+		},
+		core.ChannelsAdminType: {
+			RequireSigners:  true,
+			UnverifiedError: channelsAdminUnverifiedError,
+			CheckCertifier: func(certifier *users.UserObject) bool {
+				return certifier.Permissions.User.PermissionsUpdate
+			},
+			UnauthorizedError: channelsAdminUnauthorizedError,
+			TrustUnverified:   true,
+			Handle:            wrapHandler(sv.doChannelsAdmin),
+		},
+	}
+	for requestType, handler := range builtinHandlers {
+		sv.registry.register(requestType, handler)
+	}
+}
+
+/*
+	Running a request through its handler
+*/
+
+func (sv *Server) runHandler(handler *RequestHandler, wrappedRequest *executorRequest) {
+	rq := &Request{
+		wrapped: wrappedRequest,
+		sv:      sv,
+	}
+
+	// Check signers
+	runChecks := wrappedRequest.isVerified || !handler.TrustUnverified
+	checkCertifier := runChecks && handler.CheckCertifier != nil
+	if (checkCertifier || runChecks && handler.RequireSigners) && wrappedRequest.signers == nil {
+		rq.Reject([]error{errorOrDefault(handler.UnverifiedError, unverifiedRequestError)})
+		return
+	}
+
+	// Determine lock needs (certifier is read locked if checked)
+	lockNeeds := &LockNeeds{}
+	if handler.LockNeeds != nil {
+		var err error
+		if lockNeeds, err = handler.LockNeeds(rq); err != nil {
+			rq.Reject([]error{err})
+			return
+		}
+	}
+	if checkCertifier {
+		lockNeeds.Users = append(lockNeeds.Users, generateReadLockNeeds(wrappedRequest.signers.CertifierId)...)
+	}
+
+	// Lock/Unlock
+	if len(lockNeeds.Channels) != 0 || len(lockNeeds.Users) != 0 {
+		if !sv.makeLockRequest(wrappedRequest, core.Locking, lockNeeds.Channels, lockNeeds.Users) {
+			return
+		}
+		defer sv.makeLockRequest(wrappedRequest, core.Unlocking, lockNeeds.Channels, lockNeeds.Users)
+	}
+
+	// Check certifier permissions
+	if checkCertifier {
+		userResponsePtr := sv.readCertifier(wrappedRequest)
+		if userResponsePtr == nil {
+			return
+		}
+		if len(userResponsePtr.Data) != 1 || !handler.CheckCertifier(&userResponsePtr.Data[0]) {
+			rq.Reject([]error{errorOrDefault(handler.UnauthorizedError, unauthorizedRequestError)})
+			return
+		}
+		wrappedRequest.certifier = &userResponsePtr.Data[0]
+	}
+
+	handler.Handle(rq)
+}
+
+func errorOrDefault(err error, defaultErr error) error {
+	if err != nil {
+		return err
+	}
+	return defaultErr
+}
+
+/*
+	Locking helpers
+*/
+
+func generateReadLockNeeds(ids ...string) []core.LockNeed {
+	needs := []core.LockNeed{}
+	for _, id := range ids {
+		needs = append(needs, core.LockNeed{
+			LockType: core.ReadLockType,
+			Id:       id,
+		})
+	}
+	return needs
+}
+
+/*
+	Builds one locker request for channel and user records (locked as an ordered batch)
+*/
+func generateLockRequest(ticketId status.Ticket, lockingType core.LockingType, channelNeeds []core.LockNeed, userNeeds []core.LockNeed) *locker.LockerRequest {
+	lockRequest := &locker.LockerRequest{
+		Type:        locker.ChannelLock,
+		LockingType: lockingType,
+		Owner:       string(ticketId),
+		Needs:       channelNeeds,
+	}
+	if len(channelNeeds) == 0 {
+		lockRequest.Type = locker.UserLock
+		lockRequest.Needs = userNeeds
+	} else if len(userNeeds) != 0 {
+		lockRequest.Batch = []locker.ResourceNeeds{
+			{
+				Type:  locker.UserLock,
+				Needs: userNeeds,
+			},
+		}
+	}
+	return lockRequest
+}
+
+func (sv *Server) makeLockRequest(wrappedRequest *executorRequest, lockingType core.LockingType, channelNeeds []core.LockNeed, userNeeds []core.LockNeed) bool {
+	// Unlocking is always done regardless of the request context
+	ctx := wrappedRequest.ctx
+	if lockingType == core.Unlocking {
+		ctx = context.Background()
+	}
+
+	// Make lock request
+	lockRequest := generateLockRequest(wrappedRequest.ticket, lockingType, channelNeeds, userNeeds)
+	lockChannel, errs := sv.lockerRequester(ctx, lockRequest)
+	if len(errs) != 0 {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, errs)
+		return false
+	}
+
+	// Wait for lock
+	select {
+	case lockResult := <-lockChannel:
+		if !lockResult {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
+			return false
+		}
+		return true
+	case <-ctx.Done():
+		sv.reportContextDone(wrappedRequest)
+		return false
+	}
+}
@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/status"
+)
+
+/*
+	Errors
+*/
+
+var (
+	cancelTicketFormatError     error = core.NewError(core.InvalidFormatErrorCode, "Cancel ticket request format invalid.")
+	cancelTicketNotFoundError   error = core.NewError(core.TicketNotFoundErrorCode, "Ticket is not pending.")
+	cancelTicketPermissionError error = core.NewError(core.CertifierPermissionsErrorCode, "Only the issuer of a request can cancel it.")
+	cancelTicketUnverifiedError error = core.NewError(core.UnverifiedRequestErrorCode, "Cancel ticket request must be signed.")
+)
+
+/*
+	Cancel ticket
+*/
+
+func (sv *Server) doCancelTicket(wrappedRequest *executorRequest) {
+	// Decode request
+	request := &CancelTicketRequest{}
+	if err := request.Decode(wrappedRequest.request); err != nil {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{cancelTicketFormatError})
+		return
+	}
+
+	// Find pending request
+	pending := sv.getPendingRequest(request.Ticket)
+	if pending == nil || request.Ticket == wrappedRequest.ticket {
+		sv.reportRejection(wrappedRequest.ticket, status.FailedReason, []error{cancelTicketNotFoundError})
+		return
+	}
+	// Cancellation must come from the original issuer (unverified requests skip this check)
+	if wrappedRequest.isVerified && pending.issuerId != wrappedRequest.signers.IssuerId {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{cancelTicketPermissionError})
+		return
+	}
+
+	// Cancel (pending request reports its cancelled status)
+	sv.log.Debugf(cancelTicketLogMsg, request.Ticket)
+	pending.cancel()
+
+	sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, nil, nil)
+}
@@ -7,11 +7,75 @@ import (
 	"github.com/mngharbi/DMPC/users"
 )
 
+/*
+	Helpers
+*/
+
+/*
+	Reads user records (callers are expected to hold read locks on them)
+*/
+func (sv *Server) readUsers(wrappedRequest *executorRequest, usersRequester users.Requester, signers *core.VerifiedSigners, userIds []string) *users.UserResponse {
+	usersRequest := &users.UserRequest{
+		Type:      users.ReadRequest,
+		Timestamp: wrappedRequest.metaFields.Timestamp,
+		Fields:    userIds,
+	}
+	encodedUsersRequest, _ := usersRequest.Encode()
+	usersSubsystemResponse, errs := usersRequester(wrappedRequest.ctx, signers, encodedUsersRequest)
+	if len(errs) != 0 {
+		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
+		return nil
+	}
+	select {
+	case userResponsePtr, ok := <-usersSubsystemResponse:
+		if !ok {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+			return nil
+		}
+		if userResponsePtr.Result != users.Success {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{userResponsePtr.GetError()})
+			return nil
+		}
+		return userResponsePtr
+	case <-wrappedRequest.ctx.Done():
+		sv.reportContextDone(wrappedRequest)
+		return nil
+	}
+}
+
+func (sv *Server) readCertifier(wrappedRequest *executorRequest) *users.UserResponse {
+	return sv.readUsers(wrappedRequest, sv.usersRequesterUnverified, nil, []string{wrappedRequest.signers.CertifierId})
+}
+
 /*
 	User request
 */
 
-func (sv *server) doGenericUsersRequest(wrappedRequest *executorRequest) {
+// Signers are read locked, subjects are write locked if created or updated and read locked if read
+// (malformed requests are left to the users subsystem to reject)
+func usersRequestLockNeeds(rq *Request) (*LockNeeds, error) {
+	lockNeeds := &LockNeeds{}
+	if signers := rq.Signers(); signers != nil {
+		lockNeeds.Users = generateReadLockNeeds(signers.IssuerId, signers.CertifierId)
+	}
+
+	usersRequest := &users.UserRequest{}
+	if err := usersRequest.Decode(rq.Payload()); err != nil {
+		return lockNeeds, nil
+	}
+	switch usersRequest.Type {
+	case users.CreateRequest, users.UpdateRequest:
+		lockNeeds.Users = append(lockNeeds.Users, core.LockNeed{
+			LockType: core.WriteLockType,
+			Id:       usersRequest.Data.Id,
+		})
+	case users.ReadRequest:
+		lockNeeds.Users = append(lockNeeds.Users, generateReadLockNeeds(usersRequest.Fields...)...)
+	}
+	return lockNeeds, nil
+}
+
+func (sv *Server) doGenericUsersRequest(wrappedRequest *executorRequest) {
 	// Determine lambda to use based on whether the request is verified or not
 	var usersRequester users.Requester
 	if wrappedRequest.isVerified {
@@ -20,24 +84,31 @@ func (sv *server) doGenericUsersRequest(wrappedRequest *executorRequest) {
 		usersRequester = sv.usersRequesterUnverified
 	}
 
-	// Make the request to users subsystem (not leaving it locked)
-	channel, errs := usersRequester(wrappedRequest.signers, true, true, wrappedRequest.request)
+	// Make the request to users subsystem
+	channel, errs := usersRequester(wrappedRequest.ctx, wrappedRequest.signers, wrappedRequest.request)
 	if errs != nil {
 		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, errs)
 		return
 	}
 
 	// Wait for response from users subsystem
-	userResponsePtr, ok := <-channel
-	if !ok {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+	var userResponsePtr *users.UserResponse
+	var ok bool
+	select {
+	case userResponsePtr, ok = <-channel:
+		if !ok {
+			sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
+			return
+		}
+	case <-wrappedRequest.ctx.Done():
+		sv.reportContextDone(wrappedRequest)
 		return
 	}
 
 	// Handle failure after running the request
 	userReponseEncoded, _ := userResponsePtr.Encode()
 	if userResponsePtr.Result != users.Success {
-		sv.responseReporter(wrappedRequest.ticket, status.FailedStatus, status.FailedReason, userReponseEncoded, nil)
+		sv.responseReporter(wrappedRequest.ticket, status.FailedStatus, status.FailedReason, userReponseEncoded, []error{userResponsePtr.GetError()})
 	} else {
 		sv.responseReporter(wrappedRequest.ticket, status.SuccessStatus, status.NoReason, userReponseEncoded, nil)
 	}
@@ -47,7 +118,26 @@ func (sv *server) doGenericUsersRequest(wrappedRequest *executorRequest) {
 	Encrypt transaction
 */
 
-func (sv *server) doTransactionEncrypt(wrappedRequest *executorRequest) {
+func getTransactionReceipientIds(ts *core.Transaction) []string {
+	receipientIds := []string{}
+	for receipientId := range ts.Encryption.Challenges {
+		receipientIds = append(receipientIds, receipientId)
+	}
+	return receipientIds
+}
+
+// Transaction receipients are read locked
+func transactionEncryptLockNeeds(rq *Request) (*LockNeeds, error) {
+	ts := &core.Transaction{}
+	if err := ts.Decode(rq.Payload()); err != nil {
+		return nil, transactionEncryptOperationFormatError
+	}
+	return &LockNeeds{
+		Users: generateReadLockNeeds(getTransactionReceipientIds(ts)...),
+	}, nil
+}
+
+func (sv *Server) doTransactionEncrypt(wrappedRequest *executorRequest) {
 	// Interpret payload as transaction json
 	ts := &core.Transaction{}
 	err := ts.Decode([]byte(wrappedRequest.request))
@@ -56,35 +146,11 @@ func (sv *server) doTransactionEncrypt(wrappedRequest *executorRequest) {
 		return
 	}
 
-	// Get and RLock transaction receipients
-	receipientIds := []string{}
-	for receipientId := range ts.Encryption.Challenges {
-		receipientIds = append(receipientIds, receipientId)
-	}
-	usersRequest := &users.UserRequest{
-		Type:      users.ReadRequest,
-		Timestamp: wrappedRequest.metaFields.Timestamp,
-		Fields:    receipientIds,
-	}
-	encodedUsersRequest, _ := usersRequest.Encode()
-	usersSubsystemResponse, errs := sv.usersRequester(wrappedRequest.signers, true, false, encodedUsersRequest)
-	if len(errs) != 0 {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
-		return
-	}
-	userResponsePtr, ok := <-usersSubsystemResponse
-	if !ok {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{subsystemChannelClosed})
-		return
-	}
-	if userResponsePtr.Result != users.Success {
-		sv.reportRejection(wrappedRequest.ticket, status.RejectedReason, []error{requestRejectedError})
+	// Read transaction receipients (read locked by the handler)
+	userResponsePtr := sv.readUsers(wrappedRequest, sv.usersRequester, wrappedRequest.signers, getTransactionReceipientIds(ts))
+	if userResponsePtr == nil {
 		return
 	}
-	defer func() {
-		usersSubsystemResponse, _ = sv.usersRequester(wrappedRequest.signers, false, true, encodedUsersRequest)
-		_ = <-usersSubsystemResponse
-	}()
 
 	// Build keys array
 	keys := []*rsa.PublicKey{}
@@ -1,7 +1,6 @@
 package keys
 
 import (
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
@@ -11,17 +10,9 @@ import (
 	Errors
 */
 var (
-	invalidRequestFormatError error = errors.New("Invalid request format.")
-	addingKeyFailedError      error = errors.New("Failed to add key.")
-	encryptionFailedError     error = errors.New("Failed to do encryption operation.")
-)
-
-/*
-	Logging
-*/
-var (
-	log             *core.LoggingHandler
-	shutdownProgram core.ShutdownLambda
+	invalidRequestFormatError error = core.NewError(core.InvalidFormatErrorCode, "Invalid request format.")
+	addingKeyFailedError      error = core.NewError(core.RequestFailedErrorCode, "Failed to add key.")
+	encryptionFailedError     error = core.NewError(core.EncryptionFailedErrorCode, "Failed to do encryption operation.")
 )
 
 /*
@@ -34,44 +25,60 @@ type Config struct {
 	NumWorkers int
 }
 
-type server struct {
+/*
+	Keys instance (package functions use a default instance)
+*/
+type Server struct {
 	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
 	store         *memstore.Memstore
+
+	// Logging and fatal error handling
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+
+	// Request metrics
+	metrics *core.SubsystemMetrics
 }
 
-var (
-	serverSingleton server
-	serverHandler   *gofarm.ServerHandler
-)
+func NewServer(metricsRegistry *core.MetricsRegistry) *Server {
+	return &Server{
+		handler: core.ProvisionServer(),
+		metrics: core.NewSubsystemMetrics(metricsRegistry, "keys"),
+	}
+}
+
+var defaultServer *Server = NewServer(core.Metrics)
+
+// Instance used by package functions
+func DefaultServer() *Server {
+	return defaultServer
+}
 
 /*
 	Server helpers
 */
 
-func provisionServerOnce() {
-	if serverHandler == nil {
-		serverHandler = gofarm.ProvisionServer()
-	}
-}
-
-func makeGenericRequest(rqPtr *keyRequest) (chan *gofarm.Response, error) {
+func (sv *Server) makeGenericRequest(rqPtr *keyRequest) (chan *gofarm.Response, error) {
 	// Validate request
 	if !rqPtr.validate() {
 		return nil, invalidRequestFormatError
 	}
 
 	// Make request to server
-	nativeResponseChannel, err := serverHandler.MakeRequest(rqPtr)
+	nativeResponseChannel, err := sv.handler.MakeRequest(rqPtr)
 	if err != nil {
 		return nil, err
 	}
+	sv.metrics.Queued()
 
 	return nativeResponseChannel, nil
 }
 
-func makeGenericEncryptionRequest(request *keyRequest) ([]byte, error) {
+func (sv *Server) makeGenericEncryptionRequest(request *keyRequest) ([]byte, error) {
 	// Make request
-	nativeResponseChannel, err := makeGenericRequest(request)
+	nativeResponseChannel, err := sv.makeGenericRequest(request)
 	if err != nil {
 		return nil, err
 	}
@@ -97,24 +104,67 @@ func StartServer(
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) error {
-	provisionServerOnce()
-	if !serverSingleton.isInitialized {
-		log = loggingHandler
-		shutdownProgram = shutdownLambda
-		serverSingleton.isInitialized = true
-		serverHandler.ResetServer()
-		serverHandler.InitServer(&serverSingleton)
-	}
-	return serverHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	return defaultServer.StartServer(conf, loggingHandler, shutdownLambda)
 }
 
 func ShutdownServer() {
-	provisionServerOnce()
-	serverHandler.ShutdownServer()
+	defaultServer.ShutdownServer()
+}
+
+func ResizeServer(conf Config) error {
+	return defaultServer.ResizeServer(conf)
+}
+
+func IsRunning() bool {
+	return defaultServer.IsRunning()
 }
 
 func AddKey(keyId string, key []byte) error {
-	nativeResponseChannel, err := makeGenericRequest(&keyRequest{
+	return defaultServer.AddKey(keyId, key)
+}
+
+func Encrypt(keyId string, plaintext []byte) ([]byte, []byte, error) {
+	return defaultServer.Encrypt(keyId, plaintext)
+}
+
+func Decrypt(keyId string, nonce []byte, ciphertext []byte) ([]byte, error) {
+	return defaultServer.Decrypt(keyId, nonce, ciphertext)
+}
+
+/*
+	Instance API
+*/
+
+func (sv *Server) StartServer(
+	conf Config,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) error {
+	if !sv.isInitialized {
+		sv.log = loggingHandler
+		sv.shutdownProgram = shutdownLambda
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
+	}
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) ShutdownServer() {
+	sv.handler.ShutdownServer()
+}
+
+// Running requests are not dropped
+func (sv *Server) ResizeServer(conf Config) error {
+	return sv.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) IsRunning() bool {
+	return sv.state.IsRunning()
+}
+
+func (sv *Server) AddKey(keyId string, key []byte) error {
+	nativeResponseChannel, err := sv.makeGenericRequest(&keyRequest{
 		Type:    AddKeyRequest,
 		KeyId:   keyId,
 		Payload: key,
@@ -132,10 +182,10 @@ func AddKey(keyId string, key []byte) error {
 	return addingKeyFailedError
 }
 
-func Encrypt(keyId string, plaintext []byte) ([]byte, []byte, error) {
+func (sv *Server) Encrypt(keyId string, plaintext []byte) ([]byte, []byte, error) {
 	nonce := core.GenerateSymmetricNonce()
 
-	encrypted, err := makeGenericEncryptionRequest(&keyRequest{
+	encrypted, err := sv.makeGenericEncryptionRequest(&keyRequest{
 		Type:    EncryptRequest,
 		KeyId:   keyId,
 		Payload: plaintext,
@@ -148,8 +198,8 @@ func Encrypt(keyId string, plaintext []byte) ([]byte, []byte, error) {
 	return encrypted, nonce, nil
 }
 
-func Decrypt(keyId string, nonce []byte, ciphertext []byte) ([]byte, error) {
-	decrypted, err := makeGenericEncryptionRequest(&keyRequest{
+func (sv *Server) Decrypt(keyId string, nonce []byte, ciphertext []byte) ([]byte, error) {
+	decrypted, err := sv.makeGenericEncryptionRequest(&keyRequest{
 		Type:    DecryptRequest,
 		KeyId:   keyId,
 		Payload: ciphertext,
@@ -166,37 +216,47 @@ func Decrypt(keyId string, nonce []byte, ciphertext []byte) ([]byte, error) {
 	Server implementation
 */
 
-func (sv *server) Start(_ gofarm.Config, isFirstStart bool) error {
+func (sv *Server) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize store (only if starting for the first time)
 	if isFirstStart {
 		sv.store = memstore.New(getIndexes())
 	}
-	log.Debugf(daemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.log.Debugf(daemonStartLogMsg)
 	return nil
 }
 
-func (sv *server) Shutdown() error {
-	log.Debugf(daemonShutdownLogMsg)
+func (sv *Server) Shutdown() error {
+	sv.state.SetRunning(false)
+	sv.log.Debugf(daemonShutdownLogMsg)
 	return nil
 }
 
-func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
-	log.Debugf(runningRequestLogMsg)
+func (sv *Server) Work(request *gofarm.Request) *gofarm.Response {
+	sv.log.Debugf(runningRequestLogMsg)
 
 	rqPtr := (*request).(*keyRequest)
 
+	observation := sv.metrics.Start(requestTypeLabel(rqPtr.Type))
+	response := sv.doRequest(rqPtr)
+	observation.DoneWithSuccess(response != nil && (*response).(*keyResponse).Result == Success)
+
+	return response
+}
+
+func (sv *Server) doRequest(rqPtr *keyRequest) *gofarm.Response {
 	/*
 		Run request
 	*/
 	switch rqPtr.Type {
 	case AddKeyRequest:
 		sv.store.AddOrGet(rqPtr.makeRecord())
-		return successRequest(nil)
+		return sv.successRequest(nil)
 	case DecryptRequest:
 		// Get key
 		storedRecord := sv.store.Get(rqPtr.makeSearchRecord(), recordIdIndex)
 		if storedRecord == nil {
-			return failRequest(DecryptionFailure)
+			return sv.failRequest(DecryptionFailure)
 		}
 
 		// Decrypt
@@ -208,15 +268,15 @@ func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
 			rqPtr.Payload,
 		)
 		if err != nil {
-			return failRequest(DecryptionFailure)
+			return sv.failRequest(DecryptionFailure)
 		} else {
-			return successRequest(decrypted)
+			return sv.successRequest(decrypted)
 		}
 	case EncryptRequest:
 		// Get key
 		storedRecord := sv.store.Get(rqPtr.makeSearchRecord(), recordIdIndex)
 		if storedRecord == nil {
-			return failRequest(EncryptionFailure)
+			return sv.failRequest(EncryptionFailure)
 		}
 
 		// Encrypt
@@ -227,14 +287,14 @@ func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
 			rqPtr.Nonce,
 			rqPtr.Payload,
 		)
-		return successRequest(payloadCiphertext)
+		return sv.successRequest(payloadCiphertext)
 	}
 
 	return nil
 }
 
-func failRequest(responseCode keyResponseCode) *gofarm.Response {
-	log.Debugf(failRequestLogMsg)
+func (sv *Server) failRequest(responseCode keyResponseCode) *gofarm.Response {
+	sv.log.Debugf(failRequestLogMsg)
 	userRespPtr := &keyResponse{
 		Result: responseCode,
 	}
@@ -242,8 +302,8 @@ func failRequest(responseCode keyResponseCode) *gofarm.Response {
 	return &nativeResp
 }
 
-func successRequest(payload []byte) *gofarm.Response {
-	log.Debugf(successRequestLogMsg)
+func (sv *Server) successRequest(payload []byte) *gofarm.Response {
+	sv.log.Debugf(successRequestLogMsg)
 	userRespPtr := &keyResponse{
 		Result:  Success,
 		Payload: payload,
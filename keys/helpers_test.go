@@ -20,7 +20,7 @@ func resetAndStartServer(t *testing.T) bool {
 }
 
 func resetServer() {
-	serverSingleton = server{}
+	defaultServer = NewServer(core.Metrics)
 }
 
 func startServer(t *testing.T) bool {
@@ -58,7 +58,7 @@ func makeAddKeyRequest(t *testing.T, keyId string, key []byte) error {
 }
 
 func getKeyRecordById(id string) *keyRecord {
-	item := serverSingleton.store.Get(&keyRecord{Id: id}, recordIdIndex)
+	item := defaultServer.store.Get(&keyRecord{Id: id}, recordIdIndex)
 	if item != nil {
 		return item.(*keyRecord)
 	} else {
@@ -0,0 +1,17 @@
+package keys
+
+/*
+	Request type labels of request metrics
+*/
+var requestTypeLabels map[keyRequestType]string = map[keyRequestType]string{
+	AddKeyRequest:  "add",
+	EncryptRequest: "encrypt",
+	DecryptRequest: "decrypt",
+}
+
+func requestTypeLabel(requestType keyRequestType) string {
+	if label, ok := requestTypeLabels[requestType]; ok {
+		return label
+	}
+	return "unknown"
+}
@@ -0,0 +1,110 @@
+/*
+	Administration of the locker (lock timeout and diagnostics)
+*/
+
+package locker
+
+import (
+	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Admin request/response structures
+*/
+
+type AdminAction string
+
+const (
+	WaitForGraphAction   AdminAction = "wait_for_graph"
+	SetLockTimeoutAction AdminAction = "set_lock_timeout"
+)
+
+type AdminRequest struct {
+	Action AdminAction `json:"action"`
+
+	// Maximum time to wait for locks in milliseconds (no limit if zero)
+	LockTimeout int `json:"lockTimeout"`
+}
+
+func (rq *AdminRequest) Decode(stream []byte) error {
+	return json.Unmarshal(stream, rq)
+}
+
+func (rq *AdminRequest) Encode() ([]byte, error) {
+	return json.Marshal(rq)
+}
+
+type AdminResponse struct {
+	LockTimeout int           `json:"lockTimeout"`
+	Graph       *WaitForGraph `json:"graph,omitempty"`
+}
+
+func (resp *AdminResponse) Encode() ([]byte, error) {
+	return json.Marshal(resp)
+}
+
+func (resp *AdminResponse) Decode(stream []byte) error {
+	return json.Unmarshal(stream, resp)
+}
+
+/*
+	Admin requester type
+*/
+type AdminRequester func(*AdminRequest) (*AdminResponse, error)
+
+/*
+	Errors
+*/
+
+const (
+	unknownAdminActionErrorMsg string = "Unknown locker admin action"
+	invalidLockTimeoutErrorMsg string = "Lock timeout cannot be negative"
+)
+
+/*
+	Admin API
+*/
+
+func Admin(rq *AdminRequest) (*AdminResponse, error) {
+	return defaultServer.Admin(rq)
+}
+
+func (sv *Server) Admin(rq *AdminRequest) (*AdminResponse, error) {
+	switch rq.Action {
+	case WaitForGraphAction:
+		sv.log.Debugf(waitForGraphLogMsg)
+		return &AdminResponse{
+			LockTimeout: sv.getLockTimeout(),
+			Graph:       sv.buildWaitForGraph(),
+		}, nil
+	case SetLockTimeoutAction:
+		if rq.LockTimeout < 0 {
+			return nil, core.NewError(core.InvalidRequestErrorCode, invalidLockTimeoutErrorMsg)
+		}
+		sv.log.Infof(setLockTimeoutLogMsg, rq.LockTimeout)
+		sv.setLockTimeout(rq.LockTimeout)
+		return &AdminResponse{
+			LockTimeout: sv.getLockTimeout(),
+		}, nil
+	}
+	return nil, core.NewError(core.InvalidRequestErrorCode, unknownAdminActionErrorMsg)
+}
+
+/*
+	Lock timeout (milliseconds)
+*/
+
+func (sv *Server) getLockTimeout() int {
+	return int(atomic.LoadInt64(&sv.lockTimeout))
+}
+
+func (sv *Server) setLockTimeout(timeout int) {
+	atomic.StoreInt64(&sv.lockTimeout, int64(timeout))
+}
+
+func (sv *Server) getLockTimeoutDuration() time.Duration {
+	return time.Duration(sv.getLockTimeout()) * time.Millisecond
+}
@@ -1,6 +1,7 @@
 package locker
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
@@ -8,12 +9,27 @@ import (
 )
 
 /*
-	Server structure
+	Locker instance (package functions use a default instance)
 */
 
-type server struct {
+type Server struct {
 	isInitialized bool
-	lockStores    [1]*memstore.Memstore
+	state         core.ServerState
+	handler       *core.ServerHandler
+	lockStores    [numResourceTypes]*memstore.Memstore
+
+	// Logging and fatal error handling
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+
+	// Request metrics (lock requests are observed until the result is delivered)
+	metrics *core.SubsystemMetrics
+
+	// Resource records by id (used for diagnostics)
+	resources [numResourceTypes]*sync.Map
+
+	// Maximum time to wait for locks in milliseconds (no limit if zero)
+	lockTimeout int64
 }
 
 /*
@@ -25,61 +41,123 @@ var indexesMap map[string]bool = map[string]bool{
 	"id": true,
 }
 
-// Server object
-var serverSingleton server
+func NewServer(metricsRegistry *core.MetricsRegistry) *Server {
+	return &Server{
+		handler: core.ProvisionServer(),
+		metrics: core.NewSubsystemMetrics(metricsRegistry, "locker"),
+	}
+}
+
+var defaultServer *Server = NewServer(core.Metrics)
+
+// Instance used by package functions
+func DefaultServer() *Server {
+	return defaultServer
+}
 
 /*
 	Server implementation
 */
-func (sv *server) Start(_ gofarm.Config, isFirstStart bool) error {
+func (sv *Server) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize stores (only if starting for the first time)
 	if isFirstStart {
 		for storeIndex := range sv.lockStores {
 			sv.lockStores[storeIndex] = memstore.New(getIndexes())
+			sv.resources[storeIndex] = &sync.Map{}
 		}
 	}
-	log.Debugf(daemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.log.Debugf(daemonStartLogMsg)
 	return nil
 }
 
-func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
-	log.Debugf(runningRequestLogMsg)
+func (sv *Server) Work(request *gofarm.Request) *gofarm.Response {
+	sv.log.Debugf(runningRequestLogMsg)
 
 	rq := (*request).(*LockerRequest)
 
-	// Determine memstore based on resource type requested
-	targetMemstore := sv.lockStores[rq.Type]
+	// Group needs by resource type in locking order
+	orderedNeeds := rq.getOrderedNeeds()
+
+	// Observed until the result is delivered
+	requestType := unlockRequestLabel
+	if rq.LockingType == core.Locking {
+		requestType = lockRequestLabel
+	}
+	observation := sv.metrics.Start(requestType)
 
 	// Build channel and push result from locking into it in separate goroutine
 	responseChannel := make(chan bool)
 	go func() {
+		delivered := false
+		defer func() {
+			observation.DoneWithSuccess(delivered)
+		}()
+
 		if rq.LockingType == core.Locking {
 			// Create and lock resource records if they don't exist
 			// @TODO: include this in lockresources
-			for _, need := range rq.Needs {
-				newResourceRecord := &resourceRecord{
-					Id:   need.Id,
-					lock: &sync.RWMutex{},
+			for _, resourceNeeds := range orderedNeeds {
+				for _, need := range resourceNeeds.Needs {
+					newResourceRecord := &resourceRecord{
+						Id:   need.Id,
+						lock: core.NewTimedRWMutex(),
+					}
+					record := sv.lockStores[resourceNeeds.Type].AddOrGet(newResourceRecord)
+					sv.resources[resourceNeeds.Type].LoadOrStore(need.Id, record)
 				}
-				targetMemstore.AddOrGet(newResourceRecord)
 			}
 
-			responseChannel <- lockResources(targetMemstore, rq.Needs)
+			// Stop waiting for locks after timeout (partially held locks are rolled back)
+			ctx := rq.ctx
+			if timeout := sv.getLockTimeoutDuration(); timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(rq.ctx, timeout)
+				defer cancel()
+			}
+			lockingSuccess := sv.lockBatch(ctx, orderedNeeds, rq.Owner)
+			if !lockingSuccess && ctx.Err() == context.DeadlineExceeded && rq.ctx.Err() == nil {
+				sv.log.With(core.TicketLogField, rq.Owner).Warnf(lockTimeoutLogMsg, rq.Owner)
+			}
+
+			// Roll back locks acquired if requester stopped waiting
+			rollback := func() {
+				if lockingSuccess {
+					sv.unlockBatch(orderedNeeds, rq.Owner)
+				}
+				sv.log.Debugf(rollbackRequestLogMsg)
+			}
+			if rq.ctx.Err() != nil {
+				rollback()
+				return
+			}
+			select {
+			case responseChannel <- lockingSuccess:
+				delivered = lockingSuccess
+			case <-rq.ctx.Done():
+				rollback()
+			}
 		} else {
 			// @TODO: clean up resource after unlocking
-			responseChannel <- unlockResources(targetMemstore, rq.Needs)
+			unlockingSuccess := sv.unlockBatch(orderedNeeds, rq.Owner)
+			select {
+			case responseChannel <- unlockingSuccess:
+				delivered = unlockingSuccess
+			case <-rq.ctx.Done():
+			}
 		}
 	}()
 
 	// Log request done
-	log.Debugf(doneRequestLogMsg)
+	sv.log.Debugf(doneRequestLogMsg)
 
 	var nativeResp gofarm.Response = responseChannel
 	return &nativeResp
 }
 
-func (sv *server) Shutdown() error {
-	log.Debugf(daemonShutdownLogMsg)
+func (sv *Server) Shutdown() error {
+	sv.state.SetRunning(false)
+	sv.log.Debugf(daemonShutdownLogMsg)
 	return nil
 }
 
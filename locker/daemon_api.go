@@ -1,6 +1,7 @@
 package locker
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 )
@@ -8,30 +9,17 @@ import (
 /*
 	Requester type
 */
-type Requester func(*LockerRequest) (chan bool, []error)
-
-/*
-	Logging
-*/
-var (
-	log             *core.LoggingHandler
-	shutdownProgram core.ShutdownLambda
-)
+type Requester func(context.Context, *LockerRequest) (chan bool, []error)
 
 /*
 	Server API
 */
 
-var serverHandler *gofarm.ServerHandler
-
 type Config struct {
 	NumWorkers int
-}
 
-func provisionServerOnce() {
-	if serverHandler == nil {
-		serverHandler = gofarm.ProvisionServer()
-	}
+	// Maximum time to wait for locks in milliseconds (no limit if zero)
+	LockTimeout int
 }
 
 func StartServer(
@@ -39,34 +27,77 @@ func StartServer(
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) error {
-	provisionServerOnce()
-	if !serverSingleton.isInitialized {
-		log = loggingHandler
-		shutdownProgram = shutdownLambda
-		serverSingleton.isInitialized = true
-		serverHandler.ResetServer()
-		serverHandler.InitServer(&serverSingleton)
-	}
-	return serverHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	return defaultServer.StartServer(conf, loggingHandler, shutdownLambda)
 }
 
 func ShutdownServer() {
-	provisionServerOnce()
-	serverHandler.ShutdownServer()
+	defaultServer.ShutdownServer()
 }
 
-func RequestLock(rqPtr *LockerRequest) (chan bool, []error) {
+func ResizeServer(conf Config) error {
+	return defaultServer.ResizeServer(conf)
+}
+
+func IsRunning() bool {
+	return defaultServer.IsRunning()
+}
+
+func RequestLock(ctx context.Context, rqPtr *LockerRequest) (chan bool, []error) {
+	return defaultServer.RequestLock(ctx, rqPtr)
+}
+
+/*
+	Instance API
+*/
+
+func (sv *Server) StartServer(
+	conf Config,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) error {
+	if !sv.isInitialized {
+		sv.log = loggingHandler
+		sv.shutdownProgram = shutdownLambda
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
+	}
+	sv.setLockTimeout(conf.LockTimeout)
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) ShutdownServer() {
+	sv.handler.ShutdownServer()
+}
+
+// Running requests are not dropped
+func (sv *Server) ResizeServer(conf Config) error {
+	return sv.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) IsRunning() bool {
+	return sv.state.IsRunning()
+}
+
+func (sv *Server) RequestLock(ctx context.Context, rqPtr *LockerRequest) (chan bool, []error) {
 	// Sanitize request
 	sanitizationErrors := rqPtr.checkAndPrepareRequest()
 	if len(sanitizationErrors) != 0 {
 		return nil, sanitizationErrors
 	}
 
+	// Locks are only acquired while the requester is still waiting
+	if err := core.ContextError(ctx); rqPtr.LockingType == core.Locking && err != nil {
+		return nil, []error{err}
+	}
+	rqPtr.ctx = ctx
+
 	// Make request to server
-	nativeResponseChannel, err := serverHandler.MakeRequest(rqPtr)
+	nativeResponseChannel, err := sv.handler.MakeRequest(rqPtr)
 	if err != nil {
 		return nil, []error{err}
 	}
+	sv.metrics.Queued()
 
 	// Pass through result channel
 	nativeResponse, ok := <-nativeResponseChannel
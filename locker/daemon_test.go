@@ -1,9 +1,11 @@
 package locker
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"sync"
 	"testing"
+	"time"
 )
 
 /*
@@ -53,8 +55,8 @@ func TestInvalidRequest(t *testing.T) {
 
 	// Invalid resource type
 	invalidResourceTypeRequest := validLockerRequest
-	invalidResourceTypeRequest.Type = ChannelLock + 1
-	_, errs := RequestLock(&invalidResourceTypeRequest)
+	invalidResourceTypeRequest.Type = numResourceTypes
+	_, errs := RequestLock(context.Background(), &invalidResourceTypeRequest)
 	if len(errs) != 1 || errs[0].Error() != unknownResourceTypeErrorMsg {
 		t.Errorf("Request with invalid resource type must be rejected. errs=%+v", errs[0].Error())
 	}
@@ -62,7 +64,7 @@ func TestInvalidRequest(t *testing.T) {
 	// nil needs list
 	nilNeedsRequest := validLockerRequest
 	nilNeedsRequest.Needs = nil
-	_, errs = RequestLock(&nilNeedsRequest)
+	_, errs = RequestLock(context.Background(), &nilNeedsRequest)
 	if len(errs) != 1 || errs[0].Error() != noNeedsErrorMsg {
 		t.Errorf("Request with nil needs list must be rejected. errs=%+v", errs[0].Error())
 	}
@@ -70,11 +72,19 @@ func TestInvalidRequest(t *testing.T) {
 	// empty needs list
 	emptyNeedsRequest := validLockerRequest
 	emptyNeedsRequest.Needs = []core.LockNeed{}
-	_, errs = RequestLock(&emptyNeedsRequest)
+	_, errs = RequestLock(context.Background(), &emptyNeedsRequest)
 	if len(errs) != 1 || errs[0].Error() != noNeedsErrorMsg {
 		t.Errorf("Request with empty needs list must be rejected. errs=%+v", errs[0].Error())
 	}
 
+	// Invalid resource type in batch
+	invalidBatchRequest := validLockerRequest
+	invalidBatchRequest.Batch = []ResourceNeeds{{Type: numResourceTypes, Needs: validLockerRequest.Needs}}
+	_, errs = RequestLock(context.Background(), &invalidBatchRequest)
+	if len(errs) != 1 || errs[0].Error() != unknownResourceTypeErrorMsg {
+		t.Errorf("Request with invalid batch resource type must be rejected. errs=%+v", errs)
+	}
+
 	ShutdownServer()
 }
 
@@ -90,7 +100,7 @@ func TestOneLockUnlock(t *testing.T) {
 	unlockRequest.LockingType = core.Unlocking
 
 	// Request to lock
-	resChannel, errs := RequestLock(&lockRequest)
+	resChannel, errs := RequestLock(context.Background(), &lockRequest)
 	if len(errs) != 0 {
 		t.Errorf("Valid lock request should not be rejected. errs=%+v", errs)
 	}
@@ -100,7 +110,7 @@ func TestOneLockUnlock(t *testing.T) {
 	}
 
 	// Request to unlock
-	resChannel, errs = RequestLock(&unlockRequest)
+	resChannel, errs = RequestLock(context.Background(), &unlockRequest)
 	if len(errs) != 0 {
 		t.Errorf("Valid unlock request should not be rejected. errs=%+v", errs)
 	}
@@ -118,7 +128,7 @@ func testValidRequest(t *testing.T, request *LockerRequest, locking bool, expect
 		lockingString = "unlock"
 	}
 
-	resChannel, errs := RequestLock(request)
+	resChannel, errs := RequestLock(context.Background(), request)
 	if len(errs) != 0 {
 		t.Errorf("Valid %v request should not be rejected. errs=%+v", lockingString, errs)
 	}
@@ -193,3 +203,212 @@ func TestMultipleResourceLockUnlock(t *testing.T) {
 
 	ShutdownServer()
 }
+
+func TestLockDeadline(t *testing.T) {
+	if !resetAndStartServer(t, multipleWorkersConfig()) {
+		return
+	}
+
+	// Build lock/unlock requests for same resource
+	lockRequest := validLockerRequest
+	lockRequest.LockingType = core.Locking
+	unlockRequest := validLockerRequest
+	unlockRequest.LockingType = core.Unlocking
+
+	// Take lock
+	testValidRequest(t, &lockRequest, true, true, "Valid lock request should not fail.")
+
+	// Request lock with a deadline while resource is locked
+	timedLockRequest := lockRequest
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resChannel, errs := RequestLock(ctx, &timedLockRequest)
+	if len(errs) != 0 {
+		t.Errorf("Valid lock request with deadline should not be rejected. errs=%+v", errs)
+	}
+	select {
+	case <-resChannel:
+		t.Errorf("Lock request should not succeed while resource is locked.")
+	case <-ctx.Done():
+	}
+
+	// Requests with a done context are rejected
+	_, errs = RequestLock(ctx, &timedLockRequest)
+	if len(errs) != 1 || core.GetErrorCode(errs[0]) != core.DeadlineExceededErrorCode {
+		t.Errorf("Lock request with a done context should be rejected. errs=%+v", errs)
+	}
+
+	// Unlock, timed out lock should be rolled back
+	testValidRequest(t, &unlockRequest, false, true, "Valid unlock request should not fail.")
+	testValidRequest(t, &lockRequest, true, true, "Lock request should succeed after timed out lock is rolled back.")
+	testValidRequest(t, &unlockRequest, false, true, "Valid unlock request should not fail.")
+
+	ShutdownServer()
+}
+
+func TestLockTimeout(t *testing.T) {
+	timeoutConfig := multipleWorkersConfig()
+	timeoutConfig.LockTimeout = 50
+	if !resetAndStartServer(t, timeoutConfig) {
+		return
+	}
+
+	// Take lock on second resource only
+	secondLockRequest := validLockerRequest
+	secondLockRequest.Needs = []core.LockNeed{{LockType: core.WriteLockType, Id: channelId2}}
+	secondUnlockRequest := secondLockRequest
+	secondUnlockRequest.LockingType = core.Unlocking
+	testValidRequest(t, &secondLockRequest, true, true, "Valid lock request should not fail.")
+
+	// Request both resources, first one is rolled back after timeout
+	bothLockRequest := validLockerRequest
+	addLockingNeed(&bothLockRequest, core.WriteLockType, channelId2)
+	testValidRequest(t, &bothLockRequest, true, false, "Lock request should fail after lock timeout.")
+
+	// First resource should be available
+	firstLockRequest := validLockerRequest
+	firstUnlockRequest := validLockerRequest
+	firstUnlockRequest.LockingType = core.Unlocking
+	testValidRequest(t, &firstLockRequest, true, true, "Partially held locks should be rolled back after timeout.")
+	testValidRequest(t, &firstUnlockRequest, false, true, "Valid unlock request should not fail.")
+	testValidRequest(t, &secondUnlockRequest, false, true, "Valid unlock request should not fail.")
+
+	ShutdownServer()
+}
+
+func TestBatchLockUnlock(t *testing.T) {
+	timeoutConfig := multipleWorkersConfig()
+	timeoutConfig.LockTimeout = 50
+	if !resetAndStartServer(t, timeoutConfig) {
+		return
+	}
+
+	// Same id is a different resource for each type
+	userLockRequest := LockerRequest{
+		Type:        UserLock,
+		Needs:       []core.LockNeed{{LockType: core.WriteLockType, Id: channelId1}},
+		LockingType: core.Locking,
+	}
+	userUnlockRequest := userLockRequest
+	userUnlockRequest.LockingType = core.Unlocking
+	channelUnlockRequest := validLockerRequest
+	channelUnlockRequest.LockingType = core.Unlocking
+	testValidRequest(t, &userLockRequest, true, true, "User lock request should not fail.")
+	testValidRequest(t, &validLockerRequest, true, true, "Channel lock with same id as user should not fail.")
+	testValidRequest(t, &channelUnlockRequest, false, true, "Valid unlock request should not fail.")
+
+	// Batch is rolled back if user lock times out
+	batchLockRequest := validLockerRequest
+	batchLockRequest.Batch = []ResourceNeeds{
+		{
+			Type:  UserLock,
+			Needs: []core.LockNeed{{LockType: core.ReadLockType, Id: channelId1}},
+		},
+	}
+	batchUnlockRequest := batchLockRequest
+	batchUnlockRequest.LockingType = core.Unlocking
+	testValidRequest(t, &batchLockRequest, true, false, "Batch lock request should fail after lock timeout.")
+	testValidRequest(t, &validLockerRequest, true, true, "Channel lock should be rolled back when batch fails.")
+	testValidRequest(t, &channelUnlockRequest, false, true, "Valid unlock request should not fail.")
+	testValidRequest(t, &userUnlockRequest, false, true, "Valid unlock request should not fail.")
+
+	// Batch holds both channel and user locks until unlocked
+	testValidRequest(t, &batchLockRequest, true, true, "Batch lock request should not fail.")
+	testValidRequest(t, &userLockRequest, true, false, "User write lock should time out while batch holds read lock.")
+	testValidRequest(t, &validLockerRequest, true, false, "Channel lock should time out while batch holds it.")
+	testValidRequest(t, &batchUnlockRequest, false, true, "Batch unlock request should not fail.")
+	testValidRequest(t, &userLockRequest, true, true, "User lock request should not fail after batch unlock.")
+	testValidRequest(t, &userUnlockRequest, false, true, "Valid unlock request should not fail.")
+
+	ShutdownServer()
+}
+
+func TestWaitForGraph(t *testing.T) {
+	if !resetAndStartServer(t, multipleWorkersConfig()) {
+		return
+	}
+
+	// Holder
+	holderRequest := validLockerRequest
+	holderRequest.Owner = "HOLDER"
+	testValidRequest(t, &holderRequest, true, true, "Valid lock request should not fail.")
+
+	// Waiter
+	waiterRequest := validLockerRequest
+	waiterRequest.Owner = "WAITER"
+	ctx, cancel := context.WithCancel(context.Background())
+	resChannel, errs := RequestLock(ctx, &waiterRequest)
+	if len(errs) != 0 {
+		t.Errorf("Valid lock request should not be rejected. errs=%+v", errs)
+	}
+
+	// Wait for waiter to register
+	var response *AdminResponse
+	for i := 0; i < 100; i++ {
+		response, _ = Admin(&AdminRequest{Action: WaitForGraphAction})
+		if len(response.Graph.Edges) != 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	expectedEdge := WaitForEdge{
+		Waiter:   "WAITER",
+		Holder:   "HOLDER",
+		Type:     ChannelLock,
+		Resource: channelId1,
+	}
+	if len(response.Graph.Resources) != 1 ||
+		len(response.Graph.Resources[0].Holders) != 1 ||
+		len(response.Graph.Resources[0].Waiters) != 1 ||
+		len(response.Graph.Edges) != 1 ||
+		response.Graph.Edges[0] != expectedEdge {
+		t.Errorf("Wait-for graph should show waiter blocked on holder. graph=%+v", response.Graph)
+	}
+
+	// Give up waiting, graph should only show holder
+	cancel()
+	select {
+	case <-resChannel:
+		t.Errorf("Cancelled lock request should not send result.")
+	case <-time.After(20 * time.Millisecond):
+	}
+	response, _ = Admin(&AdminRequest{Action: WaitForGraphAction})
+	if len(response.Graph.Resources) != 1 ||
+		len(response.Graph.Resources[0].Waiters) != 0 ||
+		len(response.Graph.Edges) != 0 {
+		t.Errorf("Wait-for graph should not show waiter after it gave up. graph=%+v", response.Graph)
+	}
+
+	// Release lock, graph should be empty
+	holderUnlockRequest := holderRequest
+	holderUnlockRequest.LockingType = core.Unlocking
+	testValidRequest(t, &holderUnlockRequest, false, true, "Valid unlock request should not fail.")
+	response, _ = Admin(&AdminRequest{Action: WaitForGraphAction})
+	if len(response.Graph.Resources) != 0 {
+		t.Errorf("Wait-for graph should be empty when no locks are held. graph=%+v", response.Graph)
+	}
+
+	ShutdownServer()
+}
+
+func TestAdminLockTimeout(t *testing.T) {
+	if !resetAndStartServer(t, multipleWorkersConfig()) {
+		return
+	}
+
+	response, err := Admin(&AdminRequest{Action: SetLockTimeoutAction, LockTimeout: 100})
+	if err != nil || response.LockTimeout != 100 || defaultServer.getLockTimeout() != 100 {
+		t.Errorf("Lock timeout should be set through admin request. response=%+v, err=%v", response, err)
+	}
+
+	if _, err = Admin(&AdminRequest{Action: SetLockTimeoutAction, LockTimeout: -1}); err == nil {
+		t.Errorf("Negative lock timeout should be rejected.")
+	}
+
+	if _, err = Admin(&AdminRequest{Action: "unknown"}); err == nil {
+		t.Errorf("Unknown admin action should be rejected.")
+	}
+
+	ShutdownServer()
+}
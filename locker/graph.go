@@ -0,0 +1,87 @@
+/*
+	Wait-for graph of resource locks
+*/
+
+package locker
+
+import (
+	"github.com/mngharbi/DMPC/core"
+	"sort"
+)
+
+/*
+	Graph structure
+*/
+
+type ResourceLockState struct {
+	Type    ResourceType     `json:"type"`
+	Id      string           `json:"id"`
+	Holders []core.LockOwner `json:"holders"`
+	Waiters []core.LockOwner `json:"waiters"`
+}
+
+// Waiter is blocked on resource held by holder
+type WaitForEdge struct {
+	Waiter   string       `json:"waiter"`
+	Holder   string       `json:"holder"`
+	Type     ResourceType `json:"type"`
+	Resource string       `json:"resource"`
+}
+
+type WaitForGraph struct {
+	Resources []ResourceLockState `json:"resources"`
+	Edges     []WaitForEdge       `json:"edges"`
+}
+
+/*
+	Graph building (only resources currently held or waited on are included)
+*/
+
+func (sv *Server) buildWaitForGraph() *WaitForGraph {
+	graph := &WaitForGraph{
+		Resources: []ResourceLockState{},
+		Edges:     []WaitForEdge{},
+	}
+
+	for resourceType := range sv.resources {
+		sv.resources[resourceType].Range(func(_ interface{}, recordGeneric interface{}) bool {
+			record := recordGeneric.(*resourceRecord)
+			holders, waiters := record.lock.State()
+			if len(holders) == 0 && len(waiters) == 0 {
+				return true
+			}
+			graph.Resources = append(graph.Resources, ResourceLockState{
+				Type:    ResourceType(resourceType),
+				Id:      record.Id,
+				Holders: holders,
+				Waiters: waiters,
+			})
+
+			// Waiters wait for all holders unless both are readers
+			for _, waiter := range waiters {
+				for _, holder := range holders {
+					if waiter.Mode == core.ReadLockMode && holder.Mode == core.ReadLockMode {
+						continue
+					}
+					graph.Edges = append(graph.Edges, WaitForEdge{
+						Waiter:   waiter.Owner,
+						Holder:   holder.Owner,
+						Type:     ResourceType(resourceType),
+						Resource: record.Id,
+					})
+				}
+			}
+			return true
+		})
+	}
+
+	// Stable output
+	sort.Slice(graph.Resources, func(i, j int) bool {
+		if graph.Resources[i].Type != graph.Resources[j].Type {
+			return graph.Resources[i].Type < graph.Resources[j].Type
+		}
+		return graph.Resources[i].Id < graph.Resources[j].Id
+	})
+
+	return graph
+}
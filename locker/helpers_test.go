@@ -25,7 +25,7 @@ func singleWorkerConfig() Config {
 }
 
 func resetAndStartServer(t *testing.T, conf Config) bool {
-	serverSingleton = server{}
+	defaultServer = NewServer(core.Metrics)
 	err := StartServer(conf, log, shutdownProgram)
 	if err != nil {
 		t.Errorf(err.Error())
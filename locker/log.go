@@ -9,4 +9,8 @@ const (
 	receivedRequestLogMsg string = "Locker received request"
 	runningRequestLogMsg  string = "Locker running request"
 	doneRequestLogMsg     string = "Locker request is done"
+	rollbackRequestLogMsg string = "Locker request rolled back after requester gave up"
+	lockTimeoutLogMsg     string = "Locker request of %v timed out waiting for locks"
+	waitForGraphLogMsg    string = "Locker dumping wait-for graph"
+	setLockTimeoutLogMsg  string = "Locker lock timeout set to %vms"
 )
@@ -0,0 +1,9 @@
+package locker
+
+/*
+	Request type labels of request metrics
+*/
+const (
+	lockRequestLabel   string = "lock"
+	unlockRequestLabel string = "unlock"
+)
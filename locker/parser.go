@@ -1,8 +1,9 @@
 package locker
 
 import (
-	"errors"
+	"context"
 	"github.com/mngharbi/DMPC/core"
+	"sort"
 )
 
 /*
@@ -20,7 +21,25 @@ const (
 
 type ResourceType int
 
-const ChannelLock ResourceType = 0
+// Resource types are locked in increasing order
+const (
+	ChannelLock ResourceType = iota
+	UserLock
+	numResourceTypes
+)
+
+func (resourceType ResourceType) isValid() bool {
+	return ChannelLock <= resourceType && resourceType < numResourceTypes
+}
+
+/*
+	Lock needs on a resource type
+*/
+
+type ResourceNeeds struct {
+	Type  ResourceType
+	Needs []core.LockNeed
+}
 
 /*
 	Structure of a locker request
@@ -30,21 +49,59 @@ type LockerRequest struct {
 	Type        ResourceType
 	Needs       []core.LockNeed
 	LockingType core.LockingType
+
+	// Needs on other resource types taken in the same ordered batch
+	Batch []ResourceNeeds
+
+	// Identifies the lock holder in diagnostics (locks are released by the same owner)
+	Owner string
+
+	ctx context.Context
 }
 
 // Used to check errors within request
 func (rq *LockerRequest) checkAndPrepareRequest() []error {
 	res := []error{}
 
-	// Check type
-	if rq.Type != ChannelLock {
-		res = append(res, errors.New(unknownResourceTypeErrorMsg))
+	// Check types
+	validTypes := rq.Type.isValid()
+	numNeeds := len(rq.Needs)
+	for _, resourceNeeds := range rq.Batch {
+		validTypes = validTypes && resourceNeeds.Type.isValid()
+		numNeeds += len(resourceNeeds.Needs)
+	}
+	if !validTypes {
+		res = append(res, core.NewError(core.InvalidRequestErrorCode, unknownResourceTypeErrorMsg))
 	}
 
 	// Check we have at least one request
-	if len(rq.Needs) == 0 {
-		res = append(res, errors.New(noNeedsErrorMsg))
+	if numNeeds == 0 {
+		res = append(res, core.NewError(core.InvalidRequestErrorCode, noNeedsErrorMsg))
+	}
+
+	return res
+}
+
+// Groups needs by resource type in locking order
+func (rq *LockerRequest) getOrderedNeeds() []ResourceNeeds {
+	needsByType := map[ResourceType][]core.LockNeed{}
+	needsByType[rq.Type] = append(needsByType[rq.Type], rq.Needs...)
+	for _, resourceNeeds := range rq.Batch {
+		needsByType[resourceNeeds.Type] = append(needsByType[resourceNeeds.Type], resourceNeeds.Needs...)
+	}
+
+	res := []ResourceNeeds{}
+	for resourceType, needs := range needsByType {
+		if len(needs) != 0 {
+			res = append(res, ResourceNeeds{
+				Type:  resourceType,
+				Needs: needs,
+			})
+		}
 	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Type < res[j].Type
+	})
 
 	return res
 }
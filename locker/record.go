@@ -1,8 +1,9 @@
 package locker
 
 import (
+	"context"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/memstore"
-	"sync"
 )
 
 /*
@@ -10,7 +11,7 @@ import (
 */
 type resourceRecord struct {
 	Id   string
-	lock *sync.RWMutex
+	lock *core.TimedRWMutex
 }
 
 /*
@@ -28,24 +29,14 @@ func (rec *resourceRecord) Less(index string, than interface{}) bool {
 	Resource locking
 */
 
-// Read lock
-func (record *resourceRecord) RLock() {
-	record.lock.RLock()
+// Lock until context is done
+func (record *resourceRecord) LockContext(ctx context.Context, owner string, lockType core.LockType) bool {
+	return record.lock.LockContext(ctx, owner, lockType)
 }
 
-// Read unlock
-func (record *resourceRecord) RUnlock() {
-	record.lock.RUnlock()
-}
-
-// Write lock
-func (record *resourceRecord) Lock() {
-	record.lock.Lock()
-}
-
-// Write unlock
-func (record *resourceRecord) Unlock() {
-	record.lock.Unlock()
+// Unlock
+func (record *resourceRecord) UnlockOwner(owner string, lockType core.LockType) bool {
+	return record.lock.UnlockOwner(owner, lockType)
 }
 
 /*
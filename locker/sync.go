@@ -1,27 +1,54 @@
 /*
-	Helpers for user lock synchronization
-	Makes calls to core.Lock for the locking logic
+	Helpers for resource lock synchronization
+	Makes calls to core.LockContext for the locking logic
 */
 
 package locker
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/memstore"
 )
 
-func lockResources(store *memstore.Memstore, lockNeeds []core.LockNeed) bool {
+func lockResources(ctx context.Context, store *memstore.Memstore, lockNeeds []core.LockNeed, owner string) bool {
 	// Build reader function
 	reader := core.RecordReaderFunctor(store, makeSearchByIdRecord, "id", false, nil)
 
 	// Do locking (rollback unlocking included)
-	return core.Lock(reader, lockNeeds)
+	return core.LockContext(ctx, reader, lockNeeds, owner)
 }
 
-func unlockResources(store *memstore.Memstore, unlockNeeds []core.LockNeed) bool {
+func unlockResources(store *memstore.Memstore, unlockNeeds []core.LockNeed, owner string) bool {
 	// Build unlock function
 	reader := core.RecordReaderFunctor(store, makeSearchByIdRecord, "id", false, nil)
 
 	// Do unlocking
-	return core.Unlock(reader, unlockNeeds)
+	return core.UnlockOwner(reader, unlockNeeds, owner)
+}
+
+/*
+	Batch locking across resource types (types are locked in order)
+*/
+
+func (sv *Server) lockBatch(ctx context.Context, orderedNeeds []ResourceNeeds, owner string) bool {
+	for batchIndex, resourceNeeds := range orderedNeeds {
+		if !lockResources(ctx, sv.lockStores[resourceNeeds.Type], resourceNeeds.Needs, owner) {
+			// Roll back resource types already locked
+			sv.unlockBatch(orderedNeeds[:batchIndex], owner)
+			return false
+		}
+	}
+	return true
+}
+
+func (sv *Server) unlockBatch(orderedNeeds []ResourceNeeds, owner string) bool {
+	success := true
+	for batchIndex := len(orderedNeeds) - 1; batchIndex >= 0; batchIndex-- {
+		resourceNeeds := orderedNeeds[batchIndex]
+		if !unlockResources(sv.lockStores[resourceNeeds.Type], resourceNeeds.Needs, owner) {
+			success = false
+		}
+	}
+	return success
 }
@@ -1,40 +1,96 @@
 package main
 
 import (
-	"github.com/mngharbi/DMPC/daemon"
-	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/bench"
 	dmpcCli "github.com/mngharbi/DMPC/cli"
+	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/DMPC/daemon"
 	"github.com/urfave/cli"
 	"log"
 	"os"
+	"strconv"
 	"time"
 )
 
 var (
 	channelFlagsMap map[string]cli.Flag = map[string]cli.Flag{
 		"channel": cli.StringFlag{
-			Name: "channel, c",
+			Name:  "channel, c",
 			Usage: "Channel id",
 		},
 		"noencrypt": cli.BoolFlag{
-			Name: "noencrypt, ne",
+			Name:  "noencrypt, ne",
 			Usage: "No encryption",
 		},
 		"nosign": cli.BoolFlag{
-			Name: "nosign, ns",
+			Name:  "nosign, ns",
 			Usage: "No signature",
 		},
 		"encrypt": cli.BoolFlag{
-			Name: "encrypt, e",
+			Name:  "encrypt, e",
 			Usage: "Encrypt operation",
 		},
 		"sign": cli.BoolFlag{
-			Name: "sign, s",
+			Name:  "sign, s",
+			Usage: "Sign operation",
+		},
+	}
+)
+
+var (
+	userFlagsMap map[string]cli.Flag = map[string]cli.Flag{
+		"user": cli.StringFlag{
+			Name:  "user, u",
+			Usage: "User id",
+		},
+		"users": cli.StringSliceFlag{
+			Name:  "user, u",
+			Usage: "User id (can be repeated)",
+		},
+		"enckey": cli.StringFlag{
+			Name:  "enckey",
+			Usage: "Path to public encryption key file",
+		},
+		"signkey": cli.StringFlag{
+			Name:  "signkey",
+			Usage: "Path to public signing key file",
+		},
+		"sign": cli.BoolFlag{
+			Name:  "sign, s",
 			Usage: "Sign operation",
 		},
 	}
 )
 
+/*
+	User permission flags (true/false, only fields set are updated)
+*/
+func userPermissionFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, flag := range dmpcCli.UserPermissionFlags {
+		flags = append(flags, cli.StringFlag{
+			Name:  flag.Name,
+			Usage: "Set " + flag.Field + " (true/false)",
+		})
+	}
+	return flags
+}
+
+func userPermissionValues(c *cli.Context) map[string]bool {
+	values := map[string]bool{}
+	for _, flag := range dmpcCli.UserPermissionFlags {
+		if !c.IsSet(flag.Name) {
+			continue
+		}
+		value, err := strconv.ParseBool(c.String(flag.Name))
+		if err != nil {
+			log.Fatalf("Invalid value for %v (expected true/false)", flag.Name)
+		}
+		values[flag.Field] = value
+	}
+	return values
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "DMPC"
@@ -51,24 +107,89 @@ func main() {
 	app.Usage = "Distributed Multiuser Private Channels"
 	app.UsageText = ""
 
+	// Configuration directory and identity used to sign operations and connect to the pipeline
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config-dir",
+			Usage:  "Configuration directory (defaults to ~/.dmpc)",
+			EnvVar: "DMPC_HOME",
+		},
+		cli.StringFlag{
+			Name:   "identity, I",
+			Usage:  "Identity profile to act as (defaults to root user)",
+			EnvVar: "DMPC_IDENTITY",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		dmpcCli.SetInstallRoot(c.GlobalString("config-dir"))
+		dmpcCli.SetIdentity(c.GlobalString("identity"))
+		return nil
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:    "install",
 			Aliases: []string{"i"},
 			Usage:   "Configure DMPC",
 			Action: func(c *cli.Context) error {
-				dmpcCli.Install()
+				dmpcCli.Install(dmpcCli.InstallOptions{
+					Yes:              c.Bool("yes"),
+					RootUserId:       c.String("root-id"),
+					RootUserFilePath: c.String("root-user-file"),
+					ImportKeysDir:    c.String("import-keys"),
+					PipelinePort:     c.Int("port"),
+					MetricsPort:      c.Int("metrics-port"),
+					NoMetrics:        c.Bool("no-metrics"),
+				})
 				return nil
 			},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Do not prompt (re-install, generate keys, root user id defaults to root)",
+				},
+				cli.StringFlag{
+					Name:  "root-id",
+					Usage: "Root user id (default root user properties)",
+				},
+				cli.StringFlag{
+					Name:  "root-user-file",
+					Usage: "Path to root user object file",
+				},
+				cli.StringFlag{
+					Name:  "import-keys",
+					Usage: "Directory with root user keys to import (encryption_rsa, signing_rsa and their .pub files)",
+				},
+				cli.IntFlag{
+					Name:  "port",
+					Usage: "Pipeline port",
+				},
+				cli.IntFlag{
+					Name:  "metrics-port",
+					Usage: "Metrics port",
+				},
+				cli.BoolFlag{
+					Name:  "no-metrics",
+					Usage: "Do not serve metrics",
+				},
+			},
 		},
 		{
 			Name:    "server",
 			Aliases: []string{"s"},
 			Usage:   "Start processing daemon",
 			Action: func(c *cli.Context) error {
-				daemon.Start()
+				daemon.Start(daemon.Options{
+					RecordPath: c.String("record"),
+				})
 				return nil
 			},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "record",
+					Usage: "Append every accepted transaction to JSONL file (for replay)",
+				},
+			},
 		},
 		{
 			Name:    "transaction",
@@ -85,20 +206,20 @@ func main() {
 					},
 					Flags: []cli.Flag{
 						cli.BoolFlag{
-							Name: "ignoreresult, i",
+							Name:  "ignoreresult, i",
 							Usage: "Ignore transaction result",
 						},
 						cli.BoolFlag{
-							Name: "statusupdate, u",
+							Name:  "statusupdate, u",
 							Usage: "Get transaction status updates",
 						},
 						cli.BoolFlag{
-							Name: "keepalive, k",
+							Name:  "keepalive, k",
 							Usage: "Keep connection open after transaction",
 						},
 						cli.StringSliceFlag{
-							Name: "recepient, r",
-							Usage: "Encrypt transaction for recepient",
+							Name:  "recepient, r",
+							Usage: "Encrypt transaction for recepient (offline if all recepients are in keyring)",
 						},
 					},
 				},
@@ -119,19 +240,19 @@ func main() {
 			Usage:   "Operation related commands",
 			Subcommands: []cli.Command{
 				{
-					Name:    "sign",
-					Usage:   "Sign operation as issuer/certifier",
+					Name:  "sign",
+					Usage: "Sign operation as issuer/certifier",
 					Action: func(c *cli.Context) error {
 						dmpcCli.ReadAndSignOperation(c.Bool("issue"), c.Bool("certify"))
 						return nil
 					},
 					Flags: []cli.Flag{
 						cli.BoolFlag{
-							Name: "issue, i",
+							Name:  "issue, i",
 							Usage: "Sign as issuer",
 						},
 						cli.BoolFlag{
-							Name: "certify, c",
+							Name:  "certify, c",
 							Usage: "Sign as certifier",
 						},
 					},
@@ -142,26 +263,78 @@ func main() {
 					Usage:   "Generate operations",
 					Subcommands: []cli.Command{
 						{
-							Name:    "user",
-							Usage:   "Generate user operations",
+							Name:  "user",
+							Usage: "Generate user operations",
 							Subcommands: []cli.Command{
 								{
-									Name:    "create",
-									Usage:   "Generate user creation operation from user object",
+									Name:  "create",
+									Usage: "Generate user creation operation from user object",
 									Action: func(c *cli.Context) error {
 										dmpcCli.GenerateUserCreateOperation()
 										return nil
 									},
 								},
+								{
+									Name:  "update",
+									Usage: "Generate user update operation",
+									Flags: append([]cli.Flag{
+										userFlagsMap["user"],
+										userFlagsMap["enckey"],
+										userFlagsMap["signkey"],
+										userFlagsMap["sign"],
+									}, userPermissionFlags()...),
+									Action: func(c *cli.Context) error {
+										dmpcCli.GenerateUserUpdateOperation(c.String("user"), userPermissionValues(c), c.String("enckey"), c.String("signkey"), c.Bool("sign"))
+										return nil
+									},
+								},
+								{
+									Name:  "read",
+									Usage: "Generate user read operation",
+									Flags: []cli.Flag{
+										userFlagsMap["users"],
+										userFlagsMap["sign"],
+									},
+									Action: func(c *cli.Context) error {
+										dmpcCli.GenerateUserReadOperation(c.StringSlice("user"), c.Bool("sign"))
+										return nil
+									},
+								},
+								{
+									Name:  "deactivate",
+									Usage: "Generate user deactivation operation",
+									Flags: []cli.Flag{
+										userFlagsMap["user"],
+										userFlagsMap["sign"],
+									},
+									Action: func(c *cli.Context) error {
+										dmpcCli.GenerateUserDeactivateOperation(c.String("user"), c.Bool("sign"))
+										return nil
+									},
+								},
+								{
+									Name:  "rotate-keys",
+									Usage: "Generate user keys rotation operation from public key files",
+									Flags: []cli.Flag{
+										userFlagsMap["user"],
+										userFlagsMap["enckey"],
+										userFlagsMap["signkey"],
+										userFlagsMap["sign"],
+									},
+									Action: func(c *cli.Context) error {
+										dmpcCli.GenerateUserRotateKeysOperation(c.String("user"), c.String("enckey"), c.String("signkey"), c.Bool("sign"))
+										return nil
+									},
+								},
 							},
 						},
 						{
-							Name:    "channel",
-							Usage:   "Generate channel operations",
+							Name:  "channel",
+							Usage: "Generate channel operations",
 							Subcommands: []cli.Command{
 								{
-									Name:    "read",
-									Usage:   "Generate channel read operation",
+									Name:  "read",
+									Usage: "Generate channel read operation",
 									Flags: []cli.Flag{
 										channelFlagsMap["channel"],
 										channelFlagsMap["sign"],
@@ -172,8 +345,8 @@ func main() {
 									},
 								},
 								{
-									Name:    "open",
-									Usage:   "Generate channel open operation from channel object",
+									Name:  "open",
+									Usage: "Generate channel open operation from channel object",
 									Flags: []cli.Flag{
 										channelFlagsMap["sign"],
 									},
@@ -183,8 +356,8 @@ func main() {
 									},
 								},
 								{
-									Name:    "close",
-									Usage:   "Generate channel close operation",
+									Name:  "close",
+									Usage: "Generate channel close operation",
 									Flags: []cli.Flag{
 										channelFlagsMap["channel"],
 										channelFlagsMap["sign"],
@@ -196,8 +369,8 @@ func main() {
 									},
 								},
 								{
-									Name:    "listen",
-									Usage:   "Generate channel listen operation",
+									Name:  "listen",
+									Usage: "Generate channel listen operation",
 									Flags: []cli.Flag{
 										channelFlagsMap["channel"],
 										channelFlagsMap["sign"],
@@ -208,8 +381,8 @@ func main() {
 									},
 								},
 								{
-									Name:    "message",
-									Usage:   "Generate channel message operation",
+									Name:  "message",
+									Usage: "Generate channel message operation",
 									Flags: []cli.Flag{
 										channelFlagsMap["channel"],
 										channelFlagsMap["nosign"],
@@ -258,6 +431,247 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:  "identity",
+			Usage: "Identity profiles (user id and keys to act as)",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "Add identity (generates keys unless private key files are passed)",
+					ArgsUsage: "<name>",
+					Flags: []cli.Flag{
+						userFlagsMap["user"],
+						cli.StringFlag{
+							Name:  "enckey",
+							Usage: "Path to private encryption key file",
+						},
+						cli.StringFlag{
+							Name:  "signkey",
+							Usage: "Path to private signing key file",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						dmpcCli.AddIdentity(c.Args().First(), c.String("user"), c.String("enckey"), c.String("signkey"))
+						return nil
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Remove identity",
+					ArgsUsage: "<name>",
+					Action: func(c *cli.Context) error {
+						dmpcCli.RemoveIdentity(c.Args().First())
+						return nil
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "List identities (current one is marked)",
+					Action: func(c *cli.Context) error {
+						dmpcCli.ListIdentities()
+						return nil
+					},
+				},
+				{
+					Name:      "export",
+					Usage:     "Write user object with identity public keys",
+					ArgsUsage: "[name]",
+					Action: func(c *cli.Context) error {
+						dmpcCli.ExportIdentityUserObject(c.Args().First())
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "keyring",
+			Usage: "Public keys of other users",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "Add user public keys from key files",
+					ArgsUsage: "<user id>",
+					Flags: []cli.Flag{
+						userFlagsMap["enckey"],
+						userFlagsMap["signkey"],
+					},
+					Action: func(c *cli.Context) error {
+						dmpcCli.AddKeyringEntry(c.Args().First(), c.String("enckey"), c.String("signkey"))
+						return nil
+					},
+				},
+				{
+					Name:  "import",
+					Usage: "Add user public keys from user object",
+					Action: func(c *cli.Context) error {
+						dmpcCli.ImportKeyringEntry()
+						return nil
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Remove user from keyring",
+					ArgsUsage: "<user id>",
+					Action: func(c *cli.Context) error {
+						dmpcCli.RemoveKeyringEntry(c.Args().First())
+						return nil
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "List users in keyring",
+					Action: func(c *cli.Context) error {
+						dmpcCli.ListKeyring()
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:      "chat",
+			Usage:     "Chat in channel (sends typed lines, shows channel events)",
+			ArgsUsage: "<channel>",
+			Action: func(c *cli.Context) error {
+				return dmpcCli.Chat(c.Args().First())
+			},
+		},
+		{
+			Name:  "channels",
+			Usage: "List channels readable by current identity",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "member, m",
+					Usage: "Only channels where user is a member",
+				},
+				cli.StringFlag{
+					Name:  "state, s",
+					Usage: "Only channels in state (buffered, open or closed)",
+				},
+				cli.StringFlag{
+					Name:  "opened-after",
+					Usage: "Only channels opened after time (RFC3339)",
+				},
+				cli.StringFlag{
+					Name:  "opened-before",
+					Usage: "Only channels opened before time (RFC3339)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return dmpcCli.ListChannels(dmpcCli.ListChannelsOptions{
+					Member:       c.String("member"),
+					State:        c.String("state"),
+					OpenedAfter:  c.String("opened-after"),
+					OpenedBefore: c.String("opened-before"),
+				})
+			},
+		},
+		{
+			Name:      "replay",
+			Usage:     "Run recorded transactions (server --record file) and report outcome of each one",
+			ArgsUsage: "<file>",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "preserve-timing, t",
+					Usage: "Wait between transactions as recorded (max speed otherwise)",
+				},
+				cli.IntFlag{
+					Name:  "concurrency, c",
+					Usage: "Transactions in flight at once",
+					Value: 16,
+				},
+				cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "Time allowed for each transaction",
+					Value: 30 * time.Second,
+				},
+				cli.StringFlag{
+					Name:  "report, r",
+					Usage: "Write JSON report to file",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				dmpcCli.Replay(c.Args().First(), dmpcCli.ReplayOptions{
+					PreserveTiming: c.Bool("preserve-timing"),
+					Concurrency:    c.Int("concurrency"),
+					Timeout:        c.Duration("timeout"),
+					ReportPath:     c.String("report"),
+				})
+				return nil
+			},
+		},
+		{
+			Name:  "bench",
+			Usage: "Benchmark message traffic against an in-process node (does not use the current configuration)",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "users, u",
+					Usage: "Users created",
+					Value: 4,
+				},
+				cli.IntFlag{
+					Name:  "channels, c",
+					Usage: "Channels opened (all users are members)",
+					Value: 2,
+				},
+				cli.IntFlag{
+					Name:  "concurrency, n",
+					Usage: "Clients sending messages at once",
+					Value: 8,
+				},
+				cli.IntFlag{
+					Name:  "messages, m",
+					Usage: "Messages sent",
+					Value: 1000,
+				},
+				cli.IntFlag{
+					Name:  "size, s",
+					Usage: "Message size in bytes",
+					Value: 64,
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Write report as JSON",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return bench.RunAndWrite(bench.Options{
+					Users:       c.Int("users"),
+					Channels:    c.Int("channels"),
+					Concurrency: c.Int("concurrency"),
+					MessageSize: c.Int("size"),
+				}, c.Int("messages"), c.Bool("json"), os.Stdout)
+			},
+		},
+		{
+			Name:  "inspect",
+			Usage: "Decrypt and verify transaction or operation from stdin without running it",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "Path to private encryption key (defaults to identity key)",
+				},
+				cli.StringFlag{
+					Name:  "channel-key",
+					Usage: "Base64 encoded channel key",
+				},
+				cli.StringFlag{
+					Name:  "issuer-key",
+					Usage: "Path to issuer public signing key (defaults to keyring)",
+				},
+				cli.StringFlag{
+					Name:  "certifier-key",
+					Usage: "Path to certifier public signing key (defaults to keyring)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return dmpcCli.Inspect(dmpcCli.InspectOptions{
+					PrivateKeyPath:   c.String("key"),
+					ChannelKey:       c.String("channel-key"),
+					IssuerKeyPath:    c.String("issuer-key"),
+					CertifierKeyPath: c.String("certifier-key"),
+				})
+			},
+		},
 	}
 
 	err := app.Run(os.Args)
@@ -1,13 +1,12 @@
 package pipeline
 
 import (
-	"errors"
+	"context"
 	"github.com/mngharbi/DMPC/channels"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/decryptor"
 	"github.com/mngharbi/DMPC/status"
 	"github.com/mngharbi/gofarm"
-	"sync"
 )
 
 /*
@@ -15,56 +14,47 @@ import (
 */
 
 var (
-	serverNotRunning  error = errors.New("Pipeline not running during the operation.")
-	subscriptionError error = errors.New("Failed to unsubscribe.")
-)
-
-/*
-	Shared variables
-*/
-var (
-	log             *core.LoggingHandler
-	serverLock      *sync.RWMutex = &sync.RWMutex{}
-	serverSingleton *server       = &server{}
+	serverNotRunning  error = core.NewError(core.SubsystemShutdownErrorCode, "Pipeline not running during the operation.")
+	subscriptionError error = core.NewError(core.RequestFailedErrorCode, "Failed to unsubscribe.")
 )
 
 /*
 	Used to pass transaction to decryptor
 */
-func passTransaction(transaction *core.Transaction) (channel chan *gofarm.Response, errs []error) {
-	serverLock.RLock()
-	defer serverLock.RUnlock()
-	if !serverSingleton.isRunning {
+func (sv *Server) passTransaction(transaction *core.Transaction) (channel chan *gofarm.Response, errs []error) {
+	sv.lock.RLock()
+	defer sv.lock.RUnlock()
+	if !sv.isRunning {
 		return nil, []error{serverNotRunning}
 	}
-	return serverSingleton.requester(transaction)
+	return sv.requester(transaction)
 }
 
 /*
 	Used to get channel for status updates
 */
-func getStatusUpdateChannel(ticket status.Ticket) (status.UpdateChannel, error) {
-	serverLock.RLock()
-	defer serverLock.RUnlock()
-	if !serverSingleton.isRunning {
+func (sv *Server) getStatusUpdateChannel(ticket status.Ticket) (status.UpdateChannel, error) {
+	sv.lock.RLock()
+	defer sv.lock.RUnlock()
+	if !sv.isRunning {
 		return nil, serverNotRunning
 	}
 
-	return serverSingleton.statusSubscriber(ticket)
+	return sv.statusSubscriber(ticket)
 }
 
 /*
 	Used to do channel unsubscribe
 */
-func doUnsubscribe(channelId string, subscriberId string) error {
-	serverLock.RLock()
-	defer serverLock.RUnlock()
+func (sv *Server) doUnsubscribe(channelId string, subscriberId string) error {
+	sv.lock.RLock()
+	defer sv.lock.RUnlock()
 
-	if !serverSingleton.isRunning {
+	if !sv.isRunning {
 		return serverNotRunning
 	}
 
-	channel, err := serverSingleton.unsubscriber(&channels.UnsubscribeRequest{
+	channel, err := sv.unsubscriber(context.Background(), &channels.UnsubscribeRequest{
 		ChannelId:    channelId,
 		SubscriberId: subscriberId,
 	})
@@ -81,24 +71,61 @@ func doUnsubscribe(channelId string, subscriberId string) error {
 		return subscriptionError
 	}
 	return nil
-
 }
 
 /*
-	Server API
+	Server API (package functions use a default instance)
 */
 
 func StartServer(config Config, requester decryptor.Requester, unsubscriber channels.ListenersRequester, statusSubscriber status.Subscriber, loggingHandler *core.LoggingHandler) {
-	if log == nil {
-		log = loggingHandler
-	}
-	serverLock.Lock()
-	serverSingleton.start(config, requester, unsubscriber, statusSubscriber)
-	serverLock.Unlock()
+	defaultServer.StartServer(config, requester, unsubscriber, statusSubscriber, loggingHandler)
 }
 
 func ShutdownServer() {
-	serverLock.Lock()
-	serverSingleton.shutdown()
-	serverLock.Unlock()
+	defaultServer.ShutdownServer()
+}
+
+func ReloadConfig(config Config) bool {
+	return defaultServer.ReloadConfig(config)
+}
+
+func SetHealthReporter(healthReporter HealthReporter) {
+	defaultServer.SetHealthReporter(healthReporter)
+}
+
+/*
+	Instance API
+*/
+
+func (sv *Server) StartServer(config Config, requester decryptor.Requester, unsubscriber channels.ListenersRequester, statusSubscriber status.Subscriber, loggingHandler *core.LoggingHandler) {
+	sv.lock.Lock()
+	if sv.log == nil {
+		sv.log = loggingHandler
+	}
+	err := sv.start(config, requester, unsubscriber, statusSubscriber)
+	sv.lock.Unlock()
+
+	// Fatal errors shut down all subsystems (lock must be released)
+	if err != nil {
+		sv.log.Fatalf(serverCannotListenErrorMsg, config.makeAddrString(), err)
+	}
+}
+
+func (sv *Server) ShutdownServer() {
+	sv.lock.Lock()
+	sv.shutdown()
+	sv.lock.Unlock()
+}
+
+/*
+	Applies configuration changes that are safe while running
+	Returns false if some changes need a restart (listening address)
+*/
+func (sv *Server) ReloadConfig(config Config) bool {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	sv.config.CheckOrigin = config.CheckOrigin
+	sv.setCheckOrigin(config.CheckOrigin)
+	sv.log.Debugf(reloadedConfigLogMsg)
+	return config.makeAddrString() == sv.config.makeAddrString()
 }
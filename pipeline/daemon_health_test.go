@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+/*
+	Health and readiness endpoints
+*/
+
+func getHealth(t *testing.T, path string) (int, *HealthResponse) {
+	return getHealthOnPort(t, defaultPort, path)
+}
+
+func getHealthOnPort(t *testing.T, port int, path string) (int, *HealthResponse) {
+	healthUrl := url.URL{
+		Scheme: "http",
+		Host:   makeAddrString(defaultHostname, port),
+		Path:   path,
+	}
+	resp, err := http.Get(healthUrl.String())
+	if err != nil {
+		t.Errorf("Health request failed. err=%v", err)
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	response := &HealthResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		t.Errorf("Health response should be valid json. err=%v", err)
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, response
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	report := &HealthReport{
+		Ready: false,
+		Subsystems: map[string]bool{
+			"users": true,
+		},
+	}
+	SetHealthReporter(func() *HealthReport {
+		return report
+	})
+	defer SetHealthReporter(nil)
+
+	StartServer(
+		Config{
+			CheckOrigin: false,
+			Hostname:    defaultHostname,
+			Port:        defaultPort,
+		},
+		generateDecryptorRequester(true, true),
+		createSuccessUnsubsriberNoCalls(),
+		createSuccessStatusSubscriberNoCalls(),
+		log,
+	)
+	defer ShutdownServer()
+
+	// Healthy but not ready
+	if code, response := getHealth(t, healthPath); code != http.StatusOK ||
+		response == nil ||
+		response.Status != healthyStatus ||
+		response.Subsystems["users"] != RunningState ||
+		response.Subsystems["pipeline"] != RunningState {
+		t.Errorf("Node with all subsystems running should be healthy. code=%v response=%+v", code, response)
+	}
+	if code, response := getHealth(t, readinessPath); code != http.StatusServiceUnavailable ||
+		response == nil ||
+		response.Ready {
+		t.Errorf("Node should not be ready before startup is done. code=%v response=%+v", code, response)
+	}
+
+	// Ready
+	report = &HealthReport{
+		Ready: true,
+		Subsystems: map[string]bool{
+			"users": true,
+		},
+	}
+	if code, response := getHealth(t, readinessPath); code != http.StatusOK ||
+		response == nil ||
+		!response.Ready {
+		t.Errorf("Node should be ready after startup is done. code=%v response=%+v", code, response)
+	}
+
+	// Stopped subsystem
+	report = &HealthReport{
+		Ready: true,
+		Subsystems: map[string]bool{
+			"users": false,
+		},
+	}
+	if code, response := getHealth(t, healthPath); code != http.StatusServiceUnavailable ||
+		response == nil ||
+		response.Status != unhealthyStatus ||
+		response.Subsystems["users"] != StoppedState {
+		t.Errorf("Node with stopped subsystem should not be healthy. code=%v response=%+v", code, response)
+	}
+	if code, _ := getHealth(t, readinessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("Node with stopped subsystem should not be ready. code=%v", code)
+	}
+}
+
+func TestHealthEndpointsMultipleServers(t *testing.T) {
+	// Default and separate instance listening on different ports
+	otherServer := NewServer(core.NewMetricsRegistry())
+	otherPort := defaultPort + 1
+	for _, instance := range []struct {
+		server *Server
+		port   int
+		ready  bool
+	}{
+		{defaultServer, defaultPort, false},
+		{otherServer, otherPort, true},
+	} {
+		report := &HealthReport{Ready: instance.ready}
+		instance.server.SetHealthReporter(func() *HealthReport {
+			return report
+		})
+		instance.server.StartServer(
+			Config{
+				CheckOrigin: false,
+				Hostname:    defaultHostname,
+				Port:        instance.port,
+			},
+			generateDecryptorRequester(true, true),
+			createSuccessUnsubsriberNoCalls(),
+			createSuccessStatusSubscriberNoCalls(),
+			log,
+		)
+		defer instance.server.SetHealthReporter(nil)
+		defer instance.server.ShutdownServer()
+	}
+
+	// Each instance uses its own handlers and reporter
+	if code, _ := getHealthOnPort(t, defaultPort, readinessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("Default server should use its own health reporter. code=%v", code)
+	}
+	if code, _ := getHealthOnPort(t, otherPort, readinessPath); code != http.StatusOK {
+		t.Errorf("Separate server should use its own health reporter. code=%v", code)
+	}
+}
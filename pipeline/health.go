@@ -0,0 +1,124 @@
+/*
+	Health and readiness endpoints
+*/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	healthPath    string = "/healthz"
+	readinessPath string = "/readyz"
+)
+
+/*
+	State of the node (reported by the daemon)
+*/
+type HealthReport struct {
+	// Node finished starting up (root user created)
+	Ready bool
+
+	// Running state by subsystem name
+	Subsystems map[string]bool
+}
+
+type HealthReporter func() *HealthReport
+
+func (sv *Server) SetHealthReporter(healthReporter HealthReporter) {
+	sv.lock.Lock()
+	sv.healthReporter = healthReporter
+	sv.lock.Unlock()
+}
+
+/*
+	Response structure
+*/
+type SubsystemState string
+
+const (
+	RunningState SubsystemState = "running"
+	StoppedState SubsystemState = "stopped"
+)
+
+const (
+	healthyStatus   string = "ok"
+	unhealthyStatus string = "unavailable"
+)
+
+type HealthResponse struct {
+	Status     string                    `json:"status"`
+	Ready      bool                      `json:"ready"`
+	Subsystems map[string]SubsystemState `json:"subsystems"`
+}
+
+/*
+	Builds response (healthy if all subsystems are running)
+*/
+func (sv *Server) makeHealthResponse() (*HealthResponse, bool) {
+	sv.lock.RLock()
+	healthReporter := sv.healthReporter
+	isRunning := sv.isRunning
+	sv.lock.RUnlock()
+
+	report := &HealthReport{}
+	if healthReporter != nil {
+		report = healthReporter()
+	}
+
+	response := &HealthResponse{
+		Status: healthyStatus,
+		Ready:  report.Ready,
+		Subsystems: map[string]SubsystemState{
+			"pipeline": subsystemState(isRunning),
+		},
+	}
+	healthy := isRunning
+	for subsystem, subsystemRunning := range report.Subsystems {
+		response.Subsystems[subsystem] = subsystemState(subsystemRunning)
+		healthy = healthy && subsystemRunning
+	}
+	if !healthy {
+		response.Status = unhealthyStatus
+	}
+
+	return response, healthy
+}
+
+func subsystemState(running bool) SubsystemState {
+	if running {
+		return RunningState
+	}
+	return StoppedState
+}
+
+/*
+	Handlers
+*/
+
+func (sv *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	response, healthy := sv.makeHealthResponse()
+	writeHealthResponse(w, response, healthy)
+}
+
+// Ready once startup is done and while all subsystems are running
+func (sv *Server) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	response, healthy := sv.makeHealthResponse()
+	ready := healthy && response.Ready
+	if !ready {
+		response.Status = unhealthyStatus
+	}
+	writeHealthResponse(w, response, ready)
+}
+
+func writeHealthResponse(w http.ResponseWriter, response *HealthResponse, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -5,6 +5,7 @@
 package pipeline
 
 import (
+	"context"
 	"errors"
 	"github.com/gorilla/websocket"
 	"github.com/mngharbi/DMPC/channels"
@@ -72,7 +73,7 @@ func sendUnsubsriberResponseAfterRandomDelay(channel chan *channels.ListenersRes
 
 func createUnsubsriber(response channels.ListenersResponse, errReturned error, closeChannel bool) (channels.ListenersRequester, chan interface{}) {
 	callsChannel := make(chan interface{}, 0)
-	requester := func(request interface{}) (chan *channels.ListenersResponse, error) {
+	requester := func(_ context.Context, request interface{}) (chan *channels.ListenersResponse, error) {
 		go func() {
 			callsChannel <- request
 		}()
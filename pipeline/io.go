@@ -14,6 +14,7 @@ import (
 */
 
 type Conversation struct {
+	server                   *Server
 	socket                   *websocket.Conn
 	incomingQueue            chan *core.Transaction
 	quitChannel              chan bool
@@ -23,7 +24,12 @@ type Conversation struct {
 }
 
 func NewConversation(socket *websocket.Conn) {
+	defaultServer.NewConversation(socket)
+}
+
+func (sv *Server) NewConversation(socket *websocket.Conn) {
 	c := &Conversation{
+		server:                   sv,
 		socket:                   socket,
 		incomingQueue:            make(chan *core.Transaction),
 		quitChannel:              make(chan bool, 1),
@@ -31,6 +37,7 @@ func NewConversation(socket *websocket.Conn) {
 		transactionConversations: []*TransactionConversation{},
 		lock:                     &sync.Mutex{},
 	}
+	sv.openConversationsMetric.Inc()
 
 	go c.reader()
 	go c.dispatcher()
@@ -47,7 +54,7 @@ func (c *Conversation) reader() {
 			close(c.incomingQueue)
 			break
 		}
-		log.Debugf(readTransactionLogMsg)
+		c.server.log.Debugf(readTransactionLogMsg)
 		c.incomingQueue <- transaction
 	}
 }
@@ -57,6 +64,7 @@ func (c *Conversation) dispatcher() {
 		c.dispatch(transaction)
 	}
 	c.informQuit()
+	c.server.openConversationsMetric.Dec()
 }
 
 /*
@@ -107,7 +115,7 @@ func (c *Conversation) read() *core.Transaction {
 		c.normalClose()
 		return nil
 	} else if err != nil {
-		log.Infof(invalidTransactionLogMsg)
+		c.server.log.Infof(invalidTransactionLogMsg)
 		c.invalidClose()
 		return nil
 	}
@@ -166,11 +174,13 @@ func (tc *TransactionConversation) responseDrainer(lastStatusUpdate *status.Stat
 }
 
 func (tc *TransactionConversation) writer() {
+	sv := tc.parentConversation.server
+
 	// Make request to executor
-	channel, errs := passTransaction(tc.transaction)
+	channel, errs := sv.passTransaction(tc.transaction)
 	if errs != nil {
 		tc.parentConversation.invalidClose()
-		log.Debugf(transactionRejected, errs)
+		sv.log.Debugf(transactionRejected, errs)
 		return
 	}
 
@@ -178,7 +188,7 @@ func (tc *TransactionConversation) writer() {
 	nativeResp := <-channel
 	if nativeResp == nil {
 		tc.parentConversation.invalidClose()
-		log.Debugf(invalidDecryptorResponse, nativeResp)
+		sv.log.Debugf(invalidDecryptorResponse, nativeResp)
 		return
 	}
 	resp := (*nativeResp).(*decryptor.DecryptorResponse)
@@ -187,11 +197,12 @@ func (tc *TransactionConversation) writer() {
 		return
 	}
 	ticket := resp.Ticket
+	sv.record(tc.transaction)
 
 	// Listen to updates on ticket
-	updateChannel, err := getStatusUpdateChannel(ticket)
+	updateChannel, err := sv.getStatusUpdateChannel(ticket)
 	if err != nil {
-		log.Debugf(updateChannelFailureLogMsg, ticket, err)
+		sv.log.Debugf(updateChannelFailureLogMsg, ticket, err)
 		return
 	}
 
@@ -222,8 +233,8 @@ func (tc *TransactionConversation) writer() {
 	subscriberId, hasSubscriber := lastStatusUpdate.GetSubscriberId()
 	if hasSubscriber {
 		channelId, _ := lastStatusUpdate.GetChannelId()
-		if err = doUnsubscribe(channelId, subscriberId); err != nil {
-			log.Debugf(unsubscribeFailedLogMsg, ticket, err)
+		if err = sv.doUnsubscribe(channelId, subscriberId); err != nil {
+			sv.log.Debugf(unsubscribeFailedLogMsg, ticket, err)
 			return
 		}
 	}
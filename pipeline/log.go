@@ -13,6 +13,8 @@ const (
 	invalidDecryptorResponse   string = "Decryptor has invalid response. response=%+v"
 	updateChannelFailureLogMsg string = "Ticket[%v]: Failed to get status update channel. err=%+v"
 	unsubscribeFailedLogMsg    string = "Ticket[%v]: Failed to unsubscribe. err=%+v"
+	reloadedConfigLogMsg       string = "Pipeline server configuration reloaded"
+	recordFailedLogMsg         string = "Failed to record transaction. err=%+v"
 )
 
 /*
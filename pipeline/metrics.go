@@ -0,0 +1,12 @@
+package pipeline
+
+import (
+	"github.com/mngharbi/DMPC/core"
+)
+
+/*
+	Websocket conversations metrics
+*/
+func newOpenConversationsMetric(registry *core.MetricsRegistry) *core.Gauge {
+	return registry.Gauge("dmpc_pipeline_conversations", "Open websocket conversations.")
+}
@@ -0,0 +1,86 @@
+/*
+	Recording of accepted transactions (one JSON record per line)
+*/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	Structure of a recorded transaction
+*/
+type RecordedTransaction struct {
+	// Time transaction was accepted (used to preserve timing on replay)
+	Time        time.Time         `json:"time"`
+	Transaction *core.Transaction `json:"transaction"`
+}
+
+/*
+	Appends transactions to a file
+*/
+type Recorder struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+func (rec *Recorder) Record(transaction *core.Transaction) error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.file == nil {
+		return os.ErrClosed
+	}
+	return rec.encoder.Encode(&RecordedTransaction{
+		Time:        time.Now(),
+		Transaction: transaction,
+	})
+}
+
+func (rec *Recorder) Close() error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.file == nil {
+		return nil
+	}
+	err := rec.file.Close()
+	rec.file = nil
+	return err
+}
+
+/*
+	Recorder used by server (nil disables recording)
+*/
+func (sv *Server) SetRecorder(recorder *Recorder) {
+	sv.lock.Lock()
+	sv.recorder = recorder
+	sv.lock.Unlock()
+}
+
+func (sv *Server) record(transaction *core.Transaction) {
+	sv.lock.RLock()
+	recorder := sv.recorder
+	sv.lock.RUnlock()
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Record(transaction); err != nil {
+		sv.log.Warnf(recordFailedLogMsg, err)
+	}
+}
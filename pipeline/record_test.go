@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readRecords(t *testing.T, path string) []*RecordedTransaction {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open record file. err=%v", err)
+	}
+	defer file.Close()
+
+	records := []*RecordedTransaction{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &RecordedTransaction{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatalf("Record line should be valid JSON. err=%v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func startRecordingServer(t *testing.T, accept bool, path string) *Server {
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("Failed to make recorder. err=%v", err)
+	}
+	sv := NewServer(core.NewMetricsRegistry())
+	sv.SetRecorder(recorder)
+	sv.StartServer(
+		Config{
+			CheckOrigin: false,
+			Hostname:    defaultHostname,
+			Port:        defaultPort,
+		},
+		generateDecryptorRequester(true, accept),
+		createSuccessUnsubsriberNoCalls(),
+		createSuccessStatusSubscriberNoCalls(),
+		log,
+	)
+	return sv
+}
+
+func TestRecordAcceptedTransactions(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "pipeline_record")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "record.jsonl")
+
+	// Rejected transactions are not recorded
+	sv := startRecordingServer(t, false, path)
+	conn := openConnection(t)
+	if conn == nil {
+		return
+	}
+	if !sendMessage(t, conn, generateValidTransactionJson(true, true, false)) {
+		return
+	}
+	if !waitForConnectionClosure(t, conn) {
+		return
+	}
+	sv.ShutdownServer()
+	sv.recorder.Close()
+	if records := readRecords(t, path); len(records) != 0 {
+		t.Errorf("Rejected transaction should not be recorded. records=%+v", records)
+	}
+
+	// Accepted transactions are appended
+	for i := 1; i <= 2; i++ {
+		sv = startRecordingServer(t, true, path)
+		conn = openConnection(t)
+		if conn == nil {
+			return
+		}
+		if !testValidTransactionWithConn(t, conn, true, true, false) {
+			return
+		}
+		if !waitForConnectionClosure(t, conn) {
+			return
+		}
+		sv.ShutdownServer()
+		sv.recorder.Close()
+
+		records := readRecords(t, path)
+		if len(records) != i {
+			t.Errorf("Accepted transactions should be appended. expected=%v records=%v", i, len(records))
+			return
+		}
+		last := records[i-1]
+		if last.Transaction == nil || !last.Transaction.Pipeline.ReadStatusUpdates || last.Time.IsZero() {
+			t.Errorf("Recorded transaction should match transaction sent. record=%+v", last)
+		}
+	}
+}
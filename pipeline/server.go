@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"github.com/gorilla/websocket"
 	"github.com/mngharbi/DMPC/channels"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/DMPC/decryptor"
 	"github.com/mngharbi/DMPC/status"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 /*
@@ -20,41 +25,74 @@ type Config struct {
 }
 
 /*
-	Server structure
+	Pipeline instance (package functions use a default instance)
 */
-type server struct {
+type Server struct {
+	lock             sync.RWMutex
+	config           Config
 	isRunning        bool
 	isInitialized    bool
+	mux              *http.ServeMux
 	handler          *http.Server
 	listener         net.Listener
 	requester        decryptor.Requester
 	unsubscriber     channels.ListenersRequester
 	statusSubscriber status.Subscriber
+	healthReporter   HealthReporter
+	recorder         *Recorder
+	log              *core.LoggingHandler
+
+	// Origin check follows current configuration (can change while running)
+	checkOriginEnabled int32
+
+	// Open websocket conversations
+	openConversationsMetric *core.Gauge
+}
+
+func NewServer(metricsRegistry *core.MetricsRegistry) *Server {
+	return &Server{
+		openConversationsMetric: newOpenConversationsMetric(metricsRegistry),
+	}
+}
+
+var defaultServer *Server = NewServer(core.Metrics)
+
+// Instance used by package functions
+func DefaultServer() *Server {
+	return defaultServer
 }
 
 /*
 	Resets listener and handlers
 */
-func (sv *server) reset(config Config, requester decryptor.Requester, unsubscriber channels.ListenersRequester, statusSubscriber status.Subscriber) {
+func (sv *Server) reset(config Config, requester decryptor.Requester, unsubscriber channels.ListenersRequester, statusSubscriber status.Subscriber) error {
 	// Initialize handler
 	if !sv.isInitialized {
-		upgrader := makeUpgrader(config)
+		upgrader := sv.makeUpgrader()
+		sv.mux = http.NewServeMux()
 
 		// Upgrade HTTP requests to websockets and start conversation
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			log.Debugf(connectionRequestedLogMsg)
+		sv.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			sv.log.Debugf(connectionRequestedLogMsg)
 			socket, _ := upgrader.Upgrade(w, r, nil)
-			NewConversation(socket)
+			sv.NewConversation(socket)
 		})
+
+		// Health and readiness of the node
+		sv.mux.HandleFunc(healthPath, sv.serveHealth)
+		sv.mux.HandleFunc(readinessPath, sv.serveReadiness)
 	}
 	sv.isInitialized = true
 
 	// Make server handler
 	addrString := config.makeAddrString()
 	serverHandler := &http.Server{
-		Addr: addrString,
+		Addr:    addrString,
+		Handler: sv.mux,
 	}
 	sv.handler = serverHandler
+	sv.config = config
+	sv.setCheckOrigin(config.CheckOrigin)
 	sv.requester = requester
 	sv.unsubscriber = unsubscriber
 	sv.statusSubscriber = statusSubscriber
@@ -63,7 +101,7 @@ func (sv *server) reset(config Config, requester decryptor.Requester, unsubscrib
 	var err error
 	sv.listener, err = net.Listen("tcp", addrString)
 	if err != nil {
-		log.Fatalf(serverCannotListenErrorMsg, addrString, err)
+		return err
 	}
 
 	// Mark as running
@@ -71,45 +109,69 @@ func (sv *server) reset(config Config, requester decryptor.Requester, unsubscrib
 
 	// Start serving in separate goroutine
 	go serverHandler.Serve(sv.listener)
+
+	return nil
 }
 
 /*
 	Starts server by resetting it if it's not already running
 */
-func (sv *server) start(config Config, requester decryptor.Requester, unsubscriber channels.ListenersRequester, statusSubscriber status.Subscriber) {
+func (sv *Server) start(config Config, requester decryptor.Requester, unsubscriber channels.ListenersRequester, statusSubscriber status.Subscriber) error {
 	if !sv.isRunning {
-		log.Debugf(startLogMsg)
-		sv.reset(config, requester, unsubscriber, statusSubscriber)
-		log.Infof(startListeningInfoMsg, config.Port)
+		sv.log.Debugf(startLogMsg)
+		if err := sv.reset(config, requester, unsubscriber, statusSubscriber); err != nil {
+			return err
+		}
+		sv.log.Infof(startListeningInfoMsg, config.Port)
 	}
+	return nil
 }
 
 /*
 	Shuts down server if it's running
 */
-func (sv *server) shutdown() {
+func (sv *Server) shutdown() {
 	if sv.isRunning {
-		log.Debugf(shutdownLogMsg)
+		sv.log.Debugf(shutdownLogMsg)
 		sv.isRunning = false
 		sv.requester = nil
 		sv.handler.Shutdown(nil)
 		sv.listener.Close()
-		log.Infof(shutdownInfoMsg)
+		sv.log.Infof(shutdownInfoMsg)
 	}
 }
 
 /*
 	Utilities
 */
-func makeUpgrader(config Config) websocket.Upgrader {
-	var checkOriginLambda func(*http.Request) bool = nil
-	if !config.CheckOrigin {
-		checkOriginLambda = func(*http.Request) bool { return true }
+func (sv *Server) makeUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin: sv.checkOrigin,
 	}
+}
 
-	return websocket.Upgrader{
-		CheckOrigin: checkOriginLambda,
+func (sv *Server) setCheckOrigin(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&sv.checkOriginEnabled, value)
+}
+
+func (sv *Server) checkOrigin(r *http.Request) bool {
+	return atomic.LoadInt32(&sv.checkOriginEnabled) == 0 || isSameOrigin(r)
+}
+
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header["Origin"]
+	if len(origin) == 0 {
+		return true
+	}
+	originUrl, err := url.Parse(origin[0])
+	if err != nil {
+		return false
 	}
+	return strings.EqualFold(originUrl.Host, r.Host)
 }
 
 func makeAddrString(hostname string, port int) string {
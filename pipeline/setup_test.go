@@ -10,6 +10,11 @@ import (
 	"testing"
 )
 
+/*
+	Logging passed to servers started in tests
+*/
+var log *core.LoggingHandler
+
 func TestMain(m *testing.M) {
 	log = core.InitializeLogging()
 	log.SetLogLevel(core.WARN)
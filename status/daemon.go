@@ -6,46 +6,126 @@ package status
 
 import (
 	"github.com/mngharbi/DMPC/core"
+	"github.com/mngharbi/memstore"
 	"sync"
 )
 
-var (
-	serversStartWaitGroup sync.WaitGroup
-)
-
 /*
-	Logging
+	Status instance (package functions use a default instance)
 */
-var (
+type Subsystem struct {
+	statusServer    *statusServer
+	listenersServer *listenersServer
+
+	// Stores shared by both servers
+	statusStore    *memstore.Memstore
+	listenersStore *memstore.Memstore
+
+	serversStartWaitGroup sync.WaitGroup
+
+	// Logging and fatal error handling
 	log             *core.LoggingHandler
 	shutdownProgram core.ShutdownLambda
-)
+
+	// Request and status records metrics
+	metrics *subsystemMetrics
+}
+
+func NewSubsystem(metricsRegistry *core.MetricsRegistry) *Subsystem {
+	subsystem := &Subsystem{
+		metrics: newSubsystemMetrics(metricsRegistry),
+	}
+	subsystem.statusServer = &statusServer{
+		subsystem: subsystem,
+		handler:   core.ProvisionServer(),
+	}
+	subsystem.listenersServer = &listenersServer{
+		subsystem: subsystem,
+		handler:   core.ProvisionServer(),
+	}
+	return subsystem
+}
+
+var defaultSubsystem *Subsystem = NewSubsystem(core.Metrics)
+
+// Instance used by package functions
+func DefaultSubsystem() *Subsystem {
+	return defaultSubsystem
+}
 
 /*
-	Logging
+	Server API
 */
+
 func StartServers(
 	statusConf StatusServerConfig,
 	listenersConf ListenersServerConfig,
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) error {
-	log = loggingHandler
-	shutdownProgram = shutdownLambda
-	serversStartWaitGroup.Add(2)
-	if err := startStatusServer(statusConf); err != nil {
-		serversStartWaitGroup = sync.WaitGroup{}
+	return defaultSubsystem.StartServers(statusConf, listenersConf, loggingHandler, shutdownLambda)
+}
+
+func ShutdownServers() {
+	defaultSubsystem.ShutdownServers()
+}
+
+func ResizeServers(statusConf StatusServerConfig, listenersConf ListenersServerConfig) error {
+	return defaultSubsystem.ResizeServers(statusConf, listenersConf)
+}
+
+func IsRunning() bool {
+	return defaultSubsystem.IsRunning()
+}
+
+func UpdateStatus(ticket Ticket, status StatusCode, failReason FailReasonCode, payload interface{}, errs []error) error {
+	return defaultSubsystem.UpdateStatus(ticket, status, failReason, payload, errs)
+}
+
+func AddListener(ticket Ticket) (UpdateChannel, error) {
+	return defaultSubsystem.AddListener(ticket)
+}
+
+/*
+	Instance API
+*/
+
+func (subsystem *Subsystem) StartServers(
+	statusConf StatusServerConfig,
+	listenersConf ListenersServerConfig,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) error {
+	subsystem.log = loggingHandler
+	subsystem.shutdownProgram = shutdownLambda
+	subsystem.serversStartWaitGroup.Add(2)
+	if err := subsystem.startStatusServer(statusConf); err != nil {
+		subsystem.serversStartWaitGroup = sync.WaitGroup{}
 		return err
 	}
-	if err := startListenersServer(listenersConf); err != nil {
-		serversStartWaitGroup = sync.WaitGroup{}
+	if err := subsystem.startListenersServer(listenersConf); err != nil {
+		subsystem.serversStartWaitGroup = sync.WaitGroup{}
 		return err
 	}
-	serversStartWaitGroup.Wait()
+	subsystem.serversStartWaitGroup.Wait()
 	return nil
 }
 
-func ShutdownServers() {
-	shutdownStatusServer()
-	shutdownListenersServer()
+func (subsystem *Subsystem) ShutdownServers() {
+	subsystem.shutdownStatusServer()
+	subsystem.shutdownListenersServer()
+}
+
+// Running requests are not dropped
+func (subsystem *Subsystem) ResizeServers(statusConf StatusServerConfig, listenersConf ListenersServerConfig) error {
+	if err := subsystem.resizeStatusServer(statusConf); err != nil {
+		return err
+	}
+	return subsystem.resizeListenersServer(listenersConf)
+}
+
+// All servers are running
+func (subsystem *Subsystem) IsRunning() bool {
+	return subsystem.statusServer.state.IsRunning() &&
+		subsystem.listenersServer.state.IsRunning()
 }
@@ -1,7 +1,6 @@
 package status
 
 import (
-	"sync"
 	"testing"
 )
 
@@ -13,9 +12,7 @@ func TestStartShutdown(t *testing.T) {
 }
 
 func TestStartServersFailure(t *testing.T) {
-	serversStartWaitGroup = sync.WaitGroup{}
-	statusServerSingleton = statusServer{}
-	listenersServerSingleton = listenersServer{}
+	resetSubsystem()
 	statusConf := multipleWorkersStatusConfig()
 	listenersConf := multipleWorkersListenersConfig()
 
@@ -23,21 +20,21 @@ func TestStartServersFailure(t *testing.T) {
 	if !startStatusServerAndTest(t, statusConf) {
 		return
 	}
-	serversStartWaitGroup.Wait()
+	defaultSubsystem.serversStartWaitGroup.Wait()
 	if startBothServersAndTest(t, statusConf, listenersConf, true) {
 		t.Errorf("Servers start should fail if status server was up.")
 		return
 	}
-	shutdownStatusServer()
+	defaultSubsystem.shutdownStatusServer()
 
 	// Test listeners server failure
 	if !startListenersServerAndTest(t, listenersConf) {
 		return
 	}
-	serversStartWaitGroup.Wait()
+	defaultSubsystem.serversStartWaitGroup.Wait()
 	if startBothServersAndTest(t, statusConf, listenersConf, true) {
 		t.Errorf("Servers start should fail if listeners server was up.")
 		return
 	}
-	shutdownListenersServer()
+	defaultSubsystem.shutdownListenersServer()
 }
@@ -6,6 +6,7 @@ package status
 
 import (
 	"encoding/json"
+	"github.com/mngharbi/DMPC/core"
 	"math/rand"
 	"sync"
 	"testing"
@@ -25,10 +26,17 @@ func shuffleStatusRecords(src []*StatusRecord) {
 	}
 }
 
+// Replaces default instance (servers log to the test logging handler)
+func resetSubsystem() {
+	defaultSubsystem = NewSubsystem(core.Metrics)
+	defaultSubsystem.log = log
+	defaultSubsystem.shutdownProgram = shutdownProgram
+}
+
 func startStatusServerAndTest(t *testing.T, conf StatusServerConfig) bool {
-	serversStartWaitGroup = sync.WaitGroup{}
-	serversStartWaitGroup.Add(1)
-	if err := startStatusServer(conf); err != nil {
+	defaultSubsystem.serversStartWaitGroup = sync.WaitGroup{}
+	defaultSubsystem.serversStartWaitGroup.Add(1)
+	if err := defaultSubsystem.startStatusServer(conf); err != nil {
 		t.Errorf(err.Error())
 		return false
 	}
@@ -36,7 +44,7 @@ func startStatusServerAndTest(t *testing.T, conf StatusServerConfig) bool {
 }
 
 func resetAndStartStatusServer(t *testing.T, conf StatusServerConfig) bool {
-	statusServerSingleton = statusServer{}
+	resetSubsystem()
 	return startStatusServerAndTest(t, conf)
 }
 
@@ -47,9 +55,9 @@ func multipleWorkersStatusConfig() StatusServerConfig {
 }
 
 func startListenersServerAndTest(t *testing.T, conf ListenersServerConfig) bool {
-	serversStartWaitGroup = sync.WaitGroup{}
-	serversStartWaitGroup.Add(1)
-	if err := startListenersServer(conf); err != nil {
+	defaultSubsystem.serversStartWaitGroup = sync.WaitGroup{}
+	defaultSubsystem.serversStartWaitGroup.Add(1)
+	if err := defaultSubsystem.startListenersServer(conf); err != nil {
 		t.Errorf(err.Error())
 		return false
 	}
@@ -57,7 +65,7 @@ func startListenersServerAndTest(t *testing.T, conf ListenersServerConfig) bool
 }
 
 func resetAndStartListenersServer(t *testing.T, conf ListenersServerConfig) bool {
-	listenersServerSingleton = listenersServer{}
+	resetSubsystem()
 	return startListenersServerAndTest(t, conf)
 }
 
@@ -68,7 +76,7 @@ func multipleWorkersListenersConfig() ListenersServerConfig {
 }
 
 func startBothServersAndTest(t *testing.T, statusConf StatusServerConfig, listenersConf ListenersServerConfig, ignoreError bool) bool {
-	serversStartWaitGroup = sync.WaitGroup{}
+	defaultSubsystem.serversStartWaitGroup = sync.WaitGroup{}
 	if err := StartServers(statusConf, listenersConf, log, shutdownProgram); err != nil {
 		if !ignoreError {
 			t.Errorf(err.Error())
@@ -79,8 +87,7 @@ func startBothServersAndTest(t *testing.T, statusConf StatusServerConfig, listen
 }
 
 func resetAndStartBothServers(t *testing.T, statusConf StatusServerConfig, listenersConf ListenersServerConfig, ignoreError bool) bool {
-	statusServerSingleton = statusServer{}
-	listenersServerSingleton = listenersServer{}
+	resetSubsystem()
 	return startBothServersAndTest(t, statusConf, listenersConf, ignoreError)
 }
 
@@ -21,7 +21,7 @@ func TestIsolatedListeners(t *testing.T) {
 		_, _ = AddListener(RequestNewTicket())
 	}
 	ShutdownServers()
-	if listenersStore.Len() != numIsolatedTickets || statusStore.Len() != numIsolatedTickets {
+	if defaultSubsystem.listenersStore.Len() != numIsolatedTickets || defaultSubsystem.statusStore.Len() != numIsolatedTickets {
 		t.Errorf("Creating listeners for different tickets should create different status and listener records")
 	}
 
@@ -35,7 +35,7 @@ func TestIsolatedListeners(t *testing.T) {
 		_, _ = AddListener(ticket)
 	}
 	ShutdownServers()
-	if listenersStore.Len() != 1 || statusStore.Len() != 1 {
+	if defaultSubsystem.listenersStore.Len() != 1 || defaultSubsystem.statusStore.Len() != 1 {
 		t.Errorf("Creating listeners for the same ticket should create one status and listener record")
 	}
 }
@@ -130,7 +130,7 @@ func TestFinalUpdate(t *testing.T) {
 		channels = append(channels, channel)
 	}
 	ShutdownServers()
-	if listenersStore.Len() != 1 || statusStore.Len() != 1 {
+	if defaultSubsystem.listenersStore.Len() != 1 || defaultSubsystem.statusStore.Len() != 1 {
 		t.Errorf("Creating listeners for the same ticket should create one status and listener record")
 	}
 
@@ -157,7 +157,7 @@ func TestFinalUpdate(t *testing.T) {
 			t.Errorf("After final update, listeners channels should be closed")
 		}
 	}
-	if listenersStore.Len() != 0 || statusStore.Len() != 1 {
+	if defaultSubsystem.listenersStore.Len() != 0 || defaultSubsystem.statusStore.Len() != 1 {
 		t.Errorf("After final update, listeners record should be deleted")
 	}
 
@@ -185,7 +185,7 @@ func TestConcurrentUpdates(t *testing.T) {
 	numTickets := 10
 	numListeners := 100
 	numListenersTotal := numTickets * numListeners
-	numStatusUpdates := numTickets * (len(statusCodes) - 1)
+	numStatusUpdates := numTickets * (len(statusCodes) - 2)
 	group.Add(numListenersTotal + numStatusUpdates)
 
 	// Generate tickets
@@ -194,10 +194,10 @@ func TestConcurrentUpdates(t *testing.T) {
 		tickets = append(tickets, RequestNewTicket())
 	}
 
-	// Generate all possible status updates
+	// Generate all possible status updates (except failed and cancelled)
 	statusUpdates := []*StatusRecord{}
 	for _, ticket := range tickets {
-		for status_idx := 0; status_idx < len(statusCodes)-1; status_idx++ {
+		for status_idx := 0; status_idx < len(statusCodes)-2; status_idx++ {
 			statusCode := StatusCode(statusCodes[status_idx])
 			statusUpdates = append(statusUpdates, &StatusRecord{
 				Id:         ticket,
@@ -249,10 +249,10 @@ func TestConcurrentUpdates(t *testing.T) {
 	if len(statusUpdates) != numStatusUpdates {
 		t.Errorf("Total number of status updates doesn't match expected number.")
 	}
-	if listenersStore.Len() != 0 {
+	if defaultSubsystem.listenersStore.Len() != 0 {
 		t.Errorf("All listeners records should be deleted after final update.")
 	}
-	if statusStore.Len() != numTickets {
+	if defaultSubsystem.statusStore.Len() != numTickets {
 		t.Errorf("There should be as many status records as tickets.")
 	}
 	for _, channel := range channels {
@@ -1,6 +1,7 @@
 package status
 
 import (
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
 	"sync"
@@ -21,42 +22,40 @@ type ListenersServerConfig struct {
 	NumWorkers int
 }
 
-func provisionListenersServerOnce() {
-	if listenersServerHandler == nil {
-		listenersServerHandler = gofarm.ProvisionServer()
+func (subsystem *Subsystem) startListenersServer(conf ListenersServerConfig) (err error) {
+	sv := subsystem.listenersServer
+	if !sv.isInitialized {
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
 	}
+	err = sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	subsystem.serversStartWaitGroup.Done()
+	return
 }
 
-func startListenersServer(conf ListenersServerConfig) (err error) {
-	provisionListenersServerOnce()
-	if !listenersServerSingleton.isInitialized {
-		listenersServerSingleton.isInitialized = true
-		listenersServerHandler.ResetServer()
-		listenersServerHandler.InitServer(&listenersServerSingleton)
-	}
-	err = listenersServerHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
-	serversStartWaitGroup.Done()
-	return
+func (subsystem *Subsystem) shutdownListenersServer() {
+	subsystem.listenersServer.handler.ShutdownServer()
 }
 
-func shutdownListenersServer() {
-	provisionListenersServerOnce()
-	listenersServerHandler.ShutdownServer()
+func (subsystem *Subsystem) resizeListenersServer(conf ListenersServerConfig) error {
+	return subsystem.listenersServer.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
-func AddListener(ticket Ticket) (UpdateChannel, error) {
-	log.Debugf(listenersReceivedRequestLogMsg)
+func (subsystem *Subsystem) AddListener(ticket Ticket) (UpdateChannel, error) {
+	subsystem.log.Debugf(listenersReceivedRequestLogMsg)
 	// Pass request to server to add it
 	listeningRequest := &listeningRequest{
 		ticket:  ticket,
 		channel: make(UpdateChannel, DefaultChannelBufferSize),
 	}
 
-	_, err := listenersServerHandler.MakeRequest(listeningRequest)
+	_, err := subsystem.listenersServer.handler.MakeRequest(listeningRequest)
 	if err != nil {
 		close(listeningRequest.channel)
 		return listeningRequest.channel, err
 	}
+	subsystem.metrics.listenersRequests.Queued()
 
 	return listeningRequest.channel, nil
 }
@@ -67,29 +66,28 @@ func AddListener(ticket Ticket) (UpdateChannel, error) {
 
 type listenersServer struct {
 	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
+	subsystem     *Subsystem
 }
 
-var (
-	listenersServerSingleton listenersServer
-	listenersServerHandler   *gofarm.ServerHandler
-	listenersStore           *memstore.Memstore
-)
-
 func (sv *listenersServer) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize store (only if starting for the first time)
 	if isFirstStart {
-		listenersStore = memstore.New(getListenersIndexes())
+		sv.subsystem.listenersStore = memstore.New(getListenersIndexes())
 	}
-	log.Debugf(listenersDaemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.subsystem.log.Debugf(listenersDaemonStartLogMsg)
 	return nil
 }
 
 func (sv *listenersServer) Shutdown() error {
-	log.Debugf(listenersDaemonShutdownLogMsg)
+	sv.state.SetRunning(false)
+	sv.subsystem.log.Debugf(listenersDaemonShutdownLogMsg)
 	return nil
 }
 
-func doListenerServerWork(statusRecord *StatusRecord, channel UpdateChannel) {
+func (subsystem *Subsystem) doListenerServerWork(statusRecord *StatusRecord, channel UpdateChannel) {
 	// If status is done, we only need to put the last status
 	if statusRecord.IsDone() {
 		channel <- statusRecord
@@ -100,11 +98,11 @@ func doListenerServerWork(statusRecord *StatusRecord, channel UpdateChannel) {
 	// Read/Create and lock listeners record
 	newListenersRecord := makeEmptyListenersRecord(statusRecord.Id)
 	newListenersRecord.lock = &sync.Mutex{}
-	listenersRecordObj := listenersStore.AddOrGet(newListenersRecord).(*listenersRecord)
+	listenersRecordObj := subsystem.listenersStore.AddOrGet(newListenersRecord).(*listenersRecord)
 	listenersRecordObj.Lock()
 
 	// Read listeners record again
-	listenersRecordObj = listenersStore.Get(listenersRecordObj, listenersMemstoreId).(*listenersRecord)
+	listenersRecordObj = subsystem.listenersStore.Get(listenersRecordObj, listenersMemstoreId).(*listenersRecord)
 
 	// Add channel to listeners
 	listenersRecordObj.channels = append(listenersRecordObj.channels, channel)
@@ -113,20 +111,23 @@ func doListenerServerWork(statusRecord *StatusRecord, channel UpdateChannel) {
 }
 
 func (sv *listenersServer) Work(rq *gofarm.Request) (dummyReturnVal *gofarm.Response) {
-	log.Debugf(listenersRunningRequestLogMsg)
+	sv.subsystem.log.Debugf(listenersRunningRequestLogMsg)
 
 	dummyReturnVal = nil
 	listeningRequest := (*rq).(*listeningRequest)
 
+	observation := sv.subsystem.metrics.listenersRequests.Start(listenRequestLabel)
+	defer observation.Done(core.SuccessMetricsResult)
+
 	// Read/Create and read lock status record
 	newStatusRecord := makeStatusEmptyRecord(listeningRequest.ticket)
-	currentStatusRecord := newStatusRecord.createOrGet(statusStore)
+	currentStatusRecord := newStatusRecord.createOrGet(sv.subsystem.statusStore, sv.subsystem.metrics.statusRecords)
 	currentStatusRecord.RLock()
 
 	// Read record again (avoids race conditions)
-	currentStatusRecord = statusStore.Get(currentStatusRecord, statusMemstoreId).(*StatusRecord)
+	currentStatusRecord = sv.subsystem.statusStore.Get(currentStatusRecord, statusMemstoreId).(*StatusRecord)
 
-	doListenerServerWork(currentStatusRecord, listeningRequest.channel)
+	sv.subsystem.doListenerServerWork(currentStatusRecord, listeningRequest.channel)
 
 	currentStatusRecord.RUnlock()
 
@@ -8,7 +8,7 @@ func TestListenersStartShutdownMultipleWorker(t *testing.T) {
 	if !resetAndStartListenersServer(t, multipleWorkersListenersConfig()) {
 		return
 	}
-	shutdownListenersServer()
+	defaultSubsystem.shutdownListenersServer()
 }
 
 func TestAddListenerServerDown(t *testing.T) {
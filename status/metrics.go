@@ -0,0 +1,30 @@
+package status
+
+import (
+	"github.com/mngharbi/DMPC/core"
+)
+
+/*
+	Metrics of a status instance (registered in the registry it is made with)
+*/
+type subsystemMetrics struct {
+	// Request metrics (one worker pool per server)
+	statusRequests    *core.SubsystemMetrics
+	listenersRequests *core.SubsystemMetrics
+
+	// Status records by status code
+	statusRecords *core.Gauge
+}
+
+func newSubsystemMetrics(registry *core.MetricsRegistry) *subsystemMetrics {
+	return &subsystemMetrics{
+		statusRequests:    core.NewSubsystemMetrics(registry, "status"),
+		listenersRequests: core.NewSubsystemMetrics(registry, "status_listeners"),
+		statusRecords:     registry.Gauge("dmpc_status_records", "Status records by status.", "status"),
+	}
+}
+
+const (
+	updateRequestLabel string = "update"
+	listenRequestLabel string = "listen"
+)
@@ -1,6 +1,7 @@
 package status
 
 import (
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
 )
@@ -18,31 +19,28 @@ type StatusServerConfig struct {
 	NumWorkers int
 }
 
-func provisionStatusServerOnce() {
-	if statusServerHandler == nil {
-		statusServerHandler = gofarm.ProvisionServer()
+func (subsystem *Subsystem) startStatusServer(conf StatusServerConfig) (err error) {
+	sv := subsystem.statusServer
+	if !sv.isInitialized {
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
 	}
+	err = sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	subsystem.serversStartWaitGroup.Done()
+	return
 }
 
-func startStatusServer(conf StatusServerConfig) (err error) {
-	provisionStatusServerOnce()
-	if !statusServerSingleton.isInitialized {
-		statusServerSingleton.isInitialized = true
-		statusServerHandler.ResetServer()
-		statusServerHandler.InitServer(&statusServerSingleton)
-	}
-	err = statusServerHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
-	serversStartWaitGroup.Done()
-	return
+func (subsystem *Subsystem) shutdownStatusServer() {
+	subsystem.statusServer.handler.ShutdownServer()
 }
 
-func shutdownStatusServer() {
-	provisionStatusServerOnce()
-	statusServerHandler.ShutdownServer()
+func (subsystem *Subsystem) resizeStatusServer(conf StatusServerConfig) error {
+	return subsystem.statusServer.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
-func UpdateStatus(ticket Ticket, status StatusCode, failReason FailReasonCode, payload interface{}, errs []error) error {
-	log.Debugf(updateReceivedRequestLogMsg)
+func (subsystem *Subsystem) UpdateStatus(ticket Ticket, status StatusCode, failReason FailReasonCode, payload interface{}, errs []error) error {
+	subsystem.log.Debugf(updateReceivedRequestLogMsg)
 
 	statusRecord := &StatusRecord{
 		Id:         ticket,
@@ -58,9 +56,10 @@ func UpdateStatus(ticket Ticket, status StatusCode, failReason FailReasonCode, p
 	}
 
 	// Make request to server
-	if _, err := statusServerHandler.MakeRequest(statusRecord); err != nil {
+	if _, err := subsystem.statusServer.handler.MakeRequest(statusRecord); err != nil {
 		return err
 	}
+	subsystem.metrics.statusRequests.Queued()
 
 	return nil
 }
@@ -71,34 +70,38 @@ func UpdateStatus(ticket Ticket, status StatusCode, failReason FailReasonCode, p
 
 type statusServer struct {
 	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
+	subsystem     *Subsystem
 }
 
-var (
-	statusServerSingleton statusServer
-	statusServerHandler   *gofarm.ServerHandler
-	statusStore           *memstore.Memstore
-)
-
 func (sv *statusServer) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize store (only if starting for the first time)
 	if isFirstStart {
-		statusStore = memstore.New(getStatusIndexes())
+		sv.subsystem.statusStore = memstore.New(getStatusIndexes())
 	}
-	log.Debugf(updateDaemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.subsystem.log.Debugf(updateDaemonStartLogMsg)
 	return nil
 }
 
 func (sv *statusServer) Shutdown() error {
-	log.Debugf(updateDaemonShutdownLogMsg)
+	sv.state.SetRunning(false)
+	sv.subsystem.log.Debugf(updateDaemonShutdownLogMsg)
 	return nil
 }
 
-func doStatusUpdate(currentRecord *StatusRecord, changedRecord *StatusRecord) {
+func (subsystem *Subsystem) doStatusUpdate(currentRecord *StatusRecord, changedRecord *StatusRecord) {
 	// Update record
+	previousStatus := currentRecord.Status
 	recordChanged := currentRecord.update(changedRecord)
 	if !recordChanged {
 		return
 	}
+	if currentRecord.Status != previousStatus {
+		subsystem.metrics.statusRecords.Dec(string(previousStatus))
+		subsystem.metrics.statusRecords.Inc(string(currentRecord.Status))
+	}
 
 	/*
 		Get listeners record
@@ -106,7 +109,7 @@ func doStatusUpdate(currentRecord *StatusRecord, changedRecord *StatusRecord) {
 		Note: listeners record is implicitly locked
 		because adding listeners takes a read lock on the status record
 	*/
-	listenersRecordItem := listenersStore.Get(makeEmptyListenersRecord(currentRecord.Id), listenersMemstoreId)
+	listenersRecordItem := subsystem.listenersStore.Get(makeEmptyListenersRecord(currentRecord.Id), listenersMemstoreId)
 	if listenersRecordItem == nil {
 		return
 	}
@@ -124,25 +127,28 @@ func doStatusUpdate(currentRecord *StatusRecord, changedRecord *StatusRecord) {
 		}
 		listenersRecord.channels = nil
 		listenersRecord.lock = nil
-		listenersStore.Delete(listenersRecord, listenersMemstoreId)
+		subsystem.listenersStore.Delete(listenersRecord, listenersMemstoreId)
 	}
 }
 
 func (sv *statusServer) Work(rq *gofarm.Request) (dummyReturnVal *gofarm.Response) {
-	log.Debugf(updateRunningRequestLogMsg)
+	sv.subsystem.log.Debugf(updateRunningRequestLogMsg)
 
 	dummyReturnVal = nil
 
+	observation := sv.subsystem.metrics.statusRequests.Start(updateRequestLabel)
+	defer observation.Done(core.SuccessMetricsResult)
+
 	changedRecord := (*rq).(*StatusRecord)
 
 	// Read/Create and write lock status record
-	currentRecord := changedRecord.createOrGet(statusStore)
+	currentRecord := changedRecord.createOrGet(sv.subsystem.statusStore, sv.subsystem.metrics.statusRecords)
 	currentRecord.Lock()
 
 	// Read status record again (avoids race conditions)
-	currentRecord = statusStore.Get(currentRecord, statusMemstoreId).(*StatusRecord)
+	currentRecord = sv.subsystem.statusStore.Get(currentRecord, statusMemstoreId).(*StatusRecord)
 
-	doStatusUpdate(currentRecord, changedRecord)
+	sv.subsystem.doStatusUpdate(currentRecord, changedRecord)
 
 	currentRecord.Unlock()
 
@@ -2,7 +2,7 @@ package status
 
 import (
 	"encoding/json"
-	"errors"
+	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/memstore"
 	"reflect"
 	"sync"
@@ -12,8 +12,8 @@ import (
 	Errors
 */
 var (
-	statusRangeError error = errors.New("Status code is out of bounds.")
-	failedRangeError error = errors.New("Failed status code is out of bounds.")
+	statusRangeError error = core.NewError(core.InvalidRequestErrorCode, "Status code is out of bounds.")
+	failedRangeError error = core.NewError(core.InvalidRequestErrorCode, "Failed status code is out of bounds.")
 )
 
 /*
@@ -22,27 +22,30 @@ var (
 type StatusCode string
 
 const (
-	NoStatus      StatusCode = "no_status"
-	QueuedStatus  StatusCode = "queued"
-	RunningStatus StatusCode = "running"
-	SuccessStatus StatusCode = "success"
-	FailedStatus  StatusCode = "failed"
+	NoStatus        StatusCode = "no_status"
+	QueuedStatus    StatusCode = "queued"
+	RunningStatus   StatusCode = "running"
+	SuccessStatus   StatusCode = "success"
+	FailedStatus    StatusCode = "failed"
+	CancelledStatus StatusCode = "cancelled"
 )
 
 var (
-	statusCodes [5]StatusCode = [5]StatusCode{
+	statusCodes [6]StatusCode = [6]StatusCode{
 		NoStatus,
 		QueuedStatus,
 		RunningStatus,
 		SuccessStatus,
 		FailedStatus,
+		CancelledStatus,
 	}
 	statusCodesOrder map[StatusCode]int = map[StatusCode]int{
-		NoStatus:      0,
-		QueuedStatus:  1,
-		RunningStatus: 2,
-		SuccessStatus: 3,
-		FailedStatus:  4,
+		NoStatus:        0,
+		QueuedStatus:    1,
+		RunningStatus:   2,
+		SuccessStatus:   3,
+		FailedStatus:    4,
+		CancelledStatus: 4,
 	}
 )
 
@@ -96,6 +99,34 @@ type ChannelResponse interface {
 	GetChannelId() string
 }
 
+/*
+	Errors are encoded as code/message pairs
+*/
+type statusRecordAlias StatusRecord
+
+type statusRecordEncoded struct {
+	*statusRecordAlias
+	Errs core.CodedErrors `json:"errors"`
+}
+
+func (rec *StatusRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&statusRecordEncoded{
+		statusRecordAlias: (*statusRecordAlias)(rec),
+		Errs:              core.ToCodedErrors(rec.Errs),
+	})
+}
+
+func (rec *StatusRecord) UnmarshalJSON(stream []byte) error {
+	encoded := &statusRecordEncoded{
+		statusRecordAlias: (*statusRecordAlias)(rec),
+	}
+	if err := json.Unmarshal(stream, encoded); err != nil {
+		return err
+	}
+	rec.Errs = encoded.Errs.Errors()
+	return nil
+}
+
 // *StatusRecord -> Json
 func (rec *StatusRecord) Encode() ([]byte, error) {
 	jsonStream, err := json.Marshal(rec)
@@ -112,7 +143,7 @@ func (rec *StatusRecord) GetResponse() ([]byte, bool) {
 		encoded, _ := rec.Encode()
 		return encoded, true
 	}
-	if rec.Status == FailedStatus {
+	if rec.Status == FailedStatus || rec.Status == CancelledStatus {
 		encoded, _ := rec.Encode()
 		return encoded, false
 	}
@@ -237,13 +268,17 @@ func (a *StatusRecord) isSame(b *StatusRecord) bool {
 		reflect.DeepEqual(a.Errs, b.Errs)
 }
 
-func (rec *StatusRecord) createOrGet(mem *memstore.Memstore) *StatusRecord {
+func (rec *StatusRecord) createOrGet(mem *memstore.Memstore, recordsMetric *core.Gauge) *StatusRecord {
 	rec.lock = &sync.RWMutex{}
-	return mem.AddOrGet(rec).(*StatusRecord)
+	storedRecord := mem.AddOrGet(rec).(*StatusRecord)
+	if storedRecord == rec {
+		recordsMetric.Inc(string(rec.Status))
+	}
+	return storedRecord
 }
 
 func (rec *StatusRecord) IsDone() bool {
-	return rec.Status == SuccessStatus || rec.Status == FailedStatus
+	return rec.Status == SuccessStatus || rec.Status == FailedStatus || rec.Status == CancelledStatus
 }
 
 func makeStatusEmptyRecord(id Ticket) *StatusRecord {
@@ -0,0 +1,47 @@
+package status
+
+import (
+	"errors"
+	"github.com/mngharbi/DMPC/core"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatusRecordErrorsEncoding(t *testing.T) {
+	rec := &StatusRecord{
+		Id:         RequestNewTicket(),
+		Status:     FailedStatus,
+		FailReason: RejectedReason,
+		Errs: []error{
+			core.NewError(core.ChannelNotOpenErrorCode, "Channel is not open."),
+			errors.New("Plain error."),
+		},
+	}
+
+	encoded, err := rec.Encode()
+	if err != nil {
+		t.Errorf("Encoding status record should not fail. err=%v", err)
+		return
+	}
+	expectedErrors := `"errors":[{"code":"channel_not_open","message":"Channel is not open."},{"code":"unknown","message":"Plain error."}]`
+	if !strings.Contains(string(encoded), expectedErrors) {
+		t.Errorf("Errors should be encoded as code/message pairs. encoded=%s", encoded)
+	}
+
+	decoded := &StatusRecord{}
+	if err = decoded.UnmarshalJSON(encoded); err != nil {
+		t.Errorf("Decoding status record should not fail. err=%v", err)
+		return
+	}
+	expectedDecodedErrors := []error{
+		core.NewError(core.ChannelNotOpenErrorCode, "Channel is not open."),
+		core.NewError(core.UnknownErrorCode, "Plain error."),
+	}
+	if decoded.Id != rec.Id ||
+		decoded.Status != rec.Status ||
+		decoded.FailReason != rec.FailReason ||
+		!reflect.DeepEqual(decoded.Errs, expectedDecodedErrors) {
+		t.Errorf("Decoded status record doesn't match. decoded=%+v", decoded)
+	}
+}
@@ -1,72 +1,96 @@
 package users
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/gofarm"
 	"github.com/mngharbi/memstore"
-	"sync"
 )
 
 /*
 	Lambda to send a request and signers to users subsystem
 */
-type Requester func(*core.VerifiedSigners, bool, bool, []byte) (chan *UserResponse, []error)
+type Requester func(context.Context, *core.VerifiedSigners, []byte) (chan *UserResponse, []error)
 
 /*
-	Logging
-*/
-var (
-	log             *core.LoggingHandler
-	shutdownProgram core.ShutdownLambda
-)
-
-/*
-	Server API
+	Server API (package functions use a default instance)
 */
 
 type Config struct {
 	NumWorkers int
 }
 
-func provisionServerOnce() {
-	if serverHandler == nil {
-		serverHandler = gofarm.ProvisionServer()
-	}
+func StartServer(
+	conf Config,
+	loggingHandler *core.LoggingHandler,
+	shutdownLambda core.ShutdownLambda,
+) error {
+	return defaultServer.StartServer(conf, loggingHandler, shutdownLambda)
 }
 
-func StartServer(
+func ShutdownServer() {
+	defaultServer.ShutdownServer()
+}
+
+func ResizeServer(conf Config) error {
+	return defaultServer.ResizeServer(conf)
+}
+
+func IsRunning() bool {
+	return defaultServer.IsRunning()
+}
+
+func MakeUnverifiedRequest(ctx context.Context, signers *core.VerifiedSigners, rawRequest []byte) (chan *UserResponse, []error) {
+	return defaultServer.MakeUnverifiedRequest(ctx, signers, rawRequest)
+}
+
+func MakeRequest(ctx context.Context, signers *core.VerifiedSigners, rawRequest []byte) (chan *UserResponse, []error) {
+	return defaultServer.MakeRequest(ctx, signers, rawRequest)
+}
+
+/*
+	Instance API
+*/
+
+func (sv *Server) StartServer(
 	conf Config,
 	loggingHandler *core.LoggingHandler,
 	shutdownLambda core.ShutdownLambda,
 ) error {
-	provisionServerOnce()
-	if !serverSingleton.isInitialized {
-		log = loggingHandler
-		shutdownProgram = shutdownLambda
-		serverSingleton.isInitialized = true
-		serverHandler.ResetServer()
-		serverHandler.InitServer(&serverSingleton)
+	if !sv.isInitialized {
+		sv.log = loggingHandler
+		sv.shutdownProgram = shutdownLambda
+		sv.isInitialized = true
+		sv.handler.ResetServer()
+		sv.handler.InitServer(sv)
 	}
-	return serverHandler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
+	return sv.handler.StartServer(gofarm.Config{NumWorkers: conf.NumWorkers})
 }
 
-func ShutdownServer() {
-	provisionServerOnce()
-	serverHandler.ShutdownServer()
+func (sv *Server) ShutdownServer() {
+	sv.handler.ShutdownServer()
+}
+
+// Running requests are not dropped
+func (sv *Server) ResizeServer(conf Config) error {
+	return sv.handler.Resize(gofarm.Config{NumWorkers: conf.NumWorkers})
+}
+
+func (sv *Server) IsRunning() bool {
+	return sv.state.IsRunning()
 }
 
-func MakeUnverifiedRequest(signers *core.VerifiedSigners, readLock bool, readUnlock bool, rawRequest []byte) (chan *UserResponse, []error) {
-	log.Debugf(receivedRequestLogMsg)
-	return makeEncodedRequest(signers, readLock, readUnlock, rawRequest, true)
+func (sv *Server) MakeUnverifiedRequest(ctx context.Context, signers *core.VerifiedSigners, rawRequest []byte) (chan *UserResponse, []error) {
+	sv.log.Debugf(receivedRequestLogMsg)
+	return sv.makeEncodedRequest(ctx, signers, rawRequest, true)
 }
 
-func MakeRequest(signers *core.VerifiedSigners, readLock bool, readUnlock bool, rawRequest []byte) (chan *UserResponse, []error) {
-	log.Debugf(receivedRequestLogMsg)
-	return makeEncodedRequest(signers, readLock, readUnlock, rawRequest, false)
+func (sv *Server) MakeRequest(ctx context.Context, signers *core.VerifiedSigners, rawRequest []byte) (chan *UserResponse, []error) {
+	sv.log.Debugf(receivedRequestLogMsg)
+	return sv.makeEncodedRequest(ctx, signers, rawRequest, false)
 }
 
-// @TODO: lock/unlock needs to be moved out to locker subsystem
-func makeEncodedRequest(signers *core.VerifiedSigners, readLock bool, readUnlock bool, rawRequest []byte, skipPermissions bool) (chan *UserResponse, []error) {
+func (sv *Server) makeEncodedRequest(ctx context.Context, signers *core.VerifiedSigners, rawRequest []byte, skipPermissions bool) (chan *UserResponse, []error) {
 	// Build request object
 	rqPtr := &UserRequest{}
 	rqPtr.skipPermissions = skipPermissions
@@ -78,34 +102,39 @@ func makeEncodedRequest(signers *core.VerifiedSigners, readLock bool, readUnlock
 	// Set issuer and certifier from arguments
 	rqPtr.addSigners(signers)
 
-	// Set read lock/unlock
-	rqPtr.ReadLock = readLock
-	rqPtr.ReadUnlock = readUnlock
-
-	return makeRequest(rqPtr)
+	return sv.makeRequest(ctx, rqPtr)
 }
 
-func makeRequest(rqPtr *UserRequest) (chan *UserResponse, []error) {
+func (sv *Server) makeRequest(ctx context.Context, rqPtr *UserRequest) (chan *UserResponse, []error) {
 	// Sanitize request
 	sanitizationErrors := rqPtr.sanitizeAndCheckParams()
 	if len(sanitizationErrors) != 0 {
 		return nil, sanitizationErrors
 	}
 
+	// Drop request if the requester is not waiting anymore
+	if err := core.ContextError(ctx); err != nil {
+		return nil, []error{err}
+	}
+
 	// Make request to server
-	nativeResponseChannel, err := serverHandler.MakeRequest(rqPtr)
+	nativeResponseChannel, err := sv.handler.MakeRequest(rqPtr)
 	if err != nil {
 		return nil, []error{err}
 	}
+	sv.metrics.Queued()
 
 	// Pass through result
 	responseChannel := make(chan *UserResponse)
 	go func() {
 		nativeResponse, ok := <-nativeResponseChannel
-		if ok {
-			responseChannel <- (*nativeResponse).(*UserResponse)
-		} else {
+		if !ok {
 			close(responseChannel)
+			return
+		}
+		select {
+		case responseChannel <- (*nativeResponse).(*UserResponse):
+		case <-ctx.Done():
 		}
 	}()
 
@@ -120,9 +149,35 @@ const (
 	idIndexStr string = "id"
 )
 
-type server struct {
+/*
+	Users instance
+*/
+type Server struct {
 	isInitialized bool
+	state         core.ServerState
+	handler       *core.ServerHandler
 	store         *memstore.Memstore
+
+	// Logging and fatal error handling
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+
+	// Request metrics
+	metrics *core.SubsystemMetrics
+}
+
+func NewServer(metricsRegistry *core.MetricsRegistry) *Server {
+	return &Server{
+		handler: core.ProvisionServer(),
+		metrics: core.NewSubsystemMetrics(metricsRegistry, "users"),
+	}
+}
+
+var defaultServer *Server = NewServer(core.Metrics)
+
+// Instance used by package functions
+func DefaultServer() *Server {
+	return defaultServer
 }
 
 // Indexes used to store users
@@ -137,112 +192,69 @@ func getIndexes() (res []string) {
 	return res
 }
 
-var serverSingleton server
-var serverHandler *gofarm.ServerHandler
-
-func (sv *server) Start(_ gofarm.Config, isFirstStart bool) error {
+func (sv *Server) Start(_ gofarm.Config, isFirstStart bool) error {
 	// Initialize store (only if starting for the first time)
 	if isFirstStart {
 		sv.store = memstore.New(getIndexes())
 	}
-	log.Debugf(daemonStartLogMsg)
+	sv.state.SetRunning(true)
+	sv.log.Debugf(daemonStartLogMsg)
 	return nil
 }
 
-func (sv *server) Shutdown() error {
-	log.Debugf(daemonShutdownLogMsg)
+func (sv *Server) Shutdown() error {
+	sv.state.SetRunning(false)
+	sv.log.Debugf(daemonShutdownLogMsg)
 	return nil
 }
 
-func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
-	log.Debugf(runningRequestLogMsg)
+func (sv *Server) Work(request *gofarm.Request) *gofarm.Response {
+	sv.log.Debugf(runningRequestLogMsg)
 
 	rq := (*request).(*UserRequest)
 
+	observation := sv.metrics.Start(requestTypeLabel(rq.Type))
+	response := sv.doRequest(rq)
+	observation.DoneWithSuccess((*response).(*UserResponse).Result == Success)
+
+	return response
+}
+
+func (sv *Server) doRequest(rq *UserRequest) *gofarm.Response {
 	/*
-		Handle record level locking
+		Read records involved (callers hold locks on them through the locker)
 	*/
 
-	lockNeeds := []core.LockNeed{}
-
-	// Add need for read locks for issuer and certifier
+	// Find user records for issuer and certifier
+	var certifier *userRecord
 	if !rq.skipPermissions {
-		lockNeeds = []core.LockNeed{
-			{core.ReadLockType, rq.signers.IssuerId},
-			{core.ReadLockType, rq.signers.CertifierId},
+		if readUserRecordById(sv.store, rq.signers.IssuerId) == nil {
+			return sv.failRequest(IssuerUnknownError)
 		}
-	}
-
-	// Add write lock for user record if updating
-	if rq.Type == UpdateRequest {
-		lockNeeds = append(lockNeeds, core.LockNeed{core.WriteLockType, rq.Data.Id})
-	}
-
-	// Add read locks for user records if reading
-	lockNeedsWithoutSubjectReadLocks := lockNeeds
-	if rq.Type == ReadRequest && rq.ReadLock {
-		for _, userId := range rq.Fields {
-			lockNeeds = append(lockNeeds, core.LockNeed{core.ReadLockType, userId})
+		if certifier = readUserRecordById(sv.store, rq.signers.CertifierId); certifier == nil {
+			return sv.failRequest(CertifierUnknownError)
 		}
 	}
 
-	// Get locks needed (if locking)
+	// Find user records for subjects
 	var userRecords []*userRecord
-	lockingSuccess := true
-	if len(lockNeeds) != 0 {
-		userRecords, lockingSuccess = lockUsers(sv, lockNeeds)
-	}
-
-	// Read records if without read locking if option is on
-	readSuccess := true
-	var unlockedUserRecords []*userRecord
-	if rq.Type == ReadRequest && !rq.ReadLock {
-		unlockedUserRecords, readSuccess = readUserRecordsByIds(sv.store, rq.Fields)
-		for _, record := range unlockedUserRecords {
-			userRecords = append(userRecords, record)
-		}
-	}
-
-	// Find user records for certifier, issuer, and subject
-	var issuerIndex, certifierIndex int = -1, -1
-	for userRecordIndex, userRecord := range userRecords {
-		if userRecord == nil {
-			continue
-		}
-
-		if rq.signers != nil && userRecord.Id == rq.signers.IssuerId {
-			issuerIndex = userRecordIndex
-		}
-		if rq.signers != nil && userRecord.Id == rq.signers.CertifierId {
-			certifierIndex = userRecordIndex
-		}
-	}
-
-	// If any failed (not found), end job with corresponding failure
-	if !lockingSuccess || !readSuccess {
-		if !rq.skipPermissions && issuerIndex == -1 {
-			return failRequest(IssuerUnknownError)
+	switch rq.Type {
+	case UpdateRequest:
+		if readUserRecordById(sv.store, rq.Data.Id) == nil {
+			return sv.failRequest(SubjectUnknownError)
 		}
-		if !rq.skipPermissions && certifierIndex == -1 {
-			return failRequest(CertifierUnknownError)
+	case ReadRequest:
+		var readSuccess bool
+		if userRecords, readSuccess = readUserRecordsByIds(sv.store, rq.Fields); !readSuccess {
+			return sv.failRequest(SubjectUnknownError)
 		}
-		return failRequest(SubjectUnknownError)
 	}
 
 	/*
 		Verify certifier permissions
 	*/
-	if !rq.skipPermissions {
-		certifier := userRecords[certifierIndex]
-		if !certifier.isAuthorized(rq) {
-			// Unlock first
-			_, isUnlocked := unlockUsers(sv, lockNeeds)
-			if !isUnlocked {
-				return failRequest(UnlockingFailedError)
-			}
-			// Then fail with certifier permissions error
-			return failRequest(CertifierPermissionsError)
-		}
+	if !rq.skipPermissions && !certifier.isAuthorized(rq) {
+		return sv.failRequest(CertifierPermissionsError)
 	}
 
 	/*
@@ -264,10 +276,11 @@ func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
 		searchRecordPtr := (&rq.Data).makeSearchByIdRecord()
 
 		// Atomically apply request to record in memstore
+		// (records are copied so that readers never see a partial update)
 		updateFunc := func(obj memstore.Item) (memstore.Item, bool) {
-			objCopy := obj.(*userRecord)
+			objCopy := *obj.(*userRecord)
 			objCopy.applyUpdateRequest(rq)
-			return objCopy, true
+			return &objCopy, true
 		}
 		var modifiedRecord *userRecord
 		if isIndexUpdated {
@@ -283,9 +296,7 @@ func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
 
 	case CreateRequest:
 		// Generate record
-		newUser := &userRecord{
-			lock: &sync.RWMutex{},
-		}
+		newUser := &userRecord{}
 		newUser.create(rq)
 
 		// Add to memstore
@@ -297,57 +308,20 @@ func (sv *server) Work(request *gofarm.Request) *gofarm.Response {
 		responseData = append(responseData, createdObject)
 
 	case ReadRequest:
-		// Extract indexes for users requested
-		usersRequestedIds := []int{}
-		for _, userId := range rq.Fields {
-			for userRecordIndex, userRecord := range userRecords {
-				if userRecord.Id == userId {
-					usersRequestedIds = append(usersRequestedIds, userRecordIndex)
-					break
-				}
-			}
-		}
-
 		// Transform records requested into objects and add to response
-		for _, userRecordIndex := range usersRequestedIds {
-			var createdObject *UserObject = nil
-			if userRecords[userRecordIndex] != nil {
-				createdObject = &UserObject{}
-				createdObject.createFromRecord(userRecords[userRecordIndex])
-			}
-			responseData = append(responseData, createdObject)
-		}
-	}
-
-	/*
-		Handle unlocking
-	*/
-
-	// Add lock needs if read unlocking without locking
-	if rq.Type == ReadRequest && !rq.ReadLock && rq.ReadUnlock {
-		for _, userId := range rq.Fields {
-			lockNeeds = append(lockNeeds, core.LockNeed{core.ReadLockType, userId})
-		}
-	}
-
-	// Use lock needs without subject locks if locking without unlocking
-	if rq.Type == ReadRequest && rq.ReadLock && !rq.ReadUnlock {
-		lockNeeds = lockNeedsWithoutSubjectReadLocks
-	}
-
-	// Do unlocking
-	if len(lockNeeds) != 0 {
-		if _, isUnlocked := unlockUsers(sv, lockNeeds); !isUnlocked {
-			return failRequest(UnlockingFailedError)
+		for _, userRecord := range userRecords {
+			readObject := &UserObject{}
+			readObject.createFromRecord(userRecord)
+			responseData = append(responseData, readObject)
 		}
 	}
 
 	// Request is done, return response generated
-	return successRequest(responseData)
+	return sv.successRequest(responseData)
 }
 
-func failRequest(responseCode int) *gofarm.Response {
-	log.Debugf(failRequestLogMsg)
+func (sv *Server) failRequest(responseCode int) *gofarm.Response {
+	sv.log.Debugf(failRequestLogMsg)
 	userRespPtr := &UserResponse{
 		Result: responseCode,
 		Data:   []UserObject{},
@@ -356,8 +330,8 @@ func failRequest(responseCode int) *gofarm.Response {
 	return &nativeResp
 }
 
-func successRequest(responseData []*UserObject) *gofarm.Response {
-	log.Debugf(successRequestLogMsg)
+func (sv *Server) successRequest(responseData []*UserObject) *gofarm.Response {
+	sv.log.Debugf(successRequestLogMsg)
 	var objectDataCopy []UserObject
 	for _, objectPtr := range responseData {
 		objectDataCopy = append(objectDataCopy, *objectPtr)
@@ -1,6 +1,7 @@
 package users
 
 import (
+	"context"
 	"github.com/mngharbi/DMPC/core"
 	"reflect"
 	"strings"
@@ -31,7 +32,7 @@ func TestMalformattedRequest(t *testing.T) {
 	}
 
 	requestBytes := []byte(`{invalid}`)
-	_, errs := MakeRequest(generateGenericSigners(), true, true, requestBytes)
+	_, errs := MakeRequest(context.Background(), generateGenericSigners(), requestBytes)
 	if len(errs) == 0 {
 		t.Error("Malformatted request should fail")
 	}
@@ -48,7 +49,7 @@ func TestEmptyReadRequest(t *testing.T) {
 		return
 	}
 
-	_, errs := makeUserReadRequest(true, true, "ISSUER", "CERTIFIER", []string{})
+	_, errs := makeUserReadRequest("ISSUER", "CERTIFIER", []string{})
 	if len(errs) == 0 {
 		t.Error("Read request with no users should fail")
 	}
@@ -61,7 +62,7 @@ func TestUnknownIssuerReadRequest(t *testing.T) {
 		return
 	}
 
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER"})
+	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER"})
 	if !success {
 		return
 	}
@@ -84,7 +85,7 @@ func TestUnknownCertifierReadRequest(t *testing.T) {
 	}
 
 	// Make read request
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER"})
+	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER"})
 	if !success {
 		return
 	}
@@ -110,7 +111,7 @@ func TestUnknownSubjectReadRequest(t *testing.T) {
 	}
 
 	// Make read request
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER"})
+	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER"})
 	if !success {
 		return
 	}
@@ -144,7 +145,7 @@ func TestUnknownMultipleSubjectsReadRequest(t *testing.T) {
 	}
 
 	// Make read request for 2 users, one inexistent
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
+	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
 	if !success {
 		return
 	}
@@ -162,68 +163,7 @@ func TestUnknownMultipleSubjectsReadRequest(t *testing.T) {
 	}
 
 	// Make read request for 2 users, both existent
-	serverResponsePtr, ok, success = makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
-	if !success {
-		return
-	}
-	if !ok || serverResponsePtr.Result != Success {
-		t.Errorf("Read request no inexistent subjects should not fail, result:%v", *serverResponsePtr)
-		return
-	}
-
-	ShutdownServer()
-}
-
-func TestUnknownMultipleSubjectsReadRequestWithLocking(t *testing.T) {
-	if !resetAndStartServer(t, multipleWorkersConfig()) {
-		return
-	}
-
-	// Create issuer and certifier
-	if !createIssuerAndCertifier(t,
-		false, false, true, true, false, false, false, false,
-		false, false, true, true, false, false, false, false,
-	) {
-		return
-	}
-
-	// Create user
-	_, success := createUser(
-		t, false, "ISSUER", "CERTIFIER", "USER", false, false, false, false, false, false, false, false,
-	)
-	if !success {
-		return
-	}
-
-	// Make read lock request for 2 users, one inexistent
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, false, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
-	if !success {
-		return
-	}
-	if !ok || serverResponsePtr.Result != SubjectUnknownError {
-		t.Errorf("Read request with one inexistent subject of many should fail, result:%v", *serverResponsePtr)
-		return
-	}
-
-	// Create another user
-	_, success = createUser(
-		t, false, "ISSUER", "CERTIFIER", "USER_2", false, false, false, false, false, false, false, false,
-	)
-	if !success {
-		return
-	}
-
-	// Make lock read request for 2 users, both existent
-	serverResponsePtr, ok, success = makeAndGetUserReadRequest(t, true, false, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
-	if !success {
-		return
-	}
-	if !ok || serverResponsePtr.Result != Success {
-		t.Errorf("Read request no inexistent subjects should not fail, result:%v", *serverResponsePtr)
-		return
-	}
-	// Make unlock read request for 2 users, both existent
-	serverResponsePtr, ok, success = makeAndGetUserReadRequest(t, false, true, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
+	serverResponsePtr, ok, success = makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER", "USER_2"})
 	if !success {
 		return
 	}
@@ -257,7 +197,7 @@ func TestExistentUserReadRequestNoReadPerms(t *testing.T) {
 	}
 
 	// Make read request
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER"})
+	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER"})
 	if !success {
 		return
 	}
@@ -291,7 +231,7 @@ func TestExistentUserReadRequest(t *testing.T) {
 	}
 
 	// Make read request
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, true, "ISSUER", "CERTIFIER", []string{"USER"})
+	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{"USER"})
 	if !success {
 		return
 	}
@@ -307,62 +247,60 @@ func TestExistentUserReadRequest(t *testing.T) {
 	ShutdownServer()
 }
 
-func TestExistentUserReadRequestWithSingleLockOperation(t *testing.T) {
+func TestExistentUserReadRequestReleasesLocks(t *testing.T) {
 	if !resetAndStartServer(t, multipleWorkersConfig()) {
 		return
 	}
 
 	// Create issuer and certifier
 	if !createIssuerAndCertifier(t,
-		false, false, true, true, false, false, false, false,
-		false, false, true, true, false, false, false, false,
+		true, true, true, true, true, true, true, true,
+		true, true, true, true, true, true, true, true,
 	) {
 		return
 	}
 
 	// Create user
+	userid := "USER"
 	userObjectPtr, success := createUser(
-		t, false, "ISSUER", "CERTIFIER", "USER", false, false, false, false, false, false, false, false,
+		t, false, "ISSUER", "CERTIFIER", userid, false, false, false, false, false, false, false, false,
 	)
 	if !success {
 		return
 	}
 
-	// Make read request with read lock only
-	serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, true, false, "ISSUER", "CERTIFIER", []string{"USER"})
-	if !success {
-		return
-	}
-	if !ok || serverResponsePtr.Result != Success {
-		t.Errorf("Read request of existing user with only read lock should succeed, result:%v", *serverResponsePtr)
-		return
-	}
-	if len(serverResponsePtr.Data) != 1 || !reflect.DeepEqual(*userObjectPtr, serverResponsePtr.Data[0]) {
-		t.Errorf("Read request response doesn't match user expected.\nexpected=%v\nresult=%v", *userObjectPtr, serverResponsePtr.Data[0])
-		return
+	// Make two read requests
+	for i := 0; i < 2; i++ {
+		serverResponsePtr, ok, success := makeAndGetUserReadRequest(t, "ISSUER", "CERTIFIER", []string{userid})
+		if !success {
+			return
+		}
+		if !ok || serverResponsePtr.Result != Success {
+			t.Errorf("Read request of existing user should succeed, result:%v", *serverResponsePtr)
+			return
+		}
+		if len(serverResponsePtr.Data) != 1 || !reflect.DeepEqual(*userObjectPtr, serverResponsePtr.Data[0]) {
+			t.Errorf("Read request response doesn't match user expected.\nexpected=%v\nresult=%v", *userObjectPtr, serverResponsePtr.Data[0])
+			return
+		}
 	}
 
-	// Make read request with read unlock only
-	serverResponsePtr, ok, success = makeAndGetUserReadRequest(t, false, true, "ISSUER", "CERTIFIER", []string{"USER"})
+	// Update of the user should succeed after reads
+	active := false
+	serverResponsePtr, ok, success := makeAndGetUserUpdateRequest(
+		t, "ISSUER", "CERTIFIER", []string{"active"}, getJanuaryDate(1), &userid, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &active, nil, nil, nil,
+	)
 	if !success {
 		return
 	}
 	if !ok || serverResponsePtr.Result != Success {
-		t.Errorf("Read request of existing user with only read unlock should succeed, result:%v", *serverResponsePtr)
-		return
-	}
-	if len(serverResponsePtr.Data) != 1 || !reflect.DeepEqual(*userObjectPtr, serverResponsePtr.Data[0]) {
-		t.Errorf("Read request response doesn't match user expected.\nexpected=%v\nresult=%v", *userObjectPtr, serverResponsePtr.Data[0])
+		t.Errorf("Update request after reads should succeed, result:%v", *serverResponsePtr)
 		return
 	}
 
 	ShutdownServer()
 }
 
-/*
-	Create requests
-*/
-
 func TestUnknownIssuerCreateRequest(t *testing.T) {
 	if !resetAndStartServer(t, multipleWorkersConfig()) {
 		return
@@ -6,6 +6,7 @@ package users
 
 import (
 	"bytes"
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
@@ -78,7 +79,7 @@ func singleWorkerConfig() Config {
 }
 
 func resetAndStartServer(t *testing.T, conf Config) bool {
-	serverSingleton = server{}
+	defaultServer = NewServer(core.Metrics)
 	err := StartServer(conf, log, shutdownProgram)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -207,12 +208,12 @@ func makeUserCreationRequest(
 		userPermissionsUpdatePermission,
 	)
 
-	// Make a request to the server (always read lock/unlock)
+	// Make a request to the server
 	requestFunc := MakeRequest
 	if skipVerification {
 		requestFunc = MakeUnverifiedRequest
 	}
-	channel, errs := requestFunc(generateSigners(issuerId, certifierId), true, true, requestBytes)
+	channel, errs := requestFunc(context.Background(), generateSigners(issuerId, certifierId), requestBytes)
 	return channel, userObjectPtr, errs
 }
 
@@ -528,7 +529,7 @@ func makeUserUpdateRequest(
 		userEncKeyUpdatePermissionPtr, userSignKeyUpdatePermissionPtr, userPermissionsUpdatePtr,
 		activePtr, createdAtPtr, disabledAtPtr, updatedAtPtr,
 	)
-	return MakeRequest(generateSigners(issuerId, certifierId), true, true, requestBytes)
+	return MakeRequest(context.Background(), generateSigners(issuerId, certifierId), requestBytes)
 }
 
 func makeAndGetUserUpdateRequest(
@@ -584,13 +585,13 @@ func generateUserReadRequest(users []string) (request []byte) {
 	}`)
 }
 
-func makeUserReadRequest(readLock bool, readUnlock bool, issuerId string, certifierId string, users []string) (chan *UserResponse, []error) {
+func makeUserReadRequest(issuerId string, certifierId string, users []string) (chan *UserResponse, []error) {
 	requestBytes := generateUserReadRequest(users)
-	return MakeRequest(generateSigners(issuerId, certifierId), readLock, readUnlock, requestBytes)
+	return MakeRequest(context.Background(), generateSigners(issuerId, certifierId), requestBytes)
 }
 
-func makeAndGetUserReadRequest(t *testing.T, readLock bool, readUnlock bool, issuerId string, certifierId string, users []string) (*UserResponse, bool, bool) {
-	channel, errs := makeUserReadRequest(readLock, readUnlock, issuerId, certifierId, users)
+func makeAndGetUserReadRequest(t *testing.T, issuerId string, certifierId string, users []string) (*UserResponse, bool, bool) {
+	channel, errs := makeUserReadRequest(issuerId, certifierId, users)
 	if len(errs) > 0 {
 		t.Errorf("Valid read request should go through\n. errs=%v", errs)
 		return nil, false, false
@@ -0,0 +1,17 @@
+package users
+
+/*
+	Request type labels of request metrics
+*/
+var requestTypeLabels map[int]string = map[int]string{
+	CreateRequest: "create",
+	UpdateRequest: "update",
+	ReadRequest:   "read",
+}
+
+func requestTypeLabel(requestType int) string {
+	if label, ok := requestTypeLabels[requestType]; ok {
+		return label
+	}
+	return "unknown"
+}
@@ -3,7 +3,6 @@ package users
 import (
 	"crypto/rsa"
 	"encoding/json"
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"time"
 )
@@ -72,10 +71,6 @@ type UserRequest struct {
 	Timestamp time.Time  `json:"timestamp"`
 	signers   *core.VerifiedSigners
 
-	// Controls locking within request
-	ReadLock   bool
-	ReadUnlock bool
-
 	// Private settings
 	skipPermissions bool
 }
@@ -98,6 +93,21 @@ type UserResponse struct {
 	Data []UserObject `json:"data"`
 }
 
+/*
+	Errors corresponding to failed response results
+*/
+var resultErrors map[int]error = map[int]error{
+	IssuerUnknownError:        core.NewError(core.IssuerUnknownErrorCode, "Issuer is unknown."),
+	CertifierUnknownError:     core.NewError(core.CertifierUnknownErrorCode, "Certifier is unknown."),
+	SubjectUnknownError:       core.NewError(core.SubjectUnknownErrorCode, "At least one subject user is unknown."),
+	CertifierPermissionsError: core.NewError(core.CertifierPermissionsErrorCode, "Certifier lacks the required user permissions."),
+	UnlockingFailedError:      core.NewError(core.RequestFailedErrorCode, "Unlocking user records failed."),
+}
+
+func (resp *UserResponse) GetError() error {
+	return resultErrors[resp.Result]
+}
+
 /*
 	User request creation/checking
 */
@@ -117,16 +127,16 @@ func (rq *UserRequest) sanitizeAndCheckParams() []error {
 
 	// Verify type, issuer, and certifier
 	if !(CreateRequest <= rq.Type && rq.Type <= ReadRequest) {
-		res = append(res, errors.New(unknownRequestTypeErrorMsg))
+		res = append(res, core.NewError(core.InvalidRequestTypeErrorCode, unknownRequestTypeErrorMsg))
 	}
 
 	if !rq.skipPermissions {
 		if rq.signers == nil {
-			res = append(res, errors.New(signersMissingErrorMsg))
+			res = append(res, core.NewError(core.UnverifiedRequestErrorCode, signersMissingErrorMsg))
 		} else if len(rq.signers.IssuerId) == 0 {
-			res = append(res, errors.New(issuerIdMissingErrorMsg))
+			res = append(res, core.NewError(core.InvalidRequestErrorCode, issuerIdMissingErrorMsg))
 		} else if len(rq.signers.CertifierId) == 0 {
-			res = append(res, errors.New(certifierIdMissingErrorMsg))
+			res = append(res, core.NewError(core.InvalidRequestErrorCode, certifierIdMissingErrorMsg))
 		}
 	}
 
@@ -172,7 +182,7 @@ func (rq *UserRequest) sanitizeAndCheckParams() []error {
 		}
 
 		if len(rq.Fields) == 0 {
-			res = append(res, errors.New(noFieldsUpdatedErrorMsg))
+			res = append(res, core.NewError(core.InvalidRequestErrorCode, noFieldsUpdatedErrorMsg))
 		}
 
 	/*
@@ -181,7 +191,7 @@ func (rq *UserRequest) sanitizeAndCheckParams() []error {
 	*/
 	case ReadRequest:
 		if len(rq.Fields) == 0 {
-			res = append(res, errors.New(noSubjectsErrorMsg))
+			res = append(res, core.NewError(core.InvalidRequestErrorCode, noSubjectsErrorMsg))
 		}
 	}
 
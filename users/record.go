@@ -2,7 +2,6 @@ package users
 
 import (
 	"crypto/rsa"
-	"sync"
 	"time"
 )
 
@@ -49,7 +48,6 @@ type userRecord struct {
 	Active      booleanRecord
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
-	lock        *sync.RWMutex
 }
 
 func (rec *userRecord) Less(index string, than interface{}) bool {
@@ -61,7 +59,7 @@ func (rec *userRecord) Less(index string, than interface{}) bool {
 }
 
 /*
-	Record update (run in a mutex context)
+	Record update (applied to a copy of the stored record)
 */
 func (record *userRecord) applyUpdateRequest(req *UserRequest) {
 	for _, field := range req.Fields {
@@ -238,27 +236,3 @@ func (record *userRecord) isAuthorized(req *UserRequest) bool {
 
 	return result
 }
-
-/*
-	Record locking
-*/
-
-// Read lock
-func (record *userRecord) RLock() {
-	record.lock.RLock()
-}
-
-// Read unlock
-func (record *userRecord) RUnlock() {
-	record.lock.RUnlock()
-}
-
-// Write lock
-func (record *userRecord) Lock() {
-	record.lock.Lock()
-}
-
-// Write unlock
-func (record *userRecord) Unlock() {
-	record.lock.Unlock()
-}
@@ -10,6 +10,14 @@ import (
 	"testing"
 )
 
+/*
+	Logging and shutdown passed to servers started in tests
+*/
+var (
+	log             *core.LoggingHandler
+	shutdownProgram core.ShutdownLambda
+)
+
 func TestMain(m *testing.M) {
 	log = core.InitializeLogging()
 	log.SetLogLevel(core.WARN)
@@ -5,8 +5,8 @@
 package users
 
 import (
+	"context"
 	"crypto/rsa"
-	"errors"
 	"github.com/mngharbi/DMPC/core"
 	"github.com/mngharbi/memstore"
 	"time"
@@ -23,6 +23,29 @@ func GenerateCreateRequest(userObject *UserObject, timestamp time.Time) *UserReq
 	}
 }
 
+/*
+	Make update record (only fields listed are updated)
+*/
+func GenerateUpdateRequest(userObject *UserObject, fields []string, timestamp time.Time) *UserRequest {
+	return &UserRequest{
+		Type:      UpdateRequest,
+		Fields:    fields,
+		Data:      *userObject,
+		Timestamp: timestamp,
+	}
+}
+
+/*
+	Make read record
+*/
+func GenerateReadRequest(userIds []string, timestamp time.Time) *UserRequest {
+	return &UserRequest{
+		Type:      ReadRequest,
+		Fields:    userIds,
+		Timestamp: timestamp,
+	}
+}
+
 /*
 	Generic function to read multiple users' attribute
 */
@@ -31,26 +54,24 @@ const (
 	genericUserNotFoundErrorMsg   string = "Unable to find at least one of the users"
 )
 
-func getGenericUserAttributeByIds(ids []string, handleAttribute func(*UserObject)) error {
+func (sv *Server) getGenericUserAttributeByIds(ids []string, handleAttribute func(*UserObject)) error {
 	// Make unverified request for user
 	rq := &UserRequest{
-		Type:       ReadRequest,
-		Fields:     ids,
-		ReadLock:   true,
-		ReadUnlock: true,
+		Type:   ReadRequest,
+		Fields: ids,
 	}
 	rq.skipPermissions = true
-	channel, errs := makeRequest(rq)
+	channel, errs := sv.makeRequest(context.Background(), rq)
 	if len(errs) != 0 {
-		return errors.New(genericRequestFailureErrorMsg)
+		return core.NewError(core.RequestFailedErrorCode, genericRequestFailureErrorMsg)
 	}
 
 	// Wait for response
 	resp := <-channel
 	if resp == nil || resp.Result != Success {
-		return errors.New(genericRequestFailureErrorMsg)
+		return core.NewError(core.RequestFailedErrorCode, genericRequestFailureErrorMsg)
 	} else if resp.Data == nil || len(resp.Data) != len(ids) {
-		return errors.New(genericUserNotFoundErrorMsg)
+		return core.NewError(core.SubjectUnknownErrorCode, genericUserNotFoundErrorMsg)
 	} else {
 		for _, userObject := range resp.Data {
 			handleAttribute(&userObject)
@@ -63,11 +84,15 @@ func getGenericUserAttributeByIds(ids []string, handleAttribute func(*UserObject
 	Gets signing keys by user ids
 */
 func GetSigningKeysById(ids []string) ([]*rsa.PublicKey, error) {
+	return defaultServer.GetSigningKeysById(ids)
+}
+
+func (sv *Server) GetSigningKeysById(ids []string) ([]*rsa.PublicKey, error) {
 	var keys []*rsa.PublicKey
 	handleSingingKeyLambda := func(obj *UserObject) {
 		keys = append(keys, obj.signKeyObject)
 	}
-	if err := getGenericUserAttributeByIds(ids, handleSingingKeyLambda); err != nil {
+	if err := sv.getGenericUserAttributeByIds(ids, handleSingingKeyLambda); err != nil {
 		return nil, err
 	}
 	return keys, nil
@@ -77,11 +102,15 @@ func GetSigningKeysById(ids []string) ([]*rsa.PublicKey, error) {
 	Gets global channel permissions by user ids
 */
 func GetChannelPermissionsByIds(ids []string) ([]*ChannelPermissionsObject, error) {
+	return defaultServer.GetChannelPermissionsByIds(ids)
+}
+
+func (sv *Server) GetChannelPermissionsByIds(ids []string) ([]*ChannelPermissionsObject, error) {
 	var permissions []*ChannelPermissionsObject
 	handlePermissionsLambda := func(obj *UserObject) {
 		permissions = append(permissions, &obj.Permissions.Channel)
 	}
-	if err := getGenericUserAttributeByIds(ids, handlePermissionsLambda); err != nil {
+	if err := sv.getGenericUserAttributeByIds(ids, handlePermissionsLambda); err != nil {
 		return nil, err
 	}
 	return permissions, nil
@@ -90,17 +119,23 @@ func GetChannelPermissionsByIds(ids []string) ([]*ChannelPermissionsObject, erro
 /*
 	Read records from store
 */
+func readUserRecordById(store *memstore.Memstore, id string) *userRecord {
+	itemResult := store.Get(makeSearchByIdRecord(id), idIndexStr)
+	if itemResult == nil {
+		return nil
+	}
+	return itemResult.(*userRecord)
+}
+
 func readUserRecordsByIds(store *memstore.Memstore, ids []string) ([]*userRecord, bool) {
 	result := []*userRecord{}
 
 	for _, id := range ids {
-		searchRecord := makeSearchByIdRecord(id)
-		itemResult := store.Get(searchRecord, idIndexStr)
-		if itemResult != nil {
-			result = append(result, itemResult.(*userRecord))
-		} else {
+		record := readUserRecordById(store, id)
+		if record == nil {
 			return nil, false
 		}
+		result = append(result, record)
 	}
 
 	return result, true
@@ -89,14 +89,14 @@ func TestReadUserRecordsByIds(t *testing.T) {
 	defer ShutdownServer()
 
 	// Make sure we fail if any user id fails
-	userRecords, success := readUserRecordsByIds(serverSingleton.store, []string{"USER_0", "USER_1", "USER_2", "NOT_USER_ID"})
+	userRecords, success := readUserRecordsByIds(defaultServer.store, []string{"USER_0", "USER_1", "USER_2", "NOT_USER_ID"})
 	if success || userRecords != nil {
 		t.Errorf("Reading user records should fail. userRecords=%+v", userRecords)
 		return
 	}
 
 	// Make sure we attempt to read all user ids
-	userRecords, success = readUserRecordsByIds(serverSingleton.store, []string{"USER_0", "USER_1", "USER_2"})
+	userRecords, success = readUserRecordsByIds(defaultServer.store, []string{"USER_0", "USER_1", "USER_2"})
 	if !success || len(userRecords) != 3 {
 		t.Errorf("Reading user records failed. userRecords=%+v", userRecords)
 		return